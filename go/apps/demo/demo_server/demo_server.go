@@ -57,6 +57,9 @@ func doResponse(conn net.Conn, responseOk chan<- bool) {
 	// Both the TLS and the Tao/TLS connections and listeners handle
 	// authorization during the Accept operation. So, no extra authorization is
 	// needed here.
+	if tc, ok := conn.(*tao.Conn); ok {
+		fmt.Printf("server: connection from %s\n", tc.PeerPrincipal())
+	}
 	msg, err := bufio.NewReader(conn).ReadString('\n')
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "server: can't read: %s\n", err)
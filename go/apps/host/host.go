@@ -28,6 +28,7 @@ import (
 	"os/exec"
 	"os/signal"
 	"path"
+	"strings"
 	"syscall"
 	"text/tabwriter"
 
@@ -50,8 +51,15 @@ var opts = []options.Option{
 	{"stacked", false, "", "Create a stacked host, backed by a parent Tao", "init,start"},
 	// TODO(kwalsh) hosted program type should be selectable at time of
 	// tao_launch. A single host should be able to host all types concurrently.
-	{"hosting", "", "<type>", "Hosted program type: process, docker, kvm_coreos or kvm_custom", "init"},
+	{"hosting", "", "<type>", "Hosted program type: process, docker, kvm_coreos, kvm_custom or oci", "init"},
 	{"socket_dir", "", "<dir>", "Hosted program socket directory, relative to host directory or absolute", "init"},
+	{"log_dir", "", "<dir>", "Hosted program output log directory, relative to host directory or absolute", "init"},
+	{"log_buffer_size", 0, "SIZE", "Bytes of recent output to keep in memory for each hosted program", "init"},
+	{"log_max_file_size", 0, "SIZE", "Bytes at which to rotate hosted program output logs", "init"},
+	{"log_max_files", 0, "N", "Number of rotated output logs to keep for each hosted program", "init"},
+	{"guarded_tao_methods", "", "<method,...>", "Tao RPC methods, e.g. Attest, that hosted programs may call only if authorized for Tao<method>, or * for all", "init"},
+	{"remote_admin_uid", 0, "<uid>", "Unprivileged uid that hosted programs started by remote admin callers run as", "init"},
+	{"remote_admin_gid", 0, "<gid>", "Unprivileged gid that hosted programs started by remote admin callers run as", "init"},
 
 	// Flags for start command
 	{"foreground", false, "", "Run in the foreground", "start"},
@@ -59,13 +67,16 @@ var opts = []options.Option{
 	//    sh$ setsid tao host start ... </dev/null >/dev/null 2>&1
 	//    sh$ setsid linux_host start ... </dev/null >/dev/null 2>&1
 	{"daemon", false, "", "Detach from tty, close stdio, and run as a daemon", "start"},
+	{"remote_admin", "", "<host:port>", "Also accept admin requests from remote Tao principals at this address", "start"},
+	{"tao_listen", "", "<host:port>", "Also serve Tao requests from remote hosted programs over TLS at this address", "start"},
 
 	// Flags for root
 	{"pass", "", "<password>", "Host password for root hosts (for testing only!)", "root"},
 
 	// Flags for stacked
-	{"parent_type", "", "<type>", "Type of channel to parent Tao: TPM, TPM2, pipe, file, or unix", "stacked"},
+	{"parent_type", "", "<type>", "Type of channel to parent Tao: TPM, TPM2, pipe, file, unix, or tls", "stacked"},
 	{"parent_spec", "", "<spec>", "Spec for channel to parent Tao", "stacked"},
+	{"parent_keys", "", "<dir>", "Attested key for tls channel to parent Tao, relative to host directory or absolute", "stacked"},
 
 	// Flags for QEMU/KVM CoreOS init
 	{"kvm_coreos_img", "", "<path>", "Path to CoreOS.img file, relative to domain or absolute", "kvm"},
@@ -76,6 +87,9 @@ var opts = []options.Option{
 
 	// Flags for QEMU/KVM init with custom kernel and initram
 	{"kvm_custom_vm_memory", 1024, "SIZE", "The amount of RAM (in KB) to give VM", "kvm_custom"},
+	{"kvm_custom_machine", "", "<type>", "QEMU machine type for VM, e.g. q35", "kvm_custom"},
+	{"kvm_custom_cpu", "", "<model>", "QEMU cpu model for VM, e.g. host", "kvm_custom"},
+	{"kvm_custom_smp", 0, "N", "Number of cpus to give VM", "kvm_custom"},
 }
 
 func init() {
@@ -208,6 +222,9 @@ func configureFromOptions(cfg *tao.LinuxHostConfig) {
 	if s := *options.String["parent_spec"]; s != "" {
 		cfg.ParentSpec = proto.String(s)
 	}
+	if s := *options.String["parent_keys"]; s != "" {
+		cfg.ParentKeys = proto.String(s)
+	}
 	if s := *options.String["socket_dir"]; s != "" {
 		cfg.SocketDir = proto.String(s)
 	}
@@ -223,6 +240,49 @@ func configureFromOptions(cfg *tao.LinuxHostConfig) {
 	if i := *options.Int["kvm_custom_vm_memory"]; i != 0 {
 		cfg.KvmCustomVmMemory = proto.Int32(int32(i))
 	}
+	if s := *options.String["kvm_custom_machine"]; s != "" {
+		cfg.KvmCustomMachine = proto.String(s)
+	}
+	if s := *options.String["kvm_custom_cpu"]; s != "" {
+		cfg.KvmCustomCpu = proto.String(s)
+	}
+	if i := *options.Int["kvm_custom_smp"]; i != 0 {
+		cfg.KvmCustomSmp = proto.Int32(int32(i))
+	}
+	if s := *options.String["guarded_tao_methods"]; s != "" {
+		cfg.GuardedTaoMethod = strings.Split(s, ",")
+	}
+	if s := *options.String["log_dir"]; s != "" {
+		cfg.LogDir = proto.String(s)
+	}
+	if i := *options.Int["log_buffer_size"]; i != 0 {
+		cfg.LogBufferSize = proto.Int32(int32(i))
+	}
+	if i := *options.Int["log_max_file_size"]; i != 0 {
+		cfg.LogMaxFileSize = proto.Int64(int64(i))
+	}
+	if i := *options.Int["log_max_files"]; i != 0 {
+		cfg.LogMaxFiles = proto.Int32(int32(i))
+	}
+	if i := *options.Int["remote_admin_uid"]; i != 0 {
+		cfg.RemoteAdminUid = proto.Int32(int32(i))
+	}
+	if i := *options.Int["remote_admin_gid"]; i != 0 {
+		cfg.RemoteAdminGid = proto.Int32(int32(i))
+	}
+}
+
+func logConfig(cfg *tao.LinuxHostConfig) tao.HostedProgramLogConfig {
+	logDir := cfg.GetLogDir()
+	if logDir != "" && !path.IsAbs(logDir) {
+		logDir = path.Join(hostPath(), logDir)
+	}
+	return tao.HostedProgramLogConfig{
+		BufferSize:  int(cfg.GetLogBufferSize()),
+		Dir:         logDir,
+		MaxFileSize: cfg.GetLogMaxFileSize(),
+		MaxFiles:    int(cfg.GetLogMaxFiles()),
+	}
 }
 
 func configureFromFile() *tao.LinuxHostConfig {
@@ -262,13 +322,15 @@ func loadHost(domain *tao.Domain, cfg *tao.LinuxHostConfig) (*tao.LinuxHost, err
 		tc.HostedType = tao.KVMCoreOSFile
 	case "kvm_custom":
 		tc.HostedType = tao.KVMCustom
+	case "oci":
+		tc.HostedType = tao.OCIBundle
 	case "":
 		options.Usage("Must supply -hosting flag")
 	default:
 		options.Usage("Invalid hosting type: %s", cfg.GetHosting())
 	}
 
-	// For stacked hosts, figure out the channel type: TPM, TPM2, pipe, file, or unix
+	// For stacked hosts, figure out the channel type: TPM, TPM2, pipe, file, unix, or tls
 	if tc.HostType == tao.Stacked {
 		switch cfg.GetParentType() {
 		case "TPM":
@@ -281,6 +343,8 @@ func loadHost(domain *tao.Domain, cfg *tao.LinuxHostConfig) (*tao.LinuxHost, err
 			tc.HostChannelType = "file"
 		case "unix":
 			tc.HostChannelType = "unix"
+		case "tls":
+			tc.HostChannelType = "tls"
 		case "":
 			options.Usage("Must supply -parent_type for stacked hosts")
 		default:
@@ -312,6 +376,20 @@ func loadHost(domain *tao.Domain, cfg *tao.LinuxHostConfig) (*tao.LinuxHost, err
 			tc.TPM2PCRs = domain.Config.Tpm2Info.GetTpm2Pcrs()
 			tc.TPM2Device = domain.Config.Tpm2Info.GetTpm2Device()
 		}
+
+		// For stacked hosts over TLS, we also need an attested key, and the
+		// domain guard checks the parent.
+		if tc.HostChannelType == "tls" {
+			keysPath := cfg.GetParentKeys()
+			if keysPath == "" {
+				options.Usage("Must supply -parent_keys for tls stacked hosts")
+			}
+			if !path.IsAbs(keysPath) {
+				keysPath = path.Join(hostPath(), keysPath)
+			}
+			tc.TLSKeysPath = keysPath
+			tc.DomainConfigPath = domainConfigPath()
+		}
 	}
 
 	rulesPath := ""
@@ -378,8 +456,13 @@ func loadHost(domain *tao.Domain, cfg *tao.LinuxHostConfig) (*tao.LinuxHost, err
 		cfg := &tao.VmConfig{
 			Memory:     int(vmMemory),
 			SocketPath: socketPath,
+			Machine:    cfg.GetKvmCustomMachine(),
+			CPU:        cfg.GetKvmCustomCpu(),
+			SMP:        int(cfg.GetKvmCustomSmp()),
 		}
 		childFactory = tao.NewLinuxKVMCustomFactory(cfg)
+	case tao.OCIBundle:
+		childFactory = tao.NewLinuxOCIFactory()
 	}
 
 	if tc.HostType == tao.Root {
@@ -521,6 +604,23 @@ func startHost(domain *tao.Domain) {
 	configureFromOptions(cfg)
 	host, err := loadHost(domain, cfg)
 	options.FailIf(err, "Can't create host")
+	host.LogConfig = logConfig(cfg)
+	host.TaoRPCConfig = tao.TaoRPCConfig{
+		Limits:         cfg.GetTaoRpcLimit(),
+		GuardedMethods: cfg.GetGuardedTaoMethod(),
+	}
+	host.RemoteAdminConfig = tao.RemoteAdminConfig{
+		Uid: int(cfg.GetRemoteAdminUid()),
+		Gid: int(cfg.GetRemoteAdminGid()),
+	}
+	if dir := host.LogConfig.Dir; dir != "" {
+		err = os.MkdirAll(dir, 0700)
+		options.FailIf(err, "Can't create log directory")
+	}
+	// Resume serving any hosted programs left running by an earlier instance.
+	if err = host.AdoptHostedPrograms(); err != nil {
+		fmt.Fprintf(noise, "Couldn't re-adopt hosted programs: %s\n", err)
+	}
 
 	sockPath := path.Join(hostPath(), "admin_socket")
 	// Set the socketPath directory go+rx so tao_launch can access sockPath and
@@ -538,9 +638,33 @@ func startHost(domain *tao.Domain) {
 		options.Fail(err, "Can't change permissions on admin socket")
 	}
 
+	server := tao.NewLinuxHostAdminServer(host)
+	if addr := *options.String["remote_admin"]; addr != "" {
+		l, err := host.ListenRemoteAdmin("tcp", addr, domain.Guard, domain.Keys.VerifyingKey)
+		options.FailIf(err, "Can't listen for remote admin requests")
+		defer l.Close()
+		go func() {
+			err := server.ServeRemote(l)
+			if err != nil {
+				fmt.Fprintf(noise, "Stopped serving remote admin requests: %s\n", err)
+			}
+		}()
+	}
+	if addr := *options.String["tao_listen"]; addr != "" {
+		l, err := host.ListenTao("tcp", addr, domain.Guard, domain.Keys.VerifyingKey)
+		options.FailIf(err, "Can't listen for remote hosted programs")
+		defer l.Close()
+		go func() {
+			err := host.ServeTao(l)
+			if err != nil {
+				fmt.Fprintf(noise, "Stopped serving remote hosted programs: %s\n", err)
+			}
+		}()
+	}
+
 	go func() {
 		fmt.Fprintf(noise, "Linux Tao Service (%s) started and waiting for requests\n", host.HostName())
-		err = tao.NewLinuxHostAdminServer(host).Serve(sock)
+		err = server.Serve(sock)
 		fmt.Fprintf(noise, "Linux Tao Service finished\n")
 		sock.Close()
 		options.FailIf(err, "Error serving admin requests")
@@ -70,12 +70,14 @@ func (l *mixnetListener) Accept() (net.Conn, error) {
 			return nil, err
 		}
 
-		if err := tao.AddEndorsements(l.guard, &a, l.verifier); err != nil {
+		guard, _, err := tao.EndorsedGuard(l.guard, &a, l.verifier)
+		if err != nil {
+			c.Close()
 			return nil, err
 		}
 
 		peerCert := c.(*tls.Conn).ConnectionState().PeerCertificates[0]
-		if err := tao.ValidatePeerAttestation(&a, peerCert, l.guard); err != nil {
+		if err := tao.ValidatePeerAttestation(&a, peerCert, guard); err != nil {
 			c.Close()
 			return nil, err
 		}
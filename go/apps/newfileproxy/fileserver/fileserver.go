@@ -84,10 +84,11 @@ func server(serverAddr string, serverData *common.ServerData, serverProgramData
 		return
 	}
 	conf := &tls.Config{
-		RootCAs:            pool,
-		Certificates:       []tls.Certificate{*tlsc},
-		InsecureSkipVerify: false,
-		ClientAuth:         tls.RequireAnyClientCert,
+		RootCAs:               pool,
+		Certificates:          []tls.Certificate{*tlsc},
+		InsecureSkipVerify:    false,
+		ClientAuth:            tls.RequireAnyClientCert,
+		VerifyPeerCertificate: serverProgramData.VerifyPeerCertificate,
 	}
 
 	// Listen for clients.
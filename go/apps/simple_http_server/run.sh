@@ -65,8 +65,13 @@ sudo -E $BINPATH/tao host start -tao_domain $DOMAIN -host linux_tao_host -pass $
 sleep 3
 
 # Start the http server
-$BINPATH/tao run -tao_domain $DOMAIN \
+$BINPATH/tao run -tao_domain $DOMAIN -disown \
   $DOMAIN/http_server -domain_config $DOMAIN/tao.config -path $DOMAIN/simpleserver
+sleep 3
+
+# Fetch the secret over a Tao connection
+$BINPATH/tao run -tao_domain $DOMAIN \
+  $DOMAIN/http_server -client -domain_config $DOMAIN/tao.config
 
 # clean up..
 # sudo rm -f $DOMAIN/linux_tao_host/admin_socket
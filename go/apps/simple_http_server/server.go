@@ -15,6 +15,9 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/hex"
 	"flag"
 	"fmt"
@@ -37,12 +40,12 @@ var (
 	secretName = flag.String("secret", "secret", "file name of the secret")
 	serverHost = flag.String("host", "localhost", "address for client/server")
 	serverPort = flag.String("port", "8123", "port for client/server")
+	client     = flag.Bool("client", false, "fetch the secret from the server instead of serving it")
 )
 
-// Basic Tao Server. For this example, we assume all connections are *not*
-// Tao connections (i.e., not TLS), so we don't have any certs or secret key
-// To adapt this code to use TLS with certs and keys, look at how taosupport.go
-// and simpleserver.go in simpleexample does this.
+// Basic Tao Server. It serves HTTP over Tao connections, so each client must
+// present a key attested by a program the domain allows to run, and the
+// domain guard must authorize the client to perform each request.
 type TaoServer struct {
 	// Program name.
 	TaoName string
@@ -53,11 +56,19 @@ type TaoServer struct {
 	// Path for program to read and write files.
 	ProgramFilePath *string
 
+	// The domain the server runs in.
+	Domain *tao.Domain
+
+	// Keys for the Tao connections, attested by the host.
+	Keys *tao.Keys
+
 	// HTTP listener
 	listener net.Listener
 }
 
-func NewTaoServer() *TaoServer {
+// newTaoKeys loads the domain and extends this program's Tao name with the
+// policy key, then creates keys attested by the host for Tao connections.
+func newTaoKeys() (*tao.Domain, *tao.Keys) {
 	// Load domain info for this domain.
 	domain, err := tao.LoadDomain(*cfg, nil)
 	if err != nil {
@@ -70,6 +81,22 @@ func NewTaoServer() *TaoServer {
 		log.Fatal("Could not extend name:", err)
 	}
 
+	// Generate a key for Tao connections, and have the host attest to it.
+	keys, err := tao.NewTemporaryTaoDelegatedKeys(tao.Signing, tao.Parent())
+	if err != nil {
+		log.Fatal("Could not create delegated keys:", err)
+	}
+	keys.Cert, err = keys.SigningKey.CreateSelfSignedX509(&pkix.Name{
+		Organization: []string{"Simple HTTP Server"}})
+	if err != nil {
+		log.Fatal("Could not create a certificate:", err)
+	}
+	return domain, keys
+}
+
+func NewTaoServer() *TaoServer {
+	domain, keys := newTaoKeys()
+
 	// Retrieve extended name.
 	taoName, err := tao.Parent().GetTaoName()
 	if err != nil {
@@ -105,45 +132,71 @@ func NewTaoServer() *TaoServer {
 		TaoName:         taoName.String(),
 		Secret:          secret,
 		ProgramFilePath: serverPath,
-	}
-	return t
-}
-
-// Testing server, in case you want to test just http without any Tao.
-func NewNonTaoServer() *TaoServer {
-	t := &TaoServer{
-		TaoName:         "NonTao",
-		Secret:          []byte("TaoSecret"),
-		ProgramFilePath: serverPath,
+		Domain:          domain,
+		Keys:            keys,
 	}
 	return t
 }
 
 func (s *TaoServer) secretPage(w http.ResponseWriter, r *http.Request) {
+	if peer, ok := tao.PeerPrincipalFromContext(r.Context()); ok {
+		fmt.Println("Serving the secret to", peer)
+	}
 	io.WriteString(w, "My secret:"+hex.EncodeToString(s.Secret))
 	//io.WriteString(w, string(s.Secret))
 }
 
+// fetchSecret requests the secret from the server over a Tao connection, and
+// prints it.
+func fetchSecret() {
+	domain, keys := newTaoKeys()
+	httpClient := &http.Client{
+		Transport: tao.NewHTTPTransport(domain.Guard, domain.Keys.VerifyingKey, keys, tao.DialOptions{}),
+	}
+	resp, err := httpClient.Get("https://" + net.JoinHostPort(*serverHost, *serverPort) + "/")
+	if err != nil {
+		log.Fatal("Could not fetch the secret:", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		log.Fatal("Could not read the secret:", err)
+	}
+	fmt.Printf("%s: %s\n", resp.Status, body)
+}
+
 func main() {
 	flag.Parse()
 
-	//server := NewNonTaoServer()
+	if *client {
+		fetchSecret()
+		return
+	}
+
 	server := NewTaoServer()
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", server.secretPage)
 
-	// To use this example as TLS server, use tao.ListenAnonymous
-	var err error
-	server.listener, err = net.Listen("tcp", ":"+*serverPort)
+	tlsc, err := tao.EncodeTLSCert(server.Keys)
+	if err != nil {
+		log.Fatal("Could not encode the TLS certificate:", err)
+	}
+	conf := &tls.Config{
+		RootCAs:            x509.NewCertPool(),
+		Certificates:       []tls.Certificate{*tlsc},
+		InsecureSkipVerify: true,
+		ClientAuth:         tls.RequireAnyClientCert,
+	}
+	server.listener, err = tao.Listen("tcp", ":"+*serverPort, conf, server.Domain.Guard,
+		server.Domain.Keys.VerifyingKey, server.Keys.Delegation)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	httpServer := http.Server{
-		Addr:    ":" + *serverPort,
-		Handler: mux,
-	}
+	// The domain guard must authorize each client to perform each request,
+	// e.g. Authorized(<client>, "GET", "/").
+	httpServer := tao.NewHTTPServer(tao.AuthorizeHTTP(server.Domain.Guard, mux))
 
 	kill := make(chan os.Signal, 1)
 	signal.Notify(kill, syscall.SIGINT, syscall.SIGTERM)
@@ -113,10 +113,11 @@ func server(serverAddr string, serverProgramData *taosupport.TaoProgramData) {
 		return
 	}
 	conf := &tls.Config{
-		RootCAs:            pool,
-		Certificates:       []tls.Certificate{*tlsc},
-		InsecureSkipVerify: false,
-		ClientAuth:         tls.RequireAnyClientCert,
+		RootCAs:               pool,
+		Certificates:          []tls.Certificate{*tlsc},
+		InsecureSkipVerify:    false,
+		ClientAuth:            tls.RequireAnyClientCert,
+		VerifyPeerCertificate: serverProgramData.VerifyPeerCertificate,
 	}
 
 	// Listen for clients.
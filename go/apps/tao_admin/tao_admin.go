@@ -18,6 +18,7 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
+	"crypto/x509"
 	"flag"
 	"fmt"
 	"io"
@@ -64,6 +65,7 @@ var opts = []options.Option{
 	{"retractcanexecute", "", "<prog>", "Path of a program to retract authorization to execute", "policy"},
 	{"add", "", "<rule>", "A policy rule to be added", "policy"},
 	{"retract", "", "<rule>", "A policy rule to be retracted", "policy"},
+	{"revoke", "", "<prin>", "A principal whose attestations the domain no longer accepts", "policy"},
 	{"show", false, "", "Print the policy after all other policy commands have executed", "policy"},
 	{"query", "", "<rule>", "A policy query to be checked", "policy"},
 	{"clear", false, "", "Clear all policy rules before other changes", "policy"},
@@ -75,6 +77,10 @@ var opts = []options.Option{
 	{"add_guard", false, "", "Add a trusted guard to the policy", "policy"},
 	{"add_tpm", false, "", "Add trusted platform module to the policy", "policy"},
 	{"add_tpm2", false, "", "Add trusted platform module 2.0 to the policy", "policy"},
+	{"import_manifest", "", "<file>", "A signed reference manifest whose values are added to the policy", "policy"},
+	{"retract_manifest", "", "<name>:<version>", "An imported reference manifest whose rules are retracted", "policy"},
+	{"build_cert", "", "<file>", "DER certificate of the build key that signs reference manifests", "policy"},
+	{"manifest_predicate", "TrustedProgramHash", "<name>", "The predicate for the rules of an imported reference manifest", "policy"},
 
 	// Flags for 'user' command, used to create new user keys.
 	{"user_key_details", "", "<file>", "File containing an X509Details proto", "user"},
@@ -254,6 +260,10 @@ func managePolicy() {
 		}
 	}
 
+	if manifest := *options.String["import_manifest"]; manifest != "" {
+		importManifest(manifest, domain)
+	}
+
 	// Retract permissions
 	if retract := *options.String["retract"]; retract != "" {
 		fmt.Fprintf(noise, "Retracting policy rule: %s\n", retract)
@@ -266,15 +276,36 @@ func managePolicy() {
 		host := template().GetHostName()
 		retractExecute(retractCanExecute, host, domain)
 	}
+	if manifest := *options.String["retract_manifest"]; manifest != "" {
+		retractManifest(manifest, domain)
+	}
+
+	// Revoke principals
+	if revoke := *options.String["revoke"]; revoke != "" {
+		var prin auth.Prin
+		_, err := fmt.Sscanf(revoke, "%v", &prin)
+		options.FailIf(err, "Can't parse principal: %s", revoke)
+		fmt.Fprintf(noise, "Revoking principal: %s\n", prin)
+		domain.RevokePrincipal(prin)
+		err = domain.Save()
+		options.FailIf(err, "Can't save domain")
+	}
 
 	// Print the policy after all commands are executed.
 	if *options.Bool["show"] {
 		fmt.Print(domain.Guard.String())
+		for _, prin := range domain.Revocations.Principals() {
+			fmt.Printf("Revoked(%s)\n", prin)
+		}
+		for _, im := range domain.ReferenceManifests {
+			m := im.GetManifest()
+			fmt.Printf("ReferenceManifest(%q, %q, %s)\n", m.GetName(), m.GetVersion(), im.GetPredicate())
+		}
 	}
 }
 
-func hash(p string) ([]byte, error) {
-	// If the path is not absolute, then try $GOPATH/bin/path if it exists.
+// gopathBin returns $GOPATH/bin/p if p is not absolute and $GOPATH is set.
+func gopathBin(p string) string {
 	realPath := p
 	if !path.IsAbs(p) {
 		// TODO(kwalsh) handle case where GOPATH has multiple paths
@@ -283,7 +314,12 @@ func hash(p string) ([]byte, error) {
 			realPath = path.Join(path.Join(gopath, "bin"), realPath)
 		}
 	}
-	file, err := os.Open(realPath)
+	return realPath
+}
+
+func hash(p string) ([]byte, error) {
+	// If the path is not absolute, then try $GOPATH/bin/path if it exists.
+	file, err := os.Open(gopathBin(p))
 	if err != nil {
 		return nil, err
 	}
@@ -336,10 +372,19 @@ func makeLinuxHostSubPrin(prog string) (auth.SubPrin, error) {
 func makeContainerSubPrin(prog string) (auth.SubPrin, error) {
 	// TODO(tmroeder): This assumes no IDs
 	id := uint(0)
-	h, err := hash(prog)
+	b, err := ioutil.ReadFile(gopathBin(prog))
 	if err != nil {
 		return auth.SubPrin{}, err
 	}
+	// Containers are named by the digest of their image, which can only be
+	// known in advance for image archives, not for Dockerfiles.
+	h, err := tao.DockerImageDigest(b)
+	if err != nil {
+		return auth.SubPrin{}, err
+	}
+	if h == nil {
+		return auth.SubPrin{}, fmt.Errorf("%s is not a docker image archive", prog)
+	}
 	return tao.FormatDockerSubprin(id, h), nil
 }
 
@@ -578,6 +623,50 @@ func addProgramRules(host string, domain *tao.Domain) {
 	options.FailIf(err, "Can't save domain")
 }
 
+// importManifest adds rules for the values of a reference manifest signed by
+// the build key to the policy.
+func importManifest(manifest string, domain *tao.Domain) {
+	if domain.Config.DomainInfo.GetGuardType() != "Datalog" {
+		options.Usage("Reference manifests need a Datalog guard")
+	}
+	certPath := *options.String["build_cert"]
+	if certPath == "" {
+		options.Usage("Must supply -build_cert to import a reference manifest")
+	}
+	der, err := ioutil.ReadFile(certPath)
+	options.FailIf(err, "Can't read build key certificate")
+	cert, err := x509.ParseCertificate(der)
+	options.FailIf(err, "Can't parse build key certificate")
+	buildKey, err := tao.FromX509(cert)
+	options.FailIf(err, "Can't use build key certificate")
+	m, err := tao.LoadReferenceManifest(buildKey, manifest)
+	options.FailIf(err, "Can't load reference manifest: %s", manifest)
+
+	fmt.Fprintf(noise, "Importing reference manifest %s %s:\n", m.GetName(), m.GetVersion())
+	for _, v := range m.Values {
+		fmt.Fprintf(noise, "  %s %s: %s\n", v.GetName(), v.GetVersion(), v.GetSubprincipal())
+	}
+	err = domain.ImportReferenceManifest(m, *options.String["manifest_predicate"])
+	options.FailIf(err, "Can't import reference manifest")
+	err = domain.Save()
+	options.FailIf(err, "Can't save domain")
+}
+
+// retractManifest retracts the rules for an imported reference manifest,
+// given as name:version.
+func retractManifest(manifest string, domain *tao.Domain) {
+	i := strings.LastIndex(manifest, ":")
+	if i < 0 {
+		options.Usage("Must give the manifest to retract as <name>:<version>")
+	}
+	name, version := manifest[:i], manifest[i+1:]
+	fmt.Fprintf(noise, "Retracting reference manifest %s %s\n", name, version)
+	err := domain.RetractReferenceManifest(name, version)
+	options.FailIf(err, "Can't retract reference manifest")
+	err = domain.Save()
+	options.FailIf(err, "Can't save domain")
+}
+
 func addContainerRules(host string, domain *tao.Domain) {
 	dt := template()
 	if domain.Config.DomainInfo.GetGuardType() == "Datalog" {
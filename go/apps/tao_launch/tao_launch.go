@@ -118,6 +118,7 @@ import (
 	"os"
 	"os/signal"
 	"path"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"syscall"
@@ -133,8 +134,16 @@ import (
 
 var opts = []options.Option{
 	// Flags for all commands
-	{"tao_domain", "", "<dir>", "Tao domain configuration directory", "all,all+run"},
-	{"host", "", "<dir>", "Host configuration, relative to domain directory or absolute", "all,all+run"},
+	{"tao_domain", "", "<dir>", "Tao domain configuration directory", "all,all+run,all+logs"},
+	{"host", "", "<dir>", "Host configuration, relative to domain directory or absolute", "all,all+run,all+logs"},
+	{"remote", "", "<host:port>", "Connect to the remote admin listener of a host, instead of a local host", "all,all+run,all+logs"},
+	{"remote_keys", "", "<dir>", "Keys for -remote, instead of keys delegated by the parent Tao", "all,all+run,all+logs"},
+	{"remote_pass", "", "<password>", "Password for -remote_keys", "all,all+run,all+logs"},
+}
+
+var logs_opts = []options.Option{
+	// Flags for logs
+	{"follow", false, "", "Keep showing output until the hosted program exits", "logs,all+logs"},
 }
 
 var run_opts = []options.Option{
@@ -144,16 +153,26 @@ var run_opts = []options.Option{
 	{"disown", false, "", "Don't wait for hosted program to exit", "run,all+run"},
 	{"daemon", false, "", "Don't pipe stdio or wait for hosted program to exit", "run,all+run"},
 	{"verbose", false, "", "Be more verbose", "run,all+run"},
+	{"measure_args", false, "", "Measure arguments into hosted process name", "run,all+run"},
+	{"measure_env", "", "<var,...>", "Measure these environment variables into hosted process name", "run,all+run"},
+	{"measure_config", "", "<file,...>", "Measure these config files into hosted process name", "run,all+run"},
+	{"script", false, "", "Measure interpreter and dependencies of an interpreted hosted process", "run,all+run"},
+	{"interpreter", "", "<prog>", "Interpreter for -script, instead of the #! line", "run,all+run"},
+	{"interpreter_args", "", "<arg,...>", "Arguments for -interpreter, e.g. -jar", "run,all+run"},
+	{"script_deps", "", "<path,...>", "Files and directories -script depends on, e.g. a lock file", "run,all+run"},
 }
 
 func init() {
 	options.Add(opts...)
 	switch path.Base(os.Args[0]) {
-	case "tao_stop", "tao_kill", "tao_list":
+	case "tao_stop", "tao_kill", "tao_list", "tao_watch":
+	case "tao_logs":
+		options.Add(logs_opts...)
 	case "tao_run":
 		options.Add(run_opts...)
 	default:
 		options.Add(run_opts...)
+		options.Add(logs_opts...)
 	}
 }
 
@@ -172,13 +191,20 @@ func help() {
 			{"logging", "Options to control log output"},
 		}
 		options.ShowRelevant(w, categories...)
-	case "tao_list":
+	case "tao_list", "tao_watch":
 		fmt.Fprintf(w, "Usage: %s [options]\n", av0)
 		categories := []options.Category{
 			{"all", "Options"},
 			{"logging", "Options to control log output"},
 		}
 		options.ShowRelevant(w, categories...)
+	case "tao_logs":
+		fmt.Fprintf(w, "Usage: %s [options] <pid|subprin>\n", av0)
+		categories := []options.Category{
+			{"all+logs", "Options"},
+			{"logging", "Options to control log output"},
+		}
+		options.ShowRelevant(w, categories...)
 	case "tao_run":
 		fmt.Fprintf(w, "Usage: %s [options] <prog> [args...]\n", av0)
 		categories := []options.Category{
@@ -192,13 +218,18 @@ func help() {
 		fmt.Fprintf(w, "  %s run [options] [process:]<prog> [args...]\t Run a new hosted process\n", av0)
 		fmt.Fprintf(w, "  %s run [options] docker:<img> [dockerargs...] [-- [imgargs...]]\t Run a new hosted docker image\n", av0)
 		fmt.Fprintf(w, "  %s run [options] kvm_coreos:<img> [dockerargs...] [-- [imgargs...]]\t Run a new hosted QEMU/kvm CoreOS image\n", av0)
-		fmt.Fprintf(w, "  %s run [options] kvm_custom:<img> [-- <kernel image path> <initram image path> <SSH port>]\t Run a new hosted QEMU/kvm custom instance\n", av0)
+		fmt.Fprintf(w, "  %s run [options] kvm_custom:<img> [-append <cmdline>] [-drive <disk>[,verity=<hex root hash>]...] [-- <kernel image path> <initram image path> <SSH port>]\t Run a new hosted QEMU/kvm custom instance\n", av0)
+		fmt.Fprintf(w, "  %s run [options] oci:<bundle> [args...]\t Run a new hosted OCI bundle\n", av0)
 		fmt.Fprintf(w, "  %s list [options]\t List hosted programs\n", av0)
+		fmt.Fprintf(w, "  %s watch [options]\t Show hosted programs starting, exiting, etc.\n", av0)
+		fmt.Fprintf(w, "  %s logs [options] <pid|subprin>\t Show output of a hosted program\n", av0)
+		fmt.Fprintf(w, "  %s status [options] <pid|subprin>\t Show status of a hosted VM\n", av0)
 		fmt.Fprintf(w, "  %s stop [options] subprin [subprin...]\t Stop hosted programs\n", av0)
 		fmt.Fprintf(w, "  %s stop [options] subprin [subprin...]\t Kill hosted programs\n", av0)
 		categories := []options.Category{
 			{"all", "Basic options for all commands"},
 			{"run", "Options for 'run' command"},
+			{"logs", "Options for 'logs' command"},
 			{"logging", "Options to control log output"},
 		}
 		options.ShowRelevant(w, categories...)
@@ -211,7 +242,7 @@ func main() {
 
 	cmd := "help"
 	switch av0 := path.Base(os.Args[0]); av0 {
-	case "tao_run", "tao_list", "tao_stop", "tao_kill":
+	case "tao_run", "tao_list", "tao_stop", "tao_kill", "tao_watch", "tao_logs":
 		cmd = av0[4:]
 		flag.Parse()
 	default:
@@ -231,12 +262,16 @@ func main() {
 		noise = os.Stderr
 	}
 
-	sockPath := path.Join(hostPath(), "admin_socket")
-	conn, err := net.DialUnix("unix", nil, &net.UnixAddr{Name: sockPath, Net: "unix"})
-	options.FailIf(err, "Can't connect to host admin socket")
-	defer conn.Close()
-
-	client := tao.NewLinuxHostAdminClient(conn)
+	var client tao.LinuxHostAdminClient
+	if addr := *options.String["remote"]; addr != "" {
+		client = dialRemote(addr)
+	} else {
+		sockPath := path.Join(hostPath(), "admin_socket")
+		conn, err := net.DialUnix("unix", nil, &net.UnixAddr{Name: sockPath, Net: "unix"})
+		options.FailIf(err, "Can't connect to host admin socket")
+		client = tao.NewLinuxHostAdminClient(conn)
+	}
+	defer client.Close()
 	switch cmd {
 	case "help":
 		help()
@@ -253,6 +288,7 @@ func main() {
 	case "kill":
 		for _, s := range flag.Args() {
 			var subprin auth.SubPrin
+			_, err := fmt.Sscanf(s, "%v", &subprin)
 			options.FailIf(err, "Not a subprin: %s", s)
 			err = client.KillHostedProgram(subprin)
 			options.FailIf(err, "Could not kill %s", s)
@@ -264,6 +300,25 @@ func main() {
 			fmt.Printf("pid=%d subprin=%v\n", p, names[i])
 		}
 		fmt.Printf("%d hosted programs\n", len(pids))
+	case "watch":
+		watchHosted(&client)
+	case "logs":
+		if flag.NArg() != 1 {
+			options.Usage("Must supply one pid or subprin")
+		}
+		showLogs(&client, flag.Arg(0))
+	case "status":
+		if flag.NArg() != 1 {
+			options.Usage("Must supply one pid or subprin")
+		}
+		pid, subprin := parsePidOrSubprin(flag.Arg(0))
+		status, err := client.HostedVMStatus(pid, subprin)
+		options.FailIf(err, "Can't get status of %s", flag.Arg(0))
+		fmt.Printf("state=%s", status.State)
+		if status.ShutdownReason != "" {
+			fmt.Printf(" shutdown_reason=%s", status.ShutdownReason)
+		}
+		fmt.Printf("\n")
 	default:
 		options.Usage("Unrecognized command: %s", cmd)
 	}
@@ -273,6 +328,87 @@ func main() {
 
 const moment = 100 * time.Millisecond
 
+// dialRemote connects to the remote admin listener of a host. We authenticate
+// either with keys delegated by our parent Tao, or with -remote_keys, which
+// speak only for themselves. Either way, the domain guard must authorize us to
+// Execute, and the host's guard must authorize the admin ops we use.
+func dialRemote(addr string) tao.LinuxHostAdminClient {
+	domain, err := tao.LoadDomain(path.Join(domainPath(), "tao.config"), nil)
+	options.FailIf(err, "Can't load domain")
+
+	var conn net.Conn
+	if dir := *options.String["remote_keys"]; dir != "" {
+		pass := []byte(*options.String["remote_pass"])
+		keys, err := tao.NewOnDiskPBEKeys(tao.Signing, pass, dir, nil)
+		options.FailIf(err, "Can't load keys")
+		self := keys.SigningKey.ToPrincipal()
+		keys.Delegation, err = tao.GenerateAttestation(keys.SigningKey, nil, auth.Says{
+			Speaker: self,
+			Message: auth.Speaksfor{Delegate: self, Delegator: self},
+		})
+		options.FailIf(err, "Can't create delegation")
+		conn, err = tao.Dial("tcp", addr, domain.Guard, domain.Keys.VerifyingKey, keys)
+	} else {
+		conn, err = tao.DialWithNewX509("tcp", addr, domain.Guard, domain.Keys.VerifyingKey)
+	}
+	options.FailIf(err, "Can't connect to remote host %s", addr)
+	return tao.NewRemoteLinuxHostAdminClient(conn)
+}
+
+func watchHosted(client *tao.LinuxHostAdminClient) {
+	var seq uint64
+	for {
+		events, next, err := client.WatchHostedPrograms(seq)
+		options.FailIf(err, "Can't watch hosted programs")
+		for _, e := range events {
+			if seq != 0 && e.Seq != seq+1 {
+				// Events are skipped if the host dropped them before we
+				// asked, or if they are for other users' programs.
+				fmt.Printf("[skipped %d events]\n", e.Seq-seq-1)
+			}
+			seq = e.Seq
+			t := e.Time.Format("2006-01-02 15:04:05.000")
+			switch e.Type {
+			case tao.HostedProgramEventType_HOST_SHUTDOWN:
+				fmt.Printf("%s %s pid=%d\n", t, e.Type, e.Pid)
+				return
+			case tao.HostedProgramEventType_EXITED:
+				fmt.Printf("%s %s pid=%d subprin=%v %s\n", t, e.Type, e.Pid, e.Subprin, exitCode(e.Status))
+			default:
+				fmt.Printf("%s %s pid=%d subprin=%v\n", t, e.Type, e.Pid, e.Subprin)
+			}
+		}
+		seq = next
+	}
+}
+
+// parsePidOrSubprin parses a hosted program pid or subprincipal.
+func parsePidOrSubprin(s string) (pid int, subprin auth.SubPrin) {
+	if _, err := fmt.Sscanf(s, "%d", &pid); err != nil {
+		_, err = fmt.Sscanf(s, "%v", &subprin)
+		options.FailIf(err, "Not a pid or subprin: %s", s)
+	}
+	return
+}
+
+func showLogs(client *tao.LinuxHostAdminClient, s string) {
+	pid, subprin := parsePidOrSubprin(s)
+	follow := *options.Bool["follow"]
+	var offset int64
+	for {
+		data, next, done, err := client.HostedProgramLogs(pid, subprin, offset, follow)
+		options.FailIf(err, "Can't get output of %s", s)
+		if next-int64(len(data)) > offset {
+			fmt.Fprintf(os.Stderr, "[skipped %d bytes]\n", next-int64(len(data))-offset)
+		}
+		os.Stdout.Write(data)
+		offset = next
+		if done || !follow {
+			return
+		}
+	}
+}
+
 func split(a []string, delim string) (before []string, after []string) {
 	for i, s := range a {
 		if s == delim {
@@ -296,17 +432,32 @@ func runHosted(client *tao.LinuxHostAdminClient, args []string) {
 
 	ctype := "process"
 	spec.Path = args[0]
-	for _, prefix := range []string{"process", "docker", "kvm_coreos", "kvm_custom"} {
+	for _, prefix := range []string{"process", "docker", "kvm_coreos", "kvm_custom", "oci"} {
 		if strings.HasPrefix(spec.Path, prefix+":") {
 			ctype = prefix
 			spec.Path = strings.TrimPrefix(spec.Path, prefix+":")
 		}
 	}
 
+	remote := *options.String["remote"] != ""
+
 	switch ctype {
 	case "process":
+		if remote {
+			// The path is on the remote host, so we can't search for it.
+			spec.ContainerArgs = []string{spec.Path}
+			spec.Args = args[1:]
+			break
+		}
 		dirs := util.LiberalSearchPath()
 		binary := util.FindExecutable(args[0], dirs)
+		if binary == "" && *options.Bool["script"] {
+			// Scripts run by an explicit interpreter need not be executable.
+			if fi, err := os.Stat(spec.Path); err == nil && fi.Mode().IsRegular() {
+				binary, err = filepath.Abs(spec.Path)
+				options.FailIf(err, "Can't find script")
+			}
+		}
 		if binary == "" {
 			options.Fail(nil, "Can't find `%s` on path '%s'", args[0], strings.Join(dirs, ":"))
 		}
@@ -320,7 +471,15 @@ func runHosted(client *tao.LinuxHostAdminClient, args []string) {
 		r, _ := regexp.Compile("[^a-zA-Z0-9_.]+")
 		spec.ContainerArgs[0] = r.ReplaceAllLiteralString(path.Base(spec.Path), "_")
 	case "kvm_custom":
-		_, spec.Args = split(args, "--")
+		// args contains [ "kvm_custom:img", vmopts..., "--", kernel, initram, port ]
+		spec.ContainerArgs, spec.Args = split(args, "--")
+	case "oci":
+		// args contains [ "oci:bundle", prog_args... ]
+		if !remote {
+			spec.Path, err = filepath.Abs(spec.Path)
+			options.FailIf(err, "Can't find OCI bundle")
+		}
+		spec.Args = args[1:]
 	}
 
 	pidfile := *options.String["pidfile"]
@@ -343,6 +502,11 @@ func runHosted(client *tao.LinuxHostAdminClient, args []string) {
 
 	daemon := *options.Bool["daemon"]
 	disown := *options.Bool["disown"]
+	if remote {
+		// We can't share stdio or proxy signals across the network. Use the
+		// logs command to see the output.
+		daemon = true
+	}
 
 	var pr, pw *os.File
 	proxying := false
@@ -374,8 +538,31 @@ func runHosted(client *tao.LinuxHostAdminClient, args []string) {
 		fmt.Fprintf(noise, "[proxying stdin]\n")
 	}
 
-	spec.Dir, err = os.Getwd()
-	options.FailIf(err, "Can't get working directory")
+	if !remote {
+		spec.Dir, err = os.Getwd()
+		options.FailIf(err, "Can't get working directory")
+	}
+
+	measureEnv := *options.String["measure_env"]
+	measureConfig := *options.String["measure_config"]
+	if *options.Bool["measure_args"] || measureEnv != "" || measureConfig != "" {
+		spec.Measure = &tao.ConfigMeasurement{Args: *options.Bool["measure_args"]}
+		if measureEnv != "" {
+			spec.Measure.Env = strings.Split(measureEnv, ",")
+		}
+		if measureConfig != "" {
+			spec.Measure.Files = strings.Split(measureConfig, ",")
+		}
+	}
+	if *options.Bool["script"] {
+		spec.Script = &tao.ScriptMeasurement{Interpreter: *options.String["interpreter"]}
+		if a := *options.String["interpreter_args"]; a != "" {
+			spec.Script.InterpreterArgs = strings.Split(a, ",")
+		}
+		if d := *options.String["script_deps"]; d != "" {
+			spec.Script.Dependencies = strings.Split(d, ",")
+		}
+	}
 
 	// Start catching signals early, buffering a few, so we don't miss any. We
 	// don't proxy SIGTTIN. However, we do catch it and stop ourselves, rather
@@ -41,7 +41,11 @@ function build_docker() {
 	cp $policy_cert ${TEMP_DIR}/policy_keys/cert
 	cp $tao_config ${TEMP_DIR}/tao.config
 
-	tar -C ${TEMP_DIR} -czf "$APP_BIN".img.tgz $(ls ${TEMP_DIR})
+	# Save the built image, rather than the Dockerfile and its context, so that
+	# the image digest, which names the hosted container, is known in advance.
+	IMAGE_ID="$(docker build -q ${TEMP_DIR})"
+	docker save "$IMAGE_ID" | gzip > "$APP_BIN".img.tgz
+	docker rmi "$IMAGE_ID" >/dev/null
 	rm -rf ${TEMP_DIR}
 }
 
@@ -30,7 +30,8 @@ import (
 
 // This function packages a host attestation into a DomainServiceRequest of the type
 // DOMAIN_CERT_REQUEST, sends it to the domain service and deserializes the response
-// into an attestation that contains the domain program certificate.
+// into an attestation that contains the domain program certificate. The host attestation
+// should carry a nonce from RequestNonce.
 func RequestProgramCert(hostAtt *tao.Attestation, verifier *tao.Verifier,
 	network string, addr string) (*x509.Certificate, error) {
 	serAtt, err := proto.Marshal(hostAtt)
@@ -110,6 +111,41 @@ func RequestRevokeCertificate(att *tao.Attestation, network, addr string) error
 	return nil
 }
 
+// This function sends a DomainServiceRequest of the type GET_NONCE to the domain service,
+// and returns the nonce in the response. The host should bind the nonce into the host
+// attestation that it sends with RequestProgramCert, using tao.Tao.AttestNonce.
+func RequestNonce(network, addr string) ([]byte, error) {
+	reqType := DomainServiceRequest_GET_NONCE
+	request := &DomainServiceRequest{
+		Type: &reqType}
+
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	ms := util.NewMessageStream(conn)
+	_, err = ms.WriteMessage(request)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Sent nonce request to Domain Service using network %s at address %s.",
+		network, addr)
+	var response DomainServiceResponse
+	err = ms.ReadMessage(&response)
+	if err != nil {
+		return nil, err
+	}
+	log.Println("Got response from Domain Service.")
+	if errStr := response.GetErrorMessage(); errStr != "" {
+		return nil, errors.New(errStr)
+	}
+	if len(response.GetNonce()) == 0 {
+		return nil, errors.New("domain service returned an empty nonce")
+	}
+	return response.GetNonce(), nil
+}
+
 // This function sends a DomainServiceRequest of the type GET_CRL to the domain service,
 // and deserializes the response into a pkix.CertificateList containing the revoked certificates.
 func RequestCrl(network, addr string) (*pkix.CertificateList, error) {
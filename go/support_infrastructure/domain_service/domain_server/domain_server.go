@@ -40,8 +40,14 @@ var configPath = flag.String("domain_config", "./tao.config", "The Tao domain co
 var trustedEntitiesPath = flag.String("trusted_entities", "./TrustedEntities", "File containing trusted entities.")
 var createDomainFlag = flag.Bool("create_domain", false, "To create new domain from specified config.")
 
+// Hosts whose clients predate GET_NONCE send attestations without a nonce, so
+// nonces aren't required by default; an attestation that carries one has it
+// checked either way. Set -require_nonce once every host gets a nonce first.
+var requireNonce = flag.Bool("require_nonce", false, "Require host attestations to carry a nonce from this service.")
+
 var serialNumber = 0
 var revokedCertificates []pkix.RevokedCertificate
+var nonces = domain_service.NewNonces(domain_service.DefaultNonceLifetime)
 
 func getPass() []byte {
 	if domainPass == nil || *domainPass == "" {
@@ -150,6 +156,14 @@ func main() {
 		switch *request.Type {
 		case domain_service.DomainServiceRequest_DOMAIN_CERT_REQUEST:
 			log.Println("Got Program cert request")
+			if *requireNonce || carriesNonce(request.GetSerializedHostAttestation()) {
+				err := domain_service.CheckAttestationNonce(request.GetSerializedHostAttestation(), nonces)
+				if err != nil {
+					log.Printf("domain_server: Error checking host att nonce: %s\n", err)
+					sendError(err, ms)
+					continue
+				}
+			}
 			_, kPrin, prog, err := domain_service.VerifyAttestation(request.GetSerializedHostAttestation(),
 				domain)
 			if err != nil {
@@ -222,10 +236,28 @@ func main() {
 			if _, err := ms.WriteMessage(&resp); err != nil {
 				log.Printf("domain_server: Error sending response on the channel: %s\n ", err)
 			}
+		case domain_service.DomainServiceRequest_GET_NONCE:
+			resp := domain_service.DomainServiceResponse{}
+			nonce, err := nonces.New()
+			if err != nil {
+				errStr := err.Error()
+				resp.ErrorMessage = &errStr
+			} else {
+				resp.Nonce = nonce
+			}
+			if _, err := ms.WriteMessage(&resp); err != nil {
+				log.Printf("domain_server: Error sending response on the channel: %s\n ", err)
+			}
 		}
 	}
 }
 
+// carriesNonce reports whether a host attestation carries a nonce.
+func carriesNonce(serializedHostAttestation []byte) bool {
+	var a tao.Attestation
+	return proto.Unmarshal(serializedHostAttestation, &a) == nil && len(a.Nonce) != 0
+}
+
 func sendError(err error, ms *util.MessageStream) {
 	var errStr = ""
 	if err != nil {
@@ -23,6 +23,7 @@ import (
 	"io/ioutil"
 	"log"
 	"math/big"
+	"sync"
 	"time"
 
 	"github.com/golang/protobuf/proto"
@@ -30,6 +31,97 @@ import (
 	"github.com/jlmucb/cloudproxy/go/tao/auth"
 )
 
+// DefaultNonceLifetime is how long a host has to use a nonce from the domain
+// service in a program cert request.
+const DefaultNonceLifetime = time.Minute
+
+// MaxNonces is the most nonces that the domain service hands out within one
+// nonce lifetime, so requests for nonces can't use up its memory.
+const MaxNonces = 10000
+
+// Nonces holds the nonces that the domain service has handed out in response to
+// GET_NONCE requests. A host binds one into the host attestation of a
+// DOMAIN_CERT_REQUEST, see tao.Tao.AttestNonce, which shows that the
+// attestation is fresh rather than replayed. Each nonce can be used once,
+// before it expires.
+type Nonces struct {
+	m        sync.Mutex
+	lifetime time.Duration
+	max      int
+	issued   map[string]time.Time
+
+	// order holds the nonces handed out within the last lifetime, used or
+	// not, oldest first. Since every nonce has the same lifetime, the
+	// expired ones are at the front.
+	order []issuedNonce
+}
+
+type issuedNonce struct {
+	nonce  string
+	expiry time.Time
+}
+
+// NewNonces returns an empty set of nonces that each last for lifetime.
+func NewNonces(lifetime time.Duration) *Nonces {
+	return &Nonces{lifetime: lifetime, max: MaxNonces, issued: make(map[string]time.Time)}
+}
+
+// New returns a fresh nonce, or an error if MaxNonces nonces have been handed
+// out within the last lifetime.
+func (n *Nonces) New() ([]byte, error) {
+	nonce, err := tao.NewNonce()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	n.m.Lock()
+	defer n.m.Unlock()
+	for len(n.order) > 0 && now.After(n.order[0].expiry) {
+		delete(n.issued, n.order[0].nonce)
+		n.order = n.order[1:]
+	}
+	if len(n.order) >= n.max {
+		return nil, errors.New("too many outstanding nonces")
+	}
+	expiry := now.Add(n.lifetime)
+	n.issued[string(nonce)] = expiry
+	n.order = append(n.order, issuedNonce{string(nonce), expiry})
+	return nonce, nil
+}
+
+// Use checks that nonce was handed out by New and hasn't expired, and makes
+// sure that it can't be used again.
+func (n *Nonces) Use(nonce []byte) error {
+	n.m.Lock()
+	defer n.m.Unlock()
+	expiry, ok := n.issued[string(nonce)]
+	if !ok {
+		return errors.New("unknown or already used nonce")
+	}
+	delete(n.issued, string(nonce))
+	if time.Now().After(expiry) {
+		return errors.New("expired nonce")
+	}
+	return nil
+}
+
+// CheckAttestationNonce checks that a host attestation carries a nonce from
+// nonces, and uses the nonce up. VerifyAttestation and VerifyHostAttestation
+// check the signature that binds the nonce to the attestation.
+func CheckAttestationNonce(serializedHostAttestation []byte, nonces *Nonces) error {
+	var hostAttestation tao.Attestation
+	if err := proto.Unmarshal(serializedHostAttestation, &hostAttestation); err != nil {
+		return err
+	}
+	if len(hostAttestation.Nonce) == 0 {
+		return errors.New("host attestation does not carry a nonce")
+	}
+	if err := nonces.Use(hostAttestation.Nonce); err != nil {
+		return errors.New("host attestation nonce is not valid: " + err.Error())
+	}
+	return nil
+}
+
 func VerifyAttestation(serializedHostAttestation []byte, domain *tao.Domain) (*auth.Prin,
 	*auth.Prin, *auth.Prin, error) {
 	var hostAttestation tao.Attestation
@@ -41,6 +133,10 @@ func VerifyAttestation(serializedHostAttestation []byte, domain *tao.Domain) (*a
 	if err != nil {
 		return nil, nil, nil, err
 	}
+	err = tao.CheckChainRevocation(tao.GuardRevocation(domain.Guard), &hostAttestation)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 	f, err := auth.UnmarshalForm(hostAttestation.SerializedStatement)
 	if err != nil {
 		return nil, nil, nil, err
@@ -196,6 +292,11 @@ func VerifyHostAttestation(serializedHostAttestation []byte, domain *tao.Domain,
 		return nil, nil, nil, errors.New(
 			"host attestation fails validation check: " + err.Error())
 	}
+	err = tao.CheckChainRevocation(tao.GuardRevocation(domain.Guard), &hostAttestation)
+	if err != nil {
+		return nil, nil, nil, errors.New(
+			"host attestation has been revoked: " + err.Error())
+	}
 
 	// Next, check if SpeaksFor delegator is authorized to execute (i.e. the program is allowed to
 	// run as per policy).
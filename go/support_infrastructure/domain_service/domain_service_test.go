@@ -128,6 +128,12 @@ func TestVerifyHostAttestation_rootHost(t *testing.T) {
 	if !hostKey.SigningKey.ToPrincipal().Identical(speaker) {
 		t.Fatal("Attestation host key not identical to expected host key.")
 	}
+
+	revoked := tao.NewRevokedPrincipals(hostKey.SigningKey.ToPrincipal())
+	domain.Guard.(tao.RevocationGuard).SetRevocation(revoked)
+	if _, _, _, err := VerifyHostAttestation(rawAtt, domain, certPool); err == nil {
+		t.Fatal("Attestation from a revoked host key passed verification checks.")
+	}
 }
 
 func TestGenerateProgramCert(t *testing.T) {
@@ -147,6 +153,78 @@ func TestGenerateProgramCert(t *testing.T) {
 	}
 }
 
+func TestCheckAttestationNonce(t *testing.T) {
+	policyKey, _ := generatePolicyKey(t)
+	domain := &tao.Domain{Keys: policyKey}
+	nonces := NewNonces(DefaultNonceLifetime)
+	nonce, err := nonces.New()
+	if err != nil {
+		t.Fatal("Error generating nonce.", err)
+	}
+	says := auth.Says{
+		Speaker: domain.Keys.SigningKey.ToPrincipal(),
+		Message: auth.Speaksfor{
+			Delegate:  auth.NewKeyPrin([]byte("programKey")),
+			Delegator: programName,
+		},
+	}
+	att, err := tao.GenerateNonceAttestation(domain.Keys.SigningKey, nil, nonce, says)
+	if err != nil {
+		t.Fatal("Error generating attestation:", err)
+	}
+	rawAtt, err := proto.Marshal(att)
+	if err != nil {
+		t.Fatal("Error serializing attestation.")
+	}
+	if err := CheckAttestationNonce(rawAtt, nonces); err != nil {
+		t.Fatal("Attestation with a fresh nonce failed the nonce check.", err)
+	}
+	if _, _, _, err := VerifyAttestation(rawAtt, domain); err != nil {
+		t.Fatal("Attestation with a nonce failed verification checks.", err)
+	}
+	if err := CheckAttestationNonce(rawAtt, nonces); err == nil {
+		t.Fatal("Attestation with a used nonce passed the nonce check.")
+	}
+
+	att, err = tao.GenerateAttestation(domain.Keys.SigningKey, nil, says)
+	if err != nil {
+		t.Fatal("Error generating attestation:", err)
+	}
+	rawAtt, err = proto.Marshal(att)
+	if err != nil {
+		t.Fatal("Error serializing attestation.")
+	}
+	if err := CheckAttestationNonce(rawAtt, nonces); err == nil {
+		t.Fatal("Attestation without a nonce passed the nonce check.")
+	}
+
+	expired := NewNonces(-time.Second)
+	if nonce, err = expired.New(); err != nil {
+		t.Fatal("Error generating nonce.", err)
+	}
+	if err := expired.Use(nonce); err == nil {
+		t.Fatal("An expired nonce was accepted.")
+	}
+
+	// Only so many nonces are handed out within a lifetime, used or not.
+	nonces.max = 2
+	if _, err := nonces.New(); err != nil {
+		t.Fatal("Error generating nonce.", err)
+	}
+	if _, err := nonces.New(); err == nil {
+		t.Fatal("Generated more nonces than the limit.")
+	}
+	expired.max = 1
+	for i := 0; i < 2; i++ {
+		if _, err := expired.New(); err != nil {
+			t.Fatal("Expired nonces counted against the limit.", err)
+		}
+	}
+	if len(expired.issued) != 1 || len(expired.order) != 1 {
+		t.Fatal("Expired nonces were kept.")
+	}
+}
+
 func TestValidateEndorsementCert(t *testing.T) {
 	aikblob, err := ioutil.ReadFile("./aikblob")
 	if err != nil {
@@ -38,6 +38,7 @@ const (
 	DomainServiceRequest_MANAGE_POLICY       DomainServiceRequestRequestType = 2
 	DomainServiceRequest_REVOKE_CERTIFICATE  DomainServiceRequestRequestType = 3
 	DomainServiceRequest_GET_CRL             DomainServiceRequestRequestType = 4
+	DomainServiceRequest_GET_NONCE           DomainServiceRequestRequestType = 5
 )
 
 var DomainServiceRequestRequestType_name = map[int32]string{
@@ -45,12 +46,14 @@ var DomainServiceRequestRequestType_name = map[int32]string{
 	2: "MANAGE_POLICY",
 	3: "REVOKE_CERTIFICATE",
 	4: "GET_CRL",
+	5: "GET_NONCE",
 }
 var DomainServiceRequestRequestType_value = map[string]int32{
 	"DOMAIN_CERT_REQUEST": 1,
 	"MANAGE_POLICY":       2,
 	"REVOKE_CERTIFICATE":  3,
 	"GET_CRL":             4,
+	"GET_NONCE":           5,
 }
 
 func (x DomainServiceRequestRequestType) Enum() *DomainServiceRequestRequestType {
@@ -76,6 +79,8 @@ func (DomainServiceRequestRequestType) EnumDescriptor() ([]byte, []int) {
 type DomainServiceRequest struct {
 	Type *DomainServiceRequestRequestType `protobuf:"varint,1,opt,name=type,enum=domain_service.DomainServiceRequestRequestType" json:"type,omitempty"`
 	// Fields for type: DOMAIN_CERT_REQUEST.
+	// The host attestation must carry a nonce from a GET_NONCE request, see
+	// tao.Attestation.nonce.
 	SerializedHostAttestation []byte `protobuf:"bytes,2,opt,name=serialized_host_attestation" json:"serialized_host_attestation,omitempty"`
 	// The program key, serialized in the format that
 	// auth.NewKeyPrin() accepts.
@@ -125,7 +130,9 @@ type DomainServiceResponse struct {
 	// Fields for response to DOMAIN_CERT_REQUEST.
 	DerProgramCert []byte `protobuf:"bytes,2,opt,name=der_program_cert" json:"der_program_cert,omitempty"`
 	// Fields for response to GET_CRL.
-	Crl              []byte `protobuf:"bytes,3,opt,name=crl" json:"crl,omitempty"`
+	Crl []byte `protobuf:"bytes,3,opt,name=crl" json:"crl,omitempty"`
+	// Fields for response to GET_NONCE.
+	Nonce            []byte `protobuf:"bytes,4,opt,name=nonce" json:"nonce,omitempty"`
 	XXX_unrecognized []byte `json:"-"`
 }
 
@@ -155,6 +162,13 @@ func (m *DomainServiceResponse) GetCrl() []byte {
 	return nil
 }
 
+func (m *DomainServiceResponse) GetNonce() []byte {
+	if m != nil {
+		return m.Nonce
+	}
+	return nil
+}
+
 type TrustedEntities struct {
 	TrustedProgramTaoNames []string `protobuf:"bytes,1,rep,name=trusted_program_tao_names" json:"trusted_program_tao_names,omitempty"`
 	TrustedHostTaoNames    []string `protobuf:"bytes,2,rep,name=trusted_host_tao_names" json:"trusted_host_tao_names,omitempty"`
@@ -206,29 +220,29 @@ func init() {
 func init() { proto.RegisterFile("service.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 369 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x6c, 0x90, 0xdf, 0x6a, 0xdb, 0x30,
-	0x14, 0xc6, 0xb1, 0x1d, 0x18, 0x3b, 0xf9, 0x83, 0xa7, 0x90, 0xc4, 0xdb, 0xc8, 0xd8, 0x3c, 0x06,
-	0xb9, 0xf2, 0xc5, 0xf6, 0x04, 0xc6, 0xd3, 0x82, 0x59, 0xfe, 0x6c, 0xae, 0xdb, 0xd2, 0x2b, 0x21,
-	0x1c, 0x35, 0x11, 0x8d, 0x2d, 0x57, 0x52, 0x0a, 0xe9, 0x53, 0xf4, 0x05, 0xfa, 0xae, 0x55, 0x9c,
-	0x98, 0xd6, 0xb4, 0x57, 0x82, 0xef, 0xf7, 0x7d, 0xe7, 0xe8, 0x3b, 0xd0, 0x55, 0x4c, 0xde, 0xf1,
-	0x8c, 0x05, 0xa5, 0x14, 0x5a, 0xa0, 0xde, 0x4a, 0xe4, 0x94, 0x17, 0xe4, 0xa4, 0xfa, 0x8f, 0x36,
-	0x0c, 0x9b, 0x12, 0x91, 0xec, 0x76, 0xc7, 0x94, 0x46, 0x21, 0xb4, 0xf4, 0xbe, 0x64, 0x9e, 0xf5,
-	0xd5, 0x9a, 0xf4, 0x7e, 0xfe, 0x0a, 0x9a, 0xb6, 0xe0, 0xed, 0x54, 0x70, 0x7a, 0xc9, 0x21, 0x8a,
-	0xbe, 0xc3, 0x67, 0xc3, 0x39, 0xdd, 0xf2, 0x7b, 0xb6, 0x22, 0x1b, 0x61, 0x74, 0xaa, 0xb5, 0xc1,
-	0x54, 0x73, 0x51, 0x78, 0xb6, 0x99, 0xdc, 0x41, 0x7d, 0x68, 0x9b, 0xbf, 0xad, 0x25, 0xcd, 0xc9,
-	0x0d, 0xdb, 0x7b, 0x4e, 0x25, 0xfe, 0x80, 0xf1, 0x8b, 0x64, 0x29, 0xb6, 0x3c, 0xdb, 0x37, 0xb2,
-	0xad, 0x83, 0xcd, 0x27, 0xd0, 0x69, 0x2c, 0x1c, 0x41, 0xff, 0xf7, 0x72, 0x1e, 0xc6, 0x0b, 0x12,
-	0xe1, 0x24, 0x25, 0x09, 0xfe, 0x7f, 0x8e, 0xcf, 0x52, 0xd7, 0x42, 0x1f, 0xa0, 0x3b, 0x0f, 0x17,
-	0xe1, 0x14, 0x93, 0x7f, 0xcb, 0x59, 0x1c, 0x5d, 0xb9, 0x36, 0x1a, 0x02, 0x4a, 0xf0, 0xc5, 0xf2,
-	0x2f, 0xae, 0xbc, 0xf1, 0x9f, 0x38, 0x0a, 0x53, 0xec, 0x3a, 0xa8, 0x0d, 0xef, 0xa6, 0x38, 0x25,
-	0x51, 0x32, 0x73, 0x5b, 0xfe, 0x25, 0x8c, 0x5e, 0x15, 0x55, 0xa5, 0x28, 0x14, 0x43, 0x03, 0xe8,
-	0x32, 0x29, 0x85, 0x24, 0x39, 0x53, 0x8a, 0xae, 0x8f, 0x87, 0x7a, 0x8f, 0x3c, 0x70, 0x57, 0x4c,
-	0x92, 0xba, 0x52, 0xc6, 0xa4, 0x3e, 0x15, 0x6d, 0x83, 0x93, 0xc9, 0xed, 0xb1, 0xa0, 0xff, 0x60,
-	0x81, 0xab, 0xe5, 0x4e, 0x69, 0x53, 0x8f, 0x15, 0x9a, 0x6b, 0xce, 0x14, 0xfa, 0x06, 0x1f, 0x6b,
-	0xad, 0xce, 0x6b, 0x2a, 0x48, 0x41, 0xcd, 0x0a, 0x33, 0xde, 0x31, 0xe3, 0xbf, 0xc0, 0xb0, 0xb6,
-	0x54, 0xf7, 0x7c, 0xe6, 0x76, 0xc5, 0xc7, 0x30, 0xa8, 0x79, 0x4e, 0xb3, 0x0d, 0x2f, 0x18, 0xe1,
-	0xc5, 0xb5, 0x50, 0x66, 0xed, 0x01, 0x7f, 0x02, 0x54, 0x63, 0x29, 0x84, 0xae, 0xbe, 0xa7, 0xcc,
-	0x31, 0x9d, 0x49, 0xe7, 0x29, 0x00, 0x00, 0xff, 0xff, 0x16, 0x20, 0x58, 0x89, 0x2b, 0x02, 0x00,
-	0x00,
+	// 383 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x6c, 0x90, 0xdd, 0x8e, 0x94, 0x30,
+	0x14, 0xc7, 0xc3, 0xc0, 0xc6, 0xcc, 0x99, 0x61, 0x83, 0xdd, 0xec, 0x2c, 0x6a, 0xd6, 0xe0, 0x18,
+	0x13, 0xae, 0xb8, 0xd0, 0x27, 0x20, 0x58, 0x37, 0xc4, 0x5d, 0x50, 0x44, 0x13, 0xaf, 0x9a, 0x06,
+	0xce, 0xee, 0x36, 0x0e, 0x2d, 0xb6, 0x1d, 0x93, 0xf1, 0x29, 0x7c, 0x10, 0x1f, 0xd2, 0x0c, 0x42,
+	0x94, 0xe8, 0x55, 0xd3, 0xff, 0x47, 0x7b, 0x7e, 0x07, 0x7c, 0x83, 0xfa, 0x9b, 0x68, 0x30, 0xe9,
+	0xb5, 0xb2, 0x8a, 0x9c, 0xb6, 0xaa, 0xe3, 0x42, 0xb2, 0x51, 0xdd, 0xfe, 0x5c, 0xc0, 0x66, 0x2e,
+	0x31, 0x8d, 0x5f, 0xf7, 0x68, 0x2c, 0x49, 0xc1, 0xb3, 0x87, 0x1e, 0x43, 0x27, 0x72, 0xe2, 0xd3,
+	0x97, 0xaf, 0x92, 0x79, 0x2c, 0xf9, 0x7f, 0x2b, 0x19, 0x4f, 0x76, 0xac, 0x92, 0xe7, 0xf0, 0xc4,
+	0xa0, 0x16, 0x7c, 0x27, 0xbe, 0x63, 0xcb, 0xee, 0x95, 0xb1, 0x8c, 0x5b, 0x8b, 0xc6, 0x72, 0x2b,
+	0x94, 0x0c, 0x17, 0x91, 0x13, 0xaf, 0xc9, 0x19, 0xac, 0x7a, 0xad, 0xee, 0x34, 0xef, 0xd8, 0x17,
+	0x3c, 0x84, 0xee, 0x20, 0xbe, 0x80, 0xcb, 0xbf, 0x9a, 0xbd, 0xda, 0x89, 0xe6, 0x30, 0xeb, 0x7a,
+	0xc7, 0xd8, 0x56, 0xc2, 0x7a, 0xf6, 0xe1, 0x05, 0x9c, 0xbd, 0x2e, 0x6f, 0xd2, 0xbc, 0x60, 0x19,
+	0xad, 0x6a, 0x56, 0xd1, 0xf7, 0x1f, 0xe9, 0x87, 0x3a, 0x70, 0xc8, 0x43, 0xf0, 0x6f, 0xd2, 0x22,
+	0xbd, 0xa2, 0xec, 0x5d, 0x79, 0x9d, 0x67, 0x9f, 0x83, 0x05, 0xd9, 0x00, 0xa9, 0xe8, 0xa7, 0xf2,
+	0x2d, 0x1d, 0xb2, 0xf9, 0x9b, 0x3c, 0x4b, 0x6b, 0x1a, 0xb8, 0x64, 0x05, 0x0f, 0xae, 0x68, 0xcd,
+	0xb2, 0xea, 0x3a, 0xf0, 0x88, 0x0f, 0xcb, 0xe3, 0xa5, 0x28, 0x8b, 0x8c, 0x06, 0x27, 0xdb, 0x5b,
+	0xb8, 0xf8, 0x87, 0xdb, 0xf4, 0x4a, 0x1a, 0x24, 0xe7, 0xe0, 0xa3, 0xd6, 0x4a, 0xb3, 0x0e, 0x8d,
+	0xe1, 0x77, 0xbf, 0xf7, 0xb6, 0x24, 0x21, 0x04, 0x2d, 0x6a, 0x36, 0x11, 0x36, 0xa8, 0xed, 0xc8,
+	0xbd, 0x02, 0xb7, 0xd1, 0xbb, 0x91, 0xd7, 0x87, 0x13, 0xa9, 0x64, 0x83, 0x23, 0xd7, 0x0f, 0x07,
+	0x02, 0xab, 0xf7, 0xc6, 0x62, 0xcb, 0x50, 0x5a, 0x61, 0x05, 0x1a, 0xf2, 0x0c, 0x1e, 0x4d, 0xda,
+	0xf4, 0x9c, 0xe5, 0x8a, 0x49, 0xde, 0xa1, 0x09, 0x9d, 0xc8, 0x8d, 0x97, 0xe4, 0x29, 0x6c, 0xa6,
+	0xc8, 0xb0, 0xed, 0x3f, 0xfe, 0x62, 0xf0, 0x2f, 0xe1, 0x7c, 0xf2, 0x3b, 0xde, 0xdc, 0x0b, 0x89,
+	0x4c, 0xc8, 0x5b, 0x65, 0x42, 0x77, 0xb0, 0x1f, 0x03, 0x99, 0x6c, 0xad, 0x94, 0x1d, 0xa6, 0x35,
+	0xa1, 0x17, 0xb9, 0xf1, 0xfa, 0xd7, 0x00, 0xea, 0x62, 0x4c, 0xa2, 0x49, 0x02, 0x00, 0x00,
 }
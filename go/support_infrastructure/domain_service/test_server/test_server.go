@@ -51,8 +51,12 @@ func main() {
 	if policyCert == nil {
 		log.Fatalln("Policy cert not found")
 	}
-	hostKey, hostAtt := generateAttestation(policyKey, hostName)
-	programKey, programAtt := generateAttestation(hostKey, programName)
+	nonce, err := domain_service.RequestNonce(*network, *addr)
+	if err != nil {
+		log.Fatalln("Error getting nonce:", err)
+	}
+	hostKey, hostAtt := generateAttestation(policyKey, hostName, nil)
+	programKey, programAtt := generateAttestation(hostKey, programName, nonce)
 	rawEnd1, err := proto.Marshal(hostAtt)
 	if err != nil {
 		log.Fatalln("Error serializing attestation.")
@@ -131,7 +135,7 @@ func generateEndorsementCertficate(policyKey *tao.Keys, policyCert *x509.Certifi
 	return k, cert
 }
 
-func generateAttestation(signingKey *tao.Keys, delegator *auth.Prin) (*tao.Keys, *tao.Attestation) {
+func generateAttestation(signingKey *tao.Keys, delegator *auth.Prin, nonce []byte) (*tao.Keys, *tao.Attestation) {
 	k, err := tao.NewTemporaryKeys(tao.Signing)
 	if k == nil || err != nil {
 		log.Fatalln("Can't generate signing key")
@@ -146,7 +150,7 @@ func generateAttestation(signingKey *tao.Keys, delegator *auth.Prin) (*tao.Keys,
 		Expiration: nil,
 		Message:    speaksFor,
 	}
-	att, err := tao.GenerateAttestation(signingKey.SigningKey, nil, *says)
+	att, err := tao.GenerateNonceAttestation(signingKey.SigningKey, nil, nonce, *says)
 	if err != nil {
 		log.Fatalln(err)
 	}
@@ -0,0 +1,59 @@
+// Copyright (c) 2016, Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verifier_service
+
+// This provides the client stub for using the verifier service.
+
+import (
+	"errors"
+	"net"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/jlmucb/cloudproxy/go/tao"
+	"github.com/jlmucb/cloudproxy/go/util"
+)
+
+// RequestAppraisal sends an attestation to the verifier service and returns
+// the signed appraisal of it. If nonce isn't nil, the attestation must carry
+// it. The caller should check the appraisal with VerifySignedAppraisal.
+func RequestAppraisal(att *tao.Attestation, nonce []byte, network, addr string) (*SignedAppraisal, error) {
+	serAtt, err := proto.Marshal(att)
+	if err != nil {
+		return nil, err
+	}
+	request := &VerifierServiceRequest{
+		SerializedAttestation: serAtt,
+		Nonce:                 nonce,
+	}
+
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	ms := util.NewMessageStream(conn)
+	if _, err := ms.WriteMessage(request); err != nil {
+		return nil, err
+	}
+	var response VerifierServiceResponse
+	if err := ms.ReadMessage(&response); err != nil {
+		return nil, err
+	}
+	if errStr := response.GetErrorMessage(); errStr != "" {
+		return nil, errors.New(errStr)
+	}
+	if response.Appraisal == nil {
+		return nil, errors.New("the verifier service sent no appraisal")
+	}
+	return response.Appraisal, nil
+}
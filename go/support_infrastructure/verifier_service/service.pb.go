@@ -0,0 +1,300 @@
+// Code generated by protoc-gen-go.
+// source: service.proto
+// DO NOT EDIT!
+
+/*
+Package verifier_service is a generated protocol buffer package.
+
+It is generated from these files:
+	service.proto
+
+It has these top-level messages:
+	VerifierServiceRequest
+	VerifierServiceResponse
+	AppraisalClaim
+	Appraisal
+	SignedAppraisal
+*/
+package verifier_service
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+// The status of one claim in an appraisal.
+type ClaimStatus int32
+
+const (
+	// The claim matches a reference value, or the root is trusted.
+	ClaimStatus_AFFIRMED ClaimStatus = 1
+	// No reference value speaks to the claim.
+	ClaimStatus_NO_REFERENCE ClaimStatus = 2
+	// The claim is contradicted, e.g. the root is not trusted.
+	ClaimStatus_REJECTED ClaimStatus = 3
+)
+
+var ClaimStatus_name = map[int32]string{
+	1: "AFFIRMED",
+	2: "NO_REFERENCE",
+	3: "REJECTED",
+}
+var ClaimStatus_value = map[string]int32{
+	"AFFIRMED":     1,
+	"NO_REFERENCE": 2,
+	"REJECTED":     3,
+}
+
+func (x ClaimStatus) Enum() *ClaimStatus {
+	p := new(ClaimStatus)
+	*p = x
+	return p
+}
+func (x ClaimStatus) String() string {
+	return proto.EnumName(ClaimStatus_name, int32(x))
+}
+func (x *ClaimStatus) UnmarshalJSON(data []byte) error {
+	value, err := proto.UnmarshalJSONEnum(ClaimStatus_value, data, "ClaimStatus")
+	if err != nil {
+		return err
+	}
+	*x = ClaimStatus(value)
+	return nil
+}
+
+type VerifierServiceRequest struct {
+	// A tao.Attestation that a key speaks for the principal to appraise.
+	SerializedAttestation []byte `protobuf:"bytes,1,opt,name=serialized_attestation" json:"serialized_attestation,omitempty"`
+	// If set, the attestation must carry this nonce, see tao.Tao.AttestNonce.
+	Nonce            []byte `protobuf:"bytes,2,opt,name=nonce" json:"nonce,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *VerifierServiceRequest) Reset()         { *m = VerifierServiceRequest{} }
+func (m *VerifierServiceRequest) String() string { return proto.CompactTextString(m) }
+func (*VerifierServiceRequest) ProtoMessage()    {}
+
+func (m *VerifierServiceRequest) GetSerializedAttestation() []byte {
+	if m != nil {
+		return m.SerializedAttestation
+	}
+	return nil
+}
+
+func (m *VerifierServiceRequest) GetNonce() []byte {
+	if m != nil {
+		return m.Nonce
+	}
+	return nil
+}
+
+type VerifierServiceResponse struct {
+	ErrorMessage     *string          `protobuf:"bytes,1,opt,name=error_message" json:"error_message,omitempty"`
+	Appraisal        *SignedAppraisal `protobuf:"bytes,2,opt,name=appraisal" json:"appraisal,omitempty"`
+	XXX_unrecognized []byte           `json:"-"`
+}
+
+func (m *VerifierServiceResponse) Reset()         { *m = VerifierServiceResponse{} }
+func (m *VerifierServiceResponse) String() string { return proto.CompactTextString(m) }
+func (*VerifierServiceResponse) ProtoMessage()    {}
+
+func (m *VerifierServiceResponse) GetErrorMessage() string {
+	if m != nil && m.ErrorMessage != nil {
+		return *m.ErrorMessage
+	}
+	return ""
+}
+
+func (m *VerifierServiceResponse) GetAppraisal() *SignedAppraisal {
+	if m != nil {
+		return m.Appraisal
+	}
+	return nil
+}
+
+// The appraisal of one layer of an attested principal: its root, or one of its
+// subprincipal extensions, e.g. the PCRs of a TPM, a LinuxHost or a Program.
+type AppraisalClaim struct {
+	// "root", or the text form of the extension, e.g. ".Program(1, [...])".
+	Layer  *string      `protobuf:"bytes,1,opt,name=layer" json:"layer,omitempty"`
+	Status *ClaimStatus `protobuf:"varint,2,opt,name=status,enum=verifier_service.ClaimStatus" json:"status,omitempty"`
+	// The manifest name and version and the reference value name that affirm
+	// the claim, e.g. "release 1.2: demo_server".
+	Reference *string `protobuf:"bytes,3,opt,name=reference" json:"reference,omitempty"`
+	// Why the claim was rejected.
+	Detail           *string `protobuf:"bytes,4,opt,name=detail" json:"detail,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *AppraisalClaim) Reset()         { *m = AppraisalClaim{} }
+func (m *AppraisalClaim) String() string { return proto.CompactTextString(m) }
+func (*AppraisalClaim) ProtoMessage()    {}
+
+func (m *AppraisalClaim) GetLayer() string {
+	if m != nil && m.Layer != nil {
+		return *m.Layer
+	}
+	return ""
+}
+
+func (m *AppraisalClaim) GetStatus() ClaimStatus {
+	if m != nil && m.Status != nil {
+		return *m.Status
+	}
+	return ClaimStatus_AFFIRMED
+}
+
+func (m *AppraisalClaim) GetReference() string {
+	if m != nil && m.Reference != nil {
+		return *m.Reference
+	}
+	return ""
+}
+
+func (m *AppraisalClaim) GetDetail() string {
+	if m != nil && m.Detail != nil {
+		return *m.Detail
+	}
+	return ""
+}
+
+type Appraisal struct {
+	// The appraised principal, serialized with auth.Marshal.
+	Subject []byte `protobuf:"bytes,1,opt,name=subject" json:"subject,omitempty"`
+	// The key that speaks for the subject, serialized with auth.Marshal.
+	SubjectKey []byte `protobuf:"bytes,2,opt,name=subject_key" json:"subject_key,omitempty"`
+	// The SHA-256 hash of the serialized attestation.
+	AttestationHash []byte `protobuf:"bytes,3,opt,name=attestation_hash" json:"attestation_hash,omitempty"`
+	// The nonce that the attestation carried, if any.
+	Nonce  []byte            `protobuf:"bytes,4,opt,name=nonce" json:"nonce,omitempty"`
+	Claims []*AppraisalClaim `protobuf:"bytes,5,rep,name=claims" json:"claims,omitempty"`
+	// Whether every claim is AFFIRMED.
+	Affirmed *bool `protobuf:"varint,6,opt,name=affirmed" json:"affirmed,omitempty"`
+	// When the appraisal was made, and when the attestation expires, in
+	// nanoseconds since the epoch.
+	Time             *int64 `protobuf:"varint,7,opt,name=time" json:"time,omitempty"`
+	Expiration       *int64 `protobuf:"varint,8,opt,name=expiration" json:"expiration,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *Appraisal) Reset()         { *m = Appraisal{} }
+func (m *Appraisal) String() string { return proto.CompactTextString(m) }
+func (*Appraisal) ProtoMessage()    {}
+
+func (m *Appraisal) GetSubject() []byte {
+	if m != nil {
+		return m.Subject
+	}
+	return nil
+}
+
+func (m *Appraisal) GetSubjectKey() []byte {
+	if m != nil {
+		return m.SubjectKey
+	}
+	return nil
+}
+
+func (m *Appraisal) GetAttestationHash() []byte {
+	if m != nil {
+		return m.AttestationHash
+	}
+	return nil
+}
+
+func (m *Appraisal) GetNonce() []byte {
+	if m != nil {
+		return m.Nonce
+	}
+	return nil
+}
+
+func (m *Appraisal) GetClaims() []*AppraisalClaim {
+	if m != nil {
+		return m.Claims
+	}
+	return nil
+}
+
+func (m *Appraisal) GetAffirmed() bool {
+	if m != nil && m.Affirmed != nil {
+		return *m.Affirmed
+	}
+	return false
+}
+
+func (m *Appraisal) GetTime() int64 {
+	if m != nil && m.Time != nil {
+		return *m.Time
+	}
+	return 0
+}
+
+func (m *Appraisal) GetExpiration() int64 {
+	if m != nil && m.Expiration != nil {
+		return *m.Expiration
+	}
+	return 0
+}
+
+type SignedAppraisal struct {
+	SerializedAppraisal []byte `protobuf:"bytes,1,opt,name=serialized_appraisal" json:"serialized_appraisal,omitempty"`
+	Signature           []byte `protobuf:"bytes,2,opt,name=signature" json:"signature,omitempty"`
+	// The verifier's key, serialized with tao.Verifier.MarshalKey, and a
+	// tao.Attestation from the verifier's host that the key speaks for the
+	// verifier.
+	SignerKey            []byte `protobuf:"bytes,3,opt,name=signer_key" json:"signer_key,omitempty"`
+	SerializedDelegation []byte `protobuf:"bytes,4,opt,name=serialized_delegation" json:"serialized_delegation,omitempty"`
+	XXX_unrecognized     []byte `json:"-"`
+}
+
+func (m *SignedAppraisal) Reset()         { *m = SignedAppraisal{} }
+func (m *SignedAppraisal) String() string { return proto.CompactTextString(m) }
+func (*SignedAppraisal) ProtoMessage()    {}
+
+func (m *SignedAppraisal) GetSerializedAppraisal() []byte {
+	if m != nil {
+		return m.SerializedAppraisal
+	}
+	return nil
+}
+
+func (m *SignedAppraisal) GetSignature() []byte {
+	if m != nil {
+		return m.Signature
+	}
+	return nil
+}
+
+func (m *SignedAppraisal) GetSignerKey() []byte {
+	if m != nil {
+		return m.SignerKey
+	}
+	return nil
+}
+
+func (m *SignedAppraisal) GetSerializedDelegation() []byte {
+	if m != nil {
+		return m.SerializedDelegation
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*VerifierServiceRequest)(nil), "verifier_service.verifier_service_request")
+	proto.RegisterType((*VerifierServiceResponse)(nil), "verifier_service.verifier_service_response")
+	proto.RegisterType((*AppraisalClaim)(nil), "verifier_service.appraisal_claim")
+	proto.RegisterType((*Appraisal)(nil), "verifier_service.appraisal")
+	proto.RegisterType((*SignedAppraisal)(nil), "verifier_service.signed_appraisal")
+	proto.RegisterEnum("verifier_service.ClaimStatus", ClaimStatus_name, ClaimStatus_value)
+}
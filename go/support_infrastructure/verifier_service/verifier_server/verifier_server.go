@@ -0,0 +1,115 @@
+// Copyright (c) 2016, Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The verifier server is a hosted program that appraises attestation chains
+// against signed reference manifests, and signs its appraisals with a key that
+// its host attests to.
+package main
+
+import (
+	"crypto/x509"
+	"flag"
+	"io/ioutil"
+	"log"
+	"net"
+	"strings"
+
+	"github.com/jlmucb/cloudproxy/go/tao"
+	"github.com/jlmucb/cloudproxy/go/tao/auth"
+	"github.com/jlmucb/cloudproxy/go/util"
+
+	"github.com/jlmucb/cloudproxy/go/support_infrastructure/verifier_service"
+)
+
+var network = flag.String("network", "tcp", "The network to use for connections")
+var addr = flag.String("addr", "localhost:8125", "The address to listen on")
+var configPath = flag.String("domain_config", "./tao.config", "The Tao domain config file")
+var buildCertPath = flag.String("build_cert", "", "The DER certificate of the key that signs reference manifests")
+var manifestPaths = flag.String("manifests", "", "A comma-separated list of signed reference manifests")
+
+func main() {
+	flag.Parse()
+	if tao.Parent() == nil {
+		log.Fatalln("verifier_server: no host Tao available")
+	}
+
+	// Only the public policy key is needed: it is a trusted root, and it
+	// endorses the roots of hosts, e.g. TPM AIKs.
+	domain, err := tao.LoadDomain(*configPath, nil)
+	if err != nil {
+		log.Fatalln("verifier_server: could not load domain:", err)
+	}
+	endorsers := x509.NewCertPool()
+	endorsers.AddCert(domain.Keys.Cert)
+	appraiser := verifier_service.NewAppraiser(
+		[]auth.Prin{domain.Keys.VerifyingKey.ToPrincipal()}, endorsers)
+	appraiser.Revocation = domain.Revocations
+
+	if *manifestPaths != "" {
+		der, err := ioutil.ReadFile(*buildCertPath)
+		if err != nil {
+			log.Fatalln("verifier_server: could not read the build key certificate:", err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			log.Fatalln("verifier_server: could not parse the build key certificate:", err)
+		}
+		buildKey, err := tao.FromX509(cert)
+		if err != nil {
+			log.Fatalln("verifier_server: bad build key:", err)
+		}
+		for _, p := range strings.Split(*manifestPaths, ",") {
+			m, err := tao.LoadReferenceManifest(buildKey, p)
+			if err != nil {
+				log.Fatalf("verifier_server: could not load manifest %s: %s\n", p, err)
+			}
+			if err := appraiser.AddManifest(m); err != nil {
+				log.Fatalf("verifier_server: bad manifest %s: %s\n", p, err)
+			}
+			log.Printf("verifier_server: loaded manifest %s %s\n", m.GetName(), m.GetVersion())
+		}
+	}
+
+	keys, err := tao.NewTemporaryTaoDelegatedKeys(tao.Signing, tao.Parent())
+	if err != nil {
+		log.Fatalln("verifier_server: could not create delegated keys:", err)
+	}
+
+	ln, err := net.Listen(*network, *addr)
+	if err != nil {
+		log.Fatalln("verifier_server: could not listen at port:", err)
+	}
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			log.Fatalln("verifier_server: could not accept connection:", err)
+		}
+		go handle(conn, appraiser, keys)
+	}
+}
+
+func handle(conn net.Conn, appraiser *verifier_service.Appraiser, keys *tao.Keys) {
+	defer conn.Close()
+	ms := util.NewMessageStream(conn)
+	var request verifier_service.VerifierServiceRequest
+	if err := ms.ReadMessage(&request); err != nil {
+		log.Printf("verifier_server: Couldn't read request from channel: %s\n", err)
+		return
+	}
+	resp := appraiser.HandleRequest(&request, keys)
+	if errStr := resp.GetErrorMessage(); errStr != "" {
+		log.Printf("verifier_server: Error appraising attestation: %s\n", errStr)
+	}
+	if _, err := ms.WriteMessage(resp); err != nil {
+		log.Printf("verifier_server: Error sending response on the channel: %s\n", err)
+	}
+}
@@ -0,0 +1,394 @@
+// Copyright (c) 2016, Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verifier_service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/jlmucb/cloudproxy/go/tao"
+	"github.com/jlmucb/cloudproxy/go/tao/auth"
+)
+
+// AppraisalSigningContext is the context used to sign an Appraisal.
+const AppraisalSigningContext = "verifier_service.Appraisal Version 1"
+
+// RootLayer is the layer of the claim about the root of an attested
+// principal, e.g. a TPM AIK or the key of a soft Tao.
+const RootLayer = "root"
+
+// An Appraiser appraises attestation chains. The root of the attested
+// principal must be trusted, either directly or through an endorsement
+// certificate, and each of its subprincipal extensions, e.g. the PCRs of a
+// TPM, a LinuxHost or a Program, is matched against the reference values in
+// signed reference manifests, see tao.LoadReferenceManifest.
+type Appraiser struct {
+	// TrustedRoots are root principals, e.g. the policy key or the key of a
+	// soft Tao, that are trusted without an endorsement.
+	TrustedRoots []auth.Prin
+
+	// Endorsers, if not nil, holds certificates, e.g. the policy key's, that
+	// can endorse the root of a chain, e.g. a TPM AIK, see
+	// tao.Attestation.RootEndorsement.
+	Endorsers *x509.CertPool
+
+	// Revocation, if not nil, is consulted about each link of an attestation
+	// chain, e.g. the domain's revocation list, see tao.Domain.Revocations.
+	Revocation tao.RevocationChecker
+
+	m          sync.RWMutex
+	references []reference
+}
+
+// A reference is a reference value from a manifest.
+type reference struct {
+	subprin auth.SubPrin
+	// name is the manifest name and version and the reference value name.
+	name string
+}
+
+// NewAppraiser returns an appraiser that has no reference values yet.
+func NewAppraiser(roots []auth.Prin, endorsers *x509.CertPool) *Appraiser {
+	return &Appraiser{TrustedRoots: roots, Endorsers: endorsers}
+}
+
+// AddManifest adds the reference values in a manifest, which the caller must
+// already have checked the signature on, e.g. with tao.LoadReferenceManifest.
+func (ap *Appraiser) AddManifest(m *tao.ReferenceManifest) error {
+	var refs []reference
+	for _, v := range m.Values {
+		subprin, err := v.SubPrin()
+		if err != nil {
+			return err
+		}
+		refs = append(refs, reference{
+			subprin: subprin,
+			name:    fmt.Sprintf("%s %s: %s", m.GetName(), m.GetVersion(), v.GetName()),
+		})
+	}
+	ap.m.Lock()
+	defer ap.m.Unlock()
+	ap.references = append(ap.references, refs...)
+	return nil
+}
+
+// extMatches checks whether an extension of an attested principal matches one
+// from a reference value. Hosts number their hosted programs, e.g. Program(1,
+// [...]), but a reference value names only the code, e.g. Program([...]), so
+// a leading ID in the extension is ignored if the reference value has none.
+func extMatches(ext, ref auth.PrinExt) bool {
+	if ext.Identical(ref) {
+		return true
+	}
+	if ext.Name != ref.Name || len(ext.Arg) != len(ref.Arg)+1 {
+		return false
+	}
+	if _, ok := ext.Arg[0].(auth.Int); !ok {
+		return false
+	}
+	return auth.PrinExt{Name: ext.Name, Arg: ext.Arg[1:]}.Identical(ref)
+}
+
+// match finds the reference value that matches the most extensions at the
+// start of exts, and returns its name and the number of extensions it
+// matches, or 0 if no reference value matches.
+func (ap *Appraiser) match(exts auth.SubPrin) (string, int) {
+	ap.m.RLock()
+	defer ap.m.RUnlock()
+	var name string
+	var n int
+	for _, ref := range ap.references {
+		if len(ref.subprin) <= n || len(ref.subprin) > len(exts) {
+			continue
+		}
+		matches := true
+		for i, e := range ref.subprin {
+			if !extMatches(exts[i], e) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			name, n = ref.name, len(ref.subprin)
+		}
+	}
+	return name, n
+}
+
+// rootLink returns the last link of the attestation chain that starts with a,
+// i.e. the one signed by the root of the chain.
+func rootLink(a *tao.Attestation) (*tao.Attestation, error) {
+	for a.SerializedDelegation != nil {
+		var da tao.Attestation
+		if err := proto.Unmarshal(a.SerializedDelegation, &da); err != nil {
+			return nil, err
+		}
+		a = &da
+	}
+	return a, nil
+}
+
+// appraiseRoot checks that root is trusted, or that the root link of the chain
+// that starts with a carries a certificate for it from one of the endorsers.
+func (ap *Appraiser) appraiseRoot(a *tao.Attestation, root auth.Prin) *AppraisalClaim {
+	claim := &AppraisalClaim{Layer: proto.String(RootLayer)}
+	for _, p := range ap.TrustedRoots {
+		if p.Identical(root) {
+			claim.Status = ClaimStatus_AFFIRMED.Enum()
+			claim.Reference = proto.String("trusted root " + p.String())
+			return claim
+		}
+	}
+	if err := ap.checkEndorsement(a, root); err != nil {
+		claim.Status = ClaimStatus_REJECTED.Enum()
+		claim.Detail = proto.String(err.Error())
+		return claim
+	}
+	claim.Status = ClaimStatus_AFFIRMED.Enum()
+	claim.Reference = proto.String("endorsement certificate")
+	return claim
+}
+
+// checkEndorsement checks the endorsement certificate for root in the chain
+// that starts with a.
+func (ap *Appraiser) checkEndorsement(a *tao.Attestation, root auth.Prin) error {
+	if ap.Endorsers == nil {
+		return errors.New("the root is not trusted")
+	}
+	ra, err := rootLink(a)
+	if err != nil {
+		return err
+	}
+	if !auth.NewPrin(ra.GetSignerType(), ra.SignerKey).Identical(root) {
+		return errors.New("the root link of the chain is not signed by the root")
+	}
+	if ra.RootEndorsement == nil {
+		return errors.New("the root is not trusted and has no endorsement certificate")
+	}
+	cert, err := x509.ParseCertificate(ra.RootEndorsement)
+	if err != nil {
+		return err
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: ap.Endorsers}); err != nil {
+		return err
+	}
+	switch ra.GetSignerType() {
+	case "tpm", "tpm2":
+		if !bytes.Equal(cert.RawSubjectPublicKeyInfo, ra.SignerKey) {
+			return errors.New("the endorsement certificate is for a different TPM key")
+		}
+	default:
+		v, err := tao.UnmarshalKey(ra.SignerKey)
+		if err != nil {
+			return err
+		}
+		if !v.Equals(cert) {
+			return errors.New("the endorsement certificate is for a different key")
+		}
+	}
+	return nil
+}
+
+// speaksfor returns the delegation in the message of an attestation.
+func speaksfor(f auth.Form) (auth.Speaksfor, bool) {
+	if ptr, ok := f.(*auth.Speaksfor); ok {
+		return *ptr, true
+	}
+	sf, ok := f.(auth.Speaksfor)
+	return sf, ok
+}
+
+// Appraise checks the signatures on an attestation that a key speaks for a
+// principal, and appraises each layer of the principal. If nonce isn't nil,
+// the attestation must carry it, see tao.Tao.AttestNonce. An attestation that
+// doesn't pass these checks, or that Revocation rejects, is an error, while an
+// appraisal that has a claim that isn't AFFIRMED is not.
+func (ap *Appraiser) Appraise(a *tao.Attestation, nonce []byte) (*Appraisal, error) {
+	var stmt auth.Says
+	var err error
+	if nonce != nil {
+		stmt, err = a.ValidateNonce(nonce)
+	} else {
+		stmt, err = a.Validate()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := tao.CheckChainRevocation(ap.Revocation, a); err != nil {
+		return nil, err
+	}
+	now := time.Now().UnixNano()
+	if stmt.Expiration != nil && now >= *stmt.Expiration {
+		return nil, errors.New("the attestation has expired")
+	}
+
+	sf, ok := speaksfor(stmt.Message)
+	if !ok {
+		return nil, errors.New("the attestation must have an auth.Speaksfor as a message")
+	}
+	subject, ok := sf.Delegator.(auth.Prin)
+	if !ok {
+		return nil, errors.New("the attestation must have an auth.Prin as its delegator")
+	}
+	key, ok := sf.Delegate.(auth.Prin)
+	if !ok || key.Type != "key" {
+		return nil, errors.New("the attestation must have a key principal as its delegate")
+	}
+	if !auth.SubprinOrIdentical(subject, stmt.Speaker) {
+		return nil, errors.New("the speaker of the attestation can't speak for its delegator")
+	}
+
+	ser, err := proto.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(ser)
+	appraisal := &Appraisal{
+		Subject:         auth.Marshal(subject),
+		SubjectKey:      auth.Marshal(key),
+		AttestationHash: hash[:],
+		Nonce:           a.Nonce,
+		Time:            proto.Int64(now),
+		Expiration:      stmt.Expiration,
+	}
+
+	root := auth.Prin{Type: subject.Type, KeyHash: subject.KeyHash}
+	claims := []*AppraisalClaim{ap.appraiseRoot(a, root)}
+	for exts := subject.Ext; len(exts) > 0; {
+		name, n := ap.match(exts)
+		if n == 0 {
+			claims = append(claims, &AppraisalClaim{
+				Layer:  proto.String(exts[:1].String()),
+				Status: ClaimStatus_NO_REFERENCE.Enum(),
+			})
+			exts = exts[1:]
+			continue
+		}
+		claims = append(claims, &AppraisalClaim{
+			Layer:     proto.String(exts[:n].String()),
+			Status:    ClaimStatus_AFFIRMED.Enum(),
+			Reference: proto.String(name),
+		})
+		exts = exts[n:]
+	}
+
+	affirmed := true
+	for _, c := range claims {
+		if c.GetStatus() != ClaimStatus_AFFIRMED {
+			affirmed = false
+		}
+	}
+	appraisal.Claims = claims
+	appraisal.Affirmed = proto.Bool(affirmed)
+	return appraisal, nil
+}
+
+// SignAppraisal signs an appraisal with keys, which should be delegated keys
+// of the verifier, see tao.NewTemporaryTaoDelegatedKeys.
+func SignAppraisal(appraisal *Appraisal, keys *tao.Keys) (*SignedAppraisal, error) {
+	ser, err := proto.Marshal(appraisal)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := keys.SigningKey.Sign(ser, AppraisalSigningContext)
+	if err != nil {
+		return nil, err
+	}
+	sa := &SignedAppraisal{
+		SerializedAppraisal: ser,
+		Signature:           sig,
+		SignerKey:           keys.VerifyingKey.MarshalKey(),
+	}
+	if keys.Delegation != nil {
+		if sa.SerializedDelegation, err = proto.Marshal(keys.Delegation); err != nil {
+			return nil, err
+		}
+	}
+	return sa, nil
+}
+
+// VerifySignedAppraisal checks the signature on an appraisal and returns the
+// appraisal and the principal that signed it: the verifier that delegated to
+// the signing key, if the appraisal carries a delegation, or else the key. It
+// is up to the caller to decide whether it trusts that principal, e.g. by
+// asking its guard.
+func VerifySignedAppraisal(sa *SignedAppraisal) (*Appraisal, auth.Prin, error) {
+	v, err := tao.UnmarshalKey(sa.SignerKey)
+	if err != nil {
+		return nil, auth.Prin{}, err
+	}
+	ok, err := v.Verify(sa.SerializedAppraisal, AppraisalSigningContext, sa.Signature)
+	if err != nil {
+		return nil, auth.Prin{}, err
+	}
+	if !ok {
+		return nil, auth.Prin{}, errors.New("the signature on the appraisal didn't pass verification")
+	}
+	var appraisal Appraisal
+	if err := proto.Unmarshal(sa.SerializedAppraisal, &appraisal); err != nil {
+		return nil, auth.Prin{}, err
+	}
+	signer := v.ToPrincipal()
+	if sa.SerializedDelegation == nil {
+		return &appraisal, signer, nil
+	}
+
+	var da tao.Attestation
+	if err := proto.Unmarshal(sa.SerializedDelegation, &da); err != nil {
+		return nil, auth.Prin{}, err
+	}
+	stmt, err := da.Validate()
+	if err != nil {
+		return nil, auth.Prin{}, err
+	}
+	if stmt.Expiration != nil && time.Now().UnixNano() >= *stmt.Expiration {
+		return nil, auth.Prin{}, errors.New("the delegation to the appraisal key has expired")
+	}
+	sf, ok := speaksfor(stmt.Message)
+	if !ok || !sf.Delegate.Identical(signer) {
+		return nil, auth.Prin{}, errors.New("the delegation is not to the appraisal key")
+	}
+	verifier, ok := sf.Delegator.(auth.Prin)
+	if !ok || !auth.SubprinOrIdentical(verifier, stmt.Speaker) {
+		return nil, auth.Prin{}, errors.New("the delegation to the appraisal key is invalid")
+	}
+	return &appraisal, verifier, nil
+}
+
+// HandleRequest appraises the attestation in a request and returns a response
+// that carries the appraisal signed with keys, or an error message.
+func (ap *Appraiser) HandleRequest(request *VerifierServiceRequest, keys *tao.Keys) *VerifierServiceResponse {
+	sa, err := ap.appraiseRequest(request, keys)
+	if err != nil {
+		return &VerifierServiceResponse{ErrorMessage: proto.String(err.Error())}
+	}
+	return &VerifierServiceResponse{Appraisal: sa}
+}
+
+func (ap *Appraiser) appraiseRequest(request *VerifierServiceRequest, keys *tao.Keys) (*SignedAppraisal, error) {
+	var a tao.Attestation
+	if err := proto.Unmarshal(request.GetSerializedAttestation(), &a); err != nil {
+		return nil, err
+	}
+	appraisal, err := ap.Appraise(&a, request.GetNonce())
+	if err != nil {
+		return nil, err
+	}
+	return SignAppraisal(appraisal, keys)
+}
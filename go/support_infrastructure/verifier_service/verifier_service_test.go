@@ -0,0 +1,261 @@
+// Copyright (c) 2016, Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verifier_service
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/jlmucb/cloudproxy/go/tao"
+	"github.com/jlmucb/cloudproxy/go/tao/auth"
+)
+
+var hostHash = sha256.Sum256([]byte("linux_host"))
+var programHash = sha256.Sum256([]byte("demo_server"))
+
+var hostSubprin = auth.SubPrin{auth.PrinExt{Name: "LinuxHost", Arg: []auth.Term{auth.Bytes(hostHash[:])}}}
+
+func newKeys(t *testing.T) *tao.Keys {
+	k, err := tao.NewTemporaryKeys(tao.Signing)
+	if err != nil {
+		t.Fatalf("couldn't create a signing key: %s", err)
+	}
+	return k
+}
+
+// newTestAttestation returns an attestation by root that a new key speaks for
+// a program with ID 1 on a LinuxHost on root.
+func newTestAttestation(t *testing.T, root *tao.Keys, nonce []byte) *tao.Attestation {
+	subject := root.SigningKey.ToPrincipal().MakeSubprincipal(hostSubprin)
+	subject = subject.MakeSubprincipal(tao.FormatProcessSubprin(1, programHash[:]))
+	a, err := tao.GenerateNonceAttestation(root.SigningKey, nil, nonce, auth.Says{
+		Speaker: subject,
+		Message: auth.Speaksfor{Delegate: newKeys(t).SigningKey.ToPrincipal(), Delegator: subject},
+	})
+	if err != nil {
+		t.Fatalf("couldn't generate an attestation: %s", err)
+	}
+	return a
+}
+
+func newTestManifest(t *testing.T, build *tao.Keys, values ...*tao.ReferenceValue) *tao.ReferenceManifest {
+	m := &tao.ReferenceManifest{
+		Name:    proto.String("release"),
+		Version: proto.String("1.0"),
+		Values:  values,
+	}
+	srm, err := m.Sign(build.SigningKey)
+	if err != nil {
+		t.Fatalf("couldn't sign the manifest: %s", err)
+	}
+	m, err = tao.VerifyReferenceManifest(build.VerifyingKey, srm)
+	if err != nil {
+		t.Fatalf("couldn't verify the manifest: %s", err)
+	}
+	return m
+}
+
+func claimStatuses(a *Appraisal) []ClaimStatus {
+	var statuses []ClaimStatus
+	for _, c := range a.Claims {
+		statuses = append(statuses, c.GetStatus())
+	}
+	return statuses
+}
+
+func checkStatuses(t *testing.T, a *Appraisal, affirmed bool, want ...ClaimStatus) {
+	got := claimStatuses(a)
+	if a.GetAffirmed() != affirmed || len(got) != len(want) {
+		t.Fatalf("got an appraisal (affirmed %v) with claims %v, want (affirmed %v) %v", a.GetAffirmed(), got, affirmed, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got claims %v, want %v", got, want)
+		}
+	}
+}
+
+func TestAppraise(t *testing.T) {
+	root := newKeys(t)
+	build := newKeys(t)
+	a := newTestAttestation(t, root, nil)
+	ap := NewAppraiser([]auth.Prin{root.SigningKey.ToPrincipal()}, nil)
+
+	program := tao.NewReferenceValue("demo_server", "1.0", programHash[:], tao.FormatProcessSubprin(0, programHash[:]))
+	if err := ap.AddManifest(newTestManifest(t, build, program)); err != nil {
+		t.Fatalf("couldn't add the manifest: %s", err)
+	}
+	appraisal, err := ap.Appraise(a, nil)
+	if err != nil {
+		t.Fatalf("couldn't appraise the attestation: %s", err)
+	}
+	checkStatuses(t, appraisal, false, ClaimStatus_AFFIRMED, ClaimStatus_NO_REFERENCE, ClaimStatus_AFFIRMED)
+	if ref := appraisal.Claims[2].GetReference(); ref != "release 1.0: demo_server" {
+		t.Fatalf("the program claim has reference %q", ref)
+	}
+
+	host := tao.NewReferenceValue("linux_host", "1.0", hostHash[:], hostSubprin)
+	if err := ap.AddManifest(newTestManifest(t, build, host)); err != nil {
+		t.Fatalf("couldn't add the manifest: %s", err)
+	}
+	if appraisal, err = ap.Appraise(a, nil); err != nil {
+		t.Fatalf("couldn't appraise the attestation: %s", err)
+	}
+	checkStatuses(t, appraisal, true, ClaimStatus_AFFIRMED, ClaimStatus_AFFIRMED, ClaimStatus_AFFIRMED)
+	subject, err := auth.UnmarshalPrin(appraisal.Subject)
+	if err != nil {
+		t.Fatalf("couldn't unmarshal the subject: %s", err)
+	}
+	if len(subject.Ext) != 2 || subject.Ext[0].Name != "LinuxHost" {
+		t.Fatalf("the appraisal has the wrong subject %s", subject)
+	}
+
+	// An attestation from a revoked root is an error.
+	ap.Revocation = tao.NewRevokedPrincipals(root.SigningKey.ToPrincipal())
+	if _, err := ap.Appraise(a, nil); err == nil {
+		t.Fatal("an attestation from a revoked root was appraised")
+	}
+
+	// A root that isn't trusted is rejected.
+	other := NewAppraiser(nil, nil)
+	if err := other.AddManifest(newTestManifest(t, build, host, program)); err != nil {
+		t.Fatalf("couldn't add the manifest: %s", err)
+	}
+	if appraisal, err = other.Appraise(a, nil); err != nil {
+		t.Fatalf("couldn't appraise the attestation: %s", err)
+	}
+	checkStatuses(t, appraisal, false, ClaimStatus_REJECTED, ClaimStatus_AFFIRMED, ClaimStatus_AFFIRMED)
+}
+
+func TestAppraiseEndorsedRoot(t *testing.T) {
+	root := newKeys(t)
+	policy := newKeys(t)
+	policyCert, err := policy.SigningKey.CreateSelfSignedX509(&pkix.Name{Organization: []string{"Policy"}})
+	if err != nil {
+		t.Fatalf("couldn't create a policy certificate: %s", err)
+	}
+	endorsers := x509.NewCertPool()
+	endorsers.AddCert(policyCert)
+	ap := NewAppraiser(nil, endorsers)
+
+	a := newTestAttestation(t, root, nil)
+	appraisal, err := ap.Appraise(a, nil)
+	if err != nil {
+		t.Fatalf("couldn't appraise the attestation: %s", err)
+	}
+	if claimStatuses(appraisal)[0] != ClaimStatus_REJECTED {
+		t.Fatal("a root without an endorsement was affirmed")
+	}
+
+	cert, err := policy.SigningKey.CreateSignedX509(policyCert, 1, root.VerifyingKey, &pkix.Name{Organization: []string{"Host"}})
+	if err != nil {
+		t.Fatalf("couldn't create a root certificate: %s", err)
+	}
+	a.RootEndorsement = cert.Raw
+	if appraisal, err = ap.Appraise(a, nil); err != nil {
+		t.Fatalf("couldn't appraise the attestation: %s", err)
+	}
+	if claimStatuses(appraisal)[0] != ClaimStatus_AFFIRMED {
+		t.Fatalf("an endorsed root was not affirmed: %s", appraisal.Claims[0].GetDetail())
+	}
+
+	cert, err = policy.SigningKey.CreateSignedX509(policyCert, 2, policy.VerifyingKey, &pkix.Name{Organization: []string{"Host"}})
+	if err != nil {
+		t.Fatalf("couldn't create a certificate: %s", err)
+	}
+	a.RootEndorsement = cert.Raw
+	if appraisal, err = ap.Appraise(a, nil); err != nil {
+		t.Fatalf("couldn't appraise the attestation: %s", err)
+	}
+	if claimStatuses(appraisal)[0] != ClaimStatus_REJECTED {
+		t.Fatal("a root was affirmed by a certificate for another key")
+	}
+}
+
+func TestAppraiseNonce(t *testing.T) {
+	root := newKeys(t)
+	ap := NewAppraiser([]auth.Prin{root.SigningKey.ToPrincipal()}, nil)
+	nonce, err := tao.NewNonce()
+	if err != nil {
+		t.Fatalf("couldn't create a nonce: %s", err)
+	}
+	a := newTestAttestation(t, root, nonce)
+	appraisal, err := ap.Appraise(a, nonce)
+	if err != nil {
+		t.Fatalf("couldn't appraise the attestation: %s", err)
+	}
+	if string(appraisal.Nonce) != string(nonce) {
+		t.Fatal("the appraisal doesn't carry the nonce")
+	}
+	other, err := tao.NewNonce()
+	if err != nil {
+		t.Fatalf("couldn't create a nonce: %s", err)
+	}
+	if _, err := ap.Appraise(a, other); err == nil {
+		t.Fatal("an attestation with the wrong nonce was appraised")
+	}
+	if _, err := ap.Appraise(newTestAttestation(t, root, nil), nonce); err == nil {
+		t.Fatal("an attestation without a nonce was appraised")
+	}
+}
+
+func TestSignedAppraisal(t *testing.T) {
+	root := newKeys(t)
+	ap := NewAppraiser([]auth.Prin{root.SigningKey.ToPrincipal()}, nil)
+	ser, err := proto.Marshal(newTestAttestation(t, root, nil))
+	if err != nil {
+		t.Fatalf("couldn't marshal the attestation: %s", err)
+	}
+
+	st, err := tao.NewSoftTao("", nil)
+	if err != nil {
+		t.Fatalf("couldn't create a soft Tao: %s", err)
+	}
+	keys, err := tao.NewTemporaryTaoDelegatedKeys(tao.Signing, st)
+	if err != nil {
+		t.Fatalf("couldn't create delegated keys: %s", err)
+	}
+	resp := ap.HandleRequest(&VerifierServiceRequest{SerializedAttestation: ser}, keys)
+	if resp.GetErrorMessage() != "" {
+		t.Fatalf("couldn't appraise the attestation: %s", resp.GetErrorMessage())
+	}
+	appraisal, signer, err := VerifySignedAppraisal(resp.Appraisal)
+	if err != nil {
+		t.Fatalf("couldn't verify the signed appraisal: %s", err)
+	}
+	verifier, err := st.GetTaoName()
+	if err != nil {
+		t.Fatalf("couldn't get the verifier's name: %s", err)
+	}
+	if !signer.Identical(verifier) {
+		t.Fatalf("the appraisal was signed by %s, want %s", signer, verifier)
+	}
+	if len(appraisal.Claims) != 3 {
+		t.Fatalf("the appraisal has %d claims, want 3", len(appraisal.Claims))
+	}
+
+	resp.Appraisal.Signature[0] ^= 0xff
+	if _, _, err := VerifySignedAppraisal(resp.Appraisal); err == nil {
+		t.Fatal("an appraisal with a bad signature was verified")
+	}
+
+	resp = ap.HandleRequest(&VerifierServiceRequest{SerializedAttestation: []byte("garbage")}, keys)
+	if resp.GetErrorMessage() == "" {
+		t.Fatal("a bad attestation was appraised")
+	}
+}
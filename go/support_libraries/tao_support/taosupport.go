@@ -69,6 +69,10 @@ type TaoProgramData struct {
 
 	// Path for program to read and write files.
 	ProgramFilePath *string
+
+	// Checker for the domain service's CRL, which revokes the program certs
+	// it issued. Nil when the certs come from SimpleDomainService.
+	CRL *tao.CRLChecker
 }
 
 // Support functions
@@ -107,6 +111,7 @@ func (pp *TaoProgramData) ClearTaoProgramData() {
 	ZeroBytes(pp.ProgramSymKeys)
 	ZeroBytes(pp.ProgramCert)
 	pp.ProgramFilePath = nil
+	pp.CRL = nil
 }
 
 func (pp *TaoProgramData) FillTaoProgramData(keySetType string, policyCert []byte, taoName string,
@@ -220,7 +225,17 @@ func InitializeSealedProgramKey(filePath string, t tao.Tao, domain tao.Domain, u
 		}
 		k.Cert.Raw = programCert
 	} else {
-		cert, err := domain_service.RequestProgramCert(k.Delegation, k.VerifyingKey, "tcp", caAddr)
+		// Attest to the program key afresh, with a nonce from the domain
+		// service, so the service knows the attestation isn't replayed.
+		nonce, err := domain_service.RequestNonce("tcp", caAddr)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		delegation, err := AttestKeyWithNonce(t, k, nonce)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		cert, err := domain_service.RequestProgramCert(delegation, k.VerifyingKey, "tcp", caAddr)
 		if err != nil {
 			return nil, nil, nil, err
 		}
@@ -304,6 +319,18 @@ func TaoParadigm(cfg *string, filePath *string, keySetType string, useSimpleDoma
 	}
 	log.Printf("TaoParadigm: my name is %s\n", taoName)
 
+	// Older hosts don't report their capabilities, so assume they can seal.
+	caps, err := tao.HostCapabilities(tao.Parent())
+	if err == nil {
+		log.Printf("TaoParadigm: host speaks Tao RPC version %d, built on %v\n",
+			caps.GetVersion(), caps.GetHostTypes())
+		if !caps.HasMethod("Seal") || !caps.HasSealPolicy(tao.SealPolicyDefault) {
+			return errors.New("TaoParadigm: host can't seal with the default policy")
+		}
+	} else if err != tao.ErrNoCapabilities {
+		return errors.New(fmt.Sprintln("TaoParadigm: Can't get host capabilities. Error: ", err))
+	}
+
 	// Get my keys and certificates.
 	sealedSymmetricKey, sealedProgramKey, programCert, certChain, err :=
 		LoadProgramKeys(*filePath)
@@ -356,9 +383,45 @@ func TaoParadigm(cfg *string, filePath *string, keySetType string, useSimpleDoma
 		return errors.New("TaoParadigm: Can't initialize TaoProgramData")
 	}
 
+	// The domain service revokes the program certs it issued with a CRL,
+	// which peers' certs are checked against, see VerifyPeerCertificate.
+	if !useSimpleDomainService {
+		crl, err := domain_service.RequestCrl("tcp", caAddr)
+		if err != nil {
+			return errors.New(fmt.Sprintln("TaoParadigm: Can't get CRL. Error: ", err))
+		}
+		programObject.CRL, err = tao.NewCRLChecker(simpleDomain.Keys.Cert, crl)
+		if err != nil {
+			return errors.New(fmt.Sprintln("TaoParadigm: Bad CRL. Error: ", err))
+		}
+	}
+
 	return nil
 }
 
+// UpdateCRL fetches the current CRL from the domain service, e.g. before the
+// one TaoParadigm fetched goes out of date.
+func (pp *TaoProgramData) UpdateCRL(network, addr string) error {
+	if pp.CRL == nil {
+		return errors.New("UpdateCRL: program certs aren't from the domain service")
+	}
+	crl, err := domain_service.RequestCrl(network, addr)
+	if err != nil {
+		return err
+	}
+	return pp.CRL.Update(crl)
+}
+
+// VerifyPeerCertificate checks the certs a TLS peer presented against the
+// domain service's CRL, if there is one. It can be used as
+// tls.Config.VerifyPeerCertificate.
+func (pp *TaoProgramData) VerifyPeerCertificate(rawCerts [][]byte, chains [][]*x509.Certificate) error {
+	if pp.CRL == nil {
+		return nil
+	}
+	return pp.CRL.VerifyPeerCertificate(rawCerts, chains)
+}
+
 // Establishes the Tao Channel for a client using the Program Key.
 // This program does all the standard client side channel negotiation.
 // After negotiation is complete.  ms is the bi-directional confidentiality and
@@ -383,9 +446,10 @@ func OpenTaoChannel(programObject *TaoProgramData, serverAddr *string) (
 	}
 	// TODO(manferdelli): Replace this with tao.Dial?
 	conn, err := tls.Dial("tcp", *serverAddr, &tls.Config{
-		RootCAs:            pool,
-		Certificates:       []tls.Certificate{*tlsc},
-		InsecureSkipVerify: false,
+		RootCAs:               pool,
+		Certificates:          []tls.Certificate{*tlsc},
+		InsecureSkipVerify:    false,
+		VerifyPeerCertificate: programObject.VerifyPeerCertificate,
 	})
 	if err != nil {
 		fmt.Printf("OpenTaoChannel: Can't establish channel : %v\n", err)
@@ -487,6 +551,20 @@ func CreateSigningKey(t tao.Tao) (*tao.Keys, []byte, error) {
 	return k, derCert, nil
 }
 
+// AttestKeyWithNonce has t attest, as in CreateSigningKey, that the signing key
+// in k speaks for the caller, binding a nonce chosen by a verifier into the
+// attestation.
+func AttestKeyWithNonce(t tao.Tao, k *tao.Keys, nonce []byte) (*tao.Attestation, error) {
+	self, err := t.GetTaoName()
+	if err != nil {
+		return nil, err
+	}
+	s := &auth.Speaksfor{
+		Delegate:  k.SigningKey.ToPrincipal(),
+		Delegator: self}
+	return t.AttestNonce(&self, nil, nil, nonce, s)
+}
+
 // Obtain a signing private key (usually a Program Key) from a sealed blob.
 func SigningKeyFromBlob(t tao.Tao, sealedKeyBlob []byte, programCert []byte) (*tao.Keys, error) {
 
@@ -17,9 +17,12 @@ package tao
 import (
 	"crypto/sha256"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/golang/glog"
 	"github.com/golang/protobuf/proto"
@@ -30,10 +33,24 @@ import (
 // authorization decisions. All rules are immediately converted to strings when
 // they are added, and they are never converted back to auth.ast form. Any
 // policy that requires more than string comparison should use DatalogGuard.
+// Changes to the ACL should be made with the guard's methods, which count them,
+// see policyVersion.
 type ACLGuard struct {
 	Config ACLGuardDetails
 	ACL    []string
 	Key    *Verifier
+
+	// id and version identify the guard's rules. version counts the changes
+	// made by the guard's methods. Both are accessed atomically.
+	id      uint64
+	version uint64
+
+	// rm protects revocation, the domain's revocation checker, see
+	// RevocationGuard, and serial, the serial of the domain's revocation list
+	// that the signed ACLs record.
+	rm         sync.Mutex
+	revocation RevocationChecker
+	serial     uint64
 }
 
 // ACLGuardSigningContext is the context used for ACL-file signatures.
@@ -65,6 +82,9 @@ func (a *ACLGuard) Subprincipal() auth.SubPrin {
 // pointer.
 func (a *ACLGuard) GetSignedACLSet(signer *Signer) (*SignedACLSet, error) {
 	acls := &ACLSet{Entries: a.ACL}
+	if serial := a.revocationSerial(); serial != 0 {
+		acls.RevocationsSerial = proto.Uint64(serial)
+	}
 	ser, err := proto.Marshal(acls)
 	if err != nil {
 		return nil, err
@@ -127,6 +147,7 @@ func LoadACLGuard(key *Verifier, config ACLGuardDetails) (Guard, error) {
 	}
 	a := &ACLGuard{Config: config, Key: key}
 	a.ACL = acls.Entries
+	a.serial = acls.GetRevocationsSerial()
 	return a, nil
 }
 
@@ -147,6 +168,7 @@ func createPredicateString(name auth.Prin, op string, args []string) string {
 // Authorize adds an authorization for a principal to perform an
 // operation.
 func (a *ACLGuard) Authorize(name auth.Prin, op string, args []string) error {
+	atomic.AddUint64(&a.version, 1)
 	a.ACL = append(a.ACL, createPredicateString(name, op, args))
 	return nil
 }
@@ -159,6 +181,7 @@ func (a *ACLGuard) Authorize(name auth.Prin, op string, args []string) error {
 // supported (e.g., an "authorize all" rule), other rules may still be
 // in place authorizing the principal to perform the operation.
 func (a *ACLGuard) Retract(name auth.Prin, op string, args []string) error {
+	atomic.AddUint64(&a.version, 1)
 	ps := createPredicateString(name, op, args)
 	i := 0
 	for i < len(a.ACL) {
@@ -188,6 +211,7 @@ func (a *ACLGuard) IsAuthorized(name auth.Prin, op string, args []string) bool {
 // calling Authorize(P, op, args...) with each of the arguments
 // converted to either a string or integer.
 func (a *ACLGuard) AddRule(rule string) error {
+	atomic.AddUint64(&a.version, 1)
 	glog.Infof("Adding rule '%s'", rule)
 	a.ACL = append(a.ACL, rule)
 	return nil
@@ -196,6 +220,7 @@ func (a *ACLGuard) AddRule(rule string) error {
 // RetractRule removes a rule previously added via AddRule() or the
 // equivalent Authorize() call.
 func (a *ACLGuard) RetractRule(rule string) error {
+	atomic.AddUint64(&a.version, 1)
 	i := 0
 	for i < len(a.ACL) {
 		if rule == a.ACL[i] {
@@ -209,6 +234,7 @@ func (a *ACLGuard) RetractRule(rule string) error {
 
 // Clear removes all rules.
 func (a *ACLGuard) Clear() error {
+	atomic.AddUint64(&a.version, 1)
 	a.ACL = make([]string, 0)
 	return nil
 }
@@ -225,6 +251,39 @@ func (a *ACLGuard) Query(query string) (bool, error) {
 	return false, nil
 }
 
+// policyVersion returns a version of the guard's rules that changes whenever
+// they are changed by the guard's methods, and that no other guard has, see
+// AttestationCache.
+func (a *ACLGuard) policyVersion() string {
+	return fmt.Sprintf("ACLGuard:%d:%d", guardID(&a.id), atomic.LoadUint64(&a.version))
+}
+
+// Revocation returns the revocation checker installed on the guard, or nil.
+func (a *ACLGuard) Revocation() RevocationChecker {
+	a.rm.Lock()
+	defer a.rm.Unlock()
+	return a.revocation
+}
+
+// SetRevocation installs a revocation checker on the guard.
+func (a *ACLGuard) SetRevocation(rc RevocationChecker) {
+	a.rm.Lock()
+	defer a.rm.Unlock()
+	a.revocation = rc
+}
+
+func (a *ACLGuard) revocationSerial() uint64 {
+	a.rm.Lock()
+	defer a.rm.Unlock()
+	return a.serial
+}
+
+func (a *ACLGuard) setRevocationSerial(serial uint64) {
+	a.rm.Lock()
+	defer a.rm.Unlock()
+	a.serial = serial
+}
+
 // RuleCount returns a count of the total number of rules.
 func (a *ACLGuard) RuleCount() int {
 	return len(a.ACL)
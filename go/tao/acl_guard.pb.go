@@ -71,8 +71,10 @@ const _ = proto.ProtoPackageIsVersion1
 
 // A set of ACL entries.
 type ACLSet struct {
-	Entries          []string `protobuf:"bytes,1,rep,name=entries" json:"entries,omitempty"`
-	XXX_unrecognized []byte   `json:"-"`
+	Entries []string `protobuf:"bytes,1,rep,name=entries" json:"entries,omitempty"`
+	// The serial of the domain's revocation list when the ACLs were saved.
+	RevocationsSerial *uint64 `protobuf:"varint,2,opt,name=revocations_serial" json:"revocations_serial,omitempty"`
+	XXX_unrecognized  []byte  `json:"-"`
 }
 
 func (m *ACLSet) Reset()                    { *m = ACLSet{} }
@@ -87,6 +89,13 @@ func (m *ACLSet) GetEntries() []string {
 	return nil
 }
 
+func (m *ACLSet) GetRevocationsSerial() uint64 {
+	if m != nil && m.RevocationsSerial != nil {
+		return *m.RevocationsSerial
+	}
+	return 0
+}
+
 // A set of ACL entries signed by a key.
 type SignedACLSet struct {
 	SerializedAclset []byte `protobuf:"bytes,1,req,name=serialized_aclset" json:"serialized_aclset,omitempty"`
@@ -119,13 +128,15 @@ func init() {
 }
 
 var fileDescriptor0 = []byte{
-	// 125 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xe2, 0xe2, 0x4f, 0x4c, 0xce, 0x89,
-	0x4f, 0x2f, 0x4d, 0x2c, 0x4a, 0xd1, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x62, 0x2e, 0x49, 0xcc,
-	0x57, 0x92, 0xe4, 0x62, 0x73, 0x74, 0xf6, 0x09, 0x4e, 0x2d, 0x11, 0xe2, 0xe7, 0x62, 0x4f, 0xcd,
-	0x2b, 0x29, 0xca, 0x4c, 0x2d, 0x96, 0x60, 0x54, 0x60, 0xd6, 0xe0, 0x54, 0xb2, 0xe1, 0xe2, 0x09,
-	0xce, 0x4c, 0xcf, 0x4b, 0x4d, 0x81, 0x2a, 0x90, 0xe4, 0x12, 0x2c, 0x4e, 0x2d, 0xca, 0x4c, 0xcc,
-	0xc9, 0xac, 0x4a, 0x4d, 0x89, 0x07, 0x9a, 0x56, 0x9c, 0x5a, 0x02, 0x54, 0xca, 0xa4, 0xc1, 0x23,
-	0x24, 0xc8, 0xc5, 0x59, 0x0c, 0x54, 0x9a, 0x58, 0x52, 0x5a, 0x94, 0x2a, 0xc1, 0x04, 0x12, 0x02,
-	0x04, 0x00, 0x00, 0xff, 0xff, 0xe6, 0x6e, 0x44, 0xe5, 0x6f, 0x00, 0x00, 0x00,
+	// 147 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x2c, 0xcb, 0xb1, 0x0a, 0xc2, 0x30,
+	0x10, 0x80, 0x61, 0xda, 0x8a, 0xd2, 0xa3, 0x50, 0x9a, 0x29, 0x3a, 0x95, 0x4e, 0x9d, 0xdc, 0xdc,
+	0x5c, 0xc4, 0xd5, 0xad, 0x0f, 0x50, 0x8e, 0xe4, 0x08, 0x07, 0x21, 0x91, 0xcb, 0xd5, 0xc1, 0xa7,
+	0x17, 0xd1, 0xf5, 0xff, 0xf9, 0xa0, 0x47, 0x17, 0xd7, 0xb0, 0xa1, 0xf8, 0xf3, 0x53, 0xb2, 0x66,
+	0xd3, 0x28, 0xe6, 0xe9, 0x02, 0xfb, 0xdb, 0xfd, 0xb1, 0x90, 0x9a, 0x1e, 0x0e, 0x94, 0x54, 0x98,
+	0x8a, 0xad, 0xc6, 0x66, 0x6e, 0xcd, 0x09, 0x8c, 0xd0, 0x2b, 0x3b, 0x54, 0xce, 0xa9, 0xac, 0x85,
+	0x84, 0x31, 0xda, 0x7a, 0xac, 0xe6, 0xdd, 0x74, 0x85, 0x6e, 0xe1, 0x90, 0xc8, 0xff, 0xf1, 0x11,
+	0x86, 0xdf, 0xe7, 0x37, 0xf9, 0x15, 0x5d, 0x2c, 0xa4, 0xb6, 0x1a, 0xeb, 0xb9, 0x33, 0x03, 0xb4,
+	0x85, 0x43, 0x42, 0xdd, 0x84, 0x6c, 0xfd, 0x4d, 0x9f, 0x01, 0x00, 0xb4, 0xe3, 0x41, 0x3d, 0x8b,
+	0x00, 0x00, 0x00,
 }
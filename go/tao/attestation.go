@@ -15,6 +15,9 @@
 package tao
 
 import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
 	"time"
 
 	"github.com/golang/protobuf/proto"
@@ -58,7 +61,7 @@ func (a *Attestation) ValidSigner() (auth.Prin, error) {
 		if err != nil {
 			return auth.Prin{}, newError("tao: couldn't extract TPM key from attestation: %s", err)
 		}
-		if err := tpm.VerifyQuote(pk, a.SerializedStatement, a.Signature, pcrNums, pcrVals); err != nil {
+		if err := tpm.VerifyQuote(pk, a.signedData(), a.Signature, pcrNums, pcrVals); err != nil {
 			return auth.Prin{}, newError("tao: TPM quote failed verification: %s", err)
 		}
 
@@ -101,7 +104,7 @@ func (a *Attestation) ValidSigner() (auth.Prin, error) {
 		if err != nil {
 			return auth.Prin{}, newError("tao: Error computing PCR digest: %s", err)
 		}
-		ok, err = tpm2.VerifyTpm2Quote(a.SerializedStatement,
+		ok, err = tpm2.VerifyTpm2Quote(a.signedData(),
 			pcrNums, expectedPcrDigest, a.Tpm2QuoteStructure, a.Signature,
 			key)
 		if err != nil {
@@ -117,7 +120,7 @@ func (a *Attestation) ValidSigner() (auth.Prin, error) {
 		if err != nil {
 			return auth.Prin{}, err
 		}
-		ok, err := v.Verify(a.SerializedStatement, AttestationSigningContext, a.Signature)
+		ok, err := v.Verify(a.signedData(), a.signingContext(), a.Signature)
 		if err != nil {
 			return auth.Prin{}, err
 		}
@@ -130,6 +133,44 @@ func (a *Attestation) ValidSigner() (auth.Prin, error) {
 	}
 }
 
+// DefaultNonceSize is the size of a nonce from NewNonce.
+const DefaultNonceSize = 32
+
+// NewNonce returns a random nonce for a verifier to challenge a Tao to attest,
+// see Tao.AttestNonce.
+func NewNonce() ([]byte, error) {
+	nonce := make([]byte, DefaultNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return nonce, nil
+}
+
+// nonceBoundData returns the data that is signed, or quoted by a TPM, to attest
+// to the serialized statement ser with the given nonce. With no nonce, this is
+// just the statement.
+func nonceBoundData(ser, nonce []byte) []byte {
+	if len(nonce) == 0 {
+		return ser
+	}
+	h := sha256.Sum256(ser)
+	return append(h[:], nonce...)
+}
+
+// signedData returns the data that the signer of an attestation signed.
+func (a *Attestation) signedData() []byte {
+	return nonceBoundData(a.SerializedStatement, a.Nonce)
+}
+
+// signingContext returns the context in which a key signed an attestation, so
+// a signature over a statement with a nonce can't pass for one without.
+func (a *Attestation) signingContext() string {
+	if len(a.Nonce) == 0 {
+		return AttestationSigningContext
+	}
+	return AttestationNonceSigningContext
+}
+
 // Validate checks whether an attestation is valid and, if so, it returns the
 // statement conveyed by the attestation.
 func (a *Attestation) Validate() (auth.Says, error) {
@@ -200,9 +241,28 @@ func (a *Attestation) Validate() (auth.Says, error) {
 	return *stmt, nil
 }
 
+// ValidateNonce checks that an attestation is valid, as Validate does, and that
+// it carries the given nonce, i.e. that it was made in response to a challenge
+// with that nonce. It returns the statement conveyed by the attestation.
+func (a *Attestation) ValidateNonce(nonce []byte) (auth.Says, error) {
+	if len(nonce) == 0 {
+		return auth.Says{}, newError("tao: no nonce to check the attestation against")
+	}
+	if !bytes.Equal(a.Nonce, nonce) {
+		return auth.Says{}, newError("tao: the attestation doesn't carry the expected nonce")
+	}
+	return a.Validate()
+}
+
 // GenerateAttestation uses the signing key to generate an attestation for this
 // statement.
 func GenerateAttestation(s *Signer, delegation []byte, stmt auth.Says) (*Attestation, error) {
+	return GenerateNonceAttestation(s, delegation, nil, stmt)
+}
+
+// GenerateNonceAttestation is like GenerateAttestation, but binds a nonce into
+// the attestation, if nonce isn't empty.
+func GenerateNonceAttestation(s *Signer, delegation, nonce []byte, stmt auth.Says) (*Attestation, error) {
 	t := time.Now()
 	if stmt.Time == nil {
 		i := t.UnixNano()
@@ -214,18 +274,19 @@ func GenerateAttestation(s *Signer, delegation []byte, stmt auth.Says) (*Attesta
 		stmt.Expiration = &i
 	}
 
-	ser := auth.Marshal(stmt)
-	sig, err := s.Sign(ser, AttestationSigningContext)
-	if err != nil {
-		return nil, err
-	}
-
 	a := &Attestation{
-		SerializedStatement: ser,
-		Signature:           sig,
+		SerializedStatement: auth.Marshal(stmt),
 		SignerType:          proto.String("key"),
 		SignerKey:           s.GetVerifier().MarshalKey(),
 	}
+	if len(nonce) > 0 {
+		a.Nonce = nonce
+	}
+	sig, err := s.Sign(a.signedData(), a.signingContext())
+	if err != nil {
+		return nil, err
+	}
+	a.Signature = sig
 
 	if len(delegation) > 0 {
 		a.SerializedDelegation = delegation
@@ -177,7 +177,13 @@ type Attestation struct {
 	// attestation. This is included in attestations signed by a root Tao
 	// i.e. a TPM (1.2 or 2.0) Tao or a soft Tao, and forms the root of the
 	// attestation chain. This certificate is signed by the policy key.
-	RootEndorsement  []byte `protobuf:"bytes,8,opt,name=root_endorsement" json:"root_endorsement,omitempty"`
+	RootEndorsement []byte `protobuf:"bytes,8,opt,name=root_endorsement" json:"root_endorsement,omitempty"`
+	// A nonce chosen by a verifier that challenged the signer to attest. If this
+	// is present, the signature covers a hash of the serialized statement
+	// followed by the nonce, and for a TPM it is bound into the qualifying data
+	// of the quote, so a verifier that checks the nonce knows the attestation
+	// was made after it chose the nonce.
+	Nonce            []byte `protobuf:"bytes,9,opt,name=nonce" json:"nonce,omitempty"`
 	XXX_unrecognized []byte `json:"-"`
 }
 
@@ -241,5 +247,12 @@ func (m *Attestation) GetRootEndorsement() []byte {
 	return nil
 }
 
+func (m *Attestation) GetNonce() []byte {
+	if m != nil {
+		return m.Nonce
+	}
+	return nil
+}
+
 func init() {
 }
@@ -0,0 +1,241 @@
+// Copyright (c) 2016, Google Inc.  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tao
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/jlmucb/cloudproxy/go/tao/auth"
+)
+
+// DefaultAttestationCacheSize is the number of attestations that
+// PeerAttestationCache holds.
+const DefaultAttestationCacheSize = 1024
+
+// PeerAttestationCache holds the peer attestations that ValidatePeerAttestation,
+// and so Dial and Listen, have checked recently, so a repeat peer doesn't cost
+// another check of every signature and TPM quote in its attestation chain. Set
+// it to nil, before making any connections, to check every attestation in
+// full.
+var PeerAttestationCache = NewAttestationCache(DefaultAttestationCacheSize)
+
+// An AttestationCache holds the results of checking peer attestations, keyed
+// by a hash of the attestation. It holds at most a fixed number of
+// attestations, and drops the least recently used one to make room. An entry
+// lasts only until the attestation expires. The guard's decision that the
+// peer may Execute is kept along with the version of the guard's policy it was
+// made under, see policyVersion, so it is made again once the policy changes.
+type AttestationCache struct {
+	m       sync.Mutex
+	size    int
+	lru     *list.List // of *validatedAttestation, most recently used first
+	entries map[[sha256.Size]byte]*list.Element
+}
+
+// A validatedAttestation holds what the cache knows about an attestation.
+type validatedAttestation struct {
+	hash [sha256.Size]byte
+
+	// delegator is the principal that delegated to delegate.
+	delegator auth.Prin
+	delegate  auth.Prin
+
+	// expiration is the time in nanoseconds since the epoch at which the
+	// attestation expires, or 0 if it doesn't expire.
+	expiration int64
+
+	// policy is the version of the policy under which the guard authorized
+	// the delegator to Execute, or "" if it hasn't.
+	policy string
+}
+
+// NewAttestationCache returns a cache that holds at most size attestations.
+func NewAttestationCache(size int) *AttestationCache {
+	return &AttestationCache{
+		size:    size,
+		lru:     list.New(),
+		entries: make(map[[sha256.Size]byte]*list.Element),
+	}
+}
+
+// Len returns the number of attestations in the cache.
+func (c *AttestationCache) Len() int {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.lru.Len()
+}
+
+// Flush removes all attestations from the cache, e.g. after a key in the
+// domain has been revoked.
+func (c *AttestationCache) Flush() {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.lru.Init()
+	c.entries = make(map[[sha256.Size]byte]*list.Element)
+}
+
+// validate returns what the cache holds for a, or checks a and adds it to the
+// cache. The cache may be nil, in which case a is checked every time. The
+// caller must not modify the result.
+func (c *AttestationCache) validate(a *Attestation) (*validatedAttestation, error) {
+	ser, err := proto.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(ser)
+	now := time.Now().UnixNano()
+
+	if c != nil {
+		c.m.Lock()
+		if e, ok := c.entries[hash]; ok {
+			va := e.Value.(*validatedAttestation)
+			if va.expiration == 0 || now < va.expiration {
+				c.lru.MoveToFront(e)
+				v := *va
+				c.m.Unlock()
+				return &v, nil
+			}
+			c.lru.Remove(e)
+			delete(c.entries, hash)
+		}
+		c.m.Unlock()
+	}
+
+	va, err := validateAttestation(a, now)
+	if err != nil {
+		return nil, err
+	}
+	va.hash = hash
+
+	if c != nil && c.size > 0 {
+		c.m.Lock()
+		if _, ok := c.entries[hash]; !ok {
+			v := *va
+			c.entries[hash] = c.lru.PushFront(&v)
+			for c.lru.Len() > c.size {
+				old := c.lru.Remove(c.lru.Back()).(*validatedAttestation)
+				delete(c.entries, old.hash)
+			}
+		}
+		c.m.Unlock()
+	}
+	return va, nil
+}
+
+// authorize checks that guard authorizes the delegator of va to Execute, using
+// the decision in the cache if the guard's policy hasn't changed since it was
+// made. The cache may be nil.
+func (c *AttestationCache) authorize(va *validatedAttestation, guard Guard) bool {
+	policy, ok := policyVersion(guard)
+	if ok && va.policy == policy {
+		return true
+	}
+
+	// TODO(tmroeder): the current implementation assumes that the Tao Guard is
+	// already able to check authorization of Execute for both programs. In
+	// general, this might not be true.
+	if !guard.IsAuthorized(va.delegator, "Execute", nil) {
+		return false
+	}
+	if ok && c != nil {
+		c.m.Lock()
+		if e, found := c.entries[va.hash]; found {
+			e.Value.(*validatedAttestation).policy = policy
+		}
+		c.m.Unlock()
+	}
+	return true
+}
+
+// validateAttestation checks the signatures in a, that it hasn't expired by
+// now, and that it is a statement by a principal that a key speaks for it.
+func validateAttestation(a *Attestation, now int64) (*validatedAttestation, error) {
+	stmt, err := a.Validate()
+	if err != nil {
+		return nil, err
+	}
+	// Validate sets the expiration to the earliest one in the chain.
+	if stmt.Expiration != nil && now >= *stmt.Expiration {
+		return nil, errors.New("a peer attestation has expired")
+	}
+
+	// Insist that the message of the statement be a SpeaksFor and that the
+	// initial term be an auth.Prin of type key. Note that Validate has already
+	// checked the general well-formedness of the attestation.
+	sf, ok := stmt.Message.(auth.Speaksfor)
+	if !ok {
+		return nil, errors.New("a peer attestation must have an auth.Speaksfor as a message")
+	}
+
+	// This key must contain the serialized X.509 certificate.
+	kprin, ok := sf.Delegate.(auth.Prin)
+	if !ok {
+		return nil, errors.New("a peer attestation must have an auth.Prin as its delegate")
+	}
+
+	if kprin.Type != "key" {
+		return nil, errors.New("a peer attestation must have an auth.Prin of type 'key' as its delegate")
+	}
+
+	if _, ok := kprin.KeyHash.(auth.Bytes); !ok {
+		return nil, errors.New("a peer attestation must have a KeyHash of type auth.Bytes")
+	}
+
+	prin, ok := sf.Delegator.(auth.Prin)
+	if !ok {
+		return nil, errors.New("a peer attestation must have an auth.Prin as its delegator")
+	}
+
+	va := &validatedAttestation{delegator: prin, delegate: kprin}
+	if stmt.Expiration != nil {
+		va.expiration = *stmt.Expiration
+	}
+	return va, nil
+}
+
+// policyVersion returns a version for the policy of guard that changes
+// whenever the policy does, or false if the guard has no such version, in which
+// case its decisions can't be cached.
+func policyVersion(guard Guard) (string, bool) {
+	switch g := guard.(type) {
+	case TrivialGuard:
+		return g.Subprincipal().String(), true
+	case *ACLGuard:
+		return g.policyVersion(), true
+	case *DatalogGuard:
+		return g.policyVersion(), true
+	default:
+		return "", false
+	}
+}
+
+// guardIDs is the last id given to a guard by guardID.
+var guardIDs uint64
+
+// guardID returns the id of a guard, stored in *id, after giving the guard a
+// new one if it has none, so that the versions of different guards differ.
+func guardID(id *uint64) uint64 {
+	if v := atomic.LoadUint64(id); v != 0 {
+		return v
+	}
+	atomic.CompareAndSwapUint64(id, 0, atomic.AddUint64(&guardIDs, 1))
+	return atomic.LoadUint64(id)
+}
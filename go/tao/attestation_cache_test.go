@@ -0,0 +1,157 @@
+// Copyright (c) 2016, Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tao
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/jlmucb/cloudproxy/go/tao/auth"
+)
+
+// newTestDelegation returns an attestation by a new key that another new key
+// speaks for it, which expires after d.
+func newTestDelegation(t *testing.T, d time.Duration) (*Attestation, auth.Prin) {
+	signer, err := NewTemporaryKeys(Signing)
+	if err != nil {
+		t.Fatalf("couldn't create a signing key: %s", err)
+	}
+	delegate, err := NewTemporaryKeys(Signing)
+	if err != nil {
+		t.Fatalf("couldn't create a delegate key: %s", err)
+	}
+	exp := time.Now().Add(d).UnixNano()
+	prin := signer.SigningKey.ToPrincipal()
+	a, err := GenerateAttestation(signer.SigningKey, nil, auth.Says{
+		Speaker:    prin,
+		Expiration: &exp,
+		Message: auth.Speaksfor{
+			Delegate:  delegate.SigningKey.ToPrincipal(),
+			Delegator: prin,
+		},
+	})
+	if err != nil {
+		t.Fatalf("couldn't generate an attestation: %s", err)
+	}
+	return a, prin
+}
+
+func TestAttestationCacheBounded(t *testing.T) {
+	c := NewAttestationCache(2)
+	var as []*Attestation
+	for i := 0; i < 3; i++ {
+		a, _ := newTestDelegation(t, time.Hour)
+		as = append(as, a)
+		if _, err := c.validate(a); err != nil {
+			t.Fatalf("couldn't validate an attestation: %s", err)
+		}
+	}
+	if c.Len() != 2 {
+		t.Fatalf("the cache holds %d attestations; want 2", c.Len())
+	}
+	if _, ok := c.entries[hashAttestation(t, as[0])]; ok {
+		t.Fatal("the least recently used attestation was not dropped")
+	}
+
+	// A repeat attestation doesn't take another entry.
+	if _, err := c.validate(as[2]); err != nil {
+		t.Fatalf("couldn't validate a cached attestation: %s", err)
+	}
+	if c.Len() != 2 {
+		t.Fatalf("the cache holds %d attestations; want 2", c.Len())
+	}
+
+	c.Flush()
+	if c.Len() != 0 {
+		t.Fatalf("the cache holds %d attestations after a flush", c.Len())
+	}
+}
+
+func TestAttestationCacheExpiration(t *testing.T) {
+	c := NewAttestationCache(DefaultAttestationCacheSize)
+	a, _ := newTestDelegation(t, 100*time.Millisecond)
+	if _, err := c.validate(a); err != nil {
+		t.Fatalf("couldn't validate an attestation: %s", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if _, err := c.validate(a); err == nil {
+		t.Fatal("the cache accepted an expired attestation")
+	}
+	if c.Len() != 0 {
+		t.Fatal("the cache kept an expired attestation")
+	}
+
+	expired, _ := newTestDelegation(t, -time.Second)
+	if _, err := c.validate(expired); err == nil {
+		t.Fatal("an expired attestation was accepted")
+	}
+}
+
+func TestAttestationCachePolicyChange(t *testing.T) {
+	c := NewAttestationCache(DefaultAttestationCacheSize)
+	a, prin := newTestDelegation(t, time.Hour)
+	guard := NewACLGuard(nil, ACLGuardDetails{})
+	if err := guard.Authorize(prin, "Execute", nil); err != nil {
+		t.Fatalf("couldn't authorize the delegator: %s", err)
+	}
+
+	va, err := c.validate(a)
+	if err != nil {
+		t.Fatalf("couldn't validate an attestation: %s", err)
+	}
+	if !c.authorize(va, guard) {
+		t.Fatal("the guard didn't authorize the delegator")
+	}
+	if va, _ = c.validate(a); va.policy == "" {
+		t.Fatal("the cache didn't keep the guard's decision")
+	}
+
+	if err := guard.Retract(prin, "Execute", nil); err != nil {
+		t.Fatalf("couldn't retract the authorization: %s", err)
+	}
+	if va, _ = c.validate(a); c.authorize(va, guard) {
+		t.Fatal("the cache kept a decision from an old policy")
+	}
+
+	// Another guard with the same version of its own policy doesn't share
+	// the decision.
+	if err := guard.Authorize(prin, "Execute", nil); err != nil {
+		t.Fatalf("couldn't authorize the delegator: %s", err)
+	}
+	if va, _ = c.validate(a); !c.authorize(va, guard) {
+		t.Fatal("the guard didn't authorize the delegator")
+	}
+	other := NewACLGuard(nil, ACLGuardDetails{})
+	for i := 0; i < 3; i++ {
+		if err := other.AddRule(fmt.Sprintf("Authorized(key([%02x]), \"Execute\")", i)); err != nil {
+			t.Fatalf("couldn't add a rule: %s", err)
+		}
+	}
+	if va, _ = c.validate(a); c.authorize(va, other) {
+		t.Fatal("the cache used one guard's decision for another")
+	}
+}
+
+// hashAttestation returns the key for a in an AttestationCache.
+func hashAttestation(t *testing.T, a *Attestation) [sha256.Size]byte {
+	ser, err := proto.Marshal(a)
+	if err != nil {
+		t.Fatalf("couldn't marshal an attestation: %s", err)
+	}
+	return sha256.Sum256(ser)
+}
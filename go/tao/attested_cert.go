@@ -0,0 +1,130 @@
+// Copyright (c) 2016, Google Inc.  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tao
+
+// In the attested certificate mode of the Tao handshake, each peer's X.509
+// certificate carries the attestation for its key in an extension, and each
+// peer checks the other's attestation while verifying its certificate during
+// the TLS handshake. The TLS handshake proves that the peer holds the key, and
+// it fails if the attestation doesn't check out, so there is no Tao message
+// exchange after it, and an attestation can't be presented by anyone but the
+// holder of the attested key.
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// AttestationExtensionOID identifies the X.509 certificate extension holding
+// a serialized Attestation for the certificate's key. It lies in the arc of
+// IANA private enterprise number 11129, which belongs to Google, but the
+// 11129.2.11 sub-arc has not been assigned to CloudProxy in Google's OID
+// registry. Until it is, the attested certificate mode should only be used
+// between peers that both run this code, and the OID may change.
+var AttestationExtensionOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 11, 1}
+
+// EncodeAttestedTLSCert creates a self-signed certificate for the signing key
+// in keys that carries keys.Delegation in an extension, and combines it with
+// the key in a tls certificate suitable for a TLS config. The certificate has
+// the subject of keys.Cert, if there is one.
+func EncodeAttestedTLSCert(keys *Keys) (*tls.Certificate, error) {
+	if keys.SigningKey == nil || keys.Delegation == nil {
+		return nil, newError("an attested certificate requires a signing key with a delegation")
+	}
+	a, err := proto.Marshal(keys.Delegation)
+	if err != nil {
+		return nil, err
+	}
+	ext, err := asn1.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+
+	name := &pkix.Name{Organization: []string{"Tao attested key"}}
+	if keys.Cert != nil {
+		name = &keys.Cert.Subject
+	}
+	template := PrepareX509Template(name)
+	template.IsCA = true
+	template.BasicConstraintsValid = true
+	template.Issuer = template.Subject
+	template.ExtraExtensions = []pkix.Extension{{Id: AttestationExtensionOID, Value: ext}}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &keys.SigningKey.ec.PublicKey, keys.SigningKey.ec)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  keys.SigningKey.ec,
+	}, nil
+}
+
+// attestationFromCert returns the attestation in a certificate made by
+// EncodeAttestedTLSCert.
+func attestationFromCert(cert *x509.Certificate) (*Attestation, error) {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(AttestationExtensionOID) {
+			continue
+		}
+		var b []byte
+		if rest, err := asn1.Unmarshal(ext.Value, &b); err != nil {
+			return nil, err
+		} else if len(rest) != 0 {
+			return nil, errors.New("trailing data after the attestation in a certificate")
+		}
+		var a Attestation
+		if err := proto.Unmarshal(b, &a); err != nil {
+			return nil, err
+		}
+		return &a, nil
+	}
+	return nil, errors.New("a peer certificate must carry an attestation")
+}
+
+// verifyAttestedCert returns a function for tls.Config.VerifyPeerCertificate
+// that checks the attestation in the peer's certificate, as the Tao handshake
+// does, and records the peer's principal, attestation, and endorsements in
+// peer.
+func verifyAttestedCert(guard Guard, v *Verifier, peer *Conn) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("the peer presented no certificate")
+		}
+		cert, err := x509.ParseCertificate(rawCerts[0])
+		if err != nil {
+			return err
+		}
+		a, err := attestationFromCert(cert)
+		if err != nil {
+			return err
+		}
+		g, endorsements, err := EndorsedGuard(guard, a, v)
+		if err != nil {
+			return err
+		}
+		prin, err := validatePeerAttestation(a, cert, g)
+		if err != nil {
+			return err
+		}
+		peer.peer, peer.attestation, peer.endorsements, peer.guard = prin, a, endorsements, g
+		return nil
+	}
+}
@@ -17,6 +17,7 @@ package tao
 import (
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/jlmucb/cloudproxy/go/tao/auth"
@@ -40,6 +41,11 @@ type CachedGuard struct {
 
 	// Public policy key. (The TaoCA should sign with the private policy key.)
 	verifier *Verifier
+
+	// rm protects revocation, the domain's revocation checker, see
+	// RevocationGuard.
+	rm         sync.Mutex
+	revocation RevocationChecker
 }
 
 // CachedGuardType specifies the type of guard being cached.
@@ -165,6 +171,20 @@ func (cg *CachedGuard) Clear() error {
 	return nil
 }
 
+// Revocation returns the revocation checker installed on the guard, or nil.
+func (cg *CachedGuard) Revocation() RevocationChecker {
+	cg.rm.Lock()
+	defer cg.rm.Unlock()
+	return cg.revocation
+}
+
+// SetRevocation installs a revocation checker on the guard.
+func (cg *CachedGuard) SetRevocation(rc RevocationChecker) {
+	cg.rm.Lock()
+	defer cg.rm.Unlock()
+	cg.revocation = rc
+}
+
 // Query the policy.
 func (cg *CachedGuard) Query(query string) (bool, error) {
 	if cg.guard == nil || cg.IsExpired() {
@@ -23,7 +23,6 @@ import (
 	"net"
 	"time"
 
-	"github.com/golang/protobuf/proto"
 	"github.com/jlmucb/cloudproxy/go/tao/auth"
 	"github.com/jlmucb/cloudproxy/go/util"
 )
@@ -116,7 +115,7 @@ func DialTLSWithKeys(network, addr string, keys *Keys) (net.Conn, error) {
 // exchanges Attestation values with the server, checking that this is a Tao
 // server that is authorized to Execute. It uses a Tao Guard to perform this
 // check.
-func DialWithNewX509(network, addr string, guard Guard, v *Verifier) (net.Conn, error) {
+func DialWithNewX509(network, addr string, guard Guard, v *Verifier) (*Conn, error) {
 	keys, _, err := generateX509()
 	if err != nil {
 		return nil, fmt.Errorf("client: can't create key and cert: %s\n", err.Error())
@@ -128,8 +127,22 @@ func DialWithNewX509(network, addr string, guard Guard, v *Verifier) (net.Conn,
 // Dial connects to a Tao TLS server, performs a TLS handshake, and verifies
 // the Attestation value of the server, checking that the server is authorized
 // to execute. If keys are provided (keys!=nil), then it sends an attestation
-// of its identity to the peer.
-func Dial(network, addr string, guard Guard, v *Verifier, keys *Keys) (net.Conn, error) {
+// of its identity to the peer. The returned Conn exposes the server's
+// principal and attestation.
+func Dial(network, addr string, guard Guard, v *Verifier, keys *Keys) (*Conn, error) {
+	return DialWithOptions(network, addr, guard, v, keys, DialOptions{})
+}
+
+// DialOptions controls how Dial performs the Tao handshake.
+type DialOptions struct {
+	// AttestedCert selects the attested certificate mode, in which the
+	// attestations travel in the TLS certificates and are checked during the
+	// TLS handshake, see ListenOptions.AttestedCert.
+	AttestedCert bool
+}
+
+// DialWithOptions is like Dial, but with control over the handshake.
+func DialWithOptions(network, addr string, guard Guard, v *Verifier, keys *Keys, opts DialOptions) (*Conn, error) {
 	tlsConfig := &tls.Config{
 		RootCAs:            x509.NewCertPool(),
 		InsecureSkipVerify: true,
@@ -137,16 +150,33 @@ func Dial(network, addr string, guard Guard, v *Verifier, keys *Keys) (net.Conn,
 
 	// Set up certificate for two-way authentication.
 	if keys != nil {
-		if keys.Cert == nil {
+		var tlsCert *tls.Certificate
+		var err error
+		if opts.AttestedCert {
+			tlsCert, err = EncodeAttestedTLSCert(keys)
+		} else if keys.Cert == nil {
 			return nil, fmt.Errorf("client: can't dial with an empty client certificate\n")
+		} else {
+			tlsCert, err = EncodeTLSCert(keys)
 		}
-		tlsCert, err := EncodeTLSCert(keys)
 		if err != nil {
 			return nil, err
 		}
 		tlsConfig.Certificates = []tls.Certificate{*tlsCert}
 	}
 
+	if opts.AttestedCert {
+		// The server's attestation is checked during the TLS handshake.
+		c := &Conn{}
+		tlsConfig.VerifyPeerCertificate = verifyAttestedCert(guard, v, c)
+		conn, err := tls.Dial(network, addr, tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		c.Conn = conn
+		return c, nil
+	}
+
 	conn, err := tls.Dial(network, addr, tlsConfig)
 	if err != nil {
 		return nil, err
@@ -169,65 +199,38 @@ func Dial(network, addr string, guard Guard, v *Verifier, keys *Keys) (net.Conn,
 		return nil, err
 	}
 
-	if err := AddEndorsements(guard, &a, v); err != nil {
+	// The server's endorsements apply only to this connection.
+	eguard, endorsements, err := EndorsedGuard(guard, &a, v)
+	if err != nil {
 		conn.Close()
 		return nil, err
 	}
 
 	// Validate the peer certificate according to the guard.
 	peerCert := conn.ConnectionState().PeerCertificates[0]
-	if err := ValidatePeerAttestation(&a, peerCert, guard); err != nil {
+	prin, err := validatePeerAttestation(&a, peerCert, eguard)
+	if err != nil {
 		conn.Close()
 		return nil, err
 	}
 
-	return conn, nil
+	return &Conn{Conn: conn, peer: prin, attestation: &a, endorsements: endorsements, guard: eguard}, nil
 }
 
 // AddEndorsements reads the SerializedEndorsements in an attestation and adds
-// the ones that are predicates signed by a guard's policy key.
+// the ones that are predicates signed by a guard's policy key. The predicates
+// stay in the guard, so they affect later authorization decisions for all
+// peers. EndorsedGuard instead scopes them to a single peer.
 func AddEndorsements(guard Guard, a *Attestation, v *Verifier) error {
-	// Before validating against the guard, check to see if there are any
-	// predicates endorsed by the policy key. This allows truncated principals
-	// to get the Tao CA to sign a statement of the form
-	// TrustedHash(ext.Program(...)).
-	for _, e := range a.SerializedEndorsements {
-		var ea Attestation
-		if err := proto.Unmarshal(e, &ea); err != nil {
-			return err
-		}
-
-		f, err := auth.UnmarshalForm(ea.SerializedStatement)
-		if err != nil {
+	_, preds, err := verifyEndorsements(a, v)
+	if err != nil {
+		return err
+	}
+	for _, pred := range preds {
+		if err := guard.AddRule(pred.String()); err != nil {
 			return err
 		}
-
-		says, ok := f.(auth.Says)
-		if !ok {
-			return fmt.Errorf("a serialized endorsement must be an auth.Says")
-		}
-
-		// TODO(tmroeder): check that this endorsement hasn't expired.
-		pred, ok := says.Message.(auth.Pred)
-		if !ok {
-			return fmt.Errorf("the message in an endorsement must be a predicate")
-		}
-
-		signerPrin := auth.NewPrin(*ea.SignerType, ea.SignerKey)
-
-		if !signerPrin.Identical(says.Speaker) {
-			return fmt.Errorf("the speaker of an endorsement must be the signer: %v vs %v", signerPrin, says.Speaker)
-		}
-		if !v.ToPrincipal().Identical(signerPrin) {
-			return fmt.Errorf("the signer of an endorsement must be the guard's policy key")
-		}
-		if ok, err := v.Verify(ea.SerializedStatement, AttestationSigningContext, ea.Signature); (err != nil) || !ok {
-			return fmt.Errorf("the signature on an endorsement didn't pass verification")
-		}
-
-		return guard.AddRule(pred.String())
 	}
-
 	return nil
 }
 
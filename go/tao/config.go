@@ -48,6 +48,7 @@ const (
 	DockerUnix
 	KVMCoreOSFile
 	KVMCustom
+	OCIBundle
 )
 
 // HostedProgramTypeMap maps strings to the type of a hosted program.
@@ -57,6 +58,7 @@ var HostedProgramTypeMap = map[string]HostedProgramType{
 	"docker":     DockerUnix,
 	"kvm_coreos": KVMCoreOSFile,
 	"kvm_custom": KVMCustom,
+	"oci":        OCIBundle,
 }
 
 // A Config stores the information about the Tao, its Host Tao, and the way
@@ -79,6 +81,12 @@ type Config struct {
 	TPM2EkCert    string
 	TPM2QuoteCert string
 	TPM2SealCert  string
+
+	// Variables for the TLS channel: the directory holding the attested key
+	// presented to the host Tao, and the configuration of the domain whose
+	// guard must authorize the host Tao.
+	TLSKeysPath      string
+	DomainConfigPath string
 }
 
 // IsValid checks a Config for validity.
@@ -153,6 +161,8 @@ func NewConfigFromString(htt, htct, f, hpt, tpmaik, tpmpcrs, tpmdev string) Conf
 		tc.HostedType = KVMCoreOSFile
 	case "kvm_custom":
 		tc.HostedType = KVMCustom
+	case "oci":
+		tc.HostedType = OCIBundle
 	default:
 		tc.HostedType = NoHostedPrograms
 	}
@@ -171,7 +181,12 @@ func NewConfigFromEnv() Config {
 	tpmpcrs := os.Getenv(TaoTPMPCRsEnvVar)
 	tpmdev := os.Getenv(TaoTPMDeviceEnvVar)
 
-	return NewConfigFromString(htt, htct, f, hpt, tpmaik, tpmpcrs, tpmdev)
+	tc := NewConfigFromString(htt, htct, f, hpt, tpmaik, tpmpcrs, tpmdev)
+	if htct == "tls" {
+		tc.TLSKeysPath = os.Getenv(TaoTLSKeysEnvVar)
+		tc.DomainConfigPath = os.Getenv(TaoDomainConfigEnvVar)
+	}
+	return tc
 }
 
 // Merge combines two Config values into one. The parameter value take
@@ -231,4 +246,12 @@ func (tc *Config) Merge(c Config) {
 	if tc.TPM2QuoteCert == "" || c.TPM2QuoteCert != "" {
 		tc.TPM2QuoteCert = c.TPM2QuoteCert
 	}
+
+	if tc.TLSKeysPath == "" || c.TLSKeysPath != "" {
+		tc.TLSKeysPath = c.TLSKeysPath
+	}
+
+	if tc.DomainConfigPath == "" || c.DomainConfigPath != "" {
+		tc.DomainConfigPath = c.DomainConfigPath
+	}
 }
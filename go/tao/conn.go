@@ -0,0 +1,95 @@
+// Copyright (c) 2016, Google Inc.  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tao
+
+import (
+	"crypto/tls"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/jlmucb/cloudproxy/go/tao/auth"
+)
+
+// Conn is a TLS connection on which the Tao handshake has authenticated the
+// peer. Listen's Accept returns a *Conn, and Dial returns one for the server.
+// A server can authorize each request with e.g.
+// conn.Guard().IsAuthorized(conn.PeerPrincipal(), op, args).
+type Conn struct {
+	*tls.Conn
+
+	peer         auth.Prin
+	attestation  *Attestation
+	endorsements []*Attestation
+
+	// m protects guard, which is discarded when the connection is closed.
+	m     sync.Mutex
+	guard Guard
+}
+
+// Guard returns the guard that authorized the peer: the guard the connection
+// was made with, plus the predicates endorsed for the peer, see EndorsedGuard.
+// The endorsed predicates apply only to this connection, and Guard returns nil
+// once the connection is closed.
+func (c *Conn) Guard() Guard {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.guard
+}
+
+// Close closes the connection and discards the peer's endorsements.
+func (c *Conn) Close() error {
+	c.m.Lock()
+	c.guard = nil
+	c.m.Unlock()
+	return c.Conn.Close()
+}
+
+// PeerPrincipal returns the principal that delegated to the peer's TLS key,
+// i.e. the principal the guard authorized in the handshake. It returns a zero
+// auth.Prin if the peer did not authenticate, as on an anonymous listener.
+func (c *Conn) PeerPrincipal() auth.Prin {
+	return c.peer
+}
+
+// PeerAttestation returns the attestation the peer presented for its TLS key,
+// or nil if the peer did not authenticate.
+func (c *Conn) PeerAttestation() *Attestation {
+	return c.attestation
+}
+
+// PeerAttestationChain returns the peer's attestation followed by each
+// delegation it carries, from the attestation for the TLS key down to the
+// root of the chain.
+func (c *Conn) PeerAttestationChain() ([]*Attestation, error) {
+	var chain []*Attestation
+	for a := c.attestation; a != nil; {
+		chain = append(chain, a)
+		if a.SerializedDelegation == nil {
+			break
+		}
+		var d Attestation
+		if err := proto.Unmarshal(a.SerializedDelegation, &d); err != nil {
+			return nil, err
+		}
+		a = &d
+	}
+	return chain, nil
+}
+
+// PeerEndorsements returns the endorsements, signed by the policy key, that
+// came with the peer's attestation and were added to the connection's guard.
+func (c *Conn) PeerEndorsements() []*Attestation {
+	return c.endorsements
+}
@@ -22,6 +22,7 @@ import (
 	"io/ioutil"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang/glog"
@@ -71,15 +72,27 @@ const (
 // "Pred(...)" alone is translated to "says(K, \"Pred\", ...)".
 //
 // "forall ... F1 and F2 and ... imp G" is translated to "G :- F1, F2, ...".
-// Not safe for concurrent use by goroutines.
+// It is safe for concurrent use by goroutines, e.g. by the handshakes of a Tao
+// listener.
 type DatalogGuard struct {
 	Config DatalogGuardDetails
 	Key    *Verifier
+	// m protects the fields below, and the datalog engine's state during a
+	// query, e.g. sp.max.
+	m sync.Mutex
 	// TODO(kwalsh) maybe use a version number or timestamp inside the file?
 	modTime time.Time // Modification time of signed rules file at time of reading.
 	db      DatalogRules
 	dl      *dlengine.Engine
 	sp      *subprinPrim
+
+	// id and version identify the guard's rules, see policyVersion. version
+	// counts the changes to the rules.
+	id      uint64
+	version uint64
+
+	// revocation is the domain's revocation checker, see RevocationGuard.
+	revocation RevocationChecker
 }
 
 // subprinPrim is a custom datalog primitive that implements subprincipal
@@ -259,6 +272,8 @@ func NewDatalogGuard(verifier *Verifier) *DatalogGuard {
 // DatalogGuard(<key>) for persistent guards.
 func (g *DatalogGuard) Subprincipal() auth.SubPrin {
 	if g.Key == nil {
+		g.m.Lock()
+		defer g.m.Unlock()
 		rules, err := proto.Marshal(&g.db)
 		if err != nil {
 			return nil
@@ -274,6 +289,12 @@ func (g *DatalogGuard) Subprincipal() auth.SubPrin {
 // ReloadIfModified reads all persistent policy data from disk if the file
 // timestamp is more recent than the last time it was read.
 func (g *DatalogGuard) ReloadIfModified() error {
+	g.m.Lock()
+	defer g.m.Unlock()
+	return g.reloadIfModified()
+}
+
+func (g *DatalogGuard) reloadIfModified() error {
 	if g.Key == nil {
 		return nil
 	}
@@ -313,7 +334,9 @@ func (g *DatalogGuard) ReloadIfModified() error {
 	// Only clear the rules set, since g.assert already skips datalog rules that
 	// are already present in the engine.
 	g.db.Rules = nil
+	g.db.RevocationsSerial = db.RevocationsSerial
 	g.modTime = info.ModTime()
+	g.version++
 	for _, rule := range db.Rules {
 		r, err := auth.UnmarshalForm(rule)
 		if err != nil {
@@ -333,7 +356,9 @@ func (g *DatalogGuard) GetSignedDatalogRules(signer *Signer) (*SignedDatalogRule
 	if signer == nil {
 		return nil, newError("datalog temporary ruleset can't be saved")
 	}
+	g.m.Lock()
 	rules, err := proto.Marshal(&g.db)
+	g.m.Unlock()
 	if err != nil {
 		return nil, err
 	}
@@ -611,6 +636,7 @@ func (g *DatalogGuard) assert(f auth.Form) error {
 		return err
 	}
 	g.db.Rules = append(g.db.Rules, auth.Marshal(f))
+	g.version++
 	return nil
 }
 
@@ -627,6 +653,7 @@ func (g *DatalogGuard) retract(f auth.Form) error {
 		return err
 	}
 	g.db.Rules = append(g.db.Rules[:idx], g.db.Rules[idx+1:]...)
+	g.version++
 	return nil
 }
 
@@ -765,16 +792,22 @@ func makeDatalogPredicate(p auth.Prin, op string, args []string) auth.Pred {
 
 // Authorize adds an authorization for p to perform op(args).
 func (g *DatalogGuard) Authorize(p auth.Prin, op string, args []string) error {
+	g.m.Lock()
+	defer g.m.Unlock()
 	return g.assert(makeDatalogPredicate(p, op, args))
 }
 
 // Retract removes an authorization for p to perform op(args).
 func (g *DatalogGuard) Retract(p auth.Prin, op string, args []string) error {
+	g.m.Lock()
+	defer g.m.Unlock()
 	return g.retract(makeDatalogPredicate(p, op, args))
 }
 
 // IsAuthorized checks whether p is authorized to perform op(args).
 func (g *DatalogGuard) IsAuthorized(p auth.Prin, op string, args []string) bool {
+	g.m.Lock()
+	defer g.m.Unlock()
 	ok, _ := g.query(makeDatalogPredicate(p, op, args))
 	return ok
 }
@@ -787,13 +820,17 @@ func (g *DatalogGuard) AddRule(rule string) error {
 	if err != nil {
 		return err
 	}
+	g.m.Lock()
+	defer g.m.Unlock()
 	return g.assert(r.Form)
 }
 
 // RetractRule removes a rule previously added via AddRule() or the
 // equivalent Authorize() call.
 func (g *DatalogGuard) RetractRule(rule string) error {
-	err := g.ReloadIfModified()
+	g.m.Lock()
+	defer g.m.Unlock()
+	err := g.reloadIfModified()
 	if err != nil {
 		return err
 	}
@@ -807,15 +844,20 @@ func (g *DatalogGuard) RetractRule(rule string) error {
 
 // Clear removes all rules.
 func (g *DatalogGuard) Clear() error {
+	g.m.Lock()
+	defer g.m.Unlock()
 	g.db.Rules = nil
 	g.dl = dlengine.NewEngine()
+	g.version++
 	return nil
 }
 
 // Query the policy. Implementations of this interface should support
 // at least queries of the form: Authorized(P, op, args...).
 func (g *DatalogGuard) Query(query string) (bool, error) {
-	err := g.ReloadIfModified()
+	g.m.Lock()
+	defer g.m.Unlock()
+	err := g.reloadIfModified()
 	if err != nil {
 		return false, err
 	}
@@ -828,13 +870,55 @@ func (g *DatalogGuard) Query(query string) (bool, error) {
 	return g.query(r.Form)
 }
 
+// policyVersion returns a version of the guard's rules that changes whenever
+// they do, and that no other guard has, see AttestationCache.
+func (g *DatalogGuard) policyVersion() string {
+	g.m.Lock()
+	defer g.m.Unlock()
+	return fmt.Sprintf("DatalogGuard:%d:%d", guardID(&g.id), g.version)
+}
+
+// Revocation returns the revocation checker installed on the guard, or nil.
+func (g *DatalogGuard) Revocation() RevocationChecker {
+	g.m.Lock()
+	defer g.m.Unlock()
+	return g.revocation
+}
+
+// SetRevocation installs a revocation checker on the guard.
+func (g *DatalogGuard) SetRevocation(rc RevocationChecker) {
+	g.m.Lock()
+	defer g.m.Unlock()
+	g.revocation = rc
+}
+
+func (g *DatalogGuard) revocationSerial() uint64 {
+	g.m.Lock()
+	defer g.m.Unlock()
+	return g.db.GetRevocationsSerial()
+}
+
+func (g *DatalogGuard) setRevocationSerial(serial uint64) {
+	g.m.Lock()
+	defer g.m.Unlock()
+	g.db.RevocationsSerial = proto.Uint64(serial)
+}
+
 // RuleCount returns a count of the total number of rules.
 func (g *DatalogGuard) RuleCount() int {
+	g.m.Lock()
+	defer g.m.Unlock()
 	return len(g.db.Rules)
 }
 
 // GetRule returns the ith policy rule, if it exists.
 func (g *DatalogGuard) GetRule(i int) string {
+	g.m.Lock()
+	defer g.m.Unlock()
+	return g.getRule(i)
+}
+
+func (g *DatalogGuard) getRule(i int) string {
 	if i < 0 || i >= len(g.db.Rules) {
 		return ""
 	}
@@ -848,6 +932,8 @@ func (g *DatalogGuard) GetRule(i int) string {
 
 // RuleDebugString returns a debug string for the ith policy rule, if it exists.
 func (g *DatalogGuard) RuleDebugString(i int) string {
+	g.m.Lock()
+	defer g.m.Unlock()
 	if i < 0 || i >= len(g.db.Rules) {
 		return ""
 	}
@@ -861,9 +947,11 @@ func (g *DatalogGuard) RuleDebugString(i int) string {
 
 // String returns a string suitable for showing users authorization info.
 func (g *DatalogGuard) String() string {
+	g.m.Lock()
+	defer g.m.Unlock()
 	rules := make([]string, len(g.db.Rules))
 	for i := range g.db.Rules {
-		rules[i] = g.GetRule(i)
+		rules[i] = g.getRule(i)
 	}
 	return "DatalogGuard{\n" + strings.Join(rules, "\n") + "}\n"
 }
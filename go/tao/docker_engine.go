@@ -0,0 +1,504 @@
+// Copyright (c) 2014, Google, Inc.  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tao
+
+// This is a minimal client for the Docker Engine HTTP API, covering only what
+// LinuxDockerContainerFactory needs. It avoids depending on the docker code.
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DefaultDockerSocket is the unix socket on which the Docker daemon usually
+// serves the Engine API.
+const DefaultDockerSocket = "/var/run/docker.sock"
+
+// dockerAPIVersion is the Engine API version used for all requests. Daemons
+// that don't support it are rejected.
+const dockerAPIVersion = "1.24"
+
+// A DockerError is an error returned by the Docker daemon.
+type DockerError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *DockerError) Error() string {
+	return fmt.Sprintf("docker: %s (status %d)", e.Message, e.StatusCode)
+}
+
+// dockerClient sends requests to the Docker Engine API over a unix socket.
+type dockerClient struct {
+	socket string
+	client *http.Client
+}
+
+func newDockerClient(socket string) *dockerClient {
+	dial := func(network, addr string) (net.Conn, error) {
+		return net.Dial("unix", socket)
+	}
+	return &dockerClient{
+		socket: socket,
+		client: &http.Client{Transport: &http.Transport{Dial: dial}},
+	}
+}
+
+// request builds a request for a versioned API path.
+func (c *dockerClient) request(method, p string, query url.Values, body io.Reader, contentType string) (*http.Request, error) {
+	u := "http://docker/v" + dockerAPIVersion + p
+	if query != nil {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return req, nil
+}
+
+// dockerErrorFrom turns an unsuccessful response into a DockerError.
+func dockerErrorFrom(resp *http.Response) error {
+	b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	var msg struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(b, &msg) != nil || msg.Message == "" {
+		msg.Message = strings.TrimSpace(string(b))
+	}
+	return &DockerError{resp.StatusCode, msg.Message}
+}
+
+// do sends a request and decodes the JSON response into out, if out is not
+// nil.
+func (c *dockerClient) do(method, p string, query url.Values, in, out interface{}) error {
+	var body io.Reader
+	contentType := ""
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+		contentType = "application/json"
+	}
+	req, err := c.request(method, p, query, body, contentType)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return dockerErrorFrom(resp)
+	}
+	if out == nil {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// checkVersion checks that the daemon supports the API version we use.
+func (c *dockerClient) checkVersion() error {
+	req, err := http.NewRequest("GET", "http://docker/version", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return dockerErrorFrom(resp)
+	}
+	var v struct {
+		Version    string
+		APIVersion string `json:"ApiVersion"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return err
+	}
+	if compareAPIVersions(v.APIVersion, dockerAPIVersion) < 0 {
+		return newError("docker %s has API version %s, but %s is needed", v.Version, v.APIVersion, dockerAPIVersion)
+	}
+	return nil
+}
+
+// compareAPIVersions compares dotted version numbers such as "1.24".
+func compareAPIVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// readProgress reads the stream of JSON progress messages returned by build
+// and load requests, returning the image ID reported in it, if any.
+func readProgress(r io.Reader) (string, error) {
+	dec := json.NewDecoder(r)
+	id := ""
+	for {
+		var msg struct {
+			Stream string
+			Error  string
+			Aux    struct{ ID string }
+		}
+		if err := dec.Decode(&msg); err == io.EOF {
+			return id, nil
+		} else if err != nil {
+			return "", err
+		}
+		if msg.Error != "" {
+			return "", &DockerError{http.StatusOK, msg.Error}
+		}
+		if msg.Aux.ID != "" {
+			id = msg.Aux.ID
+		}
+		// Older daemons report the built image only in the output.
+		if s := strings.TrimSpace(msg.Stream); strings.HasPrefix(s, "sha256:") {
+			id = s
+		}
+	}
+}
+
+// postStream sends a request with a tar body and reads the progress stream.
+func (c *dockerClient) postStream(p string, query url.Values, tarball io.Reader) (string, error) {
+	req, err := c.request("POST", p, query, tarball, "application/x-tar")
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return "", dockerErrorFrom(resp)
+	}
+	return readProgress(resp.Body)
+}
+
+// build builds an image from a tar stream holding a Dockerfile and its
+// context, and returns the image ID.
+func (c *dockerClient) build(context io.Reader, tag string) (string, error) {
+	q := url.Values{"t": {tag}, "q": {"1"}, "rm": {"1"}, "forcerm": {"1"}}
+	id, err := c.postStream("/build", q, context)
+	if err != nil {
+		return "", err
+	}
+	if id == "" {
+		return c.imageID(tag)
+	}
+	return id, nil
+}
+
+// load loads an image archive as written by `docker save`.
+func (c *dockerClient) load(archive io.Reader) error {
+	_, err := c.postStream("/images/load", url.Values{"quiet": {"1"}}, archive)
+	return err
+}
+
+// imageID returns the ID of an image, i.e. the digest of its configuration.
+func (c *dockerClient) imageID(name string) (string, error) {
+	var img struct {
+		ID string `json:"Id"`
+	}
+	if err := c.do("GET", "/images/"+name+"/json", nil, nil, &img); err != nil {
+		return "", err
+	}
+	return img.ID, nil
+}
+
+// removeImage removes an image, unless it is still in use.
+func (c *dockerClient) removeImage(name string) error {
+	return c.do("DELETE", "/images/"+name, nil, nil, nil)
+}
+
+// dockerHostConfig is the part of the container HostConfig that we set.
+type dockerHostConfig struct {
+	Binds          []string                       `json:",omitempty"`
+	Links          []string                       `json:",omitempty"`
+	NetworkMode    string                         `json:",omitempty"`
+	PortBindings   map[string][]dockerPortBinding `json:",omitempty"`
+	ExtraHosts     []string                       `json:",omitempty"`
+	Dns            []string                       `json:",omitempty"`
+	Memory         int64                          `json:",omitempty"`
+	CpuShares      int64                          `json:",omitempty"`
+	CapAdd         []string                       `json:",omitempty"`
+	CapDrop        []string                       `json:",omitempty"`
+	ReadonlyRootfs bool                           `json:",omitempty"`
+	Tmpfs          map[string]string              `json:",omitempty"`
+}
+
+// dockerPortBinding is a host address to which a container port is published.
+type dockerPortBinding struct {
+	HostIp   string `json:",omitempty"`
+	HostPort string `json:",omitempty"`
+}
+
+// dockerContainerConfig is the part of the container configuration that we
+// set.
+type dockerContainerConfig struct {
+	Image        string
+	Cmd          []string            `json:",omitempty"`
+	Entrypoint   []string            `json:",omitempty"`
+	Env          []string            `json:",omitempty"`
+	User         string              `json:",omitempty"`
+	WorkingDir   string              `json:",omitempty"`
+	Hostname     string              `json:",omitempty"`
+	Labels       map[string]string   `json:",omitempty"`
+	ExposedPorts map[string]struct{} `json:",omitempty"`
+	AttachStdin  bool
+	AttachStdout bool
+	AttachStderr bool
+	OpenStdin    bool
+	StdinOnce    bool
+	HostConfig   dockerHostConfig
+}
+
+// create creates a container and returns its ID.
+func (c *dockerClient) create(name string, config *dockerContainerConfig) (string, error) {
+	var q url.Values
+	if name != "" {
+		q = url.Values{"name": {name}}
+	}
+	var resp struct {
+		ID string `json:"Id"`
+	}
+	if err := c.do("POST", "/containers/create", q, config, &resp); err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+func (c *dockerClient) start(id string) error {
+	return c.do("POST", "/containers/"+id+"/start", nil, nil, nil)
+}
+
+// wait waits for a container to exit and returns its exit code.
+func (c *dockerClient) wait(id string) (int, error) {
+	var resp struct{ StatusCode int }
+	if err := c.do("POST", "/containers/"+id+"/wait", nil, nil, &resp); err != nil {
+		return -1, err
+	}
+	return resp.StatusCode, nil
+}
+
+// pid returns the host pid of a container's main process.
+func (c *dockerClient) pid(id string) (int, error) {
+	var resp struct{ State struct{ Pid int } }
+	if err := c.do("GET", "/containers/"+id+"/json", nil, nil, &resp); err != nil {
+		return 0, err
+	}
+	return resp.State.Pid, nil
+}
+
+func (c *dockerClient) kill(id, signal string) error {
+	return c.do("POST", "/containers/"+id+"/kill", url.Values{"signal": {signal}}, nil, nil)
+}
+
+func (c *dockerClient) remove(id string) error {
+	return c.do("DELETE", "/containers/"+id, url.Values{"force": {"1"}}, nil, nil)
+}
+
+// attach connects to the stdio of a container that has not been started yet.
+// Output is demultiplexed into stdout and stderr, and stdin, if not nil, is
+// copied to the container. The returned channel is closed when all output has
+// been copied.
+func (c *dockerClient) attach(id string, stdin io.Reader, stdout, stderr io.Writer) (<-chan bool, error) {
+	q := url.Values{"stream": {"1"}, "stdout": {"1"}, "stderr": {"1"}}
+	if stdin != nil {
+		q.Set("stdin", "1")
+	}
+	req, err := c.request("POST", "/containers/"+id+"/attach", q, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "tcp")
+	conn, err := net.Dial("unix", c.socket)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols && resp.StatusCode != http.StatusOK {
+		err = dockerErrorFrom(resp)
+		conn.Close()
+		return nil, err
+	}
+	if stdin != nil {
+		go func() {
+			io.Copy(conn, stdin)
+			if uc, ok := conn.(*net.UnixConn); ok {
+				uc.CloseWrite()
+			}
+		}()
+	}
+	done := make(chan bool)
+	go func() {
+		demuxDockerStream(br, stdout, stderr)
+		conn.Close()
+		close(done)
+	}()
+	return done, nil
+}
+
+// demuxDockerStream copies the multiplexed output of a container without a
+// tty, in which each frame has an 8-byte header giving its stream and length.
+func demuxDockerStream(r io.Reader, stdout, stderr io.Writer) error {
+	var hdr [8]byte
+	for {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		var w io.Writer
+		switch hdr[0] {
+		case 1:
+			w = stdout
+		case 2:
+			w = stderr
+		}
+		if w == nil {
+			w = ioutil.Discard
+		}
+		n := int64(binary.BigEndian.Uint32(hdr[4:]))
+		if _, err := io.CopyN(w, r, n); err != nil {
+			return err
+		}
+	}
+}
+
+// DockerImageDigest returns the content-addressed digest of the image in an
+// image archive, as written by `docker save` and optionally compressed with
+// gzip. This is the digest of the image configuration, which names all of the
+// image's layers by their digests, and it is the image ID that the Docker
+// daemon reports after loading the archive. It returns nil if the archive is
+// not an image archive, e.g. if it is a Dockerfile and build context.
+func DockerImageDigest(archive []byte) ([]byte, error) {
+	var r io.Reader = bytes.NewReader(archive)
+	if len(archive) > 2 && archive[0] == 0x1f && archive[1] == 0x8b {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	files := make(map[string][]byte)
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		name := strings.TrimPrefix(h.Name, "./")
+		// Only the manifest and image configurations are needed, not layers.
+		// In older archives, configurations are top-level .json files, and in
+		// newer ones they are blobs, as are the layers.
+		keep := name == "manifest.json" ||
+			(!strings.Contains(name, "/") && strings.HasSuffix(name, ".json")) ||
+			strings.HasPrefix(name, "blobs/sha256/")
+		if !keep || h.Size > 16*1024*1024 {
+			continue
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[name] = b
+	}
+	m, ok := files["manifest.json"]
+	if !ok {
+		return nil, nil
+	}
+	var manifest []struct{ Config string }
+	if err := json.Unmarshal(m, &manifest); err != nil {
+		return nil, err
+	}
+	if len(manifest) != 1 {
+		return nil, newError("docker image archive must hold exactly one image")
+	}
+	config, ok := files[manifest[0].Config]
+	if !ok {
+		return nil, newError("docker image archive is missing config %s", manifest[0].Config)
+	}
+	h := sha256.Sum256(config)
+	return h[:], nil
+}
+
+// parseImageID decodes an image ID of the form sha256:<hex>.
+func parseImageID(id string) ([]byte, error) {
+	if !strings.HasPrefix(id, "sha256:") {
+		return nil, newError("unrecognized docker image ID %q", id)
+	}
+	return hex.DecodeString(strings.TrimPrefix(id, "sha256:"))
+}
+
+// dockerSocketFromEnv returns the unix socket named by $DOCKER_HOST, if any.
+func dockerSocketFromEnv() string {
+	if h := os.Getenv("DOCKER_HOST"); strings.HasPrefix(h, "unix://") {
+		return strings.TrimPrefix(h, "unix://")
+	}
+	return DefaultDockerSocket
+}
@@ -44,6 +44,17 @@ type Domain struct {
 	ConfigPath string
 	Keys       *Keys
 	Guard      Guard
+
+	// Revocations holds the principals whose attestations the domain no
+	// longer accepts. It is signed by the policy key and stored alongside
+	// the guard policy, which records its serial, see RevokePrincipal. It is
+	// installed on Guard, if Guard is a RevocationGuard.
+	Revocations *RevokedPrincipals
+
+	// ReferenceManifests holds the reference manifests whose values have
+	// been added to the guard policy, see ImportReferenceManifest. It is
+	// signed by the policy key and stored alongside the guard policy.
+	ReferenceManifests []*ImportedReferenceManifest
 }
 
 var errUnknownGuardType = errors.New("unknown guard type")
@@ -170,7 +181,9 @@ func CreateDomain(cfg DomainConfig, configPath string, password []byte) (*Domain
 		return nil, newError("unrecognized guard type: %s", cfg.DomainInfo.GetGuardType())
 	}
 
-	d := &Domain{cfg, configPath, keys, guard}
+	revocations := NewRevokedPrincipals()
+	setGuardRevocation(guard, revocations)
+	d := &Domain{cfg, configPath, keys, guard, revocations, nil}
 	err = d.Save()
 	if err != nil {
 		return nil, err
@@ -184,7 +197,8 @@ func CreateDomain(cfg DomainConfig, configPath string, password []byte) (*Domain
 // Refactor Request's in ca.go to use already existing connection.
 func (d *Domain) CreatePublicCachedDomain(network, addr string, ttl int64) (*Domain, error) {
 	newDomain := &Domain{
-		Config: d.Config,
+		Config:      d.Config,
+		Revocations: d.Revocations,
 	}
 	configDir, configName := path.Split(d.ConfigPath) // '/path/to/', 'file'
 
@@ -200,6 +214,7 @@ func (d *Domain) CreatePublicCachedDomain(network, addr string, ttl int64) (*Dom
 	// Set up a CachedGuard.
 	newDomain.Guard = NewCachedGuard(newDomain.Keys.VerifyingKey,
 		Datalog /*TODO(cjpatton) hardcoded*/, network, addr, ttl)
+	setGuardRevocation(newDomain.Guard, newDomain.Revocations)
 	newDomain.Config.DomainInfo.GuardNetwork = proto.String(network)
 	newDomain.Config.DomainInfo.GuardAddress = proto.String(addr)
 	newDomain.Config.DomainInfo.GuardTtl = proto.Int64(ttl)
@@ -236,6 +251,18 @@ func (d *Domain) CreatePublicCachedDomain(network, addr string, ttl int64) (*Dom
 		return nil, err
 	}
 
+	// Copy the signed revocation list, which can't be signed again without
+	// the policy private key.
+	if d.Config.DomainInfo.GetRevocationsPath() != "" {
+		b, err := ioutil.ReadFile(d.RevocationsPath())
+		if err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(newDomain.RevocationsPath(), b, revocationListFileMode); err != nil {
+			return nil, err
+		}
+	}
+
 	// Save domain.
 	err = newDomain.Save()
 	return newDomain, err
@@ -243,6 +270,10 @@ func (d *Domain) CreatePublicCachedDomain(network, addr string, ttl int64) (*Dom
 
 // Save writes all domain configuration and policy data.
 func (d *Domain) Save() error {
+	saveRevocations := d.Config.DomainInfo.GetRevocationsPath() != "" && d.Revocations != nil && d.Keys.SigningKey != nil
+	if sg, ok := d.Guard.(revocationSerialGuard); ok && saveRevocations {
+		sg.setRevocationSerial(d.Revocations.Serial())
+	}
 	file, err := util.CreatePath(d.ConfigPath, 0777, 0666)
 	if err != nil {
 		return err
@@ -250,6 +281,16 @@ func (d *Domain) Save() error {
 	ds := proto.MarshalTextString(&d.Config)
 	fmt.Fprint(file, ds)
 	file.Close()
+	if saveRevocations {
+		if err := d.Revocations.Save(d.Keys.SigningKey, d.RevocationsPath()); err != nil {
+			return err
+		}
+	}
+	if d.Config.DomainInfo.GetReferenceManifestsPath() != "" && d.Keys.SigningKey != nil {
+		if err := saveReferenceManifestList(d.Keys.SigningKey, d.ReferenceManifestsPath(), d.ReferenceManifests); err != nil {
+			return err
+		}
+	}
 	return d.Guard.Save(d.Keys.SigningKey)
 }
 
@@ -257,7 +298,9 @@ func (d *Domain) Save() error {
 // password is nil, the object will be "locked", meaning that the policy private
 // signing key will not be available, new ACL entries or attestations can not be
 // signed, etc. Otherwise, password will be used to unlock the policy private
-// signing key.
+// signing key. LoadDomain installs the domain's revocation list on the guard,
+// if the guard is a RevocationGuard, so connections checked against the guard
+// reject the attestations the domain has revoked.
 func LoadDomain(configPath string, password []byte) (*Domain, error) {
 	var cfg DomainConfig
 	d, err := ioutil.ReadFile(configPath)
@@ -335,7 +378,158 @@ func LoadDomain(configPath string, password []byte) (*Domain, error) {
 			return nil, errUnknownGuardType
 		}
 	}
-	return &Domain{cfg, configPath, keys, guard}, nil
+
+	// A domain with a revocation list fails closed: the list must be there,
+	// and must be no older than the one the signed guard policy was saved
+	// with. A CachedGuard or a trivial guard records no serial, so there is
+	// nothing to compare the list with.
+	revocations := NewRevokedPrincipals()
+	if rp := cfg.DomainInfo.GetRevocationsPath(); rp != "" {
+		r, err := LoadRevokedPrincipals(keys.VerifyingKey, path.Join(configDir, rp))
+		if err != nil {
+			return nil, err
+		}
+		if sg, ok := guard.(revocationSerialGuard); ok && r.Serial() < sg.revocationSerial() {
+			return nil, newError("tao: revocation list %d is older than the guard policy's list %d",
+				r.Serial(), sg.revocationSerial())
+		}
+		revocations = r
+	}
+	var manifests []*ImportedReferenceManifest
+	if mp := cfg.DomainInfo.GetReferenceManifestsPath(); mp != "" {
+		ms, err := loadReferenceManifestList(keys.VerifyingKey, path.Join(configDir, mp))
+		if err == nil {
+			manifests = ms
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	setGuardRevocation(guard, revocations)
+	return &Domain{cfg, configPath, keys, guard, revocations, manifests}, nil
+}
+
+// RevokePrincipal adds p to the principals whose attestations the domain no
+// longer accepts, see RevokedPrincipals. Save signs and stores the list.
+func (d *Domain) RevokePrincipal(p auth.Prin) {
+	if d.Config.DomainInfo.RevocationsPath == nil {
+		d.Config.DomainInfo.RevocationsPath = proto.String("revocations")
+	}
+	if d.Revocations == nil {
+		d.Revocations = NewRevokedPrincipals()
+		setGuardRevocation(d.Guard, d.Revocations)
+	}
+	d.Revocations.Add(p)
+}
+
+// setGuardRevocation installs r on guard, if guard is a RevocationGuard.
+func setGuardRevocation(guard Guard, r *RevokedPrincipals) {
+	rg, ok := guard.(RevocationGuard)
+	if !ok {
+		return
+	}
+	if r == nil {
+		rg.SetRevocation(nil)
+	} else {
+		rg.SetRevocation(r)
+	}
+}
+
+// RevocationsPath returns the path to the domain's signed revocation list.
+func (d *Domain) RevocationsPath() string {
+	return path.Join(path.Dir(d.ConfigPath), d.Config.DomainInfo.GetRevocationsPath())
+}
+
+// ImportReferenceManifest adds a rule to the guard policy for each value in a
+// reference manifest, e.g. TrustedProgramHash(ext.Program([...])) for the
+// predicate TrustedProgramHash, see ReferenceValueRule. The caller must have
+// checked the signature on the manifest, e.g. with LoadReferenceManifest.
+// The predicate and the rules that the policy didn't already have are kept
+// with the manifest, so RetractReferenceManifest removes only those. Save
+// signs and stores the policy and the list of imported manifests.
+func (d *Domain) ImportReferenceManifest(m *ReferenceManifest, predicate string) error {
+	for _, im := range d.ReferenceManifests {
+		if im.GetManifest().GetName() == m.GetName() && im.GetManifest().GetVersion() == m.GetVersion() {
+			return newError("tao: reference manifest %s %s has already been imported", m.GetName(), m.GetVersion())
+		}
+	}
+	rules, err := referenceManifestRules(predicate, m)
+	if err != nil {
+		return err
+	}
+	var added []string
+	for _, rule := range rules {
+		if guardHasRule(d.Guard, rule) {
+			continue
+		}
+		if err := d.Guard.AddRule(rule); err != nil {
+			for _, r := range added {
+				d.Guard.RetractRule(r)
+			}
+			return err
+		}
+		added = append(added, rule)
+	}
+	if d.Config.DomainInfo.ReferenceManifestsPath == nil {
+		d.Config.DomainInfo.ReferenceManifestsPath = proto.String("reference_manifests")
+	}
+	d.ReferenceManifests = append(d.ReferenceManifests, &ImportedReferenceManifest{
+		Manifest:   m,
+		Predicate:  proto.String(predicate),
+		AddedRules: added,
+	})
+	return nil
+}
+
+// RetractReferenceManifest removes an imported reference manifest, and
+// retracts the rules that importing it added to the policy. A rule that
+// another imported manifest also has a value for is kept, and is retracted
+// with that manifest instead.
+func (d *Domain) RetractReferenceManifest(name, version string) error {
+	var im *ImportedReferenceManifest
+	var rest []*ImportedReferenceManifest
+	for _, other := range d.ReferenceManifests {
+		if im == nil && other.GetManifest().GetName() == name && other.GetManifest().GetVersion() == version {
+			im = other
+		} else {
+			rest = append(rest, other)
+		}
+	}
+	if im == nil {
+		return newError("tao: reference manifest %s %s has not been imported", name, version)
+	}
+	owners := make(map[string]*ImportedReferenceManifest)
+	for _, other := range rest {
+		rules, err := referenceManifestRules(other.GetPredicate(), other.GetManifest())
+		if err != nil {
+			return err
+		}
+		for _, rule := range rules {
+			if owners[rule] == nil {
+				owners[rule] = other
+			}
+		}
+	}
+	for _, rule := range im.AddedRules {
+		if owners[rule] != nil || !guardHasRule(d.Guard, rule) {
+			continue
+		}
+		if err := d.Guard.RetractRule(rule); err != nil {
+			return err
+		}
+	}
+	for _, rule := range im.AddedRules {
+		if other := owners[rule]; other != nil {
+			other.AddedRules = append(other.AddedRules, rule)
+		}
+	}
+	d.ReferenceManifests = rest
+	return nil
+}
+
+// ReferenceManifestsPath returns the path to the domain's signed list of
+// imported reference manifests.
+func (d *Domain) ReferenceManifestsPath() string {
+	return path.Join(path.Dir(d.ConfigPath), d.Config.DomainInfo.GetReferenceManifestsPath())
 }
 
 // ExtendTaoName uses a Domain's Verifying key to extend the Tao with a
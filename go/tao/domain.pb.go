@@ -14,13 +14,17 @@ var _ = &json.SyntaxError{}
 var _ = math.Inf
 
 type DomainDetails struct {
-	Name             *string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
-	PolicyKeysPath   *string `protobuf:"bytes,2,opt,name=policy_keys_path" json:"policy_keys_path,omitempty"`
-	GuardType        *string `protobuf:"bytes,3,opt,name=guard_type" json:"guard_type,omitempty"`
-	GuardNetwork     *string `protobuf:"bytes,4,opt,name=guard_network" json:"guard_network,omitempty"`
-	GuardAddress     *string `protobuf:"bytes,5,opt,name=guard_address" json:"guard_address,omitempty"`
-	GuardTtl         *int64  `protobuf:"varint,6,opt,name=guard_ttl" json:"guard_ttl,omitempty"`
-	XXX_unrecognized []byte  `json:"-"`
+	Name            *string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	PolicyKeysPath  *string `protobuf:"bytes,2,opt,name=policy_keys_path" json:"policy_keys_path,omitempty"`
+	GuardType       *string `protobuf:"bytes,3,opt,name=guard_type" json:"guard_type,omitempty"`
+	GuardNetwork    *string `protobuf:"bytes,4,opt,name=guard_network" json:"guard_network,omitempty"`
+	GuardAddress    *string `protobuf:"bytes,5,opt,name=guard_address" json:"guard_address,omitempty"`
+	GuardTtl        *int64  `protobuf:"varint,6,opt,name=guard_ttl" json:"guard_ttl,omitempty"`
+	RevocationsPath *string `protobuf:"bytes,7,opt,name=revocations_path" json:"revocations_path,omitempty"`
+	// The signed list of reference manifests imported into the policy, see
+	// ReferenceManifestList.
+	ReferenceManifestsPath *string `protobuf:"bytes,8,opt,name=reference_manifests_path" json:"reference_manifests_path,omitempty"`
+	XXX_unrecognized       []byte  `json:"-"`
 }
 
 func (m *DomainDetails) Reset()         { *m = DomainDetails{} }
@@ -69,6 +73,255 @@ func (m *DomainDetails) GetGuardTtl() int64 {
 	return 0
 }
 
+func (m *DomainDetails) GetRevocationsPath() string {
+	if m != nil && m.RevocationsPath != nil {
+		return *m.RevocationsPath
+	}
+	return ""
+}
+
+func (m *DomainDetails) GetReferenceManifestsPath() string {
+	if m != nil && m.ReferenceManifestsPath != nil {
+		return *m.ReferenceManifestsPath
+	}
+	return ""
+}
+
+// A list of principals, e.g. host or program keys or TPM AIKs, whose
+// attestations the domain no longer accepts. Each principal is serialized with
+// auth.Marshal.
+type RevocationList struct {
+	RevokedPrincipals [][]byte `protobuf:"bytes,1,rep,name=revoked_principals" json:"revoked_principals,omitempty"`
+	// Increases with each change to the list. The guard policy records it, so
+	// an older list can be refused.
+	Serial           *uint64 `protobuf:"varint,2,opt,name=serial" json:"serial,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *RevocationList) Reset()         { *m = RevocationList{} }
+func (m *RevocationList) String() string { return proto.CompactTextString(m) }
+func (*RevocationList) ProtoMessage()    {}
+
+func (m *RevocationList) GetRevokedPrincipals() [][]byte {
+	if m != nil {
+		return m.RevokedPrincipals
+	}
+	return nil
+}
+
+func (m *RevocationList) GetSerial() uint64 {
+	if m != nil && m.Serial != nil {
+		return *m.Serial
+	}
+	return 0
+}
+
+// A RevocationList signed by the policy key.
+type SignedRevocationList struct {
+	SerializedList   []byte `protobuf:"bytes,1,req,name=serialized_list" json:"serialized_list,omitempty"`
+	Signature        []byte `protobuf:"bytes,2,req,name=signature" json:"signature,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *SignedRevocationList) Reset()         { *m = SignedRevocationList{} }
+func (m *SignedRevocationList) String() string { return proto.CompactTextString(m) }
+func (*SignedRevocationList) ProtoMessage()    {}
+
+func (m *SignedRevocationList) GetSerializedList() []byte {
+	if m != nil {
+		return m.SerializedList
+	}
+	return nil
+}
+
+func (m *SignedRevocationList) GetSignature() []byte {
+	if m != nil {
+		return m.Signature
+	}
+	return nil
+}
+
+// A reference value for one component of a Tao principal name, e.g. a program
+// binary, a LinuxHost or the PCRs of a TPM, as released by a build system.
+type ReferenceValue struct {
+	// The name of the component, e.g. "demo_server".
+	Name    *string `protobuf:"bytes,1,req,name=name" json:"name,omitempty"`
+	Version *string `protobuf:"bytes,2,opt,name=version" json:"version,omitempty"`
+	// The SHA-256 hash of the binary or image, if any.
+	Sha256 []byte `protobuf:"bytes,3,opt,name=sha256" json:"sha256,omitempty"`
+	// The subprincipal that a host gives the component, in the text form of
+	// auth.SubPrin, e.g. ".Program([...])".
+	Subprincipal     *string `protobuf:"bytes,4,req,name=subprincipal" json:"subprincipal,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *ReferenceValue) Reset()         { *m = ReferenceValue{} }
+func (m *ReferenceValue) String() string { return proto.CompactTextString(m) }
+func (*ReferenceValue) ProtoMessage()    {}
+
+func (m *ReferenceValue) GetName() string {
+	if m != nil && m.Name != nil {
+		return *m.Name
+	}
+	return ""
+}
+
+func (m *ReferenceValue) GetVersion() string {
+	if m != nil && m.Version != nil {
+		return *m.Version
+	}
+	return ""
+}
+
+func (m *ReferenceValue) GetSha256() []byte {
+	if m != nil {
+		return m.Sha256
+	}
+	return nil
+}
+
+func (m *ReferenceValue) GetSubprincipal() string {
+	if m != nil && m.Subprincipal != nil {
+		return *m.Subprincipal
+	}
+	return ""
+}
+
+// A release of reference values, see LoadReferenceManifest.
+type ReferenceManifest struct {
+	Name             *string           `protobuf:"bytes,1,req,name=name" json:"name,omitempty"`
+	Version          *string           `protobuf:"bytes,2,req,name=version" json:"version,omitempty"`
+	Values           []*ReferenceValue `protobuf:"bytes,3,rep,name=values" json:"values,omitempty"`
+	XXX_unrecognized []byte            `json:"-"`
+}
+
+func (m *ReferenceManifest) Reset()         { *m = ReferenceManifest{} }
+func (m *ReferenceManifest) String() string { return proto.CompactTextString(m) }
+func (*ReferenceManifest) ProtoMessage()    {}
+
+func (m *ReferenceManifest) GetName() string {
+	if m != nil && m.Name != nil {
+		return *m.Name
+	}
+	return ""
+}
+
+func (m *ReferenceManifest) GetVersion() string {
+	if m != nil && m.Version != nil {
+		return *m.Version
+	}
+	return ""
+}
+
+func (m *ReferenceManifest) GetValues() []*ReferenceValue {
+	if m != nil {
+		return m.Values
+	}
+	return nil
+}
+
+// A ReferenceManifest signed by a build key.
+type SignedReferenceManifest struct {
+	SerializedManifest []byte `protobuf:"bytes,1,req,name=serialized_manifest" json:"serialized_manifest,omitempty"`
+	Signature          []byte `protobuf:"bytes,2,req,name=signature" json:"signature,omitempty"`
+	XXX_unrecognized   []byte `json:"-"`
+}
+
+func (m *SignedReferenceManifest) Reset()         { *m = SignedReferenceManifest{} }
+func (m *SignedReferenceManifest) String() string { return proto.CompactTextString(m) }
+func (*SignedReferenceManifest) ProtoMessage()    {}
+
+func (m *SignedReferenceManifest) GetSerializedManifest() []byte {
+	if m != nil {
+		return m.SerializedManifest
+	}
+	return nil
+}
+
+func (m *SignedReferenceManifest) GetSignature() []byte {
+	if m != nil {
+		return m.Signature
+	}
+	return nil
+}
+
+// A reference manifest whose values the domain has added to its policy, with
+// the predicate of its rules and the rules that the policy didn't already have,
+// so that they can be removed again.
+type ImportedReferenceManifest struct {
+	Manifest         *ReferenceManifest `protobuf:"bytes,1,req,name=manifest" json:"manifest,omitempty"`
+	Predicate        *string            `protobuf:"bytes,2,req,name=predicate" json:"predicate,omitempty"`
+	AddedRules       []string           `protobuf:"bytes,3,rep,name=added_rules" json:"added_rules,omitempty"`
+	XXX_unrecognized []byte             `json:"-"`
+}
+
+func (m *ImportedReferenceManifest) Reset()         { *m = ImportedReferenceManifest{} }
+func (m *ImportedReferenceManifest) String() string { return proto.CompactTextString(m) }
+func (*ImportedReferenceManifest) ProtoMessage()    {}
+
+func (m *ImportedReferenceManifest) GetManifest() *ReferenceManifest {
+	if m != nil {
+		return m.Manifest
+	}
+	return nil
+}
+
+func (m *ImportedReferenceManifest) GetPredicate() string {
+	if m != nil && m.Predicate != nil {
+		return *m.Predicate
+	}
+	return ""
+}
+
+func (m *ImportedReferenceManifest) GetAddedRules() []string {
+	if m != nil {
+		return m.AddedRules
+	}
+	return nil
+}
+
+// The reference manifests that the domain has imported.
+type ReferenceManifestList struct {
+	Manifests        []*ImportedReferenceManifest `protobuf:"bytes,1,rep,name=manifests" json:"manifests,omitempty"`
+	XXX_unrecognized []byte                       `json:"-"`
+}
+
+func (m *ReferenceManifestList) Reset()         { *m = ReferenceManifestList{} }
+func (m *ReferenceManifestList) String() string { return proto.CompactTextString(m) }
+func (*ReferenceManifestList) ProtoMessage()    {}
+
+func (m *ReferenceManifestList) GetManifests() []*ImportedReferenceManifest {
+	if m != nil {
+		return m.Manifests
+	}
+	return nil
+}
+
+// A ReferenceManifestList signed by the policy key.
+type SignedReferenceManifestList struct {
+	SerializedList   []byte `protobuf:"bytes,1,req,name=serialized_list" json:"serialized_list,omitempty"`
+	Signature        []byte `protobuf:"bytes,2,req,name=signature" json:"signature,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *SignedReferenceManifestList) Reset()         { *m = SignedReferenceManifestList{} }
+func (m *SignedReferenceManifestList) String() string { return proto.CompactTextString(m) }
+func (*SignedReferenceManifestList) ProtoMessage()    {}
+
+func (m *SignedReferenceManifestList) GetSerializedList() []byte {
+	if m != nil {
+		return m.SerializedList
+	}
+	return nil
+}
+
+func (m *SignedReferenceManifestList) GetSignature() []byte {
+	if m != nil {
+		return m.Signature
+	}
+	return nil
+}
+
 type X509Details struct {
 	CommonName         *string `protobuf:"bytes,1,opt,name=common_name" json:"common_name,omitempty"`
 	Country            *string `protobuf:"bytes,2,opt,name=country" json:"country,omitempty"`
@@ -77,6 +77,69 @@ func TestDomainACLSaveAndLoad(t *testing.T) {
 	}
 }
 
+func TestDomainRevocations(t *testing.T) {
+	d, tmpdir := testNewACLDomain(t)
+	defer os.RemoveAll(tmpdir)
+	configPath := path.Join(tmpdir, "tao.config")
+
+	d.RevokePrincipal(authPrin)
+	if err := d.Save(); err != nil {
+		t.Fatal("Couldn't save the domain:", err)
+	}
+	old, err := ioutil.ReadFile(d.RevocationsPath())
+	if err != nil {
+		t.Fatal("Couldn't read the revocation list:", err)
+	}
+	d.RevokePrincipal(auth.NewKeyPrin([]byte(`other fake key`)))
+	if err := d.Save(); err != nil {
+		t.Fatal("Couldn't save the domain:", err)
+	}
+	d2, err := LoadDomain(configPath, testDomainPassword)
+	if err != nil {
+		t.Fatal("Couldn't load the domain:", err)
+	}
+	if len(d2.Revocations.Principals()) != 2 || d2.Revocations.Serial() != d.Revocations.Serial() {
+		t.Fatalf("Loaded revocation list %d %v, want %d with 2 principals",
+			d2.Revocations.Serial(), d2.Revocations.Principals(), d.Revocations.Serial())
+	}
+	if r, ok := GuardRevocation(d2.Guard).(*RevokedPrincipals); !ok || r != d2.Revocations || !r.IsRevoked(authPrin) {
+		t.Fatal("Loading the domain didn't install its revocation list on its guard")
+	}
+
+	// Each domain's guard holds its own list.
+	other, otherdir := testNewACLDomain(t)
+	defer os.RemoveAll(otherdir)
+	d3, err := LoadDomain(path.Join(otherdir, "tao.config"), nil)
+	if err != nil {
+		t.Fatal("Couldn't load the domain:", err)
+	}
+	if r := GuardRevocation(d3.Guard).(*RevokedPrincipals); r.IsRevoked(authPrin) || GuardRevocation(d2.Guard) != d2.Revocations {
+		t.Fatal("Loading a second domain changed the revocation lists")
+	}
+	if GuardRevocation(other.Guard) != other.Revocations {
+		t.Fatal("Creating the domain didn't install its revocation list on its guard")
+	}
+
+	// The signed ACLs record the serial of the list, not the config.
+	if g := d2.Guard.(*ACLGuard); g.revocationSerial() != d.Revocations.Serial() {
+		t.Fatalf("The guard recorded revocation list %d, want %d", g.revocationSerial(), d.Revocations.Serial())
+	}
+
+	// An older list, or no list at all, is refused.
+	if err := ioutil.WriteFile(d.RevocationsPath(), old, revocationListFileMode); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadDomain(configPath, testDomainPassword); err == nil {
+		t.Fatal("Loaded a domain with an old revocation list")
+	}
+	if err := os.Remove(d.RevocationsPath()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadDomain(configPath, testDomainPassword); err == nil {
+		t.Fatal("Loaded a domain without its revocation list")
+	}
+}
+
 func testNewDatalogDomain(t *testing.T) (*Domain, string) {
 	tmpdir, err := ioutil.TempDir("/tmp", "datalog_domain_test")
 	if err != nil {
@@ -128,3 +191,71 @@ func TestDomainDatalogSaveAndLoad(t *testing.T) {
 		t.Fatal("The string representation of the loaded datalog guard didn't match the original")
 	}
 }
+
+func TestDomainReferenceManifests(t *testing.T) {
+	d, tmpdir := testNewACLDomain(t)
+	defer os.RemoveAll(tmpdir)
+
+	var values []*ReferenceValue
+	var rules []string
+	for _, name := range []string{"a", "b", "c"} {
+		v := NewReferenceValue(name, "", []byte(name), FormatProcessSubprin(0, []byte(name)))
+		rule, err := ReferenceValueRule("TrustedProgramHash", v)
+		if err != nil {
+			t.Fatal("Couldn't make a rule for a reference value:", err)
+		}
+		values = append(values, v)
+		rules = append(rules, rule)
+	}
+	v1 := &ReferenceManifest{Name: proto.String("release"), Version: proto.String("1"), Values: values[:2]}
+	v2 := &ReferenceManifest{Name: proto.String("release"), Version: proto.String("2"), Values: values[1:]}
+	// A rule that the policy already has isn't retracted with a manifest.
+	if err := d.Guard.AddRule(rules[2]); err != nil {
+		t.Fatal("Couldn't add a rule:", err)
+	}
+	if err := d.ImportReferenceManifest(v1, "TrustedProgramHash"); err != nil {
+		t.Fatal("Couldn't import a reference manifest:", err)
+	}
+	if err := d.ImportReferenceManifest(v2, "TrustedProgramHash"); err != nil {
+		t.Fatal("Couldn't import a reference manifest:", err)
+	}
+	if err := d.ImportReferenceManifest(v1, "TrustedProgramHash"); err == nil {
+		t.Fatal("A reference manifest was imported twice")
+	}
+	if n := d.Guard.RuleCount(); n != 3 {
+		t.Fatalf("The policy has %d rules after importing the manifests, want 3", n)
+	}
+	if err := d.Save(); err != nil {
+		t.Fatal("Couldn't save the domain:", err)
+	}
+
+	d2, err := LoadDomain(path.Join(tmpdir, "tao.config"), testDomainPassword)
+	if err != nil {
+		t.Fatal("Couldn't load the domain:", err)
+	}
+	if len(d2.ReferenceManifests) != 2 {
+		t.Fatalf("Loaded %d reference manifests, want 2", len(d2.ReferenceManifests))
+	}
+	if p := d2.ReferenceManifests[1].GetPredicate(); p != "TrustedProgramHash" {
+		t.Fatalf("Loaded a reference manifest with predicate %q, want TrustedProgramHash", p)
+	}
+	if err := d2.RetractReferenceManifest("release", "1"); err != nil {
+		t.Fatal("Couldn't retract a reference manifest:", err)
+	}
+	for i, want := range []bool{false, true, true} {
+		if ok, _ := d2.Guard.Query(rules[i]); ok != want {
+			t.Fatalf("After the retraction, query %s returned %v, want %v", rules[i], ok, want)
+		}
+	}
+	if err := d2.RetractReferenceManifest("release", "1"); err == nil {
+		t.Fatal("A reference manifest was retracted twice")
+	}
+	if err := d2.RetractReferenceManifest("release", "2"); err != nil {
+		t.Fatal("Couldn't retract a reference manifest:", err)
+	}
+	for i, want := range []bool{false, false, true} {
+		if ok, _ := d2.Guard.Query(rules[i]); ok != want {
+			t.Fatalf("After both retractions, query %s returned %v, want %v", rules[i], ok, want)
+		}
+	}
+}
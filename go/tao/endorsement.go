@@ -0,0 +1,154 @@
+// Copyright (c) 2016, Google Inc.  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tao
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/jlmucb/cloudproxy/go/tao/auth"
+)
+
+// EndorsedGuard reads the SerializedEndorsements in an attestation and returns
+// a guard that holds the policy of guard plus the endorsed predicates, along
+// with the endorsements. Only predicates signed directly by the policy key v
+// are admitted. The returned guard is a temporary copy, so the endorsements
+// never change guard itself and don't affect decisions about other peers. It
+// carries the revocation checker of guard, see RevocationGuard. If there are
+// no endorsements, EndorsedGuard returns guard.
+func EndorsedGuard(guard Guard, a *Attestation, v *Verifier) (Guard, []*Attestation, error) {
+	endorsements, preds, err := verifyEndorsements(a, v)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(preds) == 0 {
+		return guard, nil, nil
+	}
+	overlay, err := newGuardOverlay(guard)
+	if err != nil {
+		return nil, nil, err
+	}
+	if rg, ok := overlay.(RevocationGuard); ok {
+		rg.SetRevocation(GuardRevocation(guard))
+	}
+	for _, pred := range preds {
+		if err := overlay.AddRule(pred.String()); err != nil {
+			return nil, nil, err
+		}
+	}
+	return overlay, endorsements, nil
+}
+
+// verifyEndorsements checks the SerializedEndorsements in an attestation and
+// returns them along with the predicates they endorse.
+func verifyEndorsements(a *Attestation, v *Verifier) ([]*Attestation, []auth.Pred, error) {
+	var endorsements []*Attestation
+	var preds []auth.Pred
+	// Before validating against the guard, check to see if there are any
+	// predicates endorsed by the policy key. This allows truncated principals
+	// to get the Tao CA to sign a statement of the form
+	// TrustedHash(ext.Program(...)).
+	for _, e := range a.SerializedEndorsements {
+		if v == nil {
+			return nil, nil, fmt.Errorf("no policy key to check endorsements")
+		}
+
+		var ea Attestation
+		if err := proto.Unmarshal(e, &ea); err != nil {
+			return nil, nil, err
+		}
+		if ea.SerializedDelegation != nil {
+			return nil, nil, fmt.Errorf("an endorsement must be signed directly by the policy key")
+		}
+
+		f, err := auth.UnmarshalForm(ea.SerializedStatement)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		says, ok := f.(auth.Says)
+		if !ok {
+			return nil, nil, fmt.Errorf("a serialized endorsement must be an auth.Says")
+		}
+
+		now := time.Now().UnixNano()
+		if says.Time != nil && now < *says.Time {
+			return nil, nil, fmt.Errorf("an endorsement is not yet valid")
+		}
+		if says.Expiration != nil && now > *says.Expiration {
+			return nil, nil, fmt.Errorf("an endorsement has expired")
+		}
+
+		pred, ok := says.Message.(auth.Pred)
+		if !ok {
+			return nil, nil, fmt.Errorf("the message in an endorsement must be a predicate")
+		}
+
+		signerPrin := auth.NewPrin(ea.GetSignerType(), ea.SignerKey)
+
+		if !signerPrin.Identical(says.Speaker) {
+			return nil, nil, fmt.Errorf("the speaker of an endorsement must be the signer: %v vs %v", signerPrin, says.Speaker)
+		}
+		if !v.ToPrincipal().Identical(signerPrin) {
+			return nil, nil, fmt.Errorf("the signer of an endorsement must be the guard's policy key")
+		}
+		if ok, err := v.Verify(ea.SerializedStatement, AttestationSigningContext, ea.Signature); (err != nil) || !ok {
+			return nil, nil, fmt.Errorf("the signature on an endorsement didn't pass verification")
+		}
+
+		endorsements = append(endorsements, &ea)
+		preds = append(preds, pred)
+	}
+
+	return endorsements, preds, nil
+}
+
+// newGuardOverlay returns a temporary guard with a copy of the policy of
+// guard, to which rules can be added without changing guard. The policy is
+// copied as it is, without reloading guard, since this runs during handshakes
+// that may use guard concurrently.
+func newGuardOverlay(guard Guard) (Guard, error) {
+	switch g := guard.(type) {
+	case TrivialGuard:
+		// A trivial policy ignores rules, so there is nothing to copy.
+		return g, nil
+	case *ACLGuard:
+		return &ACLGuard{ACL: append([]string(nil), g.ACL...)}, nil
+	case *DatalogGuard:
+		g.m.Lock()
+		rules := append([][]byte(nil), g.db.Rules...)
+		g.m.Unlock()
+		dg := NewTemporaryDatalogGuard().(*DatalogGuard)
+		for _, rule := range rules {
+			f, err := auth.UnmarshalForm(rule)
+			if err != nil {
+				return nil, err
+			}
+			if err := dg.assert(f); err != nil {
+				return nil, err
+			}
+		}
+		return dg, nil
+	case *CachedGuard:
+		// Overlay the policy the cache holds, rather than fetching it.
+		if g.guard == nil {
+			return nil, newError("the cached guard has no policy to endorse against")
+		}
+		return newGuardOverlay(g.guard)
+	default:
+		return nil, newError("endorsements are not supported for guard %T", guard)
+	}
+}
@@ -40,6 +40,11 @@ type Host interface {
 	Attest(childSubprin auth.SubPrin, issuer *auth.Prin,
 		time, expiration *int64, message auth.Form) (*Attestation, error)
 
+	// AttestNonce is like Attest, but binds a nonce chosen by a verifier into
+	// the attestation.
+	AttestNonce(childSubprin auth.SubPrin, issuer *auth.Prin,
+		time, expiration *int64, nonce []byte, message auth.Form) (*Attestation, error)
+
 	// Encrypt data so that only this host can access it.
 	Encrypt(data []byte) (encrypted []byte, err error)
 
@@ -15,8 +15,17 @@
 package tao
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
+	"hash"
 	"io"
+	"io/ioutil"
 	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
 
 	"github.com/jlmucb/cloudproxy/go/tao/auth"
 )
@@ -72,6 +81,203 @@ type HostedProgramSpec struct {
 	// factory-specific default environment will be used. Some factories may
 	// modify the environment, e.g. to pass certain parameters across a fork.
 	Env []string
+
+	// Measure, if not nil, selects measured configuration: the hosted program's
+	// subprincipal then covers some of its configuration as well as its code.
+	// Factories that don't support this return an error if it is set.
+	Measure *ConfigMeasurement
+
+	// Script, if not nil, selects measured launch of an interpreted program:
+	// Path is then a script, and the interpreters that run it and its declared
+	// dependencies are measured along with it. Factories that don't support
+	// this return an error if it is set.
+	Script *ScriptMeasurement
+}
+
+// A ConfigMeasurement selects the configuration of a hosted program that is
+// measured into its subprincipal, in addition to the program itself. A hash
+// of the selected configuration is appended to the subprincipal as an extra
+// Config([...]) component, e.g. Program(1, [...]).Config([...]), so policies
+// can pin the configuration as well as the code. Two launches of the same
+// program with different configurations then get different Tao names.
+type ConfigMeasurement struct {
+
+	// Args selects whether the arguments are measured.
+	Args bool
+
+	// Env names the environment variables that are measured. Each is measured
+	// with its value, or as missing if it isn't set.
+	Env []string
+
+	// Files names configuration files that are measured. Relative paths are
+	// relative to the spec's Dir. Files are measured when the hosted program
+	// is created, so they should not be writable by anyone the policy does
+	// not trust. Each must be a regular file, not a symlink, that the user the
+	// hosted program runs as can read.
+	Files []string
+}
+
+// A ScriptMeasurement selects measured launch of an interpreted program, e.g.
+// a #! script, a Python program, or a JVM jar. The interpreter is taken from
+// Interpreter or, if that is empty, from the script's #! line, following
+// "#!/usr/bin/env name" and interpreters that are themselves scripts. The
+// subprincipal names each interpreter, outermost first, then the script, then
+// the dependencies, e.g.
+//
+//	Interpreter([...], "-u").Script(1, [...]).Deps([...])
+//
+// so policies can authorize script X only under interpreter Y.
+type ScriptMeasurement struct {
+
+	// Interpreter, if not empty, is the interpreter for the script, e.g.
+	// "python3" or "/usr/bin/java". If it is not a path, it is found using the
+	// hosted program's $PATH.
+	Interpreter string
+
+	// InterpreterArgs are passed to Interpreter before the script, e.g. "-jar".
+	// They are measured with the interpreter.
+	InterpreterArgs []string
+
+	// Dependencies names files and directories the script depends on, e.g. a
+	// lock file or a module directory. Relative paths are relative to the
+	// spec's Dir. Directories are measured recursively. Unlike the
+	// interpreters, which are copied as they are measured, these are measured
+	// in place when the hosted program is created, so they should not be
+	// writable by anyone the policy does not trust.
+	Dependencies []string
+}
+
+// writeMeasured writes a length-prefixed string to a measurement hash, so
+// that distinct lists of strings can't produce the same hash.
+func writeMeasured(h hash.Hash, s string) {
+	var n [8]byte
+	binary.BigEndian.PutUint64(n[:], uint64(len(s)))
+	h.Write(n[:])
+	h.Write([]byte(s))
+}
+
+// maxMeasuredFileSize is the size of the largest file, e.g. a configuration
+// file or an interpreter, that is measured for a hosted program.
+const maxMeasuredFileSize = 256 * 1024 * 1024
+
+// openMeasured opens a file that is measured for the hosted program in spec.
+// It refuses symlinks, anything but regular files, files larger than
+// maxMeasuredFileSize, and files that the user the program runs as couldn't
+// read, so that a caller can't learn the hash of a file it can't read.
+func openMeasured(spec HostedProgramSpec, p string) (*os.File, error) {
+	f, err := os.OpenFile(p, os.O_RDONLY|syscall.O_NOFOLLOW|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		f.Close()
+		return nil, newError("can't measure %s: not a regular file", p)
+	}
+	if fi.Size() > maxMeasuredFileSize {
+		f.Close()
+		return nil, newError("can't measure %s: larger than %d bytes", p, maxMeasuredFileSize)
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok && spec.Uid != 0 {
+		perm := fi.Mode().Perm()
+		readable := perm&0004 != 0 ||
+			(int(st.Gid) == spec.Gid && perm&0040 != 0) ||
+			(int(st.Uid) == spec.Uid && perm&0400 != 0)
+		if !readable {
+			f.Close()
+			return nil, newError("can't measure %s: not readable by uid %d", p, spec.Uid)
+		}
+	}
+	return f, nil
+}
+
+// readMeasured reads a file that is measured for the hosted program in spec,
+// see openMeasured.
+func readMeasured(spec HostedProgramSpec, p string) ([]byte, error) {
+	f, err := openMeasured(spec, p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b, err := ioutil.ReadAll(io.LimitReader(f, maxMeasuredFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxMeasuredFileSize {
+		return nil, newError("can't measure %s: larger than %d bytes", p, maxMeasuredFileSize)
+	}
+	return b, nil
+}
+
+// MeasureConfig returns a hash of the configuration of a hosted program
+// selected by spec.Measure, or nil if spec.Measure is nil. The environment is
+// taken from spec.Env or, if that is nil, from defaultEnv.
+func MeasureConfig(spec HostedProgramSpec, defaultEnv []string) ([]byte, error) {
+	m := spec.Measure
+	if m == nil {
+		return nil, nil
+	}
+	h := sha256.New()
+	writeMeasured(h, "args")
+	if m.Args {
+		writeMeasured(h, "yes")
+		writeMeasured(h, strconv.Itoa(len(spec.Args)))
+		for _, arg := range spec.Args {
+			writeMeasured(h, arg)
+		}
+	} else {
+		writeMeasured(h, "no")
+	}
+
+	env := spec.Env
+	if env == nil {
+		env = defaultEnv
+	}
+	names := append([]string(nil), m.Env...)
+	sort.Strings(names)
+	writeMeasured(h, "env")
+	writeMeasured(h, strconv.Itoa(len(names)))
+	for _, name := range names {
+		writeMeasured(h, name)
+		value, found := "", false
+		for _, pair := range env {
+			if strings.HasPrefix(pair, name+"=") {
+				value, found = pair[len(name)+1:], true
+			}
+		}
+		if found {
+			writeMeasured(h, "set")
+			writeMeasured(h, value)
+		} else {
+			writeMeasured(h, "unset")
+		}
+	}
+
+	writeMeasured(h, "files")
+	for _, name := range m.Files {
+		p := name
+		if !path.IsAbs(p) {
+			p = path.Join(spec.Dir, p)
+		}
+		b, err := readMeasured(spec, p)
+		if err != nil {
+			return nil, err
+		}
+		fh := sha256.Sum256(b)
+		writeMeasured(h, name)
+		writeMeasured(h, string(fh[:]))
+	}
+	return h.Sum(nil), nil
+}
+
+// FormatConfigSubprin produces the subprincipal extension that represents a
+// measured configuration with the given hash.
+func FormatConfigSubprin(hash []byte) auth.SubPrin {
+	return auth.SubPrin{auth.PrinExt{Name: "Config", Arg: []auth.Term{auth.Bytes(hash)}}}
 }
 
 // A HostedProgram is an abstraction of a process. It is closely related to
@@ -0,0 +1,118 @@
+// Copyright (c) 2016, Google Inc.  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tao
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/golang/glog"
+	"github.com/jlmucb/cloudproxy/go/tao/auth"
+)
+
+// connContextKey is the context key for the Tao connection that carried an
+// HTTP request.
+type connContextKey struct{}
+
+// NewHTTPServer returns an http.Server that serves handler. Serve it on a Tao
+// listener, e.g. from Listen, and the context of each request carries the Tao
+// connection it came on, see ConnFromContext and PeerPrincipalFromContext.
+func NewHTTPServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler: handler,
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			if tc, ok := c.(*Conn); ok {
+				ctx = context.WithValue(ctx, connContextKey{}, tc)
+			}
+			return ctx
+		},
+	}
+}
+
+// ConnFromContext returns the Tao connection that carried the request with
+// context ctx, or nil if the request didn't come from a server made by
+// NewHTTPServer on a Tao listener.
+func ConnFromContext(ctx context.Context) *Conn {
+	c, _ := ctx.Value(connContextKey{}).(*Conn)
+	return c
+}
+
+// PeerPrincipalFromContext returns the principal that made the request with
+// context ctx, as authenticated by the Tao handshake. It returns false if the
+// request didn't come on a Tao connection or the peer didn't authenticate.
+func PeerPrincipalFromContext(ctx context.Context) (auth.Prin, bool) {
+	c := ConnFromContext(ctx)
+	if c == nil || c.PeerPrincipal().KeyHash == nil {
+		return auth.Prin{}, false
+	}
+	return c.PeerPrincipal(), true
+}
+
+// AuthorizeHTTP returns a handler that serves a request with h only if guard
+// authorizes the peer that made it to perform the request's method on its
+// path, i.e. guard.IsAuthorized(peer, r.Method, []string{r.URL.Path}). If
+// guard is nil, each request is checked against the guard of its connection,
+// which holds the peer's endorsements, see Conn.Guard. Other requests fail
+// with 403 Forbidden.
+func AuthorizeHTTP(guard Guard, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer, ok := PeerPrincipalFromContext(r.Context())
+		if !ok {
+			glog.Infof("Rejected unauthenticated HTTP request for %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		g := guard
+		if g == nil {
+			g = ConnFromContext(r.Context()).Guard()
+		}
+		if g == nil || !g.IsAuthorized(peer, r.Method, []string{r.URL.Path}) {
+			glog.Infof("Rejected HTTP request for %s %s from %s", r.Method, r.URL.Path, peer)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// NewHTTPTransport returns an http.RoundTripper that makes https requests over
+// Tao connections from DialWithOptions, which present keys to the server and
+// require guard to authorize the server, see Dial. It refuses plain http
+// requests.
+func NewHTTPTransport(guard Guard, v *Verifier, keys *Keys, opts DialOptions) http.RoundTripper {
+	return &httpTransport{&http.Transport{
+		DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return DialWithOptions(network, addr, guard, v, keys, opts)
+		},
+	}}
+}
+
+// httpTransport is an http.Transport that only makes https requests, since
+// only those go over Tao connections.
+type httpTransport struct {
+	*http.Transport
+}
+
+// RoundTrip makes an https request over a Tao connection.
+func (t *httpTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.URL.Scheme != "https" {
+		if r.Body != nil {
+			r.Body.Close()
+		}
+		return nil, newError("can't make a %s request over a Tao connection", r.URL.Scheme)
+	}
+	return t.Transport.RoundTrip(r)
+}
@@ -33,7 +33,6 @@ import (
 	"os/exec"
 	"path"
 	"strconv"
-	"syscall"
 	"time"
 
 	"github.com/golang/glog"
@@ -52,6 +51,9 @@ type CoreOSConfig struct {
 	RulesPath  string
 	SSHKeysCfg string
 	SocketPath string
+	// How long Stop waits for the guest to power down before killing it. If
+	// zero, DefaultVMShutdownTimeout is used.
+	ShutdownTimeout time.Duration
 }
 
 // A KvmCoreOSContainer represents a hosted program running as a CoreOS image on
@@ -88,6 +90,9 @@ type KvmCoreOSContainer struct {
 	// The underlying vm process.
 	QCmd *exec.Cmd
 
+	// The QMP connection to the vm process.
+	monitor *qemuMonitor
+
 	// Path to linux host.
 	// TODO(kwalsh) is this description correct?
 	LHPath string
@@ -101,11 +106,9 @@ func (kcc *KvmCoreOSContainer) WaitChan() <-chan bool {
 	return kcc.Done
 }
 
-// Kill sends a SIGKILL signal to a QEMU instance.
+// Kill sends a SIGKILL signal to a QEMU instance. Use Stop to power down the
+// guest cleanly.
 func (kcc *KvmCoreOSContainer) Kill() error {
-	// Kill the qemu command directly.
-	// TODO(tmroeder): rewrite this using qemu's communication/management
-	// system; sending SIGKILL is definitely not the right way to do this.
 	return kcc.QCmd.Process.Kill()
 }
 
@@ -219,6 +222,7 @@ func (kcc *KvmCoreOSContainer) startVM() error {
 		"-cpu", "host",
 		"-smp", "4",
 		"-nographic"} // for now, we add -nographic explicitly.
+	qemuArgs = append(qemuArgs, kcc.monitor.args()...)
 	// TODO(tmroeder): append args later.
 	//qemuArgs = append(qemuArgs, kcc.spec.Args...)
 
@@ -232,12 +236,10 @@ func (kcc *KvmCoreOSContainer) startVM() error {
 	return kcc.QCmd.Start()
 }
 
-// Stop sends a SIGSTOP signal to a docker container.
+// Stop asks the guest to power down over QMP, and kills QEMU if the guest
+// hasn't shut down after Cfg.ShutdownTimeout.
 func (kcc *KvmCoreOSContainer) Stop() error {
-	// Stop the QEMU/KVM process with SIGSTOP.
-	// TODO(tmroeder): rewrite this using qemu's communication/management
-	// system; sending SIGSTOP is definitely not the right way to do this.
-	return kcc.QCmd.Process.Signal(syscall.SIGSTOP)
+	return kcc.monitor.stop(kcc.QCmd.Process, kcc.Done, kcc.Cfg.ShutdownTimeout)
 }
 
 // Pid returns a numeric ID for this container.
@@ -245,16 +247,15 @@ func (kcc *KvmCoreOSContainer) Pid() int {
 	return kcc.QCmd.Process.Pid
 }
 
-// ExitStatus returns an exit code for the container.
+// ExitStatus returns an exit code for the vm, derived from the guest shutdown
+// reason: VMExitShutdown, VMExitPanic or VMExitCrash.
 func (kcc *KvmCoreOSContainer) ExitStatus() (int, error) {
-	s := kcc.QCmd.ProcessState
-	if s == nil {
-		return -1, fmt.Errorf("Child has not exited")
-	}
-	if code, ok := (*s).Sys().(syscall.WaitStatus); ok {
-		return int(code), nil
-	}
-	return -1, fmt.Errorf("Couldn't get exit status\n")
+	return kcc.monitor.exitStatus()
+}
+
+// VMStatus queries QEMU for the status of the vm.
+func (kcc *KvmCoreOSContainer) VMStatus() (*VMStatus, error) {
+	return kcc.monitor.status()
 }
 
 // A LinuxKVMCoreOSFactory manages hosted programs started as QEMU/KVM
@@ -318,6 +319,10 @@ func CloudConfigFromSSHKeys(keysFile string) (string, error) {
 // subprincipal for authorization purposes.
 func (lkcf *LinuxKVMCoreOSFactory) NewHostedProgram(spec HostedProgramSpec) (child HostedProgram, err error) {
 	// (id uint, image string, uid, gid int) (auth.SubPrin, string, error) {
+	if spec.Measure != nil || spec.Script != nil {
+		err = fmt.Errorf("measured configuration and scripts are not supported for CoreOS VMs")
+		return
+	}
 	// TODO(tmroeder): the combination of TeeReader and ReadAll doesn't seem
 	// to copy the entire image, so we're going to hash in place for now.
 	// This needs to be fixed to copy the image so we can avoid a TOCTTOU
@@ -415,13 +420,15 @@ func (kcc *KvmCoreOSContainer) Start() (channel io.ReadWriteCloser, err error) {
 	// Create a new docker image from the filesystem tarball, and use it to
 	// build a container and launch it.
 	kcc.Cfg = &CoreOSConfig{
-		Name:       getRandomFileName(nameLen),
-		ImageFile:  kcc.Factory.Cfg.ImageFile, // the VM image
-		Memory:     kcc.Factory.Cfg.Memory,
-		RulesPath:  kcc.Factory.Cfg.RulesPath,
-		SSHKeysCfg: sshCfg,
-		SocketPath: sockPath,
+		Name:            getRandomFileName(nameLen),
+		ImageFile:       kcc.Factory.Cfg.ImageFile, // the VM image
+		Memory:          kcc.Factory.Cfg.Memory,
+		RulesPath:       kcc.Factory.Cfg.RulesPath,
+		SSHKeysCfg:      sshCfg,
+		SocketPath:      sockPath,
+		ShutdownTimeout: kcc.Factory.Cfg.ShutdownTimeout,
 	}
+	kcc.monitor = newQEMUMonitor(sockPath + ".qmp")
 
 	// Create the listening server before starting the connection. This lets
 	// QEMU start right away. See the comments in Start, above, for why this
@@ -436,7 +443,11 @@ func (kcc *KvmCoreOSContainer) Start() (channel io.ReadWriteCloser, err error) {
 	if err = kcc.startVM(); err != nil {
 		return
 	}
-	// TODO(kwalsh) reap and clenaup when vm dies; see linux_process_factory.go
+	go kcc.monitor.wait(kcc.QCmd, kcc.Done)
+	if err = kcc.monitor.connect(qmpTimeout); err != nil {
+		glog.Errorf("Couldn't connect to QMP for vm %d: %s", kcc.QCmd.Process.Pid, err)
+		err = nil
+	}
 
 	// We need some way to wait for the socket to open before we can connect
 	// to it and return the ReadWriteCloser for communication. Also we need
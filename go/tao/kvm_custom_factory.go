@@ -16,6 +16,7 @@ package tao
 
 import (
 	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -24,7 +25,7 @@ import (
 	"os/exec"
 	"path"
 	"strconv"
-	"syscall"
+	"strings"
 	"time"
 
 	"github.com/golang/glog"
@@ -44,6 +45,31 @@ type VmConfig struct {
 	SocketPath string
 	// The port on the host that will be forwarded to port 22 on the guest for SSH.
 	Port string
+	// How long Stop waits for the guest to power down before killing it. If
+	// zero, DefaultVMShutdownTimeout is used.
+	ShutdownTimeout time.Duration
+	// The QEMU machine type, CPU model and number of CPUs. If empty or zero,
+	// QEMU's defaults are used. These are measured, see MeasureVmConfig.
+	Machine string
+	CPU     string
+	SMP     int
+	// The kernel command line.
+	Cmdline string
+	// Disk images attached to the guest, in order.
+	Disks []VmDisk
+}
+
+// A VmDisk is a disk image attached read-only to a custom VM. If
+// VerityRootHash is set, the image is measured by its dm-verity root hash
+// instead of by hashing the whole image. This only binds the contents of the
+// disk if the measured kernel command line or initramfs makes the guest
+// check the disk with dm-verity against that root hash. Otherwise, the image
+// is opened once to be hashed, and QEMU gets that open file rather than the
+// path, so the image can't be swapped after it is measured.
+type VmDisk struct {
+	Path           string
+	VerityRootHash []byte
+	file           *os.File
 }
 
 // A KvmCustomContainer represents a hosted program running as a VM on
@@ -61,6 +87,16 @@ type KvmCustomContainer struct {
 	// Hash fo the InitRam image.
 	InitRamHash []byte
 
+	// Hash of the kernel command line.
+	CmdlineHash []byte
+
+	// Measurement of each disk in Cfg.Disks: the hash of the image, or its
+	// dm-verity root hash.
+	DiskHashes [][]byte
+
+	// Measurement of the machine configuration, see MeasureVmConfig.
+	ConfigHash []byte
+
 	// The factory responsible for the vm.
 	Factory *LinuxKVMCustomFactory
 
@@ -71,6 +107,9 @@ type KvmCustomContainer struct {
 	// The underlying vm process.
 	QCmd *exec.Cmd
 
+	// The QMP connection to the vm process.
+	monitor *qemuMonitor
+
 	// A channel to be signaled when the vm is done.
 	Done chan bool
 }
@@ -80,11 +119,9 @@ func (kcc *KvmCustomContainer) WaitChan() <-chan bool {
 	return kcc.Done
 }
 
-// Kill sends a SIGKILL signal to a QEMU instance.
+// Kill sends a SIGKILL signal to a QEMU instance. Use Stop to power down the
+// guest cleanly.
 func (kcc *KvmCustomContainer) Kill() error {
-	// Kill the qemu command directly.
-	// TODO(tmroeder): rewrite this using qemu's communication/management
-	// system; sending SIGKILL is definitely not the right way to do this.
 	return kcc.QCmd.Process.Kill()
 }
 
@@ -107,22 +144,59 @@ func (kcc *KvmCustomContainer) startVM() error {
 		// The kernel and initram image to boot from.
 		"-kernel", cfg.KernelPath,
 		"-initrd", cfg.InitRamPath,
+		"-append", cfg.Cmdline,
+	}
+	var extraFiles []*os.File
+	for i, d := range cfg.Disks {
+		// Commas in the path are escaped by doubling them.
+		file := strings.Replace(d.Path, ",", ",,", -1)
+		if d.file != nil {
+			// Measured images are passed as fds 3 and up, each in its own
+			// fd set.
+			extraFiles = append(extraFiles, d.file)
+			qemuArgs = append(qemuArgs, "-add-fd",
+				fmt.Sprintf("fd=%d,set=%d", 2+len(extraFiles), i))
+			file = fmt.Sprintf("/dev/fdset/%d", i)
+		}
+		qemuArgs = append(qemuArgs, "-drive", "file="+file+",if=virtio,format=raw,readonly=on")
+	}
+	if cfg.Machine != "" {
+		qemuArgs = append(qemuArgs, "-machine", cfg.Machine)
+	}
+	if cfg.CPU != "" {
+		qemuArgs = append(qemuArgs, "-cpu", cfg.CPU)
+	}
+	if cfg.SMP != 0 {
+		qemuArgs = append(qemuArgs, "-smp", strconv.Itoa(cfg.SMP))
 	}
+	qemuArgs = append(qemuArgs, kcc.monitor.args()...)
 
 	kcc.QCmd = exec.Command(qemuProg, qemuArgs...)
 	kcc.QCmd.Stdin = os.Stdin
 	kcc.QCmd.Stdout = os.Stdout
 	kcc.QCmd.Stderr = os.Stderr
+	kcc.QCmd.ExtraFiles = extraFiles
 	// TODO(kwalsh) set up env, dir, and uid/gid.
-	return kcc.QCmd.Start()
+	err := kcc.QCmd.Start()
+	// QEMU has its own copies of the images.
+	kcc.closeDisks()
+	return err
+}
+
+// closeDisks closes the images that were opened to be measured.
+func (kcc *KvmCustomContainer) closeDisks() {
+	for i := range kcc.Cfg.Disks {
+		if f := kcc.Cfg.Disks[i].file; f != nil {
+			f.Close()
+			kcc.Cfg.Disks[i].file = nil
+		}
+	}
 }
 
-// Stop sends a SIGSTOP signal to a docker container.
+// Stop asks the guest to power down over QMP, and kills QEMU if the guest
+// hasn't shut down after Cfg.ShutdownTimeout.
 func (kcc *KvmCustomContainer) Stop() error {
-	// Stop the QEMU/KVM process with SIGSTOP.
-	// TODO(tmroeder): rewrite this using qemu's communication/management
-	// system; sending SIGSTOP is definitely not the right way to do this.
-	return kcc.QCmd.Process.Signal(syscall.SIGSTOP)
+	return kcc.monitor.stop(kcc.QCmd.Process, kcc.Done, kcc.Cfg.ShutdownTimeout)
 }
 
 // Pid returns a numeric ID for this container.
@@ -130,16 +204,15 @@ func (kcc *KvmCustomContainer) Pid() int {
 	return kcc.QCmd.Process.Pid
 }
 
-// ExitStatus returns an exit code for the container.
+// ExitStatus returns an exit code for the vm, derived from the guest shutdown
+// reason: VMExitShutdown, VMExitPanic or VMExitCrash.
 func (kcc *KvmCustomContainer) ExitStatus() (int, error) {
-	s := kcc.QCmd.ProcessState
-	if s == nil {
-		return -1, fmt.Errorf("Child has not exited")
-	}
-	if code, ok := (*s).Sys().(syscall.WaitStatus); ok {
-		return int(code), nil
-	}
-	return -1, fmt.Errorf("Couldn't get exit status\n")
+	return kcc.monitor.exitStatus()
+}
+
+// VMStatus queries QEMU for the status of the vm.
+func (kcc *KvmCustomContainer) VMStatus() (*VMStatus, error) {
+	return kcc.monitor.status()
 }
 
 // A LinuxKVMCustomFactory manages hosted programs started as QEMU/KVM instances.
@@ -158,12 +231,18 @@ func NewLinuxKVMCustomFactory(cfg *VmConfig) HostedProgramFactory {
 // MakeSubprin computes the hash of a QEMU/KVM CoreOS image to get a
 // subprincipal for authorization purposes.
 func (lkcf *LinuxKVMCustomFactory) NewHostedProgram(spec HostedProgramSpec) (child HostedProgram, err error) {
+	if spec.Measure != nil || spec.Script != nil {
+		err = fmt.Errorf("measured configuration and scripts are not supported for custom VMs")
+		return
+	}
 	// TODO(tmroeder): the combination of TeeReader and ReadAll doesn't seem
 	// to copy the entire image, so we're going to hash in place for now.
 	// This needs to be fixed to copy the image so we can avoid a TOCTTOU
 	// attack.
 
-	// The spec args must contain the kernel and initram paths as well as the port to use for SSH.
+	// The spec args must contain the kernel and initram paths as well as the
+	// port to use for SSH. The kernel command line and disks are given as
+	// options after the image name in the container args.
 	if len(spec.Args) != 3 {
 		glog.Errorf("Expected %d args, but got %d", 3, len(spec.Args))
 		for i, a := range spec.Args {
@@ -189,28 +268,133 @@ func (lkcf *LinuxKVMCustomFactory) NewHostedProgram(spec HostedProgramSpec) (chi
 	sockPath := path.Join(lkcf.Cfg.SocketPath, sockName)
 
 	cfg := VmConfig{
-		Name:        getRandomFileName(nameLen),
-		KernelPath:  spec.Args[0],
-		InitRamPath: spec.Args[1],
-		Memory:      lkcf.Cfg.Memory,
-		SocketPath:  sockPath,
-		Port:        spec.Args[2],
+		Name:            getRandomFileName(nameLen),
+		KernelPath:      spec.Args[0],
+		InitRamPath:     spec.Args[1],
+		Memory:          lkcf.Cfg.Memory,
+		SocketPath:      sockPath,
+		Port:            spec.Args[2],
+		ShutdownTimeout: lkcf.Cfg.ShutdownTimeout,
+		Machine:         lkcf.Cfg.Machine,
+		CPU:             lkcf.Cfg.CPU,
+		SMP:             lkcf.Cfg.SMP,
+	}
+	if len(spec.ContainerArgs) > 1 {
+		if err = parseVmOptions(spec.ContainerArgs[1:], &cfg); err != nil {
+			return
+		}
+	}
+
+	h3 := sha256.Sum256([]byte(cfg.Cmdline))
+	var disks [][]byte
+	defer func() {
+		if err != nil {
+			for _, d := range cfg.Disks {
+				if d.file != nil {
+					d.file.Close()
+				}
+			}
+		}
+	}()
+	for i, d := range cfg.Disks {
+		if d.VerityRootHash != nil {
+			disks = append(disks, d.VerityRootHash)
+			continue
+		}
+		var h []byte
+		if cfg.Disks[i].file, h, err = openImage(d.Path); err != nil {
+			return
+		}
+		disks = append(disks, h)
 	}
 
 	child = &KvmCustomContainer{
 		spec:        spec,
 		KernelHash:  h1[:],
 		InitRamHash: h2[:],
+		CmdlineHash: h3[:],
+		DiskHashes:  disks,
+		ConfigHash:  MeasureVmConfig(&cfg),
 		Factory:     lkcf,
 		Done:        make(chan bool, 1),
 		Cfg:         &cfg,
+		monitor:     newQEMUMonitor(sockPath + ".qmp"),
 	}
 	return
 }
 
-// Subprin returns the subprincipal representing the hosted vm.
+// parseVmOptions parses the options for a custom VM: "-append <cmdline>" sets
+// the kernel command line, and each "-drive <path>[,verity=<root hash>]"
+// attaches a disk image, with an optional hex dm-verity root hash.
+func parseVmOptions(opts []string, cfg *VmConfig) error {
+	for i := 0; i < len(opts); i++ {
+		if i+1 == len(opts) {
+			return newError("missing value for custom VM option %s", opts[i])
+		}
+		switch opts[i] {
+		case "-append":
+			cfg.Cmdline = opts[i+1]
+		case "-drive":
+			d := VmDisk{Path: opts[i+1]}
+			if n := strings.LastIndex(d.Path, ",verity="); n >= 0 {
+				root, err := hex.DecodeString(d.Path[n+len(",verity="):])
+				if err != nil || len(root) == 0 {
+					return newError("bad dm-verity root hash for disk %s", d.Path[:n])
+				}
+				d.Path, d.VerityRootHash = d.Path[:n], root
+			}
+			cfg.Disks = append(cfg.Disks, d)
+		default:
+			return newError("unknown custom VM option %s", opts[i])
+		}
+		i++
+	}
+	return nil
+}
+
+// openImage opens a disk image and hashes it without reading it all into
+// memory. The image stays open, so the guest gets what was hashed.
+func openImage(path string) (*os.File, []byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, h.Sum(nil), nil
+}
+
+// MeasureVmConfig hashes the parts of a VmConfig that affect the guest but
+// are not measured elsewhere: memory, machine type, CPU model and number of
+// CPUs. Each is written in a fixed order as name=value, so the measurement
+// doesn't depend on how the options were given. The name, sockets, ports and
+// timeouts aren't measured, since they are chosen by the host.
+func MeasureVmConfig(cfg *VmConfig) []byte {
+	h := sha256.New()
+	writeMeasured(h, fmt.Sprintf("memory=%d", cfg.Memory))
+	writeMeasured(h, "machine="+cfg.Machine)
+	writeMeasured(h, "cpu="+cfg.CPU)
+	writeMeasured(h, fmt.Sprintf("smp=%d", cfg.SMP))
+	return h.Sum(nil)
+}
+
+// Subprin returns the subprincipal representing the hosted vm. It extends
+// CustomVM(...) with the kernel command line, each disk and the machine
+// configuration, so policy can authorize each of them separately.
 func (kcc *KvmCustomContainer) Subprin() auth.SubPrin {
 	subprin := FormatCustomVmSubprin(kcc.spec.Id, kcc.KernelHash, kcc.InitRamHash)
+	subprin = append(subprin, FormatCmdlineSubprin(kcc.CmdlineHash)...)
+	for i, d := range kcc.Cfg.Disks {
+		if d.VerityRootHash != nil {
+			subprin = append(subprin, FormatVerityDiskSubprin(i, d.VerityRootHash)...)
+		} else {
+			subprin = append(subprin, FormatDiskSubprin(i, kcc.DiskHashes[i])...)
+		}
+	}
+	subprin = append(subprin, FormatVmConfigSubprin(kcc.ConfigHash)...)
 	return subprin
 }
 
@@ -224,6 +408,28 @@ func FormatCustomVmSubprin(id uint, kernelHash []byte, initramHash []byte) auth.
 	return auth.SubPrin{auth.PrinExt{Name: "CustomVM", Arg: args}}
 }
 
+// FormatCmdlineSubprin produces a subprincipal for a kernel command line hash.
+func FormatCmdlineSubprin(hash []byte) auth.SubPrin {
+	return auth.SubPrin{auth.PrinExt{Name: "Cmdline", Arg: []auth.Term{auth.Bytes(hash)}}}
+}
+
+// FormatDiskSubprin produces a subprincipal for the hash of the i'th disk.
+func FormatDiskSubprin(i int, hash []byte) auth.SubPrin {
+	return auth.SubPrin{auth.PrinExt{Name: "Disk", Arg: []auth.Term{auth.Int(i), auth.Bytes(hash)}}}
+}
+
+// FormatVerityDiskSubprin produces a subprincipal for the dm-verity root hash
+// of the i'th disk.
+func FormatVerityDiskSubprin(i int, rootHash []byte) auth.SubPrin {
+	return auth.SubPrin{auth.PrinExt{Name: "VerityDisk", Arg: []auth.Term{auth.Int(i), auth.Bytes(rootHash)}}}
+}
+
+// FormatVmConfigSubprin produces a subprincipal for a machine configuration
+// hash, see MeasureVmConfig.
+func FormatVmConfigSubprin(hash []byte) auth.SubPrin {
+	return auth.SubPrin{auth.PrinExt{Name: "VMConfig", Arg: []auth.Term{auth.Bytes(hash)}}}
+}
+
 // Spec returns the specification used to start the hosted vm.
 func (kcc *KvmCustomContainer) Spec() HostedProgramSpec {
 	return kcc.spec
@@ -246,7 +452,11 @@ func (kcc *KvmCustomContainer) Start() (channel io.ReadWriteCloser, err error) {
 	if err = kcc.startVM(); err != nil {
 		return
 	}
-	// TODO(kwalsh) reap and cleanup when vm dies; see linux_process_factory.go
+	go kcc.monitor.wait(kcc.QCmd, kcc.Done)
+	if err = kcc.monitor.connect(qmpTimeout); err != nil {
+		glog.Errorf("Couldn't connect to QMP for vm %d: %s", kcc.QCmd.Process.Pid, err)
+		err = nil
+	}
 
 	// We need some way to wait for the socket to open before we can connect
 	// to it and return the ReadWriteCloser for communication.
@@ -259,5 +469,6 @@ func (kcc *KvmCustomContainer) Start() (channel io.ReadWriteCloser, err error) {
 
 func (kcc *KvmCustomContainer) Cleanup() error {
 	// TODO(kwalsh) maybe also kill vm if still running?
+	kcc.closeDisks()
 	return nil
 }
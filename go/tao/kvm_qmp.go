@@ -0,0 +1,300 @@
+// Copyright (c) 2016, Google Inc.  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tao
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// VMStatus describes the state of a hosted VM, as reported by QEMU.
+type VMStatus struct {
+	// State is the QEMU run state, e.g. "running", "paused" or "shutdown", or
+	// "exited" once QEMU has exited.
+	State string
+
+	// ShutdownReason is why the guest shut down, as reported by QEMU, e.g.
+	// "guest-shutdown", "guest-panic", "host-qmp-quit" or "host-signal". It is
+	// empty if the guest has not shut down.
+	ShutdownReason string
+}
+
+// Exit statuses of hosted VMs. QEMU exits cleanly whatever happens to the
+// guest, so ExitStatus derives the status from the guest shutdown reason.
+const (
+	// The guest shut down, or the host powered it down or stopped QEMU.
+	VMExitShutdown = 0
+
+	// The guest panicked.
+	VMExitPanic = 1
+
+	// QEMU exited without the guest shutting down, e.g. it crashed or was
+	// killed.
+	VMExitCrash = 2
+)
+
+// DefaultVMShutdownTimeout is how long Stop waits for a VM to power down
+// before killing it.
+const DefaultVMShutdownTimeout = 30 * time.Second
+
+// qmpTimeout is how long to wait for QEMU to answer a QMP command.
+const qmpTimeout = 5 * time.Second
+
+// qmpExitTimeout is how long to wait for the last QMP events once QEMU exits.
+const qmpExitTimeout = time.Second
+
+// A qemuMonitor controls a QEMU instance over its QMP socket.
+type qemuMonitor struct {
+	path string
+
+	// cm serializes commands, since replies are not tagged.
+	cm       sync.Mutex
+	conn     net.Conn
+	enc      *json.Encoder
+	replies  chan qmpMessage
+	readDone chan bool
+
+	// m protects the fields below, which are updated by QMP events and when
+	// QEMU exits.
+	m      sync.Mutex
+	reason string
+	exited *os.ProcessState
+}
+
+type qmpError struct {
+	Class string `json:"class"`
+	Desc  string `json:"desc"`
+}
+
+type qmpMessage struct {
+	Return json.RawMessage `json:"return"`
+	Error  *qmpError       `json:"error"`
+	Event  string          `json:"event"`
+	Data   struct {
+		Reason string `json:"reason"`
+		Action string `json:"action"`
+	} `json:"data"`
+}
+
+func newQEMUMonitor(path string) *qemuMonitor {
+	return &qemuMonitor{path: path}
+}
+
+// args returns the QEMU arguments that create the QMP socket.
+func (qm *qemuMonitor) args() []string {
+	return []string{"-qmp", "unix:" + qm.path + ",server,nowait"}
+}
+
+// connect connects to the QMP socket, waiting up to timeout for QEMU to
+// create it, and enters command mode.
+func (qm *qemuMonitor) connect(timeout time.Duration) error {
+	var conn net.Conn
+	var err error
+	deadline := time.Now().Add(timeout)
+	for {
+		if conn, err = net.Dial("unix", qm.path); err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err != nil {
+		return err
+	}
+
+	// QEMU greets us first.
+	dec := json.NewDecoder(conn)
+	var greeting map[string]interface{}
+	conn.SetReadDeadline(time.Now().Add(qmpTimeout))
+	if err := dec.Decode(&greeting); err != nil {
+		conn.Close()
+		return err
+	}
+	if _, ok := greeting["QMP"]; !ok {
+		conn.Close()
+		return newError("bad QMP greeting from %s", qm.path)
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	qm.cm.Lock()
+	qm.conn = conn
+	qm.enc = json.NewEncoder(conn)
+	qm.replies = make(chan qmpMessage, 1)
+	qm.readDone = make(chan bool)
+	qm.cm.Unlock()
+	go qm.read(dec, qm.replies, qm.readDone)
+
+	_, err = qm.execute("qmp_capabilities")
+	return err
+}
+
+// read handles messages from QEMU until the connection is closed.
+func (qm *qemuMonitor) read(dec *json.Decoder, replies chan<- qmpMessage, done chan<- bool) {
+	defer close(done)
+	defer close(replies)
+	for {
+		var msg qmpMessage
+		if err := dec.Decode(&msg); err != nil {
+			return
+		}
+		switch msg.Event {
+		case "":
+			replies <- msg
+		case "SHUTDOWN":
+			// Older versions of QEMU don't give a reason.
+			reason := msg.Data.Reason
+			if reason == "" {
+				reason = "shutdown"
+			}
+			qm.m.Lock()
+			if qm.reason == "" {
+				qm.reason = reason
+			}
+			qm.m.Unlock()
+		case "GUEST_PANICKED":
+			qm.m.Lock()
+			qm.reason = "guest-panic"
+			qm.m.Unlock()
+		}
+	}
+}
+
+// execute runs a QMP command and returns its result.
+func (qm *qemuMonitor) execute(cmd string) (json.RawMessage, error) {
+	qm.cm.Lock()
+	defer qm.cm.Unlock()
+	if qm.conn == nil {
+		return nil, newError("not connected to QMP socket %s", qm.path)
+	}
+	if err := qm.enc.Encode(map[string]string{"execute": cmd}); err != nil {
+		return nil, err
+	}
+	select {
+	case msg, ok := <-qm.replies:
+		if !ok {
+			return nil, newError("QMP connection to %s closed", qm.path)
+		}
+		if msg.Error != nil {
+			return nil, newError("QMP %s failed: %s: %s", cmd, msg.Error.Class, msg.Error.Desc)
+		}
+		return msg.Return, nil
+	case <-time.After(qmpTimeout):
+		// A late reply would be taken for the reply to the next command.
+		qm.conn.Close()
+		qm.conn = nil
+		return nil, newError("QMP %s timed out", cmd)
+	}
+}
+
+// status queries the VM status.
+func (qm *qemuMonitor) status() (*VMStatus, error) {
+	qm.m.Lock()
+	s := &VMStatus{ShutdownReason: qm.reason}
+	exited := qm.exited != nil
+	qm.m.Unlock()
+	if exited {
+		s.State = "exited"
+		return s, nil
+	}
+	ret, err := qm.execute("query-status")
+	if err != nil {
+		return nil, err
+	}
+	var qs struct {
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(ret, &qs); err != nil {
+		return nil, err
+	}
+	s.State = qs.Status
+	return s, nil
+}
+
+// stop asks the guest to power down, and kills QEMU if it is still running
+// after timeout. Without QMP, it asks QEMU to quit with SIGTERM instead.
+func (qm *qemuMonitor) stop(p *os.Process, done <-chan bool, timeout time.Duration) error {
+	if timeout == 0 {
+		timeout = DefaultVMShutdownTimeout
+	}
+	if _, err := qm.execute("system_powerdown"); err != nil {
+		glog.Errorf("Couldn't power down VM, sending SIGTERM: %s", err)
+		return p.Signal(syscall.SIGTERM)
+	}
+	go func() {
+		select {
+		case <-done:
+		case <-time.After(timeout):
+			glog.Infof("VM %d did not power down after %v, killing it", p.Pid, timeout)
+			p.Kill()
+		}
+	}()
+	return nil
+}
+
+// wait waits for QEMU to exit, then signals done.
+func (qm *qemuMonitor) wait(cmd *exec.Cmd, done chan bool) {
+	cmd.Wait()
+
+	// QEMU sends the SHUTDOWN event just before it exits, so finish reading
+	// events before closing our end.
+	qm.cm.Lock()
+	readDone := qm.readDone
+	qm.cm.Unlock()
+	if readDone != nil {
+		select {
+		case <-readDone:
+		case <-time.After(qmpExitTimeout):
+		}
+	}
+	qm.m.Lock()
+	qm.exited = cmd.ProcessState
+	qm.m.Unlock()
+	qm.close()
+	os.Remove(qm.path)
+	done <- true
+	close(done) // prevent any more blocking
+}
+
+// exitStatus derives the exit status of the VM from its shutdown reason.
+func (qm *qemuMonitor) exitStatus() (int, error) {
+	qm.m.Lock()
+	reason, ps := qm.reason, qm.exited
+	qm.m.Unlock()
+	if ps == nil {
+		return -1, newError("Child has not exited")
+	}
+	switch {
+	case reason == "guest-panic":
+		return VMExitPanic, nil
+	case reason == "" || reason == "host-error" || !ps.Success():
+		return VMExitCrash, nil
+	default:
+		return VMExitShutdown, nil
+	}
+}
+
+func (qm *qemuMonitor) close() {
+	qm.cm.Lock()
+	if qm.conn != nil {
+		qm.conn.Close()
+	}
+	qm.cm.Unlock()
+}
@@ -0,0 +1,203 @@
+// Copyright (c) 2016, Google Inc.  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tao
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path"
+	"testing"
+	"time"
+)
+
+// fakeQMP is a fake QEMU QMP server. It answers query-status, and answers
+// system_powerdown by calling powerdown, which may shut down the fake guest.
+type fakeQMP struct {
+	status    string
+	powerdown func(conn net.Conn)
+	commands  chan string
+}
+
+func (f *fakeQMP) serve(t *testing.T, sock string) {
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprintf(conn, `{"QMP": {"version": {}, "capabilities": []}}`+"\r\n")
+		dec := json.NewDecoder(conn)
+		for {
+			var cmd struct {
+				Execute string `json:"execute"`
+			}
+			if err := dec.Decode(&cmd); err != nil {
+				return
+			}
+			f.commands <- cmd.Execute
+			switch cmd.Execute {
+			case "qmp_capabilities":
+				fmt.Fprintf(conn, `{"return": {}}`+"\r\n")
+			case "query-status":
+				fmt.Fprintf(conn, `{"timestamp": {}, "event": "RESUME"}`+"\r\n")
+				fmt.Fprintf(conn, `{"return": {"status": %q, "running": true}}`+"\r\n", f.status)
+			case "system_powerdown":
+				fmt.Fprintf(conn, `{"return": {}}`+"\r\n")
+				if f.powerdown != nil {
+					f.powerdown(conn)
+				}
+			default:
+				fmt.Fprintf(conn, `{"error": {"class": "CommandNotFound", "desc": "no"}}`+"\r\n")
+			}
+		}
+	}()
+}
+
+// startFakeVM starts a stand-in for QEMU that exits cleanly when its stdin is
+// closed, and connects to the fake QMP server.
+func startFakeVM(t *testing.T, dir string, f *fakeQMP) (*KvmCustomContainer, io.WriteCloser) {
+	sock := path.Join(dir, "vm.qmp")
+	f.serve(t, sock)
+	kcc := &KvmCustomContainer{
+		Cfg:     &VmConfig{ShutdownTimeout: 200 * time.Millisecond},
+		QCmd:    exec.Command("/bin/sh", "-c", "read x; exit 0"),
+		monitor: newQEMUMonitor(sock),
+		Done:    make(chan bool, 1),
+	}
+	stdin, err := kcc.QCmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := kcc.QCmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	go kcc.monitor.wait(kcc.QCmd, kcc.Done)
+	if err := kcc.monitor.connect(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if cmd := <-f.commands; cmd != "qmp_capabilities" {
+		t.Fatalf("Got QMP command %s, want qmp_capabilities", cmd)
+	}
+	return kcc, stdin
+}
+
+func waitFakeVM(t *testing.T, kcc *KvmCustomContainer) {
+	select {
+	case <-kcc.WaitChan():
+	case <-time.After(5 * time.Second):
+		t.Fatal("VM exit was not noticed")
+	}
+}
+
+func TestKVMStopPowersDown(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("/tmp", "test_kvm_qmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	var stdin io.WriteCloser
+	f := &fakeQMP{status: "running", commands: make(chan string, 10)}
+	f.powerdown = func(conn net.Conn) {
+		fmt.Fprintf(conn, `{"event": "SHUTDOWN", "data": {"guest": true, "reason": "guest-shutdown"}}`+"\r\n")
+		conn.Close()
+		stdin.Close()
+	}
+	kcc, stdin := startFakeVM(t, tmpdir, f)
+
+	status, err := kcc.VMStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.State != "running" || status.ShutdownReason != "" {
+		t.Errorf("VMStatus = %+v, want running", status)
+	}
+	<-f.commands
+
+	if _, err := kcc.ExitStatus(); err == nil {
+		t.Error("Got exit status of running VM")
+	}
+	if err := kcc.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if cmd := <-f.commands; cmd != "system_powerdown" {
+		t.Errorf("Got QMP command %s, want system_powerdown", cmd)
+	}
+	waitFakeVM(t, kcc)
+	if code, err := kcc.ExitStatus(); err != nil || code != VMExitShutdown {
+		t.Errorf("ExitStatus = %d, %v; want %d", code, err, VMExitShutdown)
+	}
+	status, err = kcc.VMStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.State != "exited" || status.ShutdownReason != "guest-shutdown" {
+		t.Errorf("VMStatus = %+v, want exited after guest-shutdown", status)
+	}
+}
+
+func TestKVMStopTimeout(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("/tmp", "test_kvm_qmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// The guest ignores the powerdown request, so it gets killed.
+	f := &fakeQMP{status: "running", commands: make(chan string, 10)}
+	kcc, _ := startFakeVM(t, tmpdir, f)
+	if err := kcc.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	waitFakeVM(t, kcc)
+	if code, err := kcc.ExitStatus(); err != nil || code != VMExitCrash {
+		t.Errorf("ExitStatus = %d, %v; want %d", code, err, VMExitCrash)
+	}
+}
+
+func TestKVMGuestPanic(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("/tmp", "test_kvm_qmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	var stdin io.WriteCloser
+	f := &fakeQMP{status: "running", commands: make(chan string, 10)}
+	f.powerdown = func(conn net.Conn) {
+		fmt.Fprintf(conn, `{"event": "GUEST_PANICKED", "data": {"action": "pause"}}`+"\r\n")
+		fmt.Fprintf(conn, `{"event": "SHUTDOWN", "data": {"guest": true, "reason": "guest-panic"}}`+"\r\n")
+		conn.Close()
+		stdin.Close()
+	}
+	kcc, stdin := startFakeVM(t, tmpdir, f)
+	if err := kcc.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	waitFakeVM(t, kcc)
+	if code, err := kcc.ExitStatus(); err != nil || code != VMExitPanic {
+		t.Errorf("ExitStatus = %d, %v; want %d", code, err, VMExitPanic)
+	}
+}
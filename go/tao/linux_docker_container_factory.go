@@ -16,17 +16,13 @@ package tao
 
 import (
 	"bytes"
-	"crypto/sha256"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"os"
-	"os/exec"
-	"os/signal"
 	"path"
+	"strconv"
 	"strings"
-	"syscall"
-	"time"
+	"sync"
 
 	"github.com/golang/glog"
 	"github.com/jlmucb/cloudproxy/go/tao/auth"
@@ -34,29 +30,36 @@ import (
 )
 
 // A DockerContainer represents a hosted program running as a Docker container.
-// It uses os/exec.Cmd and the `docker` program to send commands to the Docker
-// daemon rather than using the docker client API directly. This is so that this
-// code doesn't depend on the docker code for now.
+// It uses the Docker Engine API to send commands to the Docker daemon.
 type DockerContainer struct {
 
 	// The spec from which this process was created.
 	spec HostedProgramSpec
 
-	// Hash of the docker image.
+	// Hash of the docker image, i.e. the digest of its configuration, which is
+	// also its image ID.
 	Hash []byte
 
-	// The factory responsible for the hosted process.
+	// The factory responsible for the hosted process, and the client for the
+	// daemon that runs it.
 	Factory *LinuxDockerContainerFactory
+	client  *dockerClient
 
+	// ImageName is the tag or ID by which the image is known to the daemon.
 	ImageName   string
 	SocketPath  string
-	CidfilePath string
 	RulesPath   string
+	ContainerID string
 
-	// The underlying docker process.
-	Cmd *exec.Cmd
+	// The pid of the main process in the container.
+	pid int
 
-	// A channel to be signaled when the vm is done.
+	// The exit code of the container, once it has exited.
+	m        sync.Mutex
+	exited   bool
+	exitCode int
+
+	// A channel to be signaled when the container is done.
 	Done chan bool
 }
 
@@ -67,105 +70,36 @@ func (dc *DockerContainer) WaitChan() <-chan bool {
 
 // Kill sends a SIGKILL signal to a docker container.
 func (dc *DockerContainer) Kill() error {
-	cid, err := dc.ContainerName()
-	if err != nil {
-		return err
-	}
-	return docker(nil, "kill", cid)
+	return dc.client.kill(dc.ContainerID, "KILL")
 }
 
+// ContainerName returns the ID of the docker container.
 func (dc *DockerContainer) ContainerName() (string, error) {
-	b, err := ioutil.ReadFile(dc.CidfilePath)
-	if err != nil {
-		return "", err
-	}
-	return strings.TrimSpace(string(b)), nil
-}
-
-func docker(stdin io.Reader, cmd string, args ...string) error {
-	c := exec.Command("docker", append([]string{cmd}, args...)...)
-	var b bytes.Buffer
-	c.Stdin = stdin
-	c.Stdout = &b
-	c.Stderr = &b
-	err := c.Run()
-	if err != nil {
-		glog.Errorf("Docker error %v: cmd=%v args=%v\n"+
-			"begin docker output\n"+
-			"%v\n"+
-			"end docker output\n", err, cmd, args, b.String())
-	}
-	return err
-}
-
-// StartDocker starts a docker container using the docker run subcommand.
-func (dc *DockerContainer) StartDocker() error {
-	args := []string{"run", "--rm=true", "-v", dc.SocketPath + ":/tao"}
-	args = append(args, "--cidfile", dc.CidfilePath)
-	if dc.RulesPath != "" {
-		args = append(args, "-v", dc.RulesPath+":/"+path.Base(dc.RulesPath))
+	if dc.ContainerID == "" {
+		return "", newError("docker container has not been created")
 	}
-	// ContainerArgs has a name plus args passed directly to docker, i.e. before
-	// image name. Args are passed to the ENTRYPOINT within the Docker image,
-	// i.e. after image name.
-	// Note: Uid, Gid, Dir, and Env do not apply to docker hosted programs.
-	if len(dc.spec.ContainerArgs) > 1 {
-		args = append(args, dc.spec.ContainerArgs[1:]...)
-	}
-	args = append(args, dc.ImageName)
-	args = append(args, dc.spec.Args...)
-	dc.Cmd = exec.Command("docker", args...)
-	dc.Cmd.Stdin = dc.spec.Stdin
-	dc.Cmd.Stdout = dc.spec.Stdout
-	dc.Cmd.Stderr = dc.spec.Stderr
-
-	err := dc.Cmd.Start()
-	if err != nil {
-		return err
-	}
-	// Reap the child when the process dies.
-	go func() {
-		sc := make(chan os.Signal, 1)
-		signal.Notify(sc, syscall.SIGCHLD)
-		<-sc
-		dc.Cmd.Wait()
-		signal.Stop(sc)
-
-		time.Sleep(1 * time.Second)
-		docker(nil, "rmi", dc.ImageName)
-		dc.Done <- true
-		os.Remove(dc.CidfilePath)
-		close(dc.Done) // prevent any more blocking
-	}()
-
-	return nil
-	// TODO(kwalsh) put channel into p, remove the struct in linux_host.go
+	return dc.ContainerID, nil
 }
 
 // Stop sends a SIGSTOP signal to a docker container.
 func (dc *DockerContainer) Stop() error {
-	cid, err := dc.ContainerName()
-	if err != nil {
-		return err
-	}
-	return docker(nil, "kill", "-s", "STOP", cid)
+	return dc.client.kill(dc.ContainerID, "STOP")
 }
 
-// Pid returns a numeric ID for this docker container.
+// Pid returns a numeric ID for this docker container, namely the host pid of
+// its main process.
 func (dc *DockerContainer) Pid() int {
-	return dc.Cmd.Process.Pid
+	return dc.pid
 }
 
-// ExitStatus returns an exit code for the container.
+// ExitStatus returns the exit code of the container.
 func (dc *DockerContainer) ExitStatus() (int, error) {
-	s := dc.Cmd.ProcessState
-	if s == nil {
+	dc.m.Lock()
+	defer dc.m.Unlock()
+	if !dc.exited {
 		return -1, fmt.Errorf("Child has not exited")
 	}
-	if code, ok := (*s).Sys().(syscall.WaitStatus); ok {
-		return int(code), nil
-	}
-	return -1, fmt.Errorf("Couldn't get exit status\n")
+	return dc.exitCode, nil
 }
 
 // A LinuxDockerContainerFactory manages hosted programs started as docker
@@ -173,47 +107,106 @@ func (dc *DockerContainer) ExitStatus() (int, error) {
 type LinuxDockerContainerFactory struct {
 	SocketDir string
 	RulesPath string
+
+	// DockerSocket is the unix socket of the Docker Engine API.
+	DockerSocket string
+
+	// client talks to the daemon on DockerSocket. It is created on first use,
+	// and again if DockerSocket changes.
+	clientm sync.Mutex
+	client  *dockerClient
 }
 
 // NewLinuxDockerContainerFactory returns a new HostedProgramFactory that can
-// create docker containers to wrap programs.
+// create docker containers to wrap programs. It talks to the Docker daemon on
+// the unix socket named by $DOCKER_HOST, or on DefaultDockerSocket.
 func NewLinuxDockerContainerFactory(sockDir, rulesPath string) HostedProgramFactory {
+	socket := dockerSocketFromEnv()
 	return &LinuxDockerContainerFactory{
-		SocketDir: sockDir,
-		RulesPath: rulesPath,
+		SocketDir:    sockDir,
+		RulesPath:    rulesPath,
+		DockerSocket: socket,
+		client:       newDockerClient(socket),
+	}
+}
+
+// dockerClient returns a client for the daemon on ldcf.DockerSocket.
+func (ldcf *LinuxDockerContainerFactory) dockerClient() *dockerClient {
+	ldcf.clientm.Lock()
+	defer ldcf.clientm.Unlock()
+	if ldcf.client == nil || ldcf.client.socket != ldcf.DockerSocket {
+		ldcf.client = newDockerClient(ldcf.DockerSocket)
 	}
+	return ldcf.client
 }
 
 // NewHostedProgram initializes, but does not start, a hosted docker container.
+// The file at spec.Path is either an image archive, as written by `docker
+// save`, or a tar stream holding a Dockerfile and its context, which is built.
+// Either may be compressed with gzip. The subprincipal is derived from the
+// image ID, which is the content-addressed digest of the image. For an image
+// archive, this is computed from the archive itself, and so can be known in
+// advance. For a Dockerfile, it depends on the build.
 func (ldcf *LinuxDockerContainerFactory) NewHostedProgram(spec HostedProgramSpec) (child HostedProgram, err error) {
+	if spec.Measure != nil || spec.Script != nil {
+		err = fmt.Errorf("measured configuration and scripts are not supported for docker containers")
+		return
+	}
+	client := ldcf.dockerClient()
+	if err = client.checkVersion(); err != nil {
+		return
+	}
 
 	// The imagename for the child is given by spec.ContainerArgs[0]
 	argv0 := "cloudproxy"
 	if len(spec.ContainerArgs) >= 1 {
 		argv0 = spec.ContainerArgs[0]
 	}
-	img := argv0 + ":" + getRandomFileName(nameLen)
 
-	inf, err := os.Open(spec.Path)
-	defer inf.Close()
+	// Read the whole file first, so the daemon gets exactly what we measure.
+	b, err := ioutil.ReadFile(spec.Path)
 	if err != nil {
 		return
 	}
-
-	// Build the docker image, and hash the image as it is sent.
-	hasher := sha256.New()
-	err = docker(io.TeeReader(inf, hasher), "build", "-t", img, "-q", "-")
+	hash, err := DockerImageDigest(b)
 	if err != nil {
 		return
 	}
 
-	hash := hasher.Sum(nil)
+	var img string
+	if hash != nil {
+		if err = client.load(bytes.NewReader(b)); err != nil {
+			return
+		}
+		// Refer to the image only by the ID we computed, so that we run what
+		// we measured regardless of any tags in the archive.
+		img = fmt.Sprintf("sha256:%x", hash)
+		var id string
+		if id, err = client.imageID(img); err != nil {
+			return
+		}
+		if id != img {
+			err = newError("docker loaded image %s, expected %s", id, img)
+			return
+		}
+	} else {
+		img = argv0 + ":" + getRandomFileName(nameLen)
+		var id string
+		if id, err = client.build(bytes.NewReader(b), img); err != nil {
+			return
+		}
+		if hash, err = parseImageID(id); err != nil {
+			client.removeImage(img)
+			return
+		}
+	}
 
 	child = &DockerContainer{
 		spec:      spec,
 		ImageName: img,
 		Hash:      hash,
 		Factory:   ldcf,
+		client:    client,
 		Done:      make(chan bool, 1),
 	}
 
@@ -225,9 +218,9 @@ func (dc *DockerContainer) Spec() HostedProgramSpec {
 	return dc.spec
 }
 
-// Subprin returns the subprincipal representing the hosted docker container..
+// Subprin returns the subprincipal representing the hosted docker container.
 func (dc *DockerContainer) Subprin() auth.SubPrin {
-	return FormatProcessSubprin(dc.spec.Id, dc.Hash)
+	return FormatDockerSubprin(dc.spec.Id, dc.Hash)
 }
 
 // FormatDockerSubprin produces a string that represents a subprincipal with the
@@ -241,16 +234,174 @@ func FormatDockerSubprin(id uint, hash []byte) auth.SubPrin {
 	return auth.SubPrin{auth.PrinExt{Name: "Container", Arg: args}}
 }
 
-// Start builds the docker container from the tar file and launches it.
-func (dc *DockerContainer) Start() (channel io.ReadWriteCloser, err error) {
+// dockerRunConfig converts ContainerArgs, which are `docker run` options, to a
+// container configuration. Only the options that make sense for hosted
+// programs are supported: --rm, -d and -i are accepted and ignored, since
+// hosted containers are always removed when they exit and are attached to the
+// host, and options like --privileged and -t are rejected.
+func dockerRunConfig(args []string, config *dockerContainerConfig) (name string, err error) {
+	for i := 0; i < len(args); i++ {
+		flag, value := args[i], ""
+		hasValue := false
+		if j := strings.Index(flag, "="); strings.HasPrefix(flag, "-") && j > 0 {
+			flag, value, hasValue = flag[:j], flag[j+1:], true
+		}
+		next := func() string {
+			if hasValue {
+				return value
+			}
+			i++
+			if i >= len(args) {
+				err = newError("missing value for docker option %s", flag)
+				return ""
+			}
+			return args[i]
+		}
+		flagValue := func() bool {
+			if !hasValue {
+				return true
+			}
+			v, e := strconv.ParseBool(value)
+			if e != nil {
+				err = newError("bad value %q for docker option %s", value, flag)
+			}
+			return v
+		}
+		switch flag {
+		case "--rm", "-d", "--detach", "-i", "--interactive":
+			flagValue()
+		case "--read-only":
+			config.HostConfig.ReadonlyRootfs = flagValue()
+		case "--name":
+			name = next()
+		case "--link":
+			config.HostConfig.Links = append(config.HostConfig.Links, next())
+		case "-e", "--env":
+			config.Env = append(config.Env, next())
+		case "-v", "--volume":
+			config.HostConfig.Binds = append(config.HostConfig.Binds, next())
+		case "--net", "--network":
+			config.HostConfig.NetworkMode = next()
+		case "-w", "--workdir":
+			config.WorkingDir = next()
+		case "-u", "--user":
+			config.User = next()
+		case "--entrypoint":
+			config.Entrypoint = []string{next()}
+		case "-h", "--hostname":
+			config.Hostname = next()
+		case "-l", "--label":
+			if config.Labels == nil {
+				config.Labels = make(map[string]string)
+			}
+			kv := strings.SplitN(next(), "=", 2)
+			config.Labels[kv[0]] = strings.Join(kv[1:], "")
+		case "-p", "--publish":
+			if v := next(); err == nil {
+				err = dockerPublish(v, config)
+			}
+		case "--add-host":
+			config.HostConfig.ExtraHosts = append(config.HostConfig.ExtraHosts, next())
+		case "--dns":
+			config.HostConfig.Dns = append(config.HostConfig.Dns, next())
+		case "-m", "--memory":
+			if v := next(); err == nil {
+				config.HostConfig.Memory, err = dockerMemory(v)
+			}
+		case "--cpu-shares":
+			if v := next(); err == nil {
+				if config.HostConfig.CpuShares, err = strconv.ParseInt(v, 10, 64); err != nil {
+					err = newError("bad value %q for docker option %s", v, flag)
+				}
+			}
+		case "--cap-add":
+			config.HostConfig.CapAdd = append(config.HostConfig.CapAdd, next())
+		case "--cap-drop":
+			config.HostConfig.CapDrop = append(config.HostConfig.CapDrop, next())
+		case "--tmpfs":
+			if config.HostConfig.Tmpfs == nil {
+				config.HostConfig.Tmpfs = make(map[string]string)
+			}
+			kv := strings.SplitN(next(), ":", 2)
+			config.HostConfig.Tmpfs[kv[0]] = strings.Join(kv[1:], "")
+		default:
+			return "", newError("unsupported docker option %s", args[i])
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return name, nil
+}
 
-	s := path.Join(dc.Factory.SocketDir, getRandomFileName(nameLen))
-	dc.SocketPath = s + ".sock"
-	dc.CidfilePath = s + ".cid"
+// dockerPublish adds a `docker run -p` port mapping, e.g. 8080:80,
+// 127.0.0.1:8080:80/udp or 80, to a container configuration.
+func dockerPublish(v string, config *dockerContainerConfig) error {
+	port, proto := v, "tcp"
+	if j := strings.LastIndex(v, "/"); j >= 0 {
+		port, proto = v[:j], v[j+1:]
+	}
+	var binding dockerPortBinding
+	parts := strings.Split(port, ":")
+	switch len(parts) {
+	case 1:
+	case 2:
+		binding.HostPort = parts[0]
+	case 3:
+		binding.HostIp, binding.HostPort = parts[0], parts[1]
+	default:
+		return newError("bad docker port mapping %q", v)
+	}
+	port = parts[len(parts)-1]
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return newError("bad docker port mapping %q", v)
+	}
+	key := port + "/" + proto
+	if config.ExposedPorts == nil {
+		config.ExposedPorts = make(map[string]struct{})
+	}
+	config.ExposedPorts[key] = struct{}{}
+	if config.HostConfig.PortBindings == nil {
+		config.HostConfig.PortBindings = make(map[string][]dockerPortBinding)
+	}
+	config.HostConfig.PortBindings[key] = append(config.HostConfig.PortBindings[key], binding)
+	return nil
+}
 
+// dockerMemory parses a `docker run -m` memory limit, e.g. 512m or 1g.
+func dockerMemory(v string) (int64, error) {
+	s, unit := strings.ToLower(v), int64(1)
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'b':
+			s = s[:n-1]
+		case 'k':
+			s, unit = s[:n-1], 1<<10
+		case 'm':
+			s, unit = s[:n-1], 1<<20
+		case 'g':
+			s, unit = s[:n-1], 1<<30
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, newError("bad docker memory limit %q", v)
+	}
+	return n * unit, nil
+}
+
+// Start creates a container from the image and starts it.
+func (dc *DockerContainer) Start() (channel io.ReadWriteCloser, err error) {
+	client := dc.client
+
+	dc.SocketPath = path.Join(dc.Factory.SocketDir, getRandomFileName(nameLen)) + ".sock"
 	dc.RulesPath = dc.Factory.RulesPath
 
 	channel = util.NewUnixSingleReadWriteCloser(dc.SocketPath)
+	if channel == nil {
+		err = newError("couldn't create a new unix channel")
+		return
+	}
 	defer func() {
 		if err != nil {
 			channel.Close()
@@ -258,41 +409,79 @@ func (dc *DockerContainer) Start() (channel io.ReadWriteCloser, err error) {
 		}
 	}()
 
-	args := []string{"run", "--rm=true", "-v", dc.SocketPath + ":/tao"}
-	args = append(args, "--cidfile", dc.CidfilePath)
+	// ContainerArgs has a name plus `docker run` options. Args are passed to
+	// the ENTRYPOINT within the Docker image.
+	// Note: Uid, Gid, Dir, and Env do not apply to docker hosted programs.
+	config := &dockerContainerConfig{
+		Image:        dc.ImageName,
+		Cmd:          dc.spec.Args,
+		AttachStdin:  dc.spec.Stdin != nil,
+		OpenStdin:    dc.spec.Stdin != nil,
+		StdinOnce:    dc.spec.Stdin != nil,
+		AttachStdout: true,
+		AttachStderr: true,
+	}
+	config.HostConfig.Binds = []string{dc.SocketPath + ":/tao"}
 	if dc.RulesPath != "" {
-		args = append(args, "-v", dc.RulesPath+":/"+path.Base(dc.RulesPath))
+		config.HostConfig.Binds = append(config.HostConfig.Binds, dc.RulesPath+":/"+path.Base(dc.RulesPath))
 	}
-	// ContainerArgs has a name plus args passed directly to docker, i.e. before
-	// image name. Args are passed to the ENTRYPOINT within the Docker image,
-	// i.e. after image name.
-	// Note: Uid, Gid, Dir, and Env do not apply to docker hosted programs.
+	var name string
 	if len(dc.spec.ContainerArgs) > 1 {
-		args = append(args, dc.spec.ContainerArgs[1:]...)
+		if name, err = dockerRunConfig(dc.spec.ContainerArgs[1:], config); err != nil {
+			return
+		}
+	}
+
+	if dc.ContainerID, err = client.create(name, config); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			client.remove(dc.ContainerID)
+		}
+	}()
+
+	// Attach before starting, so no output is lost.
+	var stdin io.Reader
+	var stdout, stderr io.Writer = ioutil.Discard, ioutil.Discard
+	if dc.spec.Stdin != nil {
+		stdin = dc.spec.Stdin
+	}
+	if dc.spec.Stdout != nil {
+		stdout = dc.spec.Stdout
 	}
-	args = append(args, dc.ImageName)
-	args = append(args, dc.spec.Args...)
-	dc.Cmd = exec.Command("docker", args...)
-	dc.Cmd.Stdin = dc.spec.Stdin
-	dc.Cmd.Stdout = dc.spec.Stdout
-	dc.Cmd.Stderr = dc.spec.Stderr
-
-	err = dc.Cmd.Start()
+	if dc.spec.Stderr != nil {
+		stderr = dc.spec.Stderr
+	}
+	output, err := client.attach(dc.ContainerID, stdin, stdout, stderr)
 	if err != nil {
 		return
 	}
-	// Reap the child when the process dies.
+
+	if err = client.start(dc.ContainerID); err != nil {
+		return
+	}
+	if dc.pid, err = client.pid(dc.ContainerID); err != nil {
+		return
+	}
+
 	go func() {
-		sc := make(chan os.Signal, 1)
-		signal.Notify(sc, syscall.SIGCHLD)
-		<-sc
-		dc.Cmd.Wait()
-		signal.Stop(sc)
-
-		time.Sleep(1 * time.Second)
-		docker(nil, "rmi", dc.ImageName)
+		code, err := client.wait(dc.ContainerID)
+		if err != nil {
+			glog.Errorf("Couldn't wait for docker container %s: %s", dc.ContainerID, err)
+		}
+		<-output
+		dc.m.Lock()
+		dc.exited, dc.exitCode = true, code
+		dc.m.Unlock()
+
+		if err := client.remove(dc.ContainerID); err != nil {
+			glog.Errorf("Couldn't remove docker container %s: %s", dc.ContainerID, err)
+		}
+		// The image may still be used by other containers, in which case it
+		// is left alone.
+		client.removeImage(dc.ImageName)
 		dc.Done <- true
-		os.Remove(dc.CidfilePath)
 		close(dc.Done) // prevent any more blocking
 	}()
 
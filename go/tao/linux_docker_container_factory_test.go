@@ -0,0 +1,281 @@
+// Copyright (c) 2014, Google, Inc.  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tao
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDocker is a fake Docker Engine API server that runs a single container,
+// which writes some output and exits with a fixed status.
+type fakeDocker struct {
+	apiVersion string
+	buildID    string
+	output     string
+	status     int
+
+	m       sync.Mutex
+	images  map[string]bool
+	created *dockerContainerConfig
+	name    string
+	removed []string
+	started chan bool
+	exited  chan bool
+}
+
+func newFakeDocker() *fakeDocker {
+	return &fakeDocker{
+		apiVersion: "1.24",
+		buildID:    fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("built"))),
+		output:     "hello",
+		status:     3,
+		images:     make(map[string]bool),
+		started:    make(chan bool),
+		exited:     make(chan bool),
+	}
+}
+
+func (d *fakeDocker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p := strings.TrimPrefix(r.URL.Path, "/v"+dockerAPIVersion)
+	d.m.Lock()
+	defer d.m.Unlock()
+	switch {
+	case p == "/version":
+		fmt.Fprintf(w, `{"Version": "fake", "ApiVersion": %q}`, d.apiVersion)
+	case p == "/images/load":
+		b, _ := ioutil.ReadAll(r.Body)
+		digest, err := DockerImageDigest(b)
+		if err != nil || digest == nil {
+			fmt.Fprintf(w, `{"error": "bad archive"}`)
+			return
+		}
+		d.images[fmt.Sprintf("sha256:%x", digest)] = true
+		fmt.Fprintf(w, `{"stream": "Loaded image ID: sha256:%x\n"}`, digest)
+	case p == "/build":
+		ioutil.ReadAll(r.Body)
+		d.images[r.URL.Query().Get("t")] = true
+		fmt.Fprintf(w, `{"stream": "%s\n"}`, d.buildID)
+	case strings.HasPrefix(p, "/images/") && r.Method == "GET":
+		name := strings.TrimSuffix(strings.TrimPrefix(p, "/images/"), "/json")
+		if !d.images[name] {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"message": "no such image"}`)
+			return
+		}
+		id := name
+		if !strings.HasPrefix(id, "sha256:") {
+			id = d.buildID
+		}
+		fmt.Fprintf(w, `{"Id": %q}`, id)
+	case strings.HasPrefix(p, "/images/") && r.Method == "DELETE":
+		d.removed = append(d.removed, strings.TrimPrefix(p, "/images/"))
+	case p == "/containers/create":
+		d.created = new(dockerContainerConfig)
+		json.NewDecoder(r.Body).Decode(d.created)
+		d.name = r.URL.Query().Get("name")
+		fmt.Fprintf(w, `{"Id": "c1"}`)
+	case p == "/containers/c1/attach":
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(buf, "HTTP/1.1 101 UPGRADED\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+		buf.Flush()
+		go func() {
+			<-d.started
+			var hdr [8]byte
+			hdr[0] = 1
+			binary.BigEndian.PutUint32(hdr[4:], uint32(len(d.output)))
+			conn.Write(hdr[:])
+			conn.Write([]byte(d.output))
+			conn.Close()
+			close(d.exited)
+		}()
+	case p == "/containers/c1/start":
+		close(d.started)
+		w.WriteHeader(http.StatusNoContent)
+	case p == "/containers/c1/json":
+		fmt.Fprintf(w, `{"State": {"Pid": 1234}}`)
+	case p == "/containers/c1/wait":
+		d.m.Unlock()
+		<-d.exited
+		d.m.Lock()
+		fmt.Fprintf(w, `{"StatusCode": %d}`, d.status)
+	case p == "/containers/c1" && r.Method == "DELETE":
+		d.removed = append(d.removed, "c1")
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"message": "unexpected request %s %s"}`, r.Method, p)
+	}
+}
+
+func startFakeDocker(t *testing.T, dir string, d *fakeDocker) string {
+	sock := path.Join(dir, "docker.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go http.Serve(l, d)
+	return sock
+}
+
+func writeTar(t *testing.T, file string, files map[string]string) {
+	var b bytes.Buffer
+	tw := tar.NewWriter(&b)
+	for name, content := range files {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))})
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	if err := ioutil.WriteFile(file, b.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDockerContainerFromImageArchive(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("/tmp", "test_docker_factory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	d := newFakeDocker()
+	ldcf := &LinuxDockerContainerFactory{SocketDir: tmpdir, DockerSocket: startFakeDocker(t, tmpdir, d)}
+
+	config := `{"config": {"Entrypoint": ["/bin/demo"]}}`
+	digest := sha256.Sum256([]byte(config))
+	archive := path.Join(tmpdir, "image.tar")
+	writeTar(t, archive, map[string]string{
+		"manifest.json":                fmt.Sprintf(`[{"Config": "%x.json", "Layers": ["l/layer.tar"]}]`, digest),
+		fmt.Sprintf("%x.json", digest): config,
+		"l/layer.tar":                  "layer",
+	})
+
+	spec := HostedProgramSpec{
+		Path:          archive,
+		ContainerArgs: []string{"demo", "--name", "/demo", "--link=/other:server"},
+		Args:          []string{"-x"},
+	}
+	prog, err := ldcf.NewHostedProgram(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := FormatDockerSubprin(0, digest[:]); !prog.Subprin().Identical(want) {
+		t.Fatalf("Subprin = %s, want %s", prog.Subprin(), want)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc := prog.(*DockerContainer)
+	dc.spec.Stdout = w
+	channel, err := prog.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer channel.Close()
+	w.Close()
+	if prog.Pid() != 1234 {
+		t.Errorf("Pid = %d, want 1234", prog.Pid())
+	}
+	out, _ := ioutil.ReadAll(r)
+	if string(out) != d.output {
+		t.Errorf("Output = %q, want %q", out, d.output)
+	}
+	select {
+	case <-prog.WaitChan():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Container exit was not noticed")
+	}
+	if status, err := prog.ExitStatus(); err != nil || status != d.status {
+		t.Errorf("ExitStatus = %d, %v; want %d", status, err, d.status)
+	}
+
+	d.m.Lock()
+	defer d.m.Unlock()
+	c := d.created
+	if c.Image != fmt.Sprintf("sha256:%x", digest) || d.name != "/demo" || len(c.Cmd) != 1 || c.Cmd[0] != "-x" {
+		t.Errorf("Wrong container created: %s %+v", d.name, c)
+	}
+	if len(c.HostConfig.Links) != 1 || c.HostConfig.Links[0] != "/other:server" ||
+		len(c.HostConfig.Binds) != 1 || !strings.HasSuffix(c.HostConfig.Binds[0], ":/tao") {
+		t.Errorf("Wrong host config: %+v", c.HostConfig)
+	}
+	if len(d.removed) != 2 || d.removed[0] != "c1" || d.removed[1] != c.Image {
+		t.Errorf("Removed %v, want container and image", d.removed)
+	}
+}
+
+func TestDockerContainerFromDockerfile(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("/tmp", "test_docker_factory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	d := newFakeDocker()
+	ldcf := &LinuxDockerContainerFactory{SocketDir: tmpdir, DockerSocket: startFakeDocker(t, tmpdir, d)}
+
+	context := path.Join(tmpdir, "context.tar")
+	writeTar(t, context, map[string]string{"Dockerfile": "FROM scratch\n"})
+	prog, err := ldcf.NewHostedProgram(HostedProgramSpec{Path: context})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, _ := parseImageID(d.buildID)
+	if want := FormatDockerSubprin(0, hash); !prog.Subprin().Identical(want) {
+		t.Fatalf("Subprin = %s, want %s", prog.Subprin(), want)
+	}
+
+	// Unsupported docker run options are rejected.
+	if _, err := dockerRunConfig([]string{"--privileged"}, new(dockerContainerConfig)); err == nil {
+		t.Error("Accepted an unsupported docker option")
+	}
+	var c dockerContainerConfig
+	args := []string{"--rm", "-p", "127.0.0.1:8080:80", "--memory=512m", "--read-only", "-l", "app=demo", "--tmpfs", "/run:size=1m"}
+	if _, err := dockerRunConfig(args, &c); err != nil {
+		t.Fatalf("Couldn't convert common docker options: %s", err)
+	}
+	b := c.HostConfig.PortBindings["80/tcp"]
+	if len(b) != 1 || b[0].HostIp != "127.0.0.1" || b[0].HostPort != "8080" {
+		t.Errorf("Wrong port bindings: %+v", c.HostConfig.PortBindings)
+	}
+	if _, ok := c.ExposedPorts["80/tcp"]; !ok || c.HostConfig.Memory != 512<<20 ||
+		!c.HostConfig.ReadonlyRootfs || c.Labels["app"] != "demo" || c.HostConfig.Tmpfs["/run"] != "size=1m" {
+		t.Errorf("Wrong config for common docker options: %+v", c)
+	}
+
+	// Daemons that are too old are rejected.
+	d.m.Lock()
+	d.apiVersion = "1.20"
+	d.m.Unlock()
+	if _, err := ldcf.NewHostedProgram(HostedProgramSpec{Path: context}); err == nil {
+		t.Error("Accepted an old docker daemon")
+	}
+}
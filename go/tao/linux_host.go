@@ -18,6 +18,7 @@ import (
 	"errors"
 	"io"
 	"io/ioutil"
+	"os"
 	"path"
 	"sync"
 	"time"
@@ -34,6 +35,9 @@ import (
 // (on top of a host Tao) or in root mode (without an underlying host Tao).
 type LinuxHost struct {
 	Host               Host
+	LogConfig          HostedProgramLogConfig
+	TaoRPCConfig       TaoRPCConfig
+	RemoteAdminConfig  RemoteAdminConfig
 	path               string
 	guard              Guard
 	childFactory       HostedProgramFactory
@@ -45,6 +49,11 @@ type LinuxHost struct {
 	sealsSinceSave     int
 	rbTable            *RollbackCounterTable
 	rbdm               sync.Mutex
+	events             hostedProgramEventLog
+	logs               []*hostedProgramLog
+	logm               sync.Mutex
+	rpcLimiters        map[string]*taoRPCLimiter
+	rlm                sync.Mutex
 }
 
 // NewStackedLinuxHost creates a new LinuxHost as a hosted program of an existing
@@ -77,6 +86,7 @@ func NewStackedLinuxHost(path string, guard Guard, hostTao Tao, childFactory Hos
 // provide the Tao to hosted Linux processes.
 func NewRootLinuxHost(path string, guard Guard, password []byte, childFactory HostedProgramFactory) (*LinuxHost, error) {
 	lh := &LinuxHost{
+		path:         path,
 		guard:        guard,
 		childFactory: childFactory,
 	}
@@ -104,6 +114,7 @@ type LinuxHostChild struct {
 	channel      io.ReadWriteCloser
 	ChildSubprin auth.SubPrin
 	Cmd          HostedProgram
+	owner        auth.Prin // who started the hosted program
 }
 
 // GetTaoName returns the Tao name for the child.
@@ -114,9 +125,33 @@ func (lh *LinuxHost) GetTaoName(child *LinuxHostChild) auth.Prin {
 // ExtendTaoName irreversibly extends the Tao principal name of the child.
 func (lh *LinuxHost) ExtendTaoName(child *LinuxHostChild, ext auth.SubPrin) error {
 	child.ChildSubprin = append(child.ChildSubprin, ext...)
+	lh.saveHostedPrograms()
 	return nil
 }
 
+// GetCapabilities describes the protocol version, policies and underlying
+// Taos of this LinuxHost for the child. The methods served are filled in by
+// LinuxHostTaoServer.
+func (lh *LinuxHost) GetCapabilities(child *LinuxHostChild) *RPCCapabilities {
+	// Seal and GetSharedSecret support the same policies, see below.
+	policies := []string{SealPolicyDefault, SealPolicyConservative, SealPolicyLiberal}
+	types := []string{"LinuxHost"}
+	switch h := lh.Host.(type) {
+	case *RootHost:
+		types = append(types, "Soft")
+	case *StackedHost:
+		types = append(types, taoTypes(h.hostTao)...)
+	default:
+		types = append(types, "Unknown")
+	}
+	return &RPCCapabilities{
+		Version:              proto.Int32(TaoRPCVersion),
+		SealPolicies:         policies,
+		SharedSecretPolicies: policies,
+		HostTypes:            types,
+	}
+}
+
 // GetRandomBytes returns a slice of n random bytes for the child.
 func (lh *LinuxHost) GetRandomBytes(child *LinuxHostChild, n int) ([]byte, error) {
 	return lh.Host.GetRandomBytes(child.ChildSubprin, n)
@@ -218,8 +253,19 @@ func (lh *LinuxHost) Attest(child *LinuxHostChild, issuer *auth.Prin, time, expi
 	return lh.Host.Attest(child.ChildSubprin, issuer, time, expiration, stmt)
 }
 
+// AttestNonce signs a statement on behalf of the child, binding a nonce chosen
+// by a verifier into the attestation.
+func (lh *LinuxHost) AttestNonce(child *LinuxHostChild, issuer *auth.Prin, time, expiration *int64, nonce []byte, stmt auth.Form) (*Attestation, error) {
+	return lh.Host.AttestNonce(child.ChildSubprin, issuer, time, expiration, nonce, stmt)
+}
+
 // StartHostedProgram starts a new hosted program.
 func (lh *LinuxHost) StartHostedProgram(spec HostedProgramSpec) (auth.SubPrin, int, error) {
+	return lh.startHostedProgram(spec, lh.userPrin(spec.Uid))
+}
+
+// startHostedProgram starts a new hosted program on behalf of owner.
+func (lh *LinuxHost) startHostedProgram(spec HostedProgramSpec, owner auth.Prin) (auth.SubPrin, int, error) {
 	lh.idm.Lock()
 	id := lh.nextChildID
 	if lh.nextChildID != 0 {
@@ -229,6 +275,28 @@ func (lh *LinuxHost) StartHostedProgram(spec HostedProgramSpec) (auth.SubPrin, i
 
 	spec.Id = id
 
+	// Capture output the launcher didn't ask to have sent elsewhere.
+	var output *os.File
+	if !lh.LogConfig.Disable && (spec.Stdout == nil || spec.Stderr == nil) {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return auth.SubPrin{}, 0, err
+		}
+		defer func() {
+			if output != nil {
+				output.Close()
+			}
+		}()
+		defer w.Close()
+		output = r
+		if spec.Stdout == nil {
+			spec.Stdout = w
+		}
+		if spec.Stderr == nil {
+			spec.Stderr = w
+		}
+	}
+
 	prog, err := lh.childFactory.NewHostedProgram(spec)
 	if err != nil {
 		return auth.SubPrin{}, 0, err
@@ -244,6 +312,7 @@ func (lh *LinuxHost) StartHostedProgram(spec HostedProgramSpec) (auth.SubPrin, i
 	subprin := prog.Subprin()
 	childName := hostName.MakeSubprincipal(subprin)
 	if !lh.guard.IsAuthorized(childName, "Execute", []string{}) {
+		lh.events.add(HostedProgramEventType_DENIED, subprin, owner, 0, 0)
 		return auth.SubPrin{}, 0, newError("Hosted program %s denied authorization to execute on host %s", subprin, hostName)
 	}
 
@@ -251,19 +320,37 @@ func (lh *LinuxHost) StartHostedProgram(spec HostedProgramSpec) (auth.SubPrin, i
 	if err != nil {
 		return auth.SubPrin{}, 0, err
 	}
-	child := &LinuxHostChild{channel, subprin, prog}
+	child := &LinuxHostChild{channel, subprin, prog, owner}
 	glog.Infof("Started hosted program with pid %d ...\n  path: %s\n  subprincipal: %s\n", child.Cmd.Pid(), spec.Path, subprin)
 
 	go NewLinuxHostTaoServer(lh, child).Serve(channel)
 	pid := child.Cmd.Pid()
 
+	if output != nil {
+		lh.captureOutput(output, subprin, owner, pid)
+		output = nil
+	}
+
+	lh.addHostedProgram(child, HostedProgramEventType_STARTED)
+	lh.saveHostedPrograms()
+
+	return subprin, pid, nil
+}
+
+// addHostedProgram records a running child and removes it once it exits.
+func (lh *LinuxHost) addHostedProgram(child *LinuxHostChild, event HostedProgramEventType) {
+	subprin := child.ChildSubprin
+	pid := child.Cmd.Pid()
 	lh.hpm.Lock()
 	lh.hostedPrograms = append(lh.hostedPrograms, child)
 	lh.hpm.Unlock()
+	lh.events.add(event, subprin, child.owner, pid, 0)
 
 	go func() {
 		<-child.Cmd.WaitChan()
-		glog.Infof("Hosted program with pid %d exited", child.Cmd.Pid())
+		glog.Infof("Hosted program with pid %d exited", pid)
+		status, _ := child.Cmd.ExitStatus()
+		lh.events.add(HostedProgramEventType_EXITED, subprin, child.owner, pid, status)
 		lh.hpm.Lock()
 		for i, lph := range lh.hostedPrograms {
 			if child == lph {
@@ -273,9 +360,8 @@ func (lh *LinuxHost) StartHostedProgram(spec HostedProgramSpec) (auth.SubPrin, i
 			}
 		}
 		lh.hpm.Unlock()
+		lh.saveHostedPrograms()
 	}()
-
-	return subprin, pid, nil
 }
 
 // StopHostedProgram stops a running hosted program.
@@ -293,17 +379,46 @@ func (lh *LinuxHost) StopHostedProgram(subprin auth.SubPrin) error {
 	return nil
 }
 
+// hostedProgramOwners returns the principals that started the running hosted
+// programs with the given pid, if it is not zero, and subprincipal, if it is
+// not empty.
+func (lh *LinuxHost) hostedProgramOwners(pid int, subprin auth.SubPrin) []auth.Prin {
+	lh.hpm.RLock()
+	defer lh.hpm.RUnlock()
+	var owners []auth.Prin
+	for _, lph := range lh.hostedPrograms {
+		if pid != 0 && lph.Cmd.Pid() != pid {
+			continue
+		}
+		if len(subprin) != 0 && !lph.ChildSubprin.Identical(subprin) {
+			continue
+		}
+		owners = append(owners, lph.owner)
+	}
+	return owners
+}
+
 // ListHostedPrograms returns a list of running hosted programs.
 func (lh *LinuxHost) ListHostedPrograms() ([]auth.SubPrin, []int, error) {
+	subprins, pids := lh.hostedProgramsOwnedBy(nil)
+	return subprins, pids, nil
+}
+
+// hostedProgramsOwnedBy returns the running hosted programs started by owner,
+// or all of them if owner is nil.
+func (lh *LinuxHost) hostedProgramsOwnedBy(owner *auth.Prin) ([]auth.SubPrin, []int) {
 	lh.hpm.RLock()
-	subprins := make([]auth.SubPrin, len(lh.hostedPrograms))
-	pids := make([]int, len(lh.hostedPrograms))
-	for i, v := range lh.hostedPrograms {
-		subprins[i] = v.ChildSubprin
-		pids[i] = v.Cmd.Pid()
+	defer lh.hpm.RUnlock()
+	subprins := make([]auth.SubPrin, 0, len(lh.hostedPrograms))
+	pids := make([]int, 0, len(lh.hostedPrograms))
+	for _, v := range lh.hostedPrograms {
+		if owner != nil && !v.owner.Identical(*owner) {
+			continue
+		}
+		subprins = append(subprins, v.ChildSubprin)
+		pids = append(pids, v.Cmd.Pid())
 	}
-	lh.hpm.RUnlock()
-	return subprins, pids, nil
+	return subprins, pids
 }
 
 // WaitHostedProgram waits for a running hosted program to exit.
@@ -324,6 +439,34 @@ func (lh *LinuxHost) WaitHostedProgram(pid int, subprin auth.SubPrin) (int, erro
 	return p.Cmd.ExitStatus()
 }
 
+// HostedVMStatus queries the status of a running hosted VM. The VM is
+// identified by pid, if it is not zero, and by subprin, if it is not empty.
+func (lh *LinuxHost) HostedVMStatus(pid int, subprin auth.SubPrin) (*VMStatus, error) {
+	lh.hpm.RLock()
+	var p *LinuxHostChild
+	for _, lph := range lh.hostedPrograms {
+		if pid != 0 && lph.Cmd.Pid() != pid {
+			continue
+		}
+		if len(subprin) != 0 && !lph.ChildSubprin.Identical(subprin) {
+			continue
+		}
+		p = lph
+		break
+	}
+	lh.hpm.RUnlock()
+	if p == nil {
+		return nil, newError("no such hosted program")
+	}
+	vm, ok := p.Cmd.(interface {
+		VMStatus() (*VMStatus, error)
+	})
+	if !ok {
+		return nil, newError("hosted program %d is not a VM", p.Cmd.Pid())
+	}
+	return vm.VMStatus()
+}
+
 // KillHostedProgram kills a running hosted program.
 func (lh *LinuxHost) KillHostedProgram(subprin auth.SubPrin) error {
 	lh.hpm.Lock()
@@ -333,12 +476,23 @@ func (lh *LinuxHost) KillHostedProgram(subprin auth.SubPrin) error {
 			lph.channel.Close()
 			if err := lph.Cmd.Kill(); err != nil {
 				glog.Errorf("Couldn't kill hosted program %d, subprincipal %s: %s\n", lph.Cmd.Pid(), subprin, err)
+				continue
 			}
+			lh.events.add(HostedProgramEventType_KILLED, lph.ChildSubprin, lph.owner, lph.Cmd.Pid(), 0)
 		}
 	}
 	return nil
 }
 
+// WatchHostedPrograms waits for hosted program events with sequence numbers
+// after seq. If there are none, it waits up to timeout for one to happen. If
+// seq is zero, only events that happen after the call are returned. It also
+// returns the sequence number to pass to the next call.
+func (lh *LinuxHost) WatchHostedPrograms(seq uint64, timeout time.Duration) ([]HostedProgramEvent, uint64, error) {
+	events, seq := lh.events.since(seq, timeout)
+	return events, seq, nil
+}
+
 // HostName returns the name of the Host used by the LinuxHost.
 func (lh *LinuxHost) HostName() auth.Prin {
 	return lh.Host.HostName()
@@ -347,6 +501,9 @@ func (lh *LinuxHost) HostName() auth.Prin {
 // Shutdown stops all hosted programs. If any remain after 10 seconds, they are
 // killed.
 func (lh *LinuxHost) Shutdown() error {
+	// Publish the event before anything stops, so watchers see it while their
+	// connections to the host are still up.
+	lh.events.add(HostedProgramEventType_HOST_SHUTDOWN, nil, auth.Prin{}, os.Getpid(), 0)
 	glog.Infof("Stopping all hosted programs")
 	lh.hpm.Lock()
 	// Request each child stop
@@ -390,6 +547,7 @@ func (lh *LinuxHost) Shutdown() error {
 	}
 	lh.hostedPrograms = nil
 	lh.hpm.Unlock()
+	lh.saveHostedPrograms()
 	return nil
 }
 
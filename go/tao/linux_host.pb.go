@@ -48,13 +48,13 @@ func (m *LinuxHostSealedBundle) GetData() []byte {
 type LinuxHostConfig struct {
 	// Either "root" or "stacked"
 	Type *string `protobuf:"bytes,1,req,name=type" json:"type,omitempty"`
-	// Either "TPM", "TPM2", "pipe", "file", or "unix"
+	// Either "TPM", "TPM2", "pipe", "file", "unix", or "tls"
 	ParentType *string `protobuf:"bytes,2,opt,name=parent_type" json:"parent_type,omitempty"`
 	// For non-tpm parent types, the parent connection spec
 	ParentSpec *string `protobuf:"bytes,3,opt,name=parent_spec" json:"parent_spec,omitempty"`
 	// Socket directory, relative to host configuration directory.
 	SocketDir *string `protobuf:"bytes,4,opt,name=socket_dir" json:"socket_dir,omitempty"`
-	// Either "process", "docker", or "kvm_coreos"
+	// Either "process", "docker", "kvm_coreos", "kvm_custom", or "oci"
 	Hosting *string `protobuf:"bytes,5,req,name=hosting" json:"hosting,omitempty"`
 	// Path to CoreOS image for hosted KVM, absolute or relative to domain.
 	KvmCoreosImg *string `protobuf:"bytes,6,opt,name=kvm_coreos_img" json:"kvm_coreos_img,omitempty"`
@@ -64,7 +64,34 @@ type LinuxHostConfig struct {
 	KvmCoreosSshAuthKeys *string `protobuf:"bytes,8,opt,name=kvm_coreos_ssh_auth_keys" json:"kvm_coreos_ssh_auth_keys,omitempty"`
 	// KB of memory to allocate for each VM with custom kernel and initram.
 	KvmCustomVmMemory *int32 `protobuf:"varint,9,opt,name=kvm_custom_vm_memory" json:"kvm_custom_vm_memory,omitempty"`
-	XXX_unrecognized  []byte `json:"-"`
+	// Bytes of recent output to keep in memory for each hosted program.
+	LogBufferSize *int32 `protobuf:"varint,10,opt,name=log_buffer_size" json:"log_buffer_size,omitempty"`
+	// Directory for hosted program output logs, relative to host configuration
+	// directory. If not set, output is kept only in memory.
+	LogDir *string `protobuf:"bytes,11,opt,name=log_dir" json:"log_dir,omitempty"`
+	// Bytes at which a hosted program output log is rotated.
+	LogMaxFileSize *int64 `protobuf:"varint,12,opt,name=log_max_file_size" json:"log_max_file_size,omitempty"`
+	// Number of rotated output logs to keep for each hosted program.
+	LogMaxFiles *int32 `protobuf:"varint,13,opt,name=log_max_files" json:"log_max_files,omitempty"`
+	// QEMU machine type, cpu model and number of cpus for each VM with custom
+	// kernel and initram. These are measured into the VM's subprincipal.
+	KvmCustomMachine *string `protobuf:"bytes,14,opt,name=kvm_custom_machine" json:"kvm_custom_machine,omitempty"`
+	KvmCustomCpu     *string `protobuf:"bytes,15,opt,name=kvm_custom_cpu" json:"kvm_custom_cpu,omitempty"`
+	KvmCustomSmp     *int32  `protobuf:"varint,16,opt,name=kvm_custom_smp" json:"kvm_custom_smp,omitempty"`
+	// Limits on the Tao RPC calls each hosted program may make, and the Tao RPC
+	// methods, e.g. "Attest", that a hosted program may call only if the guard
+	// authorizes it for "Tao" + method. See TaoRPCConfig.
+	TaoRpcLimit      []*TaoRPCLimit `protobuf:"bytes,17,rep,name=tao_rpc_limit" json:"tao_rpc_limit,omitempty"`
+	GuardedTaoMethod []string       `protobuf:"bytes,18,rep,name=guarded_tao_method" json:"guarded_tao_method,omitempty"`
+	// For "tls" parent types, the directory holding the attested key the host
+	// presents to its parent, relative to host configuration directory.
+	ParentKeys *string `protobuf:"bytes,19,opt,name=parent_keys" json:"parent_keys,omitempty"`
+	// The unprivileged uid and gid that hosted programs started by remote admin
+	// callers run as. Remote callers can't start hosted programs unless both are
+	// set to something other than root.
+	RemoteAdminUid   *int32 `protobuf:"varint,20,opt,name=remote_admin_uid" json:"remote_admin_uid,omitempty"`
+	RemoteAdminGid   *int32 `protobuf:"varint,21,opt,name=remote_admin_gid" json:"remote_admin_gid,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
 }
 
 func (m *LinuxHostConfig) Reset()         { *m = LinuxHostConfig{} }
@@ -134,5 +161,345 @@ func (m *LinuxHostConfig) GetKvmCustomVmMemory() int32 {
 	return 0
 }
 
+func (m *LinuxHostConfig) GetLogBufferSize() int32 {
+	if m != nil && m.LogBufferSize != nil {
+		return *m.LogBufferSize
+	}
+	return 0
+}
+
+func (m *LinuxHostConfig) GetLogDir() string {
+	if m != nil && m.LogDir != nil {
+		return *m.LogDir
+	}
+	return ""
+}
+
+func (m *LinuxHostConfig) GetLogMaxFileSize() int64 {
+	if m != nil && m.LogMaxFileSize != nil {
+		return *m.LogMaxFileSize
+	}
+	return 0
+}
+
+func (m *LinuxHostConfig) GetLogMaxFiles() int32 {
+	if m != nil && m.LogMaxFiles != nil {
+		return *m.LogMaxFiles
+	}
+	return 0
+}
+
+func (m *LinuxHostConfig) GetKvmCustomMachine() string {
+	if m != nil && m.KvmCustomMachine != nil {
+		return *m.KvmCustomMachine
+	}
+	return ""
+}
+
+func (m *LinuxHostConfig) GetKvmCustomCpu() string {
+	if m != nil && m.KvmCustomCpu != nil {
+		return *m.KvmCustomCpu
+	}
+	return ""
+}
+
+func (m *LinuxHostConfig) GetKvmCustomSmp() int32 {
+	if m != nil && m.KvmCustomSmp != nil {
+		return *m.KvmCustomSmp
+	}
+	return 0
+}
+
+func (m *LinuxHostConfig) GetTaoRpcLimit() []*TaoRPCLimit {
+	if m != nil {
+		return m.TaoRpcLimit
+	}
+	return nil
+}
+
+func (m *LinuxHostConfig) GetGuardedTaoMethod() []string {
+	if m != nil {
+		return m.GuardedTaoMethod
+	}
+	return nil
+}
+
+func (m *LinuxHostConfig) GetParentKeys() string {
+	if m != nil && m.ParentKeys != nil {
+		return *m.ParentKeys
+	}
+	return ""
+}
+
+func (m *LinuxHostConfig) GetRemoteAdminUid() int32 {
+	if m != nil && m.RemoteAdminUid != nil {
+		return *m.RemoteAdminUid
+	}
+	return 0
+}
+
+func (m *LinuxHostConfig) GetRemoteAdminGid() int32 {
+	if m != nil && m.RemoteAdminGid != nil {
+		return *m.RemoteAdminGid
+	}
+	return 0
+}
+
+// A limit on calls to a Tao RPC method by each hosted program, see TaoRPCLimit.
+type TaoRPCLimit struct {
+	Method *string `protobuf:"bytes,1,req,name=method" json:"method,omitempty"`
+	// Calls per second, and how many calls may be made at once after a pause.
+	Rate  *float64 `protobuf:"fixed64,2,opt,name=rate" json:"rate,omitempty"`
+	Burst *int32   `protobuf:"varint,3,opt,name=burst" json:"burst,omitempty"`
+	// The largest size or amount of data accepted in a request.
+	MaxSize          *int32 `protobuf:"varint,4,opt,name=max_size" json:"max_size,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *TaoRPCLimit) Reset()         { *m = TaoRPCLimit{} }
+func (m *TaoRPCLimit) String() string { return proto.CompactTextString(m) }
+func (*TaoRPCLimit) ProtoMessage()    {}
+
+func (m *TaoRPCLimit) GetMethod() string {
+	if m != nil && m.Method != nil {
+		return *m.Method
+	}
+	return ""
+}
+
+func (m *TaoRPCLimit) GetRate() float64 {
+	if m != nil && m.Rate != nil {
+		return *m.Rate
+	}
+	return 0
+}
+
+func (m *TaoRPCLimit) GetBurst() int32 {
+	if m != nil && m.Burst != nil {
+		return *m.Burst
+	}
+	return 0
+}
+
+func (m *TaoRPCLimit) GetMaxSize() int32 {
+	if m != nil && m.MaxSize != nil {
+		return *m.MaxSize
+	}
+	return 0
+}
+
+// An interpreter that runs a hosted process, see ProcessInterpreter.
+type LinuxHostChildInterpreter struct {
+	Path             *string  `protobuf:"bytes,1,req,name=path" json:"path,omitempty"`
+	Args             []string `protobuf:"bytes,2,rep,name=args" json:"args,omitempty"`
+	Hash             []byte   `protobuf:"bytes,3,req,name=hash" json:"hash,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *LinuxHostChildInterpreter) Reset()         { *m = LinuxHostChildInterpreter{} }
+func (m *LinuxHostChildInterpreter) String() string { return proto.CompactTextString(m) }
+func (*LinuxHostChildInterpreter) ProtoMessage()    {}
+
+func (m *LinuxHostChildInterpreter) GetPath() string {
+	if m != nil && m.Path != nil {
+		return *m.Path
+	}
+	return ""
+}
+
+func (m *LinuxHostChildInterpreter) GetArgs() []string {
+	if m != nil {
+		return m.Args
+	}
+	return nil
+}
+
+func (m *LinuxHostChildInterpreter) GetHash() []byte {
+	if m != nil {
+		return m.Hash
+	}
+	return nil
+}
+
+// A record of a hosted process, kept so that a LinuxHost that restarts can
+// re-adopt hosted processes started by its previous instance.
+type LinuxHostChildRecord struct {
+	// Current subprincipal, including any extensions.
+	Subprin []byte `protobuf:"bytes,1,req,name=subprin" json:"subprin,omitempty"`
+	Pid     *int32 `protobuf:"varint,2,req,name=pid" json:"pid,omitempty"`
+	// Start time of the process, in clock ticks since boot, used to detect
+	// reuse of the pid.
+	StartTime *uint64 `protobuf:"varint,3,req,name=start_time" json:"start_time,omitempty"`
+	// Hash of the measured binary.
+	Hash []byte `protobuf:"bytes,4,req,name=hash" json:"hash,omitempty"`
+	// Either "pipe" or "unix". Only "unix" channels can be re-established.
+	ChannelType *string `protobuf:"bytes,5,req,name=channel_type" json:"channel_type,omitempty"`
+	// Socket path for "unix" channels.
+	ChannelSpec *string  `protobuf:"bytes,6,opt,name=channel_spec" json:"channel_spec,omitempty"`
+	Id          *uint32  `protobuf:"varint,7,opt,name=id" json:"id,omitempty"`
+	Path        *string  `protobuf:"bytes,8,opt,name=path" json:"path,omitempty"`
+	Args        []string `protobuf:"bytes,9,rep,name=args" json:"args,omitempty"`
+	Dir         *string  `protobuf:"bytes,10,opt,name=dir" json:"dir,omitempty"`
+	Uid         *int32   `protobuf:"varint,11,opt,name=uid" json:"uid,omitempty"`
+	Gid         *int32   `protobuf:"varint,12,opt,name=gid" json:"gid,omitempty"`
+	Argv0       *string  `protobuf:"bytes,13,opt,name=argv0" json:"argv0,omitempty"`
+	Tempdir     *string  `protobuf:"bytes,14,opt,name=tempdir" json:"tempdir,omitempty"`
+	// Who started the hosted process.
+	Owner []byte `protobuf:"bytes,15,opt,name=owner" json:"owner,omitempty"`
+	// Hash of the measured configuration, if any.
+	ConfigHash []byte `protobuf:"bytes,16,opt,name=config_hash" json:"config_hash,omitempty"`
+	// For interpreted programs, the interpreters, outermost first, and the hash
+	// of the dependencies, if any.
+	Interpreter      []*LinuxHostChildInterpreter `protobuf:"bytes,17,rep,name=interpreter" json:"interpreter,omitempty"`
+	DepsHash         []byte                       `protobuf:"bytes,18,opt,name=deps_hash" json:"deps_hash,omitempty"`
+	XXX_unrecognized []byte                       `json:"-"`
+}
+
+func (m *LinuxHostChildRecord) Reset()         { *m = LinuxHostChildRecord{} }
+func (m *LinuxHostChildRecord) String() string { return proto.CompactTextString(m) }
+func (*LinuxHostChildRecord) ProtoMessage()    {}
+
+func (m *LinuxHostChildRecord) GetSubprin() []byte {
+	if m != nil {
+		return m.Subprin
+	}
+	return nil
+}
+
+func (m *LinuxHostChildRecord) GetPid() int32 {
+	if m != nil && m.Pid != nil {
+		return *m.Pid
+	}
+	return 0
+}
+
+func (m *LinuxHostChildRecord) GetStartTime() uint64 {
+	if m != nil && m.StartTime != nil {
+		return *m.StartTime
+	}
+	return 0
+}
+
+func (m *LinuxHostChildRecord) GetHash() []byte {
+	if m != nil {
+		return m.Hash
+	}
+	return nil
+}
+
+func (m *LinuxHostChildRecord) GetChannelType() string {
+	if m != nil && m.ChannelType != nil {
+		return *m.ChannelType
+	}
+	return ""
+}
+
+func (m *LinuxHostChildRecord) GetChannelSpec() string {
+	if m != nil && m.ChannelSpec != nil {
+		return *m.ChannelSpec
+	}
+	return ""
+}
+
+func (m *LinuxHostChildRecord) GetId() uint32 {
+	if m != nil && m.Id != nil {
+		return *m.Id
+	}
+	return 0
+}
+
+func (m *LinuxHostChildRecord) GetPath() string {
+	if m != nil && m.Path != nil {
+		return *m.Path
+	}
+	return ""
+}
+
+func (m *LinuxHostChildRecord) GetArgs() []string {
+	if m != nil {
+		return m.Args
+	}
+	return nil
+}
+
+func (m *LinuxHostChildRecord) GetDir() string {
+	if m != nil && m.Dir != nil {
+		return *m.Dir
+	}
+	return ""
+}
+
+func (m *LinuxHostChildRecord) GetUid() int32 {
+	if m != nil && m.Uid != nil {
+		return *m.Uid
+	}
+	return 0
+}
+
+func (m *LinuxHostChildRecord) GetGid() int32 {
+	if m != nil && m.Gid != nil {
+		return *m.Gid
+	}
+	return 0
+}
+
+func (m *LinuxHostChildRecord) GetArgv0() string {
+	if m != nil && m.Argv0 != nil {
+		return *m.Argv0
+	}
+	return ""
+}
+
+func (m *LinuxHostChildRecord) GetTempdir() string {
+	if m != nil && m.Tempdir != nil {
+		return *m.Tempdir
+	}
+	return ""
+}
+
+func (m *LinuxHostChildRecord) GetOwner() []byte {
+	if m != nil {
+		return m.Owner
+	}
+	return nil
+}
+
+func (m *LinuxHostChildRecord) GetConfigHash() []byte {
+	if m != nil {
+		return m.ConfigHash
+	}
+	return nil
+}
+
+func (m *LinuxHostChildRecord) GetInterpreter() []*LinuxHostChildInterpreter {
+	if m != nil {
+		return m.Interpreter
+	}
+	return nil
+}
+
+func (m *LinuxHostChildRecord) GetDepsHash() []byte {
+	if m != nil {
+		return m.DepsHash
+	}
+	return nil
+}
+
+type LinuxHostChildRecords struct {
+	Child            []*LinuxHostChildRecord `protobuf:"bytes,1,rep,name=child" json:"child,omitempty"`
+	XXX_unrecognized []byte                  `json:"-"`
+}
+
+func (m *LinuxHostChildRecords) Reset()         { *m = LinuxHostChildRecords{} }
+func (m *LinuxHostChildRecords) String() string { return proto.CompactTextString(m) }
+func (*LinuxHostChildRecords) ProtoMessage()    {}
+
+func (m *LinuxHostChildRecords) GetChild() []*LinuxHostChildRecord {
+	if m != nil {
+		return m.Child
+	}
+	return nil
+}
+
 func init() {
 }
@@ -18,10 +18,15 @@ package tao
 // This code is extremely dull and, ideally, would be generated automatically.
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"net"
 	"net/rpc"
 	"os"
+	"time"
 
+	"github.com/golang/glog"
 	"github.com/golang/protobuf/proto"
 	"github.com/jlmucb/cloudproxy/go/tao/auth"
 	"github.com/jlmucb/cloudproxy/go/util"
@@ -30,7 +35,7 @@ import (
 
 // LinuxHostAdminClient is a client stub for LinuxHost's admin RPC interface.
 type LinuxHostAdminClient struct {
-	oob *util.OOBUnixConn
+	oob *util.OOBUnixConn // nil for remote hosts
 	*rpc.Client
 }
 
@@ -42,6 +47,14 @@ func NewLinuxHostAdminClient(conn *net.UnixConn) LinuxHostAdminClient {
 	return LinuxHostAdminClient{oob, c}
 }
 
+// NewRemoteLinuxHostAdminClient returns a new client stub for LinuxHost's admin
+// RPC interface over a connection to a remote host, e.g. one returned by Dial.
+// Remote clients can't share stdio with the hosted programs they start.
+func NewRemoteLinuxHostAdminClient(conn net.Conn) LinuxHostAdminClient {
+	c := rpc.NewClientWithCodec(protorpc.NewClientCodec(conn))
+	return LinuxHostAdminClient{nil, c}
+}
+
 // StartHostedProgram is the client stub for LinuxHost.StartHostedProgram.
 func (client LinuxHostAdminClient) StartHostedProgram(spec *HostedProgramSpec) (auth.SubPrin, int, error) {
 	req := &LinuxHostAdminRPCRequest{
@@ -51,21 +64,37 @@ func (client LinuxHostAdminClient) StartHostedProgram(spec *HostedProgramSpec) (
 		Args:          spec.Args,
 		// TODO: pass uid and gid?
 	}
+	if m := spec.Measure; m != nil {
+		req.MeasureArgs = proto.Bool(m.Args)
+		req.MeasureEnv = m.Env
+		req.MeasureFiles = m.Files
+	}
+	if sm := spec.Script; sm != nil {
+		req.Script = proto.Bool(true)
+		req.Interpreter = proto.String(sm.Interpreter)
+		req.InterpreterArgs = sm.InterpreterArgs
+		req.ScriptDeps = sm.Dependencies
+	}
 	var fds []int
 	if spec.Stdin != nil {
 		req.Stdin = proto.Int32(int32(len(fds)))
 		fds = append(fds, int(spec.Stdin.Fd()))
 	}
-	if spec.Stdin != nil {
+	if spec.Stdout != nil {
 		req.Stdout = proto.Int32(int32(len(fds)))
 		fds = append(fds, int(spec.Stdout.Fd()))
 	}
-	if spec.Stdin != nil {
+	if spec.Stderr != nil {
 		req.Stderr = proto.Int32(int32(len(fds)))
 		fds = append(fds, int(spec.Stderr.Fd()))
 	}
+	if client.oob == nil && len(fds) > 0 {
+		return auth.SubPrin{}, 0, newError("can't share stdio with a remote host")
+	}
 	resp := new(LinuxHostAdminRPCResponse)
-	client.oob.ShareFDs(fds...)
+	if client.oob != nil {
+		client.oob.ShareFDs(fds...)
+	}
 	err := client.Call("LinuxHost.StartHostedProgram", req, resp)
 	if err != nil {
 		return auth.SubPrin{}, 0, err
@@ -91,6 +120,8 @@ func (client LinuxHostAdminClient) StopHostedProgram(subprin auth.SubPrin) error
 }
 
 // ListHostedPrograms is the client stub for LinuxHost.ListHostedPrograms.
+// Unless the caller is authorized for AdminListAny, only the hosted programs it
+// started are listed.
 func (client LinuxHostAdminClient) ListHostedPrograms() (name []auth.SubPrin, pid []int, err error) {
 	req := &LinuxHostAdminRPCRequest{}
 	resp := new(LinuxHostAdminRPCResponse)
@@ -137,6 +168,78 @@ func (client LinuxHostAdminClient) KillHostedProgram(subprin auth.SubPrin) error
 	return nil
 }
 
+// WatchHostedPrograms is the client stub for LinuxHost.WatchHostedPrograms.
+// It returns the events after seq, or no events if none happen for a while, and
+// the sequence number to pass to the next call. Passing zero for seq skips any
+// past events. Unless the caller is authorized for AdminWatchAny, events for
+// hosted programs started by others are left out, so sequence numbers may skip.
+func (client LinuxHostAdminClient) WatchHostedPrograms(seq uint64) ([]HostedProgramEvent, uint64, error) {
+	req := &LinuxHostAdminRPCRequest{
+		Seq: proto.Uint64(seq),
+	}
+	resp := new(LinuxHostAdminRPCResponse)
+	err := client.Call("LinuxHost.WatchHostedPrograms", req, resp)
+	if err != nil {
+		return nil, seq, err
+	}
+	events := make([]HostedProgramEvent, len(resp.Event))
+	for i, e := range resp.Event {
+		events[i] = HostedProgramEvent{
+			Seq:    e.GetSeq(),
+			Type:   e.GetType(),
+			Pid:    int(e.GetPid()),
+			Status: int(e.GetStatus()),
+			Time:   time.Unix(0, e.GetTime()),
+		}
+		if e.Subprin != nil {
+			events[i].Subprin, err = auth.UnmarshalSubPrin(e.Subprin)
+			if err != nil {
+				return nil, seq, err
+			}
+		}
+	}
+	return events, resp.GetSeq(), nil
+}
+
+// HostedProgramLogs is the client stub for LinuxHost.HostedProgramLogs. The
+// hosted program is identified by pid, if it is not zero, and by subprin, if it
+// is not empty. It returns the output starting at offset and the offset to pass
+// to the next call. If follow is set and there is no output at offset yet, it
+// waits a while for some. It also returns whether the output is complete.
+func (client LinuxHostAdminClient) HostedProgramLogs(pid int, subprin auth.SubPrin, offset int64, follow bool) ([]byte, int64, bool, error) {
+	req := &LinuxHostAdminRPCRequest{
+		Pid:    proto.Int32(int32(pid)),
+		Offset: proto.Int64(offset),
+		Follow: proto.Bool(follow),
+	}
+	if len(subprin) != 0 {
+		req.Subprin = auth.Marshal(subprin)
+	}
+	resp := new(LinuxHostAdminRPCResponse)
+	err := client.Call("LinuxHost.HostedProgramLogs", req, resp)
+	if err != nil {
+		return nil, offset, false, err
+	}
+	return resp.Data, resp.GetOffset(), resp.GetDone(), nil
+}
+
+// HostedVMStatus is the client stub for LinuxHost.HostedVMStatus. The VM is
+// identified by pid, if it is not zero, and by subprin, if it is not empty.
+func (client LinuxHostAdminClient) HostedVMStatus(pid int, subprin auth.SubPrin) (*VMStatus, error) {
+	req := &LinuxHostAdminRPCRequest{
+		Pid: proto.Int32(int32(pid)),
+	}
+	if len(subprin) != 0 {
+		req.Subprin = auth.Marshal(subprin)
+	}
+	resp := new(LinuxHostAdminRPCResponse)
+	err := client.Call("LinuxHost.HostedVMStatus", req, resp)
+	if err != nil {
+		return nil, err
+	}
+	return &VMStatus{State: resp.GetVmState(), ShutdownReason: resp.GetShutdownReason()}, nil
+}
+
 // HostName is the client stub for LinuxHost.HostName.
 func (client LinuxHostAdminClient) HostName() (auth.Prin, error) {
 	req := &LinuxHostAdminRPCRequest{}
@@ -162,7 +265,8 @@ type LinuxHostAdminServer struct {
 }
 
 type linuxHostAdminServerStub struct {
-	oob  *util.OOBUnixConn
+	oob  *util.OOBUnixConn // nil for remote callers
+	peer *auth.Prin        // nil for local callers
 	lh   *LinuxHost
 	Done chan bool
 }
@@ -173,15 +277,143 @@ func NewLinuxHostAdminServer(host *LinuxHost) LinuxHostAdminServer {
 	return LinuxHostAdminServer{host, make(chan bool, 1)}
 }
 
+// AdminCallerPrins returns the principals that stand for a local caller of the
+// admin RPC with the given credentials: a subprincipal of the host naming the
+// uid, e.g. host.User(1000), and one naming the gid, e.g. host.Group(1000).
+func (lh *LinuxHost) AdminCallerPrins(ucred *util.Ucred) []auth.Prin {
+	return []auth.Prin{lh.userPrin(int(ucred.Uid)), lh.groupPrin(int(ucred.Gid))}
+}
+
+func (lh *LinuxHost) userPrin(uid int) auth.Prin {
+	return lh.HostName().MakeSubprincipal(auth.SubPrin{auth.PrinExt{Name: "User", Arg: []auth.Term{auth.Int(uid)}}})
+}
+
+func (lh *LinuxHost) groupPrin(gid int) auth.Prin {
+	return lh.HostName().MakeSubprincipal(auth.SubPrin{auth.PrinExt{Name: "Group", Arg: []auth.Term{auth.Int(gid)}}})
+}
+
+// An adminCaller is the caller of an admin RPC: either a local user,
+// identified by the unix credentials passed over the admin socket, or a remote
+// principal, authenticated by a Tao listener.
+type adminCaller struct {
+	ucred *util.Ucred
+	peer  *auth.Prin
+}
+
+// adminCallerPrins returns the principals that stand for a caller. The first is
+// the one recorded as the owner of hosted programs the caller starts.
+func (lh *LinuxHost) adminCallerPrins(caller adminCaller) []auth.Prin {
+	if caller.peer != nil {
+		return []auth.Prin{*caller.peer}
+	}
+	if caller.ucred != nil {
+		return lh.AdminCallerPrins(caller.ucred)
+	}
+	return nil
+}
+
+// authorizeAdmin checks whether a caller of the admin RPC may perform op, which
+// is one of "AdminStart", "AdminStop", "AdminKill", "AdminWait", "AdminList",
+// "AdminWatch", "AdminLogs", any of these but "AdminStart" with "Any"
+// appended, "AdminSuperuser", or "AdminShutdown". Local callers running as root or as the user
+// running the host may do anything. Other callers must have one of their
+// principals authorized for op by the guard.
+func (lh *LinuxHost) authorizeAdmin(caller adminCaller, op string) error {
+	if caller.peer == nil && caller.ucred == nil {
+		return newError("unauthorized: missing peer credentials")
+	}
+	if caller.peer == nil && (caller.ucred.Uid == 0 || int(caller.ucred.Uid) == os.Geteuid()) {
+		return nil
+	}
+	for _, prin := range lh.adminCallerPrins(caller) {
+		if lh.guard.IsAuthorized(prin, op, nil) {
+			return nil
+		}
+	}
+	return newError("unauthorized: %s is not authorized for %s", lh.adminCallerPrins(caller)[0], op)
+}
+
+// authorizeAdminControl checks whether a caller of the admin RPC may perform
+// op, either "AdminStop" or "AdminKill", on the hosted programs with the given
+// subprincipal. Callers may only control hosted programs that they started,
+// unless they are also authorized for op+"Any".
+func (lh *LinuxHost) authorizeAdminControl(caller adminCaller, op string, subprin auth.SubPrin) error {
+	return lh.authorizeOwner(caller, op, lh.hostedProgramOwners(0, subprin))
+}
+
+// authorizeOwner checks whether a caller of the admin RPC may perform op on
+// hosted programs started by owners. Callers authorized for op may perform it
+// on hosted programs that they started, and on others only if they are also
+// authorized for op+"Any".
+func (lh *LinuxHost) authorizeOwner(caller adminCaller, op string, owners []auth.Prin) error {
+	if err := lh.authorizeAdmin(caller, op); err != nil {
+		return err
+	}
+	self := lh.adminCallerPrins(caller)[0]
+	for _, owner := range owners {
+		if !owner.Identical(self) {
+			return lh.authorizeAdmin(caller, op+"Any")
+		}
+	}
+	return nil
+}
+
+// ownerFilter checks whether a caller of the admin RPC may perform op, and
+// returns the owner whose hosted programs op is restricted to, or nil if the
+// caller is also authorized for op+"Any".
+func (lh *LinuxHost) ownerFilter(caller adminCaller, op string) (*auth.Prin, error) {
+	if err := lh.authorizeAdmin(caller, op); err != nil {
+		return nil, err
+	}
+	if lh.authorizeAdmin(caller, op+"Any") == nil {
+		return nil, nil
+	}
+	self := lh.adminCallerPrins(caller)[0]
+	return &self, nil
+}
+
+// adminCallerUser returns the uid and gid that hosted programs started by a
+// caller of the admin RPC run as. Local callers' programs run as the caller.
+// Remote callers have no local account, so their programs run as the
+// unprivileged user in the host's RemoteAdminConfig, or as the user running the
+// host if the guard authorizes them for AdminSuperuser.
+func (lh *LinuxHost) adminCallerUser(caller adminCaller) (int, int, error) {
+	if caller.ucred != nil {
+		return int(caller.ucred.Uid), int(caller.ucred.Gid), nil
+	}
+	if lh.authorizeAdmin(caller, "AdminSuperuser") == nil {
+		return os.Getuid(), os.Getgid(), nil
+	}
+	cfg := lh.RemoteAdminConfig
+	if cfg.Uid <= 0 || cfg.Gid <= 0 {
+		return 0, 0, newError("unauthorized: no unprivileged user is configured for remote admin callers")
+	}
+	return cfg.Uid, cfg.Gid, nil
+}
+
+// caller returns the caller of the RPC being served.
+func (server linuxHostAdminServerStub) caller() adminCaller {
+	if server.peer != nil {
+		return adminCaller{peer: server.peer}
+	}
+	return adminCaller{ucred: server.oob.PeerCred()}
+}
+
 // StartHostedProgram is the server stub for LinuxHost.StartHostedProgram.
 func (server linuxHostAdminServerStub) StartHostedProgram(r *LinuxHostAdminRPCRequest, s *LinuxHostAdminRPCResponse) error {
-	files := server.oob.SharedFiles()
+	var files []*os.File
+	if server.oob != nil {
+		files = server.oob.SharedFiles()
+	}
 	defer func() {
 		for _, f := range files {
 			f.Close()
 		}
 	}()
-	ucred := server.oob.PeerCred()
+	caller := server.caller()
+	if err := server.lh.authorizeAdmin(caller, "AdminStart"); err != nil {
+		return err
+	}
 	if r.Path == nil {
 		return newError("missing path")
 	}
@@ -189,12 +421,29 @@ func (server linuxHostAdminServerStub) StartHostedProgram(r *LinuxHostAdminRPCRe
 		Path:          *r.Path,
 		Args:          r.Args,
 		ContainerArgs: r.ContainerArgs,
-		Dir:           *r.Dir,
-		Uid:           int(ucred.Uid),
-		Gid:           int(ucred.Gid),
+		Dir:           r.GetDir(),
+	}
+	if r.MeasureArgs != nil || len(r.MeasureEnv) != 0 || len(r.MeasureFiles) != 0 {
+		spec.Measure = &ConfigMeasurement{
+			Args:  r.GetMeasureArgs(),
+			Env:   r.MeasureEnv,
+			Files: r.MeasureFiles,
+		}
+	}
+	if r.GetScript() {
+		spec.Script = &ScriptMeasurement{
+			Interpreter:     r.GetInterpreter(),
+			InterpreterArgs: r.InterpreterArgs,
+			Dependencies:    r.ScriptDeps,
+		}
+	}
+	var err error
+	if spec.Uid, spec.Gid, err = server.lh.adminCallerUser(caller); err != nil {
+		return err
 	}
-	// We do allow superuser here, since we trust the oob credentials
-	spec.Superuser = (ucred.Uid == 0 || ucred.Gid == 0)
+	// We do allow superuser here, since we trust the oob credentials, or the
+	// guard authorized the remote caller for AdminSuperuser.
+	spec.Superuser = (spec.Uid == 0 || spec.Gid == 0)
 	if r.Stdin != nil {
 		if int(*r.Stdin) >= len(files) {
 			return newError("missing stdin")
@@ -213,7 +462,8 @@ func (server linuxHostAdminServerStub) StartHostedProgram(r *LinuxHostAdminRPCRe
 		}
 		spec.Stderr = files[*r.Stderr]
 	}
-	subprin, pid, err := server.lh.StartHostedProgram(spec)
+	owner := server.lh.adminCallerPrins(caller)[0]
+	subprin, pid, err := server.lh.startHostedProgram(spec, owner)
 	if err != nil {
 		return err
 	}
@@ -227,24 +477,23 @@ func (server linuxHostAdminServerStub) StartHostedProgram(r *LinuxHostAdminRPCRe
 
 // StopHostedProgram is the server stub for LinuxHost.StopHostedProgram.
 func (server linuxHostAdminServerStub) StopHostedProgram(r *LinuxHostAdminRPCRequest, s *LinuxHostAdminRPCResponse) error {
-	ucred := server.oob.PeerCred()
-	// TODO(kwalsh): also authorize owner of child
-	if ucred.Uid != 0 && int(ucred.Uid) != os.Geteuid() {
-		return newError("unauthorized: only root or owner can stop hosted programs")
-	}
 	subprin, err := auth.UnmarshalSubPrin(r.Subprin)
 	if err != nil {
 		return err
 	}
+	if err := server.lh.authorizeAdminControl(server.caller(), "AdminStop", subprin); err != nil {
+		return err
+	}
 	return server.lh.StopHostedProgram(subprin)
 }
 
 // ListHostedPrograms is the server stub for LinuxHost.ListHostedPrograms.
 func (server linuxHostAdminServerStub) ListHostedPrograms(r *LinuxHostAdminRPCRequest, s *LinuxHostAdminRPCResponse) error {
-	names, pids, err := server.lh.ListHostedPrograms()
+	owner, err := server.lh.ownerFilter(server.caller(), "AdminList")
 	if err != nil {
 		return err
 	}
+	names, pids := server.lh.hostedProgramsOwnedBy(owner)
 	if len(names) != len(pids) {
 		return newError("invalid response")
 	}
@@ -260,11 +509,6 @@ func (server linuxHostAdminServerStub) ListHostedPrograms(r *LinuxHostAdminRPCRe
 
 // WaitHostedProgram is the server stub for LinuxHost.WaitHostedProgram.
 func (server linuxHostAdminServerStub) WaitHostedProgram(r *LinuxHostAdminRPCRequest, s *LinuxHostAdminRPCResponse) error {
-	// ucred := server.oob.PeerCred()
-	// TODO(kwalsh): also authorize owner of child
-	// if ucred.Uid != 0 && int(ucred.Uid) != os.Geteuid() {
-	// 	return newError("unauthorized: only root or owner can wait for hosted programs")
-	// }
 	if r.Pid == nil {
 		return newError("required pid is nil")
 	}
@@ -273,6 +517,9 @@ func (server linuxHostAdminServerStub) WaitHostedProgram(r *LinuxHostAdminRPCReq
 	if err != nil {
 		return err
 	}
+	if err := server.lh.authorizeOwner(server.caller(), "AdminWait", server.lh.hostedProgramOwners(pid, subprin)); err != nil {
+		return err
+	}
 	status, err := server.lh.WaitHostedProgram(pid, subprin)
 	if err != nil {
 		return err
@@ -283,18 +530,101 @@ func (server linuxHostAdminServerStub) WaitHostedProgram(r *LinuxHostAdminRPCReq
 
 // KillHostedProgram is the server stub for LinuxHost.KillHostedProgram.
 func (server linuxHostAdminServerStub) KillHostedProgram(r *LinuxHostAdminRPCRequest, s *LinuxHostAdminRPCResponse) error {
-	ucred := server.oob.PeerCred()
-	// TODO(kwalsh): also authorize owner of child
-	if ucred.Uid != 0 && int(ucred.Uid) != os.Geteuid() {
-		return newError("unauthorized: only root or owner can kill hosted programs")
-	}
 	subprin, err := auth.UnmarshalSubPrin(r.Subprin)
 	if err != nil {
 		return err
 	}
+	if err := server.lh.authorizeAdminControl(server.caller(), "AdminKill", subprin); err != nil {
+		return err
+	}
 	return server.lh.KillHostedProgram(subprin)
 }
 
+// watchTimeout is how long the server stub for LinuxHost.WatchHostedPrograms
+// waits for an event before replying with none.
+const watchTimeout = 30 * time.Second
+
+// WatchHostedPrograms is the server stub for LinuxHost.WatchHostedPrograms.
+// Callers not authorized for AdminWatchAny only see events for hosted programs
+// they started, and HOST_SHUTDOWN events.
+func (server linuxHostAdminServerStub) WatchHostedPrograms(r *LinuxHostAdminRPCRequest, s *LinuxHostAdminRPCResponse) error {
+	owner, err := server.lh.ownerFilter(server.caller(), "AdminWatch")
+	if err != nil {
+		return err
+	}
+	events, seq, err := server.lh.WatchHostedPrograms(r.GetSeq(), watchTimeout)
+	if err != nil {
+		return err
+	}
+	for _, e := range events {
+		if owner != nil && e.Type != HostedProgramEventType_HOST_SHUTDOWN && !e.Owner.Identical(*owner) {
+			continue
+		}
+		s.Event = append(s.Event, &LinuxHostAdminRPCEvent{
+			Seq:    proto.Uint64(e.Seq),
+			Type:   e.Type.Enum(),
+			Pid:    proto.Int32(int32(e.Pid)),
+			Status: proto.Int32(int32(e.Status)),
+			Time:   proto.Int64(e.Time.UnixNano()),
+		})
+		if e.Subprin != nil {
+			s.Event[len(s.Event)-1].Subprin = auth.Marshal(e.Subprin)
+		}
+	}
+	s.Seq = proto.Uint64(seq)
+	return nil
+}
+
+// HostedProgramLogs is the server stub for LinuxHost.HostedProgramLogs.
+func (server linuxHostAdminServerStub) HostedProgramLogs(r *LinuxHostAdminRPCRequest, s *LinuxHostAdminRPCResponse) error {
+	var subprin auth.SubPrin
+	if r.Subprin != nil {
+		var err error
+		subprin, err = auth.UnmarshalSubPrin(r.Subprin)
+		if err != nil {
+			return err
+		}
+	}
+	l, err := server.lh.hostedProgramLog(int(r.GetPid()), subprin)
+	if err != nil {
+		return err
+	}
+	if err := server.lh.authorizeOwner(server.caller(), "AdminLogs", []auth.Prin{l.owner}); err != nil {
+		return err
+	}
+	var timeout time.Duration
+	if r.GetFollow() {
+		timeout = watchTimeout
+	}
+	data, offset, done := l.read(r.GetOffset(), timeout)
+	s.Data = data
+	s.Offset = proto.Int64(offset)
+	s.Done = proto.Bool(done)
+	return nil
+}
+
+// HostedVMStatus is the server stub for LinuxHost.HostedVMStatus.
+func (server linuxHostAdminServerStub) HostedVMStatus(r *LinuxHostAdminRPCRequest, s *LinuxHostAdminRPCResponse) error {
+	var subprin auth.SubPrin
+	if r.Subprin != nil {
+		var err error
+		subprin, err = auth.UnmarshalSubPrin(r.Subprin)
+		if err != nil {
+			return err
+		}
+	}
+	if err := server.lh.authorizeOwner(server.caller(), "AdminList", server.lh.hostedProgramOwners(int(r.GetPid()), subprin)); err != nil {
+		return err
+	}
+	status, err := server.lh.HostedVMStatus(int(r.GetPid()), subprin)
+	if err != nil {
+		return err
+	}
+	s.VmState = proto.String(status.State)
+	s.ShutdownReason = proto.String(status.ShutdownReason)
+	return nil
+}
+
 // HostName is the server stub for LinuxHost.HostName.
 func (server linuxHostAdminServerStub) HostName(r *LinuxHostAdminRPCRequest, s *LinuxHostAdminRPCResponse) error {
 	prin := server.lh.HostName()
@@ -304,10 +634,8 @@ func (server linuxHostAdminServerStub) HostName(r *LinuxHostAdminRPCRequest, s *
 
 // Shutdown is the server stub for LinuxHost.Shutdown.
 func (server linuxHostAdminServerStub) Shutdown(r *LinuxHostAdminRPCRequest, s *LinuxHostAdminRPCResponse) error {
-	ucred := server.oob.PeerCred()
-	// TODO(kwalsh): also authorize owner of child
-	if ucred.Uid != 0 && int(ucred.Uid) != os.Geteuid() {
-		return newError("unauthorized: only root or owner can shut down linux_host")
+	if err := server.lh.authorizeAdmin(server.caller(), "AdminShutdown"); err != nil {
+		return err
 	}
 	err := server.lh.Shutdown()
 	server.Done <- true
@@ -348,10 +676,110 @@ func (server LinuxHostAdminServer) Serve(sock *net.UnixListener) error {
 		}
 		s := rpc.NewServer()
 		oob := util.NewOOBUnixConn(conn)
-		err = s.RegisterName("LinuxHost", linuxHostAdminServerStub{oob, server.lh, server.Done})
+		err = s.RegisterName("LinuxHost", linuxHostAdminServerStub{oob, nil, server.lh, server.Done})
 		if err != nil {
 			return err
 		}
 		go s.ServeCodec(protorpc.NewServerCodec(oob))
 	}
 }
+
+// ListenRemoteAdmin returns a Tao listener for remote admin RPC connections to
+// this host, for use with LinuxHostAdminServer.ServeRemote. The host attests
+// to a fresh TLS key for the listener. Callers must present an attestation for
+// a principal that guard, normally the domain guard, authorizes to Execute.
+func (lh *LinuxHost) ListenRemoteAdmin(network, addr string, guard Guard, v *Verifier) (net.Listener, error) {
+	return lh.listenAttested(network, addr, "Tao LinuxHost Admin", guard, v, ListenOptions{
+		OnReject: func(addr net.Addr, err error) {
+			glog.Errorf("Rejected remote admin connection from %s: %s", addr, err)
+		},
+	})
+}
+
+// listenAttested returns a Tao listener whose fresh TLS key, with a
+// self-signed certificate for organization org, is attested by this host.
+func (lh *LinuxHost) listenAttested(network, addr, org string, guard Guard, v *Verifier, opts ListenOptions) (net.Listener, error) {
+	keys, err := NewTemporaryKeys(Signing)
+	if err != nil {
+		return nil, err
+	}
+	keys.Cert, err = keys.SigningKey.CreateSelfSignedX509(&pkix.Name{
+		Organization: []string{org}})
+	if err != nil {
+		return nil, err
+	}
+	s := &auth.Speaksfor{
+		Delegate:  keys.SigningKey.ToPrincipal(),
+		Delegator: lh.HostName(),
+	}
+	keys.Delegation, err = lh.Host.Attest(nil, nil, nil, nil, s)
+	if err != nil {
+		return nil, err
+	}
+	tlsCert, err := EncodeTLSCert(keys)
+	if err != nil {
+		return nil, err
+	}
+	conf := &tls.Config{
+		RootCAs:            x509.NewCertPool(),
+		Certificates:       []tls.Certificate{*tlsCert},
+		InsecureSkipVerify: true,
+	}
+	return ListenWithOptions(network, addr, conf, guard, v, keys.Delegation, opts)
+}
+
+// RemoteAdminConfig controls hosted programs started by remote callers of the
+// admin RPC, see LinuxHostAdminServer.ServeRemote.
+type RemoteAdminConfig struct {
+	// Uid and Gid are the unprivileged user and group that hosted programs
+	// started by remote callers run as. Remote callers can't start hosted
+	// programs unless both are set to something other than root, or the guard
+	// authorizes them for AdminSuperuser, in which case their hosted programs
+	// run as the user running the host.
+	Uid, Gid int
+}
+
+// ServeRemote accepts remote connections on sock, which must come from
+// ListenRemoteAdmin, and services them. Each admin op is authorized for the
+// principal the caller presented in the Tao handshake. Hosted programs that
+// remote callers start run as configured by the host's RemoteAdminConfig.
+func (server LinuxHostAdminServer) ServeRemote(sock net.Listener) error {
+	if l, ok := sock.(*listener); !ok || l.opts.Anonymous {
+		return newError("remote admin requires a Tao listener")
+	}
+
+	connections := make(chan *Conn, 1)
+	errors := make(chan error, 1)
+	go func() {
+		for {
+			conn, err := sock.Accept()
+			if err != nil {
+				errors <- err
+				break
+			}
+			connections <- conn.(*Conn)
+		}
+	}()
+
+	for {
+		var conn *Conn
+		select {
+		case conn = <-connections:
+			break
+		case err := <-errors:
+			return err
+		case <-server.Done:
+			return nil
+		}
+		go func(conn *Conn) {
+			peer := conn.PeerPrincipal()
+			s := rpc.NewServer()
+			err := s.RegisterName("LinuxHost", linuxHostAdminServerStub{nil, &peer, server.lh, server.Done})
+			if err != nil {
+				conn.Close()
+				return
+			}
+			s.ServeCodec(protorpc.NewServerCodec(conn))
+		}(conn)
+	}
+}
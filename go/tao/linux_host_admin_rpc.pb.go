@@ -13,16 +13,74 @@ var _ = proto.Marshal
 var _ = fmt.Errorf
 var _ = math.Inf
 
+type HostedProgramEventType int32
+
+const (
+	HostedProgramEventType_STARTED       HostedProgramEventType = 1
+	HostedProgramEventType_EXITED        HostedProgramEventType = 2
+	HostedProgramEventType_KILLED        HostedProgramEventType = 3
+	HostedProgramEventType_DENIED        HostedProgramEventType = 4
+	HostedProgramEventType_HOST_SHUTDOWN HostedProgramEventType = 5
+	HostedProgramEventType_ADOPTED       HostedProgramEventType = 6
+)
+
+var HostedProgramEventType_name = map[int32]string{
+	1: "STARTED",
+	2: "EXITED",
+	3: "KILLED",
+	4: "DENIED",
+	5: "HOST_SHUTDOWN",
+	6: "ADOPTED",
+}
+var HostedProgramEventType_value = map[string]int32{
+	"STARTED":       1,
+	"EXITED":        2,
+	"KILLED":        3,
+	"DENIED":        4,
+	"HOST_SHUTDOWN": 5,
+	"ADOPTED":       6,
+}
+
+func (x HostedProgramEventType) Enum() *HostedProgramEventType {
+	p := new(HostedProgramEventType)
+	*p = x
+	return p
+}
+func (x HostedProgramEventType) String() string {
+	return proto.EnumName(HostedProgramEventType_name, int32(x))
+}
+func (x *HostedProgramEventType) UnmarshalJSON(data []byte) error {
+	value, err := proto.UnmarshalJSONEnum(HostedProgramEventType_value, data, "HostedProgramEventType")
+	if err != nil {
+		return err
+	}
+	*x = HostedProgramEventType(value)
+	return nil
+}
+func (HostedProgramEventType) EnumDescriptor() ([]byte, []int) { return fileDescriptor6, []int{0} }
+
 type LinuxHostAdminRPCRequest struct {
-	Subprin          []byte   `protobuf:"bytes,1,opt,name=subprin" json:"subprin,omitempty"`
-	Path             *string  `protobuf:"bytes,2,opt,name=path" json:"path,omitempty"`
-	Args             []string `protobuf:"bytes,3,rep,name=args" json:"args,omitempty"`
-	Pid              *int32   `protobuf:"varint,4,opt,name=pid" json:"pid,omitempty"`
-	Dir              *string  `protobuf:"bytes,5,opt,name=dir" json:"dir,omitempty"`
-	ContainerArgs    []string `protobuf:"bytes,6,rep,name=container_args" json:"container_args,omitempty"`
-	Stdin            *int32   `protobuf:"varint,7,opt,name=stdin" json:"stdin,omitempty"`
-	Stdout           *int32   `protobuf:"varint,8,opt,name=stdout" json:"stdout,omitempty"`
-	Stderr           *int32   `protobuf:"varint,9,opt,name=stderr" json:"stderr,omitempty"`
+	Subprin       []byte   `protobuf:"bytes,1,opt,name=subprin" json:"subprin,omitempty"`
+	Path          *string  `protobuf:"bytes,2,opt,name=path" json:"path,omitempty"`
+	Args          []string `protobuf:"bytes,3,rep,name=args" json:"args,omitempty"`
+	Pid           *int32   `protobuf:"varint,4,opt,name=pid" json:"pid,omitempty"`
+	Dir           *string  `protobuf:"bytes,5,opt,name=dir" json:"dir,omitempty"`
+	ContainerArgs []string `protobuf:"bytes,6,rep,name=container_args" json:"container_args,omitempty"`
+	Stdin         *int32   `protobuf:"varint,7,opt,name=stdin" json:"stdin,omitempty"`
+	Stdout        *int32   `protobuf:"varint,8,opt,name=stdout" json:"stdout,omitempty"`
+	Stderr        *int32   `protobuf:"varint,9,opt,name=stderr" json:"stderr,omitempty"`
+	Seq           *uint64  `protobuf:"varint,10,opt,name=seq" json:"seq,omitempty"`
+	Offset        *int64   `protobuf:"varint,11,opt,name=offset" json:"offset,omitempty"`
+	Follow        *bool    `protobuf:"varint,12,opt,name=follow" json:"follow,omitempty"`
+	// Configuration to measure into the subprincipal, see ConfigMeasurement.
+	MeasureArgs  *bool    `protobuf:"varint,13,opt,name=measure_args" json:"measure_args,omitempty"`
+	MeasureEnv   []string `protobuf:"bytes,14,rep,name=measure_env" json:"measure_env,omitempty"`
+	MeasureFiles []string `protobuf:"bytes,15,rep,name=measure_files" json:"measure_files,omitempty"`
+	// Measured launch of an interpreted program, see ScriptMeasurement.
+	Script           *bool    `protobuf:"varint,16,opt,name=script" json:"script,omitempty"`
+	Interpreter      *string  `protobuf:"bytes,17,opt,name=interpreter" json:"interpreter,omitempty"`
+	InterpreterArgs  []string `protobuf:"bytes,18,rep,name=interpreter_args" json:"interpreter_args,omitempty"`
+	ScriptDeps       []string `protobuf:"bytes,19,rep,name=script_deps" json:"script_deps,omitempty"`
 	XXX_unrecognized []byte   `json:"-"`
 }
 
@@ -94,6 +152,76 @@ func (m *LinuxHostAdminRPCRequest) GetStderr() int32 {
 	return 0
 }
 
+func (m *LinuxHostAdminRPCRequest) GetSeq() uint64 {
+	if m != nil && m.Seq != nil {
+		return *m.Seq
+	}
+	return 0
+}
+
+func (m *LinuxHostAdminRPCRequest) GetOffset() int64 {
+	if m != nil && m.Offset != nil {
+		return *m.Offset
+	}
+	return 0
+}
+
+func (m *LinuxHostAdminRPCRequest) GetFollow() bool {
+	if m != nil && m.Follow != nil {
+		return *m.Follow
+	}
+	return false
+}
+
+func (m *LinuxHostAdminRPCRequest) GetMeasureArgs() bool {
+	if m != nil && m.MeasureArgs != nil {
+		return *m.MeasureArgs
+	}
+	return false
+}
+
+func (m *LinuxHostAdminRPCRequest) GetMeasureEnv() []string {
+	if m != nil {
+		return m.MeasureEnv
+	}
+	return nil
+}
+
+func (m *LinuxHostAdminRPCRequest) GetMeasureFiles() []string {
+	if m != nil {
+		return m.MeasureFiles
+	}
+	return nil
+}
+
+func (m *LinuxHostAdminRPCRequest) GetScript() bool {
+	if m != nil && m.Script != nil {
+		return *m.Script
+	}
+	return false
+}
+
+func (m *LinuxHostAdminRPCRequest) GetInterpreter() string {
+	if m != nil && m.Interpreter != nil {
+		return *m.Interpreter
+	}
+	return ""
+}
+
+func (m *LinuxHostAdminRPCRequest) GetInterpreterArgs() []string {
+	if m != nil {
+		return m.InterpreterArgs
+	}
+	return nil
+}
+
+func (m *LinuxHostAdminRPCRequest) GetScriptDeps() []string {
+	if m != nil {
+		return m.ScriptDeps
+	}
+	return nil
+}
+
 type LinuxHostAdminRPCHostedProgram struct {
 	Subprin          []byte `protobuf:"bytes,1,req,name=subprin" json:"subprin,omitempty"`
 	Pid              *int32 `protobuf:"varint,2,req,name=pid" json:"pid,omitempty"`
@@ -120,10 +248,18 @@ func (m *LinuxHostAdminRPCHostedProgram) GetPid() int32 {
 }
 
 type LinuxHostAdminRPCResponse struct {
-	Child            []*LinuxHostAdminRPCHostedProgram `protobuf:"bytes,1,rep,name=child" json:"child,omitempty"`
-	Prin             []byte                            `protobuf:"bytes,2,opt,name=prin" json:"prin,omitempty"`
-	Status           *int32                            `protobuf:"varint,3,opt,name=status" json:"status,omitempty"`
-	XXX_unrecognized []byte                            `json:"-"`
+	Child  []*LinuxHostAdminRPCHostedProgram `protobuf:"bytes,1,rep,name=child" json:"child,omitempty"`
+	Prin   []byte                            `protobuf:"bytes,2,opt,name=prin" json:"prin,omitempty"`
+	Status *int32                            `protobuf:"varint,3,opt,name=status" json:"status,omitempty"`
+	Event  []*LinuxHostAdminRPCEvent         `protobuf:"bytes,4,rep,name=event" json:"event,omitempty"`
+	Seq    *uint64                           `protobuf:"varint,5,opt,name=seq" json:"seq,omitempty"`
+	Data   []byte                            `protobuf:"bytes,6,opt,name=data" json:"data,omitempty"`
+	Offset *int64                            `protobuf:"varint,7,opt,name=offset" json:"offset,omitempty"`
+	Done   *bool                             `protobuf:"varint,8,opt,name=done" json:"done,omitempty"`
+	// Status of a hosted VM, see VMStatus.
+	VmState          *string `protobuf:"bytes,9,opt,name=vm_state" json:"vm_state,omitempty"`
+	ShutdownReason   *string `protobuf:"bytes,10,opt,name=shutdown_reason" json:"shutdown_reason,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
 }
 
 func (m *LinuxHostAdminRPCResponse) Reset()                    { *m = LinuxHostAdminRPCResponse{} }
@@ -152,29 +288,155 @@ func (m *LinuxHostAdminRPCResponse) GetStatus() int32 {
 	return 0
 }
 
+func (m *LinuxHostAdminRPCResponse) GetEvent() []*LinuxHostAdminRPCEvent {
+	if m != nil {
+		return m.Event
+	}
+	return nil
+}
+
+func (m *LinuxHostAdminRPCResponse) GetSeq() uint64 {
+	if m != nil && m.Seq != nil {
+		return *m.Seq
+	}
+	return 0
+}
+
+func (m *LinuxHostAdminRPCResponse) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+func (m *LinuxHostAdminRPCResponse) GetOffset() int64 {
+	if m != nil && m.Offset != nil {
+		return *m.Offset
+	}
+	return 0
+}
+
+func (m *LinuxHostAdminRPCResponse) GetDone() bool {
+	if m != nil && m.Done != nil {
+		return *m.Done
+	}
+	return false
+}
+
+func (m *LinuxHostAdminRPCResponse) GetVmState() string {
+	if m != nil && m.VmState != nil {
+		return *m.VmState
+	}
+	return ""
+}
+
+func (m *LinuxHostAdminRPCResponse) GetShutdownReason() string {
+	if m != nil && m.ShutdownReason != nil {
+		return *m.ShutdownReason
+	}
+	return ""
+}
+
+type LinuxHostAdminRPCEvent struct {
+	Seq              *uint64                 `protobuf:"varint,1,req,name=seq" json:"seq,omitempty"`
+	Type             *HostedProgramEventType `protobuf:"varint,2,req,name=type,enum=tao.HostedProgramEventType" json:"type,omitempty"`
+	Subprin          []byte                  `protobuf:"bytes,3,opt,name=subprin" json:"subprin,omitempty"`
+	Pid              *int32                  `protobuf:"varint,4,opt,name=pid" json:"pid,omitempty"`
+	Status           *int32                  `protobuf:"varint,5,opt,name=status" json:"status,omitempty"`
+	Time             *int64                  `protobuf:"varint,6,opt,name=time" json:"time,omitempty"`
+	XXX_unrecognized []byte                  `json:"-"`
+}
+
+func (m *LinuxHostAdminRPCEvent) Reset()                    { *m = LinuxHostAdminRPCEvent{} }
+func (m *LinuxHostAdminRPCEvent) String() string            { return proto.CompactTextString(m) }
+func (*LinuxHostAdminRPCEvent) ProtoMessage()               {}
+func (*LinuxHostAdminRPCEvent) Descriptor() ([]byte, []int) { return fileDescriptor6, []int{3} }
+
+func (m *LinuxHostAdminRPCEvent) GetSeq() uint64 {
+	if m != nil && m.Seq != nil {
+		return *m.Seq
+	}
+	return 0
+}
+
+func (m *LinuxHostAdminRPCEvent) GetType() HostedProgramEventType {
+	if m != nil && m.Type != nil {
+		return *m.Type
+	}
+	return HostedProgramEventType_STARTED
+}
+
+func (m *LinuxHostAdminRPCEvent) GetSubprin() []byte {
+	if m != nil {
+		return m.Subprin
+	}
+	return nil
+}
+
+func (m *LinuxHostAdminRPCEvent) GetPid() int32 {
+	if m != nil && m.Pid != nil {
+		return *m.Pid
+	}
+	return 0
+}
+
+func (m *LinuxHostAdminRPCEvent) GetStatus() int32 {
+	if m != nil && m.Status != nil {
+		return *m.Status
+	}
+	return 0
+}
+
+func (m *LinuxHostAdminRPCEvent) GetTime() int64 {
+	if m != nil && m.Time != nil {
+		return *m.Time
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterType((*LinuxHostAdminRPCRequest)(nil), "tao.LinuxHostAdminRPCRequest")
 	proto.RegisterType((*LinuxHostAdminRPCHostedProgram)(nil), "tao.LinuxHostAdminRPCHostedProgram")
 	proto.RegisterType((*LinuxHostAdminRPCResponse)(nil), "tao.LinuxHostAdminRPCResponse")
+	proto.RegisterType((*LinuxHostAdminRPCEvent)(nil), "tao.LinuxHostAdminRPCEvent")
+	proto.RegisterEnum("tao.HostedProgramEventType", HostedProgramEventType_name, HostedProgramEventType_value)
 }
 
 var fileDescriptor6 = []byte{
-	// 259 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x84, 0x90, 0xb1, 0x4e, 0xc3, 0x30,
-	0x14, 0x45, 0x95, 0xb8, 0x6e, 0xe9, 0x6b, 0x29, 0x52, 0x06, 0x64, 0x18, 0x50, 0x15, 0x96, 0x4e,
-	0x19, 0xfa, 0x01, 0x48, 0x88, 0x85, 0x81, 0xa1, 0xea, 0x0f, 0x44, 0x26, 0xb6, 0x1a, 0x4b, 0x8d,
-	0x6d, 0x9e, 0x6d, 0x89, 0x4f, 0xe2, 0x33, 0x79, 0xb6, 0x18, 0x40, 0x20, 0xb1, 0xe5, 0x28, 0xf7,
-	0xe6, 0x9d, 0x5c, 0xb8, 0x3d, 0x1b, 0x9b, 0xde, 0xfb, 0xd1, 0x85, 0xd8, 0x4b, 0x35, 0x19, 0xdb,
-	0xa3, 0x1f, 0x3a, 0x8f, 0x2e, 0xba, 0x86, 0x45, 0xe9, 0xda, 0x8f, 0x0a, 0xc4, 0x4b, 0xce, 0x3c,
-	0x53, 0xe4, 0x31, 0x27, 0x8e, 0x87, 0xa7, 0xa3, 0x7e, 0x4b, 0x3a, 0xc4, 0xe6, 0x0a, 0x16, 0x21,
-	0xbd, 0x7a, 0x34, 0x56, 0x54, 0xdb, 0x6a, 0xb7, 0x6e, 0xd6, 0x30, 0xf3, 0x32, 0x8e, 0xa2, 0x26,
-	0x5a, 0x66, 0x92, 0x78, 0x0a, 0x82, 0x6d, 0x19, 0xd1, 0x0a, 0x98, 0x37, 0x4a, 0xcc, 0xe8, 0x15,
-	0xcf, 0xa0, 0x0c, 0x0a, 0x5e, 0x72, 0xd7, 0xb0, 0x19, 0x9c, 0x8d, 0xd2, 0x58, 0x8d, 0x7d, 0x69,
-	0xcc, 0x4b, 0xe3, 0x12, 0x78, 0x88, 0x8a, 0x3e, 0xbe, 0x28, 0x9d, 0x0d, 0xcc, 0x09, 0x5d, 0x8a,
-	0xe2, 0xe2, 0x1b, 0x6b, 0x44, 0xb1, 0xcc, 0xdc, 0x3e, 0xc0, 0xdd, 0x2f, 0xd3, 0xfc, 0xac, 0xd5,
-	0x01, 0xdd, 0x09, 0xe5, 0xf4, 0xd3, 0xb7, 0x26, 0xdf, 0x2f, 0xa7, 0x9a, 0x80, 0xb7, 0x13, 0xdc,
-	0xfc, 0xf1, 0xa7, 0xc1, 0x3b, 0x1b, 0x74, 0xb3, 0x07, 0x3e, 0x8c, 0xe6, 0xac, 0xa8, 0xc8, 0x76,
-	0xab, 0xfd, 0x7d, 0x47, 0xe3, 0x74, 0xff, 0x9c, 0xcb, 0x6b, 0xe4, 0x5b, 0x75, 0xd9, 0xa6, 0xe8,
-	0xca, 0x98, 0xf2, 0x1e, 0xa4, 0xfb, 0x19, 0x00, 0x00, 0xff, 0xff, 0x5b, 0xb0, 0xde, 0xf2, 0x7b,
-	0x01, 0x00, 0x00,
+	// 557 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x84, 0x52, 0xdd, 0x4e, 0x1b, 0x3d,
+	0x10, 0x95, 0xf7, 0x27, 0x3f, 0x93, 0x4d, 0x58, 0xcc, 0xf7, 0x51, 0xb7, 0x95, 0xaa, 0x55, 0x7a,
+	0xb3, 0xe5, 0x82, 0x0b, 0x1e, 0xa0, 0x12, 0xea, 0xae, 0x04, 0x2a, 0x02, 0x04, 0xa9, 0xda, 0xbb,
+	0x95, 0x9b, 0x9d, 0x10, 0x4b, 0x89, 0xbd, 0xd8, 0x5e, 0x28, 0xef, 0xd0, 0x37, 0xed, 0x33, 0x54,
+	0xaa, 0x6c, 0x58, 0x11, 0x54, 0xda, 0xde, 0xcd, 0x1c, 0xcf, 0x99, 0x63, 0x9f, 0x63, 0x78, 0xb5,
+	0x12, 0xb2, 0xfd, 0x56, 0x2d, 0x95, 0xb1, 0x15, 0xaf, 0xd7, 0x42, 0x56, 0xba, 0x99, 0xef, 0x37,
+	0x5a, 0x59, 0x45, 0x43, 0xcb, 0xd5, 0xf4, 0x47, 0x00, 0xec, 0xc4, 0xcd, 0x1c, 0x29, 0x63, 0x0f,
+	0xdd, 0xc4, 0xc5, 0xf9, 0x87, 0x0b, 0xbc, 0x6e, 0xd1, 0x58, 0xba, 0x05, 0x7d, 0xd3, 0x7e, 0x6d,
+	0xb4, 0x90, 0x8c, 0x64, 0x24, 0x4f, 0x68, 0x02, 0x51, 0xc3, 0xed, 0x92, 0x05, 0x19, 0xc9, 0x87,
+	0xae, 0xe3, 0xfa, 0xca, 0xb0, 0x30, 0x0b, 0xf3, 0x21, 0x1d, 0x41, 0xd8, 0x88, 0x9a, 0x45, 0x19,
+	0xc9, 0x63, 0xd7, 0xd4, 0x42, 0xb3, 0xd8, 0xcf, 0xed, 0xc2, 0x64, 0xae, 0xa4, 0xe5, 0x42, 0xa2,
+	0xae, 0x3c, 0xa3, 0xe7, 0x19, 0x63, 0x88, 0x8d, 0xad, 0x85, 0x64, 0x7d, 0xcf, 0x99, 0x40, 0xcf,
+	0xd8, 0x5a, 0xb5, 0x96, 0x0d, 0x36, 0x7a, 0xd4, 0x9a, 0x0d, 0xbb, 0x9d, 0x06, 0xaf, 0x19, 0x64,
+	0x24, 0x8f, 0xdc, 0xa1, 0x5a, 0x2c, 0x0c, 0x5a, 0x36, 0xca, 0x48, 0x1e, 0xba, 0x7e, 0xa1, 0x56,
+	0x2b, 0x75, 0xcb, 0x92, 0x8c, 0xe4, 0x03, 0xfa, 0x1f, 0x24, 0x6b, 0xe4, 0xa6, 0xd5, 0x78, 0xaf,
+	0x38, 0xf6, 0xe8, 0x0e, 0x8c, 0x3a, 0x14, 0xe5, 0x0d, 0x9b, 0xf8, 0x6b, 0xfc, 0x0f, 0xe3, 0x0e,
+	0x5c, 0x88, 0x15, 0x1a, 0xb6, 0xe5, 0x61, 0x27, 0x3f, 0xd7, 0xa2, 0xb1, 0x2c, 0xed, 0xb8, 0x42,
+	0x5a, 0xd4, 0x8d, 0x46, 0x8b, 0x9a, 0x6d, 0xfb, 0xa7, 0x31, 0x48, 0x37, 0xc0, 0x7b, 0x29, 0xea,
+	0xe9, 0x3b, 0x30, 0xba, 0xa7, 0x57, 0x35, 0x36, 0x86, 0xed, 0x38, 0x70, 0xfa, 0x1e, 0xde, 0xfc,
+	0x66, 0xb6, 0xab, 0xb1, 0x3e, 0xd7, 0xea, 0x4a, 0xf3, 0xf5, 0x53, 0xcb, 0x83, 0x3c, 0xe9, 0x6c,
+	0x0d, 0xb2, 0x20, 0x8f, 0xa7, 0x3f, 0x09, 0xbc, 0x7c, 0x26, 0x2d, 0xd3, 0x28, 0x69, 0x90, 0x1e,
+	0x40, 0x3c, 0x5f, 0x8a, 0x55, 0xcd, 0x48, 0x16, 0xe6, 0xa3, 0x83, 0xb7, 0xfb, 0x96, 0xab, 0xfd,
+	0x7f, 0xe8, 0xb9, 0x44, 0x9d, 0x58, 0xe0, 0xf3, 0xf5, 0x96, 0x73, 0xdb, 0xba, 0x4c, 0x9d, 0xe5,
+	0x7b, 0x10, 0xe3, 0x0d, 0x4a, 0xcb, 0x22, 0xbf, 0xf1, 0xf5, 0xf3, 0x1b, 0x4b, 0x37, 0xd2, 0xc5,
+	0x13, 0xfb, 0x78, 0x12, 0x88, 0x6a, 0x6e, 0x39, 0xeb, 0x75, 0x6b, 0x1f, 0xc2, 0xea, 0xfb, 0xb0,
+	0xdc, 0xa9, 0x92, 0xe8, 0x73, 0x1e, 0xd0, 0x14, 0x06, 0x37, 0xeb, 0xca, 0xe9, 0xa2, 0x4f, 0x7a,
+	0x48, 0x5f, 0xc0, 0x96, 0x59, 0xb6, 0xb6, 0x56, 0xb7, 0xb2, 0xd2, 0xc8, 0x8d, 0x92, 0x3e, 0xf5,
+	0xe1, 0xf4, 0x3b, 0x81, 0xdd, 0xbf, 0xcb, 0x3b, 0xd3, 0x22, 0xfa, 0x0e, 0x22, 0x7b, 0xd7, 0xa0,
+	0x77, 0x6d, 0xf2, 0x70, 0xed, 0x27, 0xef, 0xf6, 0x9c, 0xd9, 0x5d, 0x83, 0x9b, 0x86, 0x87, 0x19,
+	0x79, 0x34, 0x3c, 0x7a, 0xfc, 0x83, 0xde, 0x90, 0xd8, 0xf7, 0x09, 0x44, 0x56, 0xac, 0xd1, 0xbf,
+	0x2b, 0xdc, 0x13, 0xb0, 0xfb, 0x87, 0xad, 0x23, 0xe8, 0x5f, 0xce, 0x0e, 0x2f, 0x66, 0x65, 0x91,
+	0x12, 0x0a, 0xd0, 0x2b, 0xbf, 0x1c, 0xbb, 0x3a, 0x70, 0xf5, 0xc7, 0xe3, 0x93, 0x93, 0xb2, 0x48,
+	0x43, 0x57, 0x17, 0xe5, 0xe9, 0x71, 0x59, 0xa4, 0x11, 0xdd, 0x86, 0xf1, 0xd1, 0xd9, 0xe5, 0xac,
+	0xba, 0x3c, 0xfa, 0x34, 0x2b, 0xce, 0x3e, 0x9f, 0xa6, 0xee, 0xbf, 0xf7, 0x0f, 0x8b, 0xb3, 0x73,
+	0xc7, 0xeb, 0xfd, 0x1a, 0x00, 0x3c, 0xc9, 0xdf, 0xb0, 0xc9, 0x03, 0x00, 0x00,
 }
@@ -26,3 +26,9 @@ func NewAuthenticatedFileSocket(sock *net.UnixListener) (error) {
         sockFile.Close()
 	return nil
 }
+
+// peerPid returns the pid of the process at the other end of a unix socket
+// connection. It isn't supported on this platform.
+func peerPid(c net.Conn) (int, error) {
+	return 0, newError("peer pids are not supported on this platform")
+}
@@ -28,3 +28,22 @@ func NewAuthenticatedFileSocket(sock *net.UnixListener) (error) {
         sockFile.Close()
 	return err
 }
+
+// peerPid returns the pid of the process at the other end of a unix socket
+// connection, as the kernel recorded it when the connection was made.
+func peerPid(c net.Conn) (int, error) {
+	uc, ok := c.(*net.UnixConn)
+	if !ok {
+		return 0, newError("not a unix socket connection")
+	}
+	f, err := uc.File()
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	ucred, err := syscall.GetsockoptUcred(int(f.Fd()), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	if err != nil {
+		return 0, err
+	}
+	return int(ucred.Pid), nil
+}
@@ -0,0 +1,310 @@
+// Copyright (c) 2014, Google Inc.  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tao
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
+	"github.com/jlmucb/cloudproxy/go/tao/auth"
+	"github.com/jlmucb/cloudproxy/go/util"
+)
+
+// adoptedPollInterval is how often a LinuxHost checks whether an adopted hosted
+// process, which is no longer its child and so can't be waited for, has exited.
+const adoptedPollInterval = time.Second
+
+// childRecordsFile is the file, relative to the host directory, in which a
+// LinuxHost keeps a sealed record of its running hosted processes.
+const childRecordsFile = "hosted_programs"
+
+// processStartTime returns the start time of a process, in clock ticks since
+// boot. Together with the pid, this identifies a process even if pids are
+// reused.
+func processStartTime(pid int) (uint64, error) {
+	stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+	// The command name, in parentheses, may contain spaces, so skip past it.
+	// The start time is the 22nd field overall.
+	i := bytes.LastIndexByte(stat, ')')
+	if i < 0 {
+		return 0, newError("malformed stat for process %d", pid)
+	}
+	fields := strings.Fields(string(stat[i+1:]))
+	if len(fields) < 20 {
+		return 0, newError("malformed stat for process %d", pid)
+	}
+	return strconv.ParseUint(fields[19], 10, 64)
+}
+
+// processHash returns the hash of the binary a process is running.
+func processHash(pid int) ([]byte, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/exe", pid))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// childRecord returns a record of a running hosted process, or nil if the
+// child is not a hosted process or has exited.
+func childRecord(child *LinuxHostChild) *LinuxHostChildRecord {
+	p, ok := child.Cmd.(*HostedProcess)
+	if !ok || p.Cmd.Process == nil {
+		return nil
+	}
+	pid := p.Cmd.Process.Pid
+	startTime, err := processStartTime(pid)
+	if err != nil {
+		return nil
+	}
+	r := &LinuxHostChildRecord{
+		Subprin:     auth.Marshal(child.ChildSubprin),
+		Pid:         proto.Int32(int32(pid)),
+		StartTime:   proto.Uint64(startTime),
+		Hash:        p.Hash,
+		ConfigHash:  p.ConfigHash,
+		ChannelType: proto.String(p.Factory.channelType),
+		Id:          proto.Uint32(uint32(p.spec.Id)),
+		Path:        proto.String(p.spec.Path),
+		Args:        p.spec.Args,
+		Dir:         proto.String(p.spec.Dir),
+		Uid:         proto.Int32(int32(p.spec.Uid)),
+		Gid:         proto.Int32(int32(p.spec.Gid)),
+		Argv0:       proto.String(p.Argv0),
+		Tempdir:     proto.String(p.Tempdir),
+	}
+	if p.SocketPath != "" {
+		r.ChannelSpec = proto.String(p.SocketPath)
+	}
+	if child.owner.Type != "" {
+		r.Owner = auth.Marshal(child.owner)
+	}
+	for _, in := range p.Interpreters {
+		r.Interpreter = append(r.Interpreter, &LinuxHostChildInterpreter{
+			Path: proto.String(in.Path),
+			Args: in.Args,
+			Hash: in.Hash,
+		})
+	}
+	r.DepsHash = p.DepsHash
+	return r
+}
+
+// saveHostedPrograms writes a sealed record of the running hosted processes, so
+// that they can be re-adopted if this host restarts.
+func (lh *LinuxHost) saveHostedPrograms() {
+	if lh.path == "" {
+		return
+	}
+	records := new(LinuxHostChildRecords)
+	lh.hpm.RLock()
+	for _, child := range lh.hostedPrograms {
+		if r := childRecord(child); r != nil {
+			records.Child = append(records.Child, r)
+		}
+	}
+	lh.hpm.RUnlock()
+	file := path.Join(lh.path, childRecordsFile)
+	if len(records.Child) == 0 {
+		os.Remove(file)
+		return
+	}
+	m, err := proto.Marshal(records)
+	if err != nil {
+		glog.Errorf("Couldn't marshal hosted program records: %s", err)
+		return
+	}
+	sealed, err := lh.Host.Encrypt(m)
+	if err != nil {
+		glog.Errorf("Couldn't seal hosted program records: %s", err)
+		return
+	}
+	if err := util.WritePath(file, sealed, 0700, 0600); err != nil {
+		glog.Errorf("Couldn't save hosted program records: %s", err)
+	}
+}
+
+// AdoptHostedPrograms re-adopts the hosted processes that were started by an
+// earlier instance of this host and are still running. A process is adopted
+// only if it still runs the measured binary and its Tao channel can be
+// re-established, i.e. it uses the "unix" channel type, in which case the
+// hosted program must reconnect to the same socket. Other recorded processes
+// that are still running are killed. Output of adopted processes is no longer
+// captured. This should be called before any new hosted programs are started.
+func (lh *LinuxHost) AdoptHostedPrograms() error {
+	lpf, ok := lh.childFactory.(*LinuxProcessFactory)
+	if !ok || lh.path == "" {
+		return nil
+	}
+	sealed, err := ioutil.ReadFile(path.Join(lh.path, childRecordsFile))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	m, err := lh.Host.Decrypt(sealed)
+	if err != nil {
+		return err
+	}
+	var records LinuxHostChildRecords
+	if err := proto.Unmarshal(m, &records); err != nil {
+		return err
+	}
+	for _, r := range records.Child {
+		pid := int(r.GetPid())
+		startTime, err := processStartTime(pid)
+		if err != nil || startTime != r.GetStartTime() {
+			// The process exited while we were gone.
+			os.RemoveAll(r.GetTempdir())
+			continue
+		}
+		child, err := lh.adoptHostedProcess(lpf, r)
+		if err != nil {
+			glog.Errorf("Killing hosted program %d, which can't be re-adopted: %s", pid, err)
+			syscall.Kill(pid, syscall.SIGKILL)
+			os.RemoveAll(r.GetTempdir())
+			continue
+		}
+		glog.Infof("Re-adopted hosted program with pid %d ...\n  subprincipal: %s\n", pid, child.ChildSubprin)
+		go NewLinuxHostTaoServer(lh, child).Serve(child.channel)
+		lh.addHostedProgram(child, HostedProgramEventType_ADOPTED)
+	}
+	lh.saveHostedPrograms()
+	return nil
+}
+
+// adoptHostedProcess verifies a recorded hosted process and re-establishes its
+// Tao channel.
+func (lh *LinuxHost) adoptHostedProcess(lpf *LinuxProcessFactory, r *LinuxHostChildRecord) (*LinuxHostChild, error) {
+	pid := int(r.GetPid())
+	subprin, err := auth.UnmarshalSubPrin(r.Subprin)
+	if err != nil {
+		return nil, err
+	}
+	spec := HostedProgramSpec{
+		Id:   uint(r.GetId()),
+		Path: r.GetPath(),
+		Args: r.Args,
+		Dir:  r.GetDir(),
+		Uid:  int(r.GetUid()),
+		Gid:  int(r.GetGid()),
+	}
+	spec.Superuser = spec.Uid == 0 || spec.Gid == 0
+	p := &HostedProcess{
+		spec:       spec,
+		Argv0:      r.GetArgv0(),
+		Tempdir:    r.GetTempdir(),
+		Hash:       r.Hash,
+		ConfigHash: r.ConfigHash,
+		SocketPath: r.GetChannelSpec(),
+		Factory:    lpf,
+		Done:       make(chan bool, 1),
+	}
+	for _, in := range r.Interpreter {
+		p.Interpreters = append(p.Interpreters, ProcessInterpreter{
+			Path: in.GetPath(),
+			Args: in.Args,
+			Hash: in.Hash,
+		})
+	}
+	p.DepsHash = r.DepsHash
+
+	// The recorded subprincipal may have been extended, but it must start with
+	// the one for the measured binary and configuration.
+	base := p.Subprin()
+	if len(subprin) < len(base) || !auth.SubPrin(subprin[:len(base)]).Identical(base) {
+		return nil, newError("recorded subprincipal %s doesn't match binary", subprin)
+	}
+
+	// For interpreted programs, the process runs the outermost interpreter.
+	hash, err := processHash(pid)
+	if err != nil {
+		return nil, err
+	}
+	want := r.Hash
+	if len(p.Interpreters) > 0 {
+		want = p.Interpreters[0].Hash
+	}
+	if !bytes.Equal(hash, want) {
+		return nil, newError("process no longer runs the measured binary")
+	}
+	if r.GetChannelType() != "unix" || p.SocketPath == "" {
+		return nil, newError("can't re-establish channel of type %s", r.GetChannelType())
+	}
+
+	// The old socket is left behind by our previous instance. Only the adopted
+	// process itself may connect to the new one.
+	os.Remove(p.SocketPath)
+	channel := util.NewCheckedUnixSingleReadWriteCloser(p.SocketPath, func(c net.Conn) error {
+		peer, err := peerPid(c)
+		if err != nil {
+			return err
+		}
+		if peer != pid {
+			return newError("connection from pid %d, not adopted hosted program %d", peer, pid)
+		}
+		return nil
+	})
+	if channel == nil {
+		return nil, newError("couldn't re-create unix channel %s", p.SocketPath)
+	}
+	if p.Cmd.Process, err = os.FindProcess(pid); err != nil {
+		channel.Close()
+		return nil, err
+	}
+
+	// We aren't the parent of the process any more, so we can't wait for it.
+	// Instead, poll until it is gone.
+	startTime := r.GetStartTime()
+	go func() {
+		for {
+			time.Sleep(adoptedPollInterval)
+			if t, err := processStartTime(pid); err != nil || t != startTime {
+				break
+			}
+		}
+		os.RemoveAll(p.Tempdir)
+		p.Done <- true
+		close(p.Done)
+	}()
+
+	var owner auth.Prin
+	if r.Owner != nil {
+		if owner, err = auth.UnmarshalPrin(r.Owner); err != nil {
+			owner = auth.Prin{}
+		}
+	}
+	return &LinuxHostChild{channel, subprin, p, owner}, nil
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2014, Google Inc.  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tao
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jlmucb/cloudproxy/go/tao/auth"
+)
+
+// maxHostedProgramEvents is the number of recent events a LinuxHost keeps for
+// watchers. Watchers that fall further behind than this will miss events, which
+// they can detect by a gap in the sequence numbers.
+const maxHostedProgramEvents = 1024
+
+// A HostedProgramEvent records a change in the lifecycle of a hosted program,
+// or of the LinuxHost itself.
+type HostedProgramEvent struct {
+	// Seq is a sequence number, starting at 1 and increasing by one with each
+	// event.
+	Seq uint64
+
+	// Type is the kind of event.
+	Type HostedProgramEventType
+
+	// Subprin is the subprincipal of the hosted program. It is empty for
+	// HOST_SHUTDOWN events.
+	Subprin auth.SubPrin
+
+	// Pid is the pid of the hosted program, or of the host for HOST_SHUTDOWN
+	// events. It is zero for DENIED events, since no process was started.
+	Pid int
+
+	// Status is the exit status of the hosted program, for EXITED events.
+	Status int
+
+	// Owner is the principal that started, or tried to start, the hosted
+	// program. It is empty for HOST_SHUTDOWN events and for adopted programs
+	// whose owner wasn't recorded.
+	Owner auth.Prin
+
+	// Time is when the event happened.
+	Time time.Time
+}
+
+// hostedProgramEventLog holds recent hosted program events and lets callers
+// wait for new ones. The zero value is ready to use.
+type hostedProgramEventLog struct {
+	m       sync.Mutex
+	events  []HostedProgramEvent
+	lastSeq uint64
+	// notify is closed, and replaced, whenever an event is added.
+	notify chan bool
+}
+
+// add records a new event and wakes up any waiting watchers.
+func (l *hostedProgramEventLog) add(t HostedProgramEventType, subprin auth.SubPrin, owner auth.Prin, pid, status int) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	l.lastSeq++
+	e := HostedProgramEvent{
+		Seq:     l.lastSeq,
+		Type:    t,
+		Subprin: subprin,
+		Pid:     pid,
+		Status:  status,
+		Owner:   owner,
+		Time:    time.Now(),
+	}
+	l.events = append(l.events, e)
+	if len(l.events) > maxHostedProgramEvents {
+		l.events = l.events[len(l.events)-maxHostedProgramEvents:]
+	}
+	if l.notify != nil {
+		close(l.notify)
+		l.notify = nil
+	}
+}
+
+// since returns the events with sequence numbers after seq, waiting up to
+// timeout for one to happen if there are none yet. If seq is zero, only events
+// that happen after the call are returned. It also returns the sequence number
+// that should be passed to the next call.
+func (l *hostedProgramEventLog) since(seq uint64, timeout time.Duration) ([]HostedProgramEvent, uint64) {
+	deadline := time.After(timeout)
+	l.m.Lock()
+	if seq == 0 || seq > l.lastSeq {
+		seq = l.lastSeq
+	}
+	for seq == l.lastSeq {
+		if l.notify == nil {
+			l.notify = make(chan bool)
+		}
+		notify := l.notify
+		l.m.Unlock()
+		select {
+		case <-notify:
+		case <-deadline:
+			return nil, seq
+		}
+		l.m.Lock()
+	}
+	defer l.m.Unlock()
+	var events []HostedProgramEvent
+	for _, e := range l.events {
+		if e.Seq > seq {
+			events = append(events, e)
+		}
+	}
+	return events, l.lastSeq
+}
@@ -0,0 +1,280 @@
+// Copyright (c) 2014, Google Inc.  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tao
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/jlmucb/cloudproxy/go/tao/auth"
+)
+
+// Defaults for capturing hosted program output.
+const (
+	defaultLogBufferSize = 64 * 1024
+	defaultLogFileSize   = 1024 * 1024
+	defaultLogFiles      = 4
+
+	// maxExitedLogs is the number of exited hosted programs whose output a
+	// LinuxHost retains.
+	maxExitedLogs = 16
+)
+
+// HostedProgramLogConfig controls how a LinuxHost captures the stdout and
+// stderr of hosted programs that are started without their own stdout or
+// stderr.
+type HostedProgramLogConfig struct {
+	// Disable turns off capturing. Output goes wherever the factory sends it by
+	// default, e.g. /dev/null.
+	Disable bool
+
+	// BufferSize is the number of recent bytes of output kept in memory for
+	// each hosted program. If zero, a default is used.
+	BufferSize int
+
+	// Dir, if not empty, is a directory where output is also written, to
+	// <pid>-<start time>.log for each hosted program. The start time keeps a
+	// program from overwriting the log of an earlier one with the same pid.
+	Dir string
+
+	// MaxFileSize is the size at which a log file in Dir is rotated, i.e.
+	// renamed to <pid>-<start time>.log.1 and so on. If zero, a default is used.
+	MaxFileSize int64
+
+	// MaxFiles is the number of rotated log files kept for each hosted
+	// program. If zero, a default is used.
+	MaxFiles int
+}
+
+// hostedProgramLog holds the captured output of a single hosted program in a
+// bounded ring buffer, optionally copying it to rotated files on disk.
+type hostedProgramLog struct {
+	subprin auth.SubPrin
+	owner   auth.Prin
+	pid     int
+
+	m      sync.Mutex
+	buf    []byte
+	size   int
+	total  int64 // bytes ever written
+	done   bool  // no more output will be written
+	notify chan bool
+
+	file     *os.File
+	fileName string
+	fileSize int64
+	maxSize  int64
+	maxFiles int
+}
+
+func newHostedProgramLog(config HostedProgramLogConfig, subprin auth.SubPrin, owner auth.Prin, pid int) *hostedProgramLog {
+	l := &hostedProgramLog{
+		subprin:  subprin,
+		owner:    owner,
+		pid:      pid,
+		size:     config.BufferSize,
+		maxSize:  config.MaxFileSize,
+		maxFiles: config.MaxFiles,
+	}
+	if l.size <= 0 {
+		l.size = defaultLogBufferSize
+	}
+	if l.maxSize <= 0 {
+		l.maxSize = defaultLogFileSize
+	}
+	if l.maxFiles <= 0 {
+		l.maxFiles = defaultLogFiles
+	}
+	if config.Dir != "" {
+		start := time.Now().UTC().Format("20060102T150405.000000000")
+		l.fileName = path.Join(config.Dir, fmt.Sprintf("%d-%s.log", pid, start))
+		f, err := os.OpenFile(l.fileName, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600)
+		if err != nil {
+			glog.Errorf("Couldn't open log file for hosted program %d: %s", pid, err)
+		} else {
+			l.file = f
+		}
+	}
+	return l
+}
+
+// Write appends output to the buffer, discarding the oldest output if the
+// buffer is full, and to the log file, if any.
+func (l *hostedProgramLog) Write(p []byte) (int, error) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	l.buf = append(l.buf, p...)
+	if len(l.buf) > l.size {
+		l.buf = append([]byte(nil), l.buf[len(l.buf)-l.size:]...)
+	}
+	l.total += int64(len(p))
+	l.writeFile(p)
+	l.wake()
+	return len(p), nil
+}
+
+// writeFile writes p to the log file, rotating it first if needed. Errors are
+// logged but otherwise ignored, since the in-memory copy is still available.
+func (l *hostedProgramLog) writeFile(p []byte) {
+	if l.file == nil {
+		return
+	}
+	if l.fileSize > 0 && l.fileSize+int64(len(p)) > l.maxSize {
+		l.file.Close()
+		l.file = nil
+		for i := l.maxFiles - 1; i > 0; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", l.fileName, i), fmt.Sprintf("%s.%d", l.fileName, i+1))
+		}
+		os.Rename(l.fileName, l.fileName+".1")
+		f, err := os.OpenFile(l.fileName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			glog.Errorf("Couldn't rotate log file for hosted program %d: %s", l.pid, err)
+			return
+		}
+		l.file = f
+		l.fileSize = 0
+	}
+	n, err := l.file.Write(p)
+	l.fileSize += int64(n)
+	if err != nil {
+		glog.Errorf("Couldn't write log file for hosted program %d: %s", l.pid, err)
+	}
+}
+
+// wake notifies any callers of read that are waiting for output.
+func (l *hostedProgramLog) wake() {
+	if l.notify != nil {
+		close(l.notify)
+		l.notify = nil
+	}
+}
+
+// capture copies r into the log until r returns an error or EOF, then closes
+// r and marks the log as done.
+func (l *hostedProgramLog) capture(r io.ReadCloser) {
+	io.Copy(l, r)
+	r.Close()
+	l.m.Lock()
+	defer l.m.Unlock()
+	l.done = true
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+	l.wake()
+}
+
+// read returns the output starting at offset, where offset counts bytes since
+// the hosted program started. If offset refers to output that is no longer in
+// the buffer, the oldest output still held is returned instead. If there is
+// no output at offset yet, read waits up to timeout for some. It returns the
+// offset to pass to the next call and whether the output is complete.
+func (l *hostedProgramLog) read(offset int64, timeout time.Duration) ([]byte, int64, bool) {
+	deadline := time.After(timeout)
+	l.m.Lock()
+	if offset > l.total {
+		offset = l.total
+	}
+	for offset == l.total && !l.done && timeout > 0 {
+		if l.notify == nil {
+			l.notify = make(chan bool)
+		}
+		notify := l.notify
+		l.m.Unlock()
+		select {
+		case <-notify:
+		case <-deadline:
+			timeout = 0
+		}
+		l.m.Lock()
+	}
+	defer l.m.Unlock()
+	start := l.total - int64(len(l.buf))
+	if offset < start {
+		offset = start
+	}
+	data := append([]byte(nil), l.buf[offset-start:]...)
+	return data, l.total, l.done
+}
+
+// isDone reports whether all output has been captured.
+func (l *hostedProgramLog) isDone() bool {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return l.done
+}
+
+// captureOutput starts capturing the output of a newly started hosted program.
+func (lh *LinuxHost) captureOutput(r io.ReadCloser, subprin auth.SubPrin, owner auth.Prin, pid int) {
+	l := newHostedProgramLog(lh.LogConfig, subprin, owner, pid)
+	go l.capture(r)
+
+	lh.logm.Lock()
+	defer lh.logm.Unlock()
+	// Forget the oldest finished logs beyond the number we retain.
+	exited := 0
+	for i := len(lh.logs) - 1; i >= 0; i-- {
+		if lh.logs[i].isDone() {
+			exited++
+			if exited > maxExitedLogs {
+				lh.logs = append(lh.logs[:i], lh.logs[i+1:]...)
+			}
+		}
+	}
+	lh.logs = append(lh.logs, l)
+}
+
+// HostedProgramLogs returns captured output of a hosted program, starting at
+// offset bytes since the program started. The program is identified by pid, if
+// it is not zero, and by subprin, if it is not empty. If several programs
+// match, the most recently started one is used. If there is no output at
+// offset yet, HostedProgramLogs waits up to timeout for some. It returns the
+// offset to pass to the next call and whether the output is complete.
+func (lh *LinuxHost) HostedProgramLogs(pid int, subprin auth.SubPrin, offset int64, timeout time.Duration) ([]byte, int64, bool, error) {
+	l, err := lh.hostedProgramLog(pid, subprin)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	data, offset, done := l.read(offset, timeout)
+	return data, offset, done, nil
+}
+
+// hostedProgramLog returns the captured output of the most recently started
+// hosted program with the given pid, if it is not zero, and subprin, if it is
+// not empty.
+func (lh *LinuxHost) hostedProgramLog(pid int, subprin auth.SubPrin) (*hostedProgramLog, error) {
+	var l *hostedProgramLog
+	lh.logm.Lock()
+	for i := len(lh.logs) - 1; i >= 0; i-- {
+		if pid != 0 && lh.logs[i].pid != pid {
+			continue
+		}
+		if len(subprin) != 0 && !lh.logs[i].subprin.Identical(subprin) {
+			continue
+		}
+		l = lh.logs[i]
+		break
+	}
+	lh.logm.Unlock()
+	if l == nil {
+		return nil, newError("no output for such hosted program")
+	}
+	return l, nil
+}
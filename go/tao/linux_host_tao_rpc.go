@@ -23,6 +23,7 @@ import (
 	"errors"
 	"io"
 	"net/rpc"
+	"reflect"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/jlmucb/cloudproxy/go/tao/auth"
@@ -31,20 +32,23 @@ import (
 
 // LinuxHostTaoServer is a server stub for LinuxHost's Tao RPC interface.
 type LinuxHostTaoServer struct {
-	lh    *LinuxHost
-	child *LinuxHostChild
+	lh      *LinuxHost
+	child   *LinuxHostChild
+	limiter *taoRPCLimiter
 }
 
 type linuxHostTaoServerStub LinuxHostTaoServer
 
 // NewLinuxHostTaoServer returns a new server stub for LinuxHost's Tao RPC
-// interface.
+// interface, for one connection, which Serve must be called on. All the
+// connections of a child share its rate limits.
 func NewLinuxHostTaoServer(host *LinuxHost, child *LinuxHostChild) LinuxHostTaoServer {
-	return LinuxHostTaoServer{host, child}
+	return LinuxHostTaoServer{host, child, host.rpcLimiter(child)}
 }
 
 // Serve listens on sock for new connections and services them.
 func (server LinuxHostTaoServer) Serve(conn io.ReadWriteCloser) error {
+	defer server.lh.releaseRPCLimiter(server.limiter)
 	s := rpc.NewServer()
 	err := s.RegisterName("Tao", linuxHostTaoServerStub(server))
 	if err != nil {
@@ -54,14 +58,52 @@ func (server LinuxHostTaoServer) Serve(conn io.ReadWriteCloser) error {
 	return nil
 }
 
+// check checks whether the child may make a call, see LinuxHost.checkTaoRPC.
+func (server linuxHostTaoServerStub) check(method string, r *RPCRequest) error {
+	return server.lh.checkTaoRPC(server.child, server.limiter, method, r)
+}
+
+// linuxHostTaoMethods lists the Tao RPC methods served by LinuxHostTaoServer.
+var linuxHostTaoMethods = func() []string {
+	var methods []string
+	t := reflect.TypeOf(linuxHostTaoServerStub{})
+	for i := 0; i < t.NumMethod(); i++ {
+		methods = append(methods, t.Method(i).Name)
+	}
+	return methods
+}()
+
+// GetCapabilities is the server stub for Tao.GetCapabilities.
+func (server linuxHostTaoServerStub) GetCapabilities(r *RPCRequest, s *RPCResponse) error {
+	if err := server.check("GetCapabilities", r); err != nil {
+		return err
+	}
+	caps := server.lh.GetCapabilities(server.child)
+	// Leave out the methods the child may not call.
+	for _, m := range linuxHostTaoMethods {
+		if server.lh.authorizeTaoMethod(server.child, m) == nil {
+			caps.Methods = append(caps.Methods, m)
+		}
+	}
+	var err error
+	s.Data, err = proto.Marshal(caps)
+	return err
+}
+
 // GetTaoName is the server stub for Tao.GetTaoName.
 func (server linuxHostTaoServerStub) GetTaoName(r *RPCRequest, s *RPCResponse) error {
+	if err := server.check("GetTaoName", r); err != nil {
+		return err
+	}
 	s.Data = auth.Marshal(server.lh.GetTaoName(server.child))
 	return nil
 }
 
 // ExtendTaoName is the server stub for Tao.ExtendTaoName.
 func (server linuxHostTaoServerStub) ExtendTaoName(r *RPCRequest, s *RPCResponse) error {
+	if err := server.check("ExtendTaoName", r); err != nil {
+		return err
+	}
 	ext, err := auth.UnmarshalSubPrin(r.Data)
 	if err != nil {
 		return err
@@ -71,6 +113,9 @@ func (server linuxHostTaoServerStub) ExtendTaoName(r *RPCRequest, s *RPCResponse
 
 // GetRandomBytes is the server stub for Tao.GetRandomBytes.
 func (server linuxHostTaoServerStub) GetRandomBytes(r *RPCRequest, s *RPCResponse) error {
+	if err := server.check("GetRandomBytes", r); err != nil {
+		return err
+	}
 	if r.Size == nil || *r.Size <= 0 {
 		return newError("invalid size")
 	}
@@ -81,6 +126,9 @@ func (server linuxHostTaoServerStub) GetRandomBytes(r *RPCRequest, s *RPCRespons
 
 // GetSharedSecret is the server stub for Tao.GetSharedSecret.
 func (server linuxHostTaoServerStub) GetSharedSecret(r *RPCRequest, s *RPCResponse) error {
+	if err := server.check("GetSharedSecret", r); err != nil {
+		return err
+	}
 	if r.Size == nil || *r.Size <= 0 {
 		return newError("invalid size")
 	}
@@ -94,6 +142,9 @@ func (server linuxHostTaoServerStub) GetSharedSecret(r *RPCRequest, s *RPCRespon
 
 // Seal is the server stub for Tao.Seal.
 func (server linuxHostTaoServerStub) Seal(r *RPCRequest, s *RPCResponse) error {
+	if err := server.check("Seal", r); err != nil {
+		return err
+	}
 	if r.Policy == nil {
 		return newError("missing policy")
 	}
@@ -104,6 +155,9 @@ func (server linuxHostTaoServerStub) Seal(r *RPCRequest, s *RPCResponse) error {
 
 // Unseal is the server stub for Tao.Unseal.
 func (server linuxHostTaoServerStub) Unseal(r *RPCRequest, s *RPCResponse) error {
+	if err := server.check("Unseal", r); err != nil {
+		return err
+	}
 	data, policy, err := server.lh.Unseal(server.child, r.Data)
 	s.Data = data
 	s.Policy = proto.String(policy)
@@ -112,6 +166,9 @@ func (server linuxHostTaoServerStub) Unseal(r *RPCRequest, s *RPCResponse) error
 
 // Attest is the server stub for Tao.Attest.
 func (server linuxHostTaoServerStub) Attest(r *RPCRequest, s *RPCResponse) error {
+	if err := server.check("Attest", r); err != nil {
+		return err
+	}
 	stmt, err := auth.UnmarshalForm(r.Data)
 	if err != nil {
 		return err
@@ -124,7 +181,7 @@ func (server linuxHostTaoServerStub) Attest(r *RPCRequest, s *RPCResponse) error
 		}
 		issuer = &p
 	}
-	a, err := server.lh.Attest(server.child, issuer, r.Time, r.Expiration, stmt)
+	a, err := server.lh.AttestNonce(server.child, issuer, r.Time, r.Expiration, r.Nonce, stmt)
 	if err != nil {
 		return err
 	}
@@ -134,6 +191,9 @@ func (server linuxHostTaoServerStub) Attest(r *RPCRequest, s *RPCResponse) error
 
 // InitCounter initializes counter.
 func (server linuxHostTaoServerStub) InitCounter(r *RPCRequest, s *RPCResponse) error {
+	if err := server.check("InitCounter", r); err != nil {
+		return err
+	}
 	// fmt.Printf("linuxHostTaoServerStub.InitCounter called %s\n", server.child.ChildSubprin.String()) // REMOVE
 	if r.Label == nil || r.Counter == nil {
 		return errors.New("Label or counter unspecified")
@@ -144,6 +204,9 @@ func (server linuxHostTaoServerStub) InitCounter(r *RPCRequest, s *RPCResponse)
 
 // GetCounter gets counter
 func (server linuxHostTaoServerStub) GetCounter(r *RPCRequest, s *RPCResponse) error {
+	if err := server.check("GetCounter", r); err != nil {
+		return err
+	}
 	if r.Label == nil {
 		return errors.New("Label unspecified")
 	}
@@ -157,6 +220,9 @@ func (server linuxHostTaoServerStub) GetCounter(r *RPCRequest, s *RPCResponse) e
 
 // RollbackProtectedSeal does a rollback protected seal
 func (server linuxHostTaoServerStub) RollbackProtectedSeal(r *RPCRequest, s *RPCResponse) error {
+	if err := server.check("RollbackProtectedSeal", r); err != nil {
+		return err
+	}
 	if r.Label == nil {
 		return errors.New("Label unspecified")
 	}
@@ -173,6 +239,9 @@ func (server linuxHostTaoServerStub) RollbackProtectedSeal(r *RPCRequest, s *RPC
 
 // RollbackProtectedUnseal does a rollback protected Unseal
 func (server linuxHostTaoServerStub) RollbackProtectedUnseal(r *RPCRequest, s *RPCResponse) error {
+	if err := server.check("RollbackProtectedUnseal", r); err != nil {
+		return err
+	}
 	if r.Data == nil {
 		return errors.New("Data unspecified")
 	}
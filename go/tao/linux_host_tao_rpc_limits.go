@@ -0,0 +1,278 @@
+// Copyright (c) 2016, Google Inc.  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tao
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
+)
+
+// TaoRPCConfig controls which Tao RPC calls a LinuxHost serves to its hosted
+// programs, and how often.
+type TaoRPCConfig struct {
+	// Limits holds the limits on calls to each Tao RPC method, e.g. "Attest",
+	// by each hosted program. A limit for method "*" applies to methods
+	// without their own limit. GetRandomBytes and GetSharedSecret are limited
+	// to DefaultTaoRPCMaxSize bytes unless their limit sets another size.
+	Limits []*TaoRPCLimit
+
+	// GuardedMethods lists the Tao RPC methods that a hosted program may call
+	// only if the guard authorizes it for "Tao" + method, e.g.
+	// Authorized(child, "TaoAttest"). "*" stands for all methods.
+	GuardedMethods []string
+}
+
+// DefaultTaoRPCMaxSize is the largest number of random or secret bytes that a
+// hosted program may ask for in one call, unless TaoRPCConfig says otherwise.
+const DefaultTaoRPCMaxSize = 1 << 20
+
+// Reasons a host refuses a Tao RPC call, see RPCRefusedError.
+const (
+	RPCUnauthorized = "unauthorized"
+	RPCRateLimited  = "rate-limited"
+	RPCTooLarge     = "too-large"
+)
+
+// An RPCRefusedError is returned when a host refuses to serve a Tao RPC call,
+// because the guard doesn't authorize the caller for the method, or the call
+// exceeds a limit in TaoRPCConfig. It is sent to the hosted program as an
+// error string, which RPC turns back into an RPCRefusedError.
+type RPCRefusedError struct {
+	// Reason is RPCUnauthorized, RPCRateLimited or RPCTooLarge.
+	Reason string
+
+	// Method is the refused method, e.g. "Attest".
+	Method string
+
+	Detail string
+}
+
+const rpcRefusedPrefix = "taorpc refused: "
+
+func (e *RPCRefusedError) Error() string {
+	return rpcRefusedPrefix + e.Reason + ": " + e.Method + ": " + e.Detail
+}
+
+// parseRPCRefusedError parses an RPCRefusedError sent by a host, or returns
+// nil if s is some other error.
+func parseRPCRefusedError(s string) *RPCRefusedError {
+	if !strings.HasPrefix(s, rpcRefusedPrefix) {
+		return nil
+	}
+	f := strings.SplitN(strings.TrimPrefix(s, rpcRefusedPrefix), ": ", 3)
+	if len(f) != 3 {
+		return nil
+	}
+	return &RPCRefusedError{Reason: f[0], Method: f[1], Detail: f[2]}
+}
+
+// limit returns the limit on calls to method, or nil if there is none.
+func (c *TaoRPCConfig) limit(method string) *TaoRPCLimit {
+	var limit *TaoRPCLimit
+	for _, l := range c.Limits {
+		if l.GetMethod() == method {
+			limit = l
+			break
+		} else if l.GetMethod() == "*" {
+			limit = l
+		}
+	}
+	if limit.GetMaxSize() == 0 && (method == "GetRandomBytes" || method == "GetSharedSecret") {
+		l := &TaoRPCLimit{MaxSize: proto.Int32(DefaultTaoRPCMaxSize)}
+		if limit != nil {
+			l.Rate, l.Burst = limit.Rate, limit.Burst
+		}
+		limit = l
+	}
+	return limit
+}
+
+// guarded checks whether calls to method need the guard's authorization.
+func (c *TaoRPCConfig) guarded(method string) bool {
+	for _, m := range c.GuardedMethods {
+		if m == method || m == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeTaoMethod checks whether the guard authorizes a child to call a Tao
+// RPC method, if the method is guarded.
+func (lh *LinuxHost) authorizeTaoMethod(child *LinuxHostChild, method string) error {
+	if !lh.TaoRPCConfig.guarded(method) {
+		return nil
+	}
+	name := lh.Host.HostName().MakeSubprincipal(child.ChildSubprin)
+	if lh.guard.IsAuthorized(name, "Tao"+method, nil) {
+		return nil
+	}
+	return &RPCRefusedError{RPCUnauthorized, method,
+		fmt.Sprintf("hosted program %s is not authorized for Tao%s", child.ChildSubprin, method)}
+}
+
+// A taoRPCLimiter enforces the rate limits in a TaoRPCConfig for one child.
+type taoRPCLimiter struct {
+	m       sync.Mutex
+	buckets map[string]*tokenBucket
+
+	// key, conns and idle are protected by LinuxHost.rlm. conns is the
+	// number of open connections that use the limiter, and idle is when the
+	// last of them closed.
+	key   string
+	conns int
+	idle  time.Time
+}
+
+// A tokenBucket allows calls at a steady rate, with bursts after a pause.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	rate   float64
+	burst  float64
+}
+
+// maxIdleTaoRPCLimiters is the number of limiters that a LinuxHost keeps for
+// children without an open connection, see rpcLimiter.
+const maxIdleTaoRPCLimiters = 1024
+
+func newTaoRPCLimiter(key string) *taoRPCLimiter {
+	return &taoRPCLimiter{buckets: make(map[string]*tokenBucket), key: key}
+}
+
+// rpcLimiter returns the limiter for a child, for a new connection from it,
+// which must call releaseRPCLimiter when it closes. Limiters are kept by
+// subprincipal, so a child can't escape its rate limits by opening another
+// connection. Once a child has no open connections, its limiter is kept only
+// until its buckets have refilled, when a new one would be no different, see
+// pruneRPCLimiters.
+func (lh *LinuxHost) rpcLimiter(child *LinuxHostChild) *taoRPCLimiter {
+	key := child.ChildSubprin.String()
+	lh.rlm.Lock()
+	defer lh.rlm.Unlock()
+	if lh.rpcLimiters == nil {
+		lh.rpcLimiters = make(map[string]*taoRPCLimiter)
+	}
+	lh.pruneRPCLimiters(time.Now())
+	l, ok := lh.rpcLimiters[key]
+	if !ok {
+		l = newTaoRPCLimiter(key)
+		lh.rpcLimiters[key] = l
+	}
+	l.conns++
+	return l
+}
+
+// releaseRPCLimiter records that a connection using l has closed.
+func (lh *LinuxHost) releaseRPCLimiter(l *taoRPCLimiter) {
+	lh.rlm.Lock()
+	defer lh.rlm.Unlock()
+	l.conns--
+	if l.conns == 0 {
+		l.idle = time.Now()
+	}
+}
+
+// pruneRPCLimiters drops the limiters of children without open connections
+// whose buckets have refilled by now. If more than maxIdleTaoRPCLimiters such
+// limiters are left, e.g. for many remote children that each attested a
+// fresh key, the ones idle longest are dropped as well. The caller must hold
+// lh.rlm.
+func (lh *LinuxHost) pruneRPCLimiters(now time.Time) {
+	var idle []*taoRPCLimiter
+	for key, l := range lh.rpcLimiters {
+		if l.conns > 0 {
+			continue
+		}
+		if l.full(now) {
+			delete(lh.rpcLimiters, key)
+		} else {
+			idle = append(idle, l)
+		}
+	}
+	if len(idle) <= maxIdleTaoRPCLimiters {
+		return
+	}
+	sort.Slice(idle, func(i, j int) bool { return idle[i].idle.Before(idle[j].idle) })
+	for _, l := range idle[:len(idle)-maxIdleTaoRPCLimiters] {
+		delete(lh.rpcLimiters, l.key)
+	}
+}
+
+// full checks whether each of the limiter's buckets has refilled by now.
+func (l *taoRPCLimiter) full(now time.Time) bool {
+	l.m.Lock()
+	defer l.m.Unlock()
+	for _, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*b.rate < b.burst {
+			return false
+		}
+	}
+	return true
+}
+
+// allow checks whether a call to method is within its rate limit, and if so
+// counts it.
+func (l *taoRPCLimiter) allow(method string, limit *TaoRPCLimit, now time.Time) bool {
+	rate := limit.GetRate()
+	if rate <= 0 {
+		return true
+	}
+	burst := float64(limit.GetBurst())
+	if burst < 1 {
+		burst = math.Max(1, math.Ceil(rate))
+	}
+	l.m.Lock()
+	defer l.m.Unlock()
+	b, ok := l.buckets[method]
+	if !ok {
+		b = &tokenBucket{tokens: burst}
+		l.buckets[method] = b
+	} else {
+		b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	}
+	b.last, b.rate, b.burst = now, rate, burst
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// checkTaoRPC checks whether a child may make a Tao RPC call: whether the guard
+// authorizes it, if the method is guarded, and whether the call is within the
+// limits for the method.
+func (lh *LinuxHost) checkTaoRPC(child *LinuxHostChild, limiter *taoRPCLimiter, method string, r *RPCRequest) error {
+	err := lh.authorizeTaoMethod(child, method)
+	if err == nil {
+		limit := lh.TaoRPCConfig.limit(method)
+		if max := int(limit.GetMaxSize()); max > 0 && (int(r.GetSize()) > max || len(r.Data) > max) {
+			err = &RPCRefusedError{RPCTooLarge, method, fmt.Sprintf("requests are limited to %d bytes", max)}
+		} else if !limiter.allow(method, limit, time.Now()) {
+			err = &RPCRefusedError{RPCRateLimited, method, fmt.Sprintf("calls are limited to %g per second", limit.GetRate())}
+		}
+	}
+	if err != nil {
+		glog.Infof("Refused Tao RPC from hosted program %s: %s", child.ChildSubprin, err)
+	}
+	return err
+}
@@ -20,12 +20,16 @@ package tao
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"net/rpc"
 	"os"
 	"strconv"
 	"testing"
 	"time"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/jlmucb/cloudproxy/go/tao/auth"
 	"github.com/jlmucb/cloudproxy/go/util"
 	"github.com/jlmucb/cloudproxy/go/util/protorpc"
@@ -36,7 +40,10 @@ func testNewLinuxHostTaoServer(t *testing.T) (Tao, error) {
 	if err != nil {
 		return nil, fmt.Errorf("Can't make root linux host: %s", err)
 	}
+	return testServeLinuxHostTao(lh)
+}
 
+func testServeLinuxHostTao(lh *LinuxHost) (*RPC, error) {
 	hostRead, childWrite, err := os.Pipe()
 	if err != nil {
 		return nil, fmt.Errorf("Can't make pipe: %s", err)
@@ -59,7 +66,7 @@ func testNewLinuxHostTaoServer(t *testing.T) (Tao, error) {
 	}
 
 	go NewLinuxHostTaoServer(lh, child).Serve(hostChannel)
-	return &RPC{protorpc.NewClient(childChannel), "Tao"}, nil
+	return &RPC{rpc: protorpc.NewContextClient(childChannel), serviceName: "Tao"}, nil
 }
 
 func TestLinuxHostTaoServerGetTaoName(t *testing.T) {
@@ -170,6 +177,24 @@ func TestLinuxHostTaoServerAttest(t *testing.T) {
 	// TODO(tmroeder): verify the attestation
 }
 
+func TestLinuxHostTaoServerAttestNonce(t *testing.T) {
+	host, err := testNewLinuxHostTaoServer(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce, err := NewNonce()
+	if err != nil {
+		t.Fatal("Couldn't make a nonce:", err)
+	}
+	a, err := host.AttestNonce(nil, nil, nil, nonce, auth.Pred{Name: "FakePredicate"})
+	if err != nil {
+		t.Fatal("Couldn't attest to data through LinuxHostTaoServer:", err)
+	}
+	if _, err := a.ValidateNonce(nonce); err != nil {
+		t.Fatal("The attestation from LinuxHostTaoServer didn't pass validation:", err)
+	}
+}
+
 func TestLinuxHostTaoServerInitCounter(t *testing.T) {
 	host, err := testNewLinuxHostTaoServer(t)
 	if err != nil {
@@ -212,3 +237,313 @@ func TestLinuxHostTaoServerRollbackProtectedSeal(t *testing.T) {
 	}
 	fmt.Printf("Data: %x, policy: %s\n", newData, policy)
 }
+
+// slowTaoServer is a Tao server whose Seal method waits to be released.
+type slowTaoServer struct {
+	started chan bool
+	release chan bool
+}
+
+func (server slowTaoServer) Seal(r *RPCRequest, s *RPCResponse) error {
+	server.started <- true
+	<-server.release
+	s.Data = r.Data
+	return nil
+}
+
+func testNewSlowTaoServer(t *testing.T) (*RPC, slowTaoServer) {
+	hostRead, childWrite, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	childRead, hostWrite, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := slowTaoServer{make(chan bool, 10), make(chan bool, 10)}
+	s := rpc.NewServer()
+	if err := s.RegisterName("Tao", server); err != nil {
+		t.Fatal(err)
+	}
+	go s.ServeCodec(protorpc.NewServerCodec(util.NewPairReadWriteCloser(hostRead, hostWrite)))
+	childChannel := util.NewPairReadWriteCloser(childRead, childWrite)
+	return &RPC{rpc: protorpc.NewContextClient(childChannel), serviceName: "Tao"}, server
+}
+
+func TestRPCContextCancel(t *testing.T) {
+	host, server := testNewSlowTaoServer(t)
+	defer host.rpc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := host.SealContext(ctx, []byte{1}, SealPolicyDefault); err != context.DeadlineExceeded {
+		t.Fatalf("SealContext on a hung host returned %v, want %v", err, context.DeadlineExceeded)
+	}
+	<-server.started
+
+	// The late response to the cancelled request must not be taken as the
+	// response to the next one.
+	server.release <- true
+	server.release <- true
+	sealed, err := host.Seal([]byte{2}, SealPolicyDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sealed, []byte{2}) {
+		t.Fatalf("Got response %v, want [2]", sealed)
+	}
+
+	host.SetTimeout(100 * time.Millisecond)
+	if _, err := host.Seal([]byte{3}, SealPolicyDefault); err != context.DeadlineExceeded {
+		t.Fatalf("Seal with timeout on a hung host returned %v, want %v", err, context.DeadlineExceeded)
+	}
+	server.release <- true
+}
+
+func TestRPCConcurrentCalls(t *testing.T) {
+	host, server := testNewSlowTaoServer(t)
+	defer host.rpc.Close()
+
+	const n = 3
+	results := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func(i byte) {
+			sealed, err := host.Seal([]byte{i}, SealPolicyDefault)
+			if err == nil && !bytes.Equal(sealed, []byte{i}) {
+				err = fmt.Errorf("got response %v, want [%d]", sealed, i)
+			}
+			results <- err
+		}(byte(i))
+	}
+	// All requests reach the host before any of them is answered.
+	for i := 0; i < n; i++ {
+		select {
+		case <-server.started:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Only %d of %d requests were in flight", i, n)
+		}
+	}
+	for i := 0; i < n; i++ {
+		server.release <- true
+	}
+	for i := 0; i < n; i++ {
+		if err := <-results; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// lostTaoClient is an rpcClient whose connection to the host is lost, if
+// lost is set, or that answers every call with data.
+type lostTaoClient struct {
+	lost  bool
+	calls *[]string
+}
+
+func (c lostTaoClient) Call(ctx context.Context, method string, args interface{}, reply interface{}) error {
+	*c.calls = append(*c.calls, method)
+	if c.lost {
+		return io.EOF
+	}
+	reply.(*RPCResponse).Data = []byte{1}
+	return nil
+}
+
+func (c lostTaoClient) Close() error { return nil }
+
+func TestRPCReconnect(t *testing.T) {
+	var calls []string
+	host := &RPC{
+		rpc:         lostTaoClient{true, &calls},
+		serviceName: "Tao",
+		redial: func() (rpcClient, error) {
+			return lostTaoClient{false, &calls}, nil
+		},
+	}
+
+	// Seal isn't repeated on the new connection, but the next call uses it.
+	if _, err := host.Seal([]byte{1}, SealPolicyDefault); err != io.EOF {
+		t.Fatalf("Seal on a lost connection returned %v, want %v", err, io.EOF)
+	}
+	if _, err := host.Seal([]byte{1}, SealPolicyDefault); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 2 {
+		t.Fatalf("Got calls %v, want two calls to Seal", calls)
+	}
+
+	// GetRandomBytes is retried.
+	calls = nil
+	host.rpc = lostTaoClient{true, &calls}
+	if _, err := host.GetRandomBytes(1); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 2 {
+		t.Fatalf("Got calls %v, want a retried call to GetRandomBytes", calls)
+	}
+}
+
+func TestLinuxHostTaoServerGetCapabilities(t *testing.T) {
+	host, err := testNewLinuxHostTaoServer(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caps, err := HostCapabilities(host)
+	if err != nil {
+		t.Fatal("Couldn't get capabilities from LinuxHostTaoServer:", err)
+	}
+	if caps.GetVersion() != TaoRPCVersion {
+		t.Errorf("Got version %d, want %d", caps.GetVersion(), TaoRPCVersion)
+	}
+	for _, m := range []string{"GetCapabilities", "Seal", "Attest", "RollbackProtectedUnseal"} {
+		if !caps.HasMethod(m) {
+			t.Errorf("Method %s missing from %v", m, caps.Methods)
+		}
+	}
+	if caps.HasMethod("Bogus") {
+		t.Errorf("Unexpected methods %v", caps.Methods)
+	}
+	if !caps.HasSealPolicy(SealPolicyLiberal) || caps.HasSealPolicy("bogus") {
+		t.Errorf("Unexpected seal policies %v", caps.SealPolicies)
+	}
+	if !caps.HasSharedSecretPolicy(SharedSecretPolicyDefault) {
+		t.Errorf("Unexpected shared secret policies %v", caps.SharedSecretPolicies)
+	}
+	if fmt.Sprint(caps.HostTypes) != "[LinuxHost Soft]" {
+		t.Errorf("Got host types %v, want [LinuxHost Soft]", caps.HostTypes)
+	}
+
+	// A host that predates capabilities.
+	old, _ := testNewSlowTaoServer(t)
+	defer old.rpc.Close()
+	if _, err := old.GetCapabilities(); err != ErrNoCapabilities {
+		t.Errorf("GetCapabilities on an old host returned %v, want %v", err, ErrNoCapabilities)
+	}
+}
+
+func TestLinuxHostTaoServerLimits(t *testing.T) {
+	lh, err := testNewRootLinuxHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lh.TaoRPCConfig.Limits = []*TaoRPCLimit{
+		{Method: proto.String("Seal"), MaxSize: proto.Int32(4)},
+		{Method: proto.String("*"), Rate: proto.Float64(0.001), Burst: proto.Int32(2)},
+	}
+	host, err := testServeLinuxHostTao(lh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := host.GetRandomBytes(DefaultTaoRPCMaxSize + 1); !isRefused(err, RPCTooLarge, "GetRandomBytes") {
+		t.Errorf("Huge GetRandomBytes returned %v, want refusal", err)
+	}
+	if _, err := host.Seal([]byte{1, 2, 3, 4}, SealPolicyDefault); err != nil {
+		t.Errorf("Small Seal failed: %s", err)
+	}
+	if _, err := host.Seal([]byte{1, 2, 3, 4, 5}, SealPolicyDefault); !isRefused(err, RPCTooLarge, "Seal") {
+		t.Errorf("Large Seal returned %v, want refusal", err)
+	}
+
+	// The rate limit allows a burst of two calls, for each method.
+	for i := 0; i < 2; i++ {
+		if _, err := host.GetTaoName(); err != nil {
+			t.Fatalf("GetTaoName %d failed: %s", i, err)
+		}
+	}
+	if _, err := host.GetTaoName(); !isRefused(err, RPCRateLimited, "GetTaoName") {
+		t.Errorf("Third GetTaoName returned %v, want refusal", err)
+	}
+	// Another connection from the same child shares its limits.
+	other, err := testServeLinuxHostTao(lh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.GetTaoName(); !isRefused(err, RPCRateLimited, "GetTaoName") {
+		t.Errorf("GetTaoName on a new connection returned %v, want refusal", err)
+	}
+	if err := host.ExtendTaoName(auth.SubPrin{auth.PrinExt{Name: "Extension"}}); err != nil {
+		t.Errorf("ExtendTaoName was limited by GetTaoName calls: %s", err)
+	}
+}
+
+func TestLinuxHostTaoRPCLimiterPruning(t *testing.T) {
+	lh, err := testNewRootLinuxHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	limit := &TaoRPCLimit{Rate: proto.Float64(1), Burst: proto.Int32(2)}
+	child := &LinuxHostChild{ChildSubprin: auth.SubPrin{auth.PrinExt{Name: "TestChild"}}}
+	now := time.Now()
+
+	l := lh.rpcLimiter(child)
+	if !l.allow("GetTaoName", limit, now) {
+		t.Fatal("The first call was refused")
+	}
+	lh.releaseRPCLimiter(l)
+	// A child that reconnects before its buckets refill keeps its limiter.
+	if lh.rpcLimiter(child) != l {
+		t.Fatal("A reconnecting child got a new limiter")
+	}
+	lh.releaseRPCLimiter(l)
+
+	lh.rlm.Lock()
+	lh.pruneRPCLimiters(now.Add(time.Minute))
+	n := len(lh.rpcLimiters)
+	lh.rlm.Unlock()
+	if n != 0 {
+		t.Fatalf("%d limiters were kept after their buckets refilled, want 0", n)
+	}
+
+	// Idle limiters with partly empty buckets are capped.
+	for i := uint(0); i < maxIdleTaoRPCLimiters+10; i++ {
+		c := &LinuxHostChild{ChildSubprin: FormatProcessSubprin(i, nil)}
+		l := lh.rpcLimiter(c)
+		l.allow("GetTaoName", limit, time.Now())
+		lh.releaseRPCLimiter(l)
+	}
+	lh.rlm.Lock()
+	lh.pruneRPCLimiters(time.Now())
+	n = len(lh.rpcLimiters)
+	lh.rlm.Unlock()
+	if n != maxIdleTaoRPCLimiters {
+		t.Fatalf("%d idle limiters were kept, want %d", n, maxIdleTaoRPCLimiters)
+	}
+}
+
+func TestLinuxHostTaoServerGuardedMethods(t *testing.T) {
+	lh, err := testNewRootLinuxHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lh.TaoRPCConfig.GuardedMethods = []string{"Attest"}
+	lh.guard = ConservativeGuard
+	host, err := testServeLinuxHostTao(lh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := host.Attest(nil, nil, nil, auth.Pred{Name: "FakePredicate"}); !isRefused(err, RPCUnauthorized, "Attest") {
+		t.Errorf("Unauthorized Attest returned %v, want refusal", err)
+	}
+	if _, err := host.GetTaoName(); err != nil {
+		t.Errorf("Unguarded GetTaoName failed: %s", err)
+	}
+	caps, err := host.GetCapabilities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caps.HasMethod("Attest") || !caps.HasMethod("Seal") {
+		t.Errorf("Got methods %v, want all but Attest", caps.Methods)
+	}
+
+	lh.guard = LiberalGuard
+	if _, err := host.Attest(nil, nil, nil, auth.Pred{Name: "FakePredicate"}); err != nil {
+		t.Errorf("Authorized Attest failed: %s", err)
+	}
+}
+
+func isRefused(err error, reason, method string) bool {
+	e, ok := err.(*RPCRefusedError)
+	return ok && e.Reason == reason && e.Method == method
+}
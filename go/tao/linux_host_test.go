@@ -16,12 +16,20 @@ package tao
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"os"
+	"os/exec"
+	"path"
 	"testing"
+	"time"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/jlmucb/cloudproxy/go/tao/auth"
+	"github.com/jlmucb/cloudproxy/go/util"
 )
 
 func testNewStackedLinuxHost() (*LinuxHost, error) {
@@ -266,3 +274,741 @@ func testStackedLinuxHostHandleAttest(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestLinuxHostWatchHostedPrograms(t *testing.T) {
+	lh, err := testNewRootLinuxHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An event that happened before the first watch call is skipped.
+	lh.events.add(HostedProgramEventType_STARTED, testChildLH.ChildSubprin, auth.Prin{}, 10, 0)
+	events, seq, err := lh.WatchHostedPrograms(0, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 || seq != 1 {
+		t.Fatalf("WatchHostedPrograms(0) = %v, %d; want no events, seq 1", events, seq)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		lh.events.add(HostedProgramEventType_EXITED, testChildLH.ChildSubprin, auth.Prin{}, 10, 3)
+	}()
+	events, seq, err = lh.WatchHostedPrograms(seq, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || seq != 2 {
+		t.Fatalf("WatchHostedPrograms(1) = %v, %d; want one event, seq 2", events, seq)
+	}
+	e := events[0]
+	if e.Type != HostedProgramEventType_EXITED || e.Pid != 10 || e.Status != 3 || !e.Subprin.Identical(testChildLH.ChildSubprin) {
+		t.Fatalf("Wrong event: %v", e)
+	}
+}
+
+func TestLinuxHostHostedProgramLogs(t *testing.T) {
+	lh, err := testNewRootLinuxHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lh.LogConfig.BufferSize = 8
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lh.captureOutput(r, testChildLH.ChildSubprin, auth.Prin{}, 10)
+
+	if _, _, _, err := lh.HostedProgramLogs(11, nil, 0, 0); err == nil {
+		t.Fatal("Got output for the wrong pid")
+	}
+
+	// Only the most recent output is kept.
+	fmt.Fprintf(w, "0123456789")
+	data, offset, done, err := lh.HostedProgramLogs(10, nil, 0, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "23456789" || offset != 10 || done {
+		t.Fatalf("HostedProgramLogs(0) = %q, %d, %v; want \"23456789\", 10, false", data, offset, done)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		fmt.Fprintf(w, "abc")
+		w.Close()
+	}()
+	for !done {
+		var more []byte
+		more, offset, done, err = lh.HostedProgramLogs(0, testChildLH.ChildSubprin, offset, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, more...)
+	}
+	if string(data) != "23456789abc" || offset != 13 {
+		t.Fatalf("Wrong output %q at offset %d", data, offset)
+	}
+
+	// A program that reuses a pid doesn't overwrite the earlier log file.
+	tmpdir, err := ioutil.TempDir("/tmp", "test_hosted_program_logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	lh.LogConfig.Dir = tmpdir
+	for i := 0; i < 2; i++ {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		lh.captureOutput(r, testChildLH.ChildSubprin, auth.Prin{}, 10)
+		fmt.Fprintf(w, "run %d", i)
+		w.Close()
+		time.Sleep(10 * time.Millisecond)
+	}
+	files, err := ioutil.ReadDir(tmpdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("Got %d log files for two runs with the same pid, want 2", len(files))
+	}
+}
+
+func TestLinuxHostAuthorizeAdmin(t *testing.T) {
+	lh, err := testNewRootLinuxHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lh.guard = NewACLGuard(nil, ACLGuardDetails{})
+
+	root := adminCaller{ucred: &util.Ucred{Uid: 0, Gid: 0}}
+	alice := adminCaller{ucred: &util.Ucred{Uid: 4242, Gid: 4242}}
+	bob := adminCaller{ucred: &util.Ucred{Uid: 4243, Gid: 4242}}
+	if err := lh.authorizeAdmin(root, "AdminShutdown"); err != nil {
+		t.Fatal("Root was denied:", err)
+	}
+	if err := lh.authorizeAdmin(alice, "AdminStart"); err == nil {
+		t.Fatal("Unauthorized user was allowed to start a hosted program")
+	}
+
+	// Authorize the group to start and kill hosted programs.
+	group := lh.AdminCallerPrins(alice.ucred)[1]
+	lh.guard.Authorize(group, "AdminStart", nil)
+	lh.guard.Authorize(group, "AdminKill", nil)
+	if err := lh.authorizeAdmin(bob, "AdminStart"); err != nil {
+		t.Fatal("Group member was denied:", err)
+	}
+	if err := lh.authorizeAdmin(bob, "AdminShutdown"); err == nil {
+		t.Fatal("Group member was allowed to shut down the host")
+	}
+
+	// Only the user that started a hosted program may kill it.
+	lh.hostedPrograms = append(lh.hostedPrograms, &LinuxHostChild{
+		ChildSubprin: testChildLH.ChildSubprin,
+		owner:        lh.userPrin(4242),
+	})
+	if err := lh.authorizeAdminControl(alice, "AdminKill", testChildLH.ChildSubprin); err != nil {
+		t.Fatal("User was denied killing its own hosted program:", err)
+	}
+	if err := lh.authorizeAdminControl(bob, "AdminKill", testChildLH.ChildSubprin); err == nil {
+		t.Fatal("User was allowed to kill another user's hosted program")
+	}
+	lh.guard.Authorize(lh.AdminCallerPrins(bob.ucred)[0], "AdminKillAny", nil)
+	if err := lh.authorizeAdminControl(bob, "AdminKill", testChildLH.ChildSubprin); err != nil {
+		t.Fatal("User authorized for AdminKillAny was denied:", err)
+	}
+
+	// Reading logs follows the same rule.
+	alicePrin := lh.userPrin(4242)
+	if err := lh.authorizeOwner(alice, "AdminLogs", []auth.Prin{alicePrin}); err == nil {
+		t.Fatal("Unauthorized user was allowed to read logs")
+	}
+	lh.guard.Authorize(group, "AdminLogs", nil)
+	if err := lh.authorizeOwner(alice, "AdminLogs", []auth.Prin{alicePrin}); err != nil {
+		t.Fatal("User was denied the logs of its own hosted program:", err)
+	}
+	if err := lh.authorizeOwner(bob, "AdminLogs", []auth.Prin{alicePrin}); err == nil {
+		t.Fatal("User was allowed to read another user's logs")
+	}
+
+	// Listing is restricted to the caller's own hosted programs unless it is
+	// authorized for AdminListAny.
+	lh.guard.Authorize(group, "AdminList", nil)
+	if owner, err := lh.ownerFilter(bob, "AdminList"); err != nil || owner == nil {
+		t.Fatalf("ownerFilter(bob) = %v, %v; want bob's principal", owner, err)
+	}
+	lh.guard.Authorize(lh.AdminCallerPrins(bob.ucred)[0], "AdminListAny", nil)
+	if owner, err := lh.ownerFilter(bob, "AdminList"); err != nil || owner != nil {
+		t.Fatalf("ownerFilter(bob) = %v, %v; want no restriction", owner, err)
+	}
+
+	// Remote callers are authorized by their own principal.
+	remote := adminCaller{peer: &auth.Prin{Type: "key", KeyHash: auth.Bytes("operator")}}
+	if err := lh.authorizeAdminControl(remote, "AdminKill", testChildLH.ChildSubprin); err == nil {
+		t.Fatal("Unauthorized remote caller was allowed to kill a hosted program")
+	}
+	lh.guard.Authorize(*remote.peer, "AdminKill", nil)
+	lh.guard.Authorize(*remote.peer, "AdminKillAny", nil)
+	if err := lh.authorizeAdminControl(remote, "AdminKill", testChildLH.ChildSubprin); err != nil {
+		t.Fatal("Authorized remote caller was denied:", err)
+	}
+
+	// Remote callers' hosted programs run as the configured unprivileged user,
+	// unless they are authorized for AdminSuperuser.
+	if _, _, err := lh.adminCallerUser(remote); err == nil {
+		t.Fatal("Remote caller got a user with none configured")
+	}
+	lh.RemoteAdminConfig = RemoteAdminConfig{Uid: 4244, Gid: 4244}
+	if uid, gid, err := lh.adminCallerUser(remote); err != nil || uid != 4244 || gid != 4244 {
+		t.Fatalf("adminCallerUser(remote) = %d, %d, %v; want 4244, 4244", uid, gid, err)
+	}
+	lh.guard.Authorize(*remote.peer, "AdminSuperuser", nil)
+	if uid, _, err := lh.adminCallerUser(remote); err != nil || uid != os.Getuid() {
+		t.Fatalf("adminCallerUser(remote) = %d, %v; want %d", uid, err, os.Getuid())
+	}
+}
+
+func TestLinuxHostRemoteAdmin(t *testing.T) {
+	lh, err := testNewRootLinuxHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lh.guard = NewACLGuard(nil, ACLGuardDetails{})
+	l, err := lh.ListenRemoteAdmin("tcp", "127.0.0.1:0", LiberalGuard, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go NewLinuxHostAdminServer(lh).ServeRemote(l)
+
+	st, err := NewSoftTao("", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, _ := newNetKeys(t, st, "Remote Admin Test")
+	conn, err := Dial("tcp", l.Addr().String(), LiberalGuard, nil, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewRemoteLinuxHostAdminClient(conn)
+	defer client.Close()
+
+	name, err := client.HostName()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !name.Identical(lh.HostName()) {
+		t.Fatalf("Remote host name is %v; want %v", name, lh.HostName())
+	}
+
+	// The remote caller is not the host owner, so it needs authorization.
+	if err := client.Shutdown(); err == nil {
+		t.Fatal("Unauthorized remote caller was allowed to shut down the host")
+	}
+}
+
+func TestLinuxHostServeTao(t *testing.T) {
+	lh, err := testNewRootLinuxHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := lh.ListenTao("tcp", "127.0.0.1:0", LiberalGuard, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go lh.ServeTao(l)
+
+	st, err := NewSoftTao("", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, _ := newNetKeys(t, st, "Remote Tao Test")
+	remote, err := DialTLSRPC("tcp", l.Addr().String(), LiberalGuard, nil, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.rpc.Close()
+
+	name, err := remote.GetTaoName()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := lh.HostName().MakeSubprincipal(FormatRemoteKeySubprin(keys.VerifyingKey))
+	if !name.Identical(want) {
+		t.Fatalf("Remote hosted program name is %v; want %v", name, want)
+	}
+
+	sealed, err := remote.Seal([]byte("remote secret"), SealPolicyDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _, err := remote.Unseal(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "remote secret" {
+		t.Fatalf("Unsealed %q; want %q", data, "remote secret")
+	}
+
+	// A hosted program without an attested key can't connect.
+	if _, err := DialTLSRPC("tcp", l.Addr().String(), LiberalGuard, nil, nil); err == nil {
+		t.Fatal("Connected without an attested key")
+	}
+}
+
+func TestLinuxHostAdoptHostedPrograms(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("/tmp", "test_adopt_linux_host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip("no sleep binary")
+	}
+
+	tg := LiberalGuard
+	lpf := NewLinuxProcessFactory("unix", tmpdir)
+	lh, err := NewRootLinuxHost(tmpdir, &tg, []byte("bad password"), lpf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two processes that an earlier instance of the host might have started.
+	var cmds []*exec.Cmd
+	var records []*LinuxHostChildRecord
+	for i := 0; i < 2; i++ {
+		cmd := exec.Command(sleep, "60")
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer cmd.Process.Kill()
+		cmds = append(cmds, cmd)
+		hash, err := processHash(cmd.Process.Pid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		startTime, err := processStartTime(cmd.Process.Pid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, &LinuxHostChildRecord{
+			Subprin:     auth.Marshal(FormatProcessSubprin(0, hash)),
+			Pid:         proto.Int32(int32(cmd.Process.Pid)),
+			StartTime:   proto.Uint64(startTime),
+			Hash:        hash,
+			ChannelType: proto.String("unix"),
+			ChannelSpec: proto.String(path.Join(tmpdir, fmt.Sprintf("child%d", i))),
+			Path:        proto.String(sleep),
+		})
+	}
+	// The second one doesn't run the recorded binary, so it must be killed.
+	records[1].Hash = []byte("wrong hash")
+	records[1].Subprin = auth.Marshal(FormatProcessSubprin(0, records[1].Hash))
+	m, err := proto.Marshal(&LinuxHostChildRecords{Child: records})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := lh.Host.Encrypt(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(tmpdir, childRecordsFile), sealed, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lh.AdoptHostedPrograms(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmds[1].Wait(); err == nil {
+		t.Fatal("Unverified process was not killed")
+	}
+	_, pids, err := lh.ListHostedPrograms()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pids) != 1 || pids[0] != cmds[0].Process.Pid {
+		t.Fatalf("Adopted pids %v, want [%d]", pids, cmds[0].Process.Pid)
+	}
+
+	// Only the adopted process may connect to its channel.
+	conn, err := net.Dial("unix", records[0].GetChannelSpec())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("Connection from another process got %v, want EOF", err)
+	}
+	conn.Close()
+
+	// The adopted process can still be killed, and its exit is noticed.
+	if err := lh.KillHostedProgram(FormatProcessSubprin(0, records[0].Hash)); err != nil {
+		t.Fatal(err)
+	}
+	cmds[0].Wait()
+	for i := 0; i < 50; i++ {
+		if _, pids, _ = lh.ListHostedPrograms(); len(pids) == 0 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(pids) != 0 {
+		t.Fatal("Exit of adopted process was not noticed")
+	}
+	if _, err := os.Stat(path.Join(tmpdir, childRecordsFile)); !os.IsNotExist(err) {
+		t.Fatal("Records of exited hosted programs were not removed")
+	}
+}
+
+func TestMeasureConfig(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("/tmp", "test_measure_config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	if err := ioutil.WriteFile(path.Join(tmpdir, "config"), []byte("a"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := HostedProgramSpec{
+		Args: []string{"-x"},
+		Dir:  tmpdir,
+		Env:  []string{"A=1", "B=2"},
+	}
+	if h, err := MeasureConfig(spec, nil); err != nil || h != nil {
+		t.Fatalf("MeasureConfig without Measure = %v, %v; want nil", h, err)
+	}
+	spec.Measure = &ConfigMeasurement{Args: true, Env: []string{"A"}, Files: []string{"config"}}
+	h, err := MeasureConfig(spec, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Changing anything measured changes the hash; other changes don't.
+	changes := []func(s *HostedProgramSpec){
+		func(s *HostedProgramSpec) { s.Args = []string{"-y"} },
+		func(s *HostedProgramSpec) { s.Env = []string{"B=2"} },
+		func(s *HostedProgramSpec) { s.Env = []string{"A=", "B=2"} },
+		func(s *HostedProgramSpec) {
+			ioutil.WriteFile(path.Join(tmpdir, "config"), []byte("b"), 0600)
+		},
+	}
+	for i, change := range changes {
+		s := spec
+		s.Measure = &ConfigMeasurement{Args: true, Env: []string{"A"}, Files: []string{"config"}}
+		change(&s)
+		h2, err := MeasureConfig(s, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Equal(h, h2) {
+			t.Errorf("Change %d was not measured", i)
+		}
+	}
+	ioutil.WriteFile(path.Join(tmpdir, "config"), []byte("a"), 0600)
+	spec.Env = []string{"A=1", "B=3"}
+	if h2, err := MeasureConfig(spec, nil); err != nil || !bytes.Equal(h, h2) {
+		t.Errorf("Unmeasured change changed the hash")
+	}
+
+	spec.Measure.Files = []string{"missing"}
+	if _, err := MeasureConfig(spec, nil); err == nil {
+		t.Error("Measured a missing config file")
+	}
+
+	// Symlinks, and files the hosted program's user can't read, are refused.
+	if err := os.Symlink("config", path.Join(tmpdir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	spec.Measure.Files = []string{"link"}
+	if _, err := MeasureConfig(spec, nil); err == nil {
+		t.Error("Measured a config file through a symlink")
+	}
+	spec.Measure.Files = []string{"config"}
+	spec.Uid, spec.Gid = os.Getuid()+1, os.Getgid()+1
+	if _, err := MeasureConfig(spec, nil); err == nil {
+		t.Error("Measured a config file another user can't read")
+	}
+}
+
+func TestResolveInterpreters(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("/tmp", "test_resolve_interpreters")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh binary")
+	}
+	b, err := ioutil.ReadFile(sh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := sha256.Sum256(b)
+	shHash := h[:]
+
+	// A script whose interpreter is itself a script run by sh.
+	inner := path.Join(tmpdir, "inner")
+	if err := ioutil.WriteFile(inner, []byte("#!"+sh+" -e\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	script := []byte("#! " + inner + "  x y \necho hi\n")
+	newTempdir := func() string {
+		dir, err := ioutil.TempDir(tmpdir, "copies")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dir
+	}
+	spec := HostedProgramSpec{Script: &ScriptMeasurement{}}
+	chain, err := resolveInterpreters(spec, script, newTempdir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != 2 || chain[0].Path != sh || !bytes.Equal(chain[0].Hash, shHash) || chain[1].Path != inner {
+		t.Fatalf("Wrong interpreters %v", chain)
+	}
+	if len(chain[0].Args) != 1 || chain[0].Args[0] != "-e" || len(chain[1].Args) != 1 || chain[1].Args[0] != "x y" {
+		t.Fatalf("Wrong interpreter args %v", chain)
+	}
+	// The copies that were hashed are run.
+	prog, argv := interpreterCommand(chain, "/tmp/script")
+	if prog != chain[0].Copy || fmt.Sprint(argv) != fmt.Sprint([]string{sh, "-e", chain[1].Copy, "x y", "/tmp/script"}) {
+		t.Fatalf("Wrong command %s %v", prog, argv)
+	}
+	if c, err := ioutil.ReadFile(chain[0].Copy); err != nil || !bytes.Equal(c, b) {
+		t.Fatalf("Wrong copy of the interpreter: %v", err)
+	}
+
+	// env is followed using the given $PATH.
+	spec.Env = []string{"PATH=" + path.Dir(sh)}
+	chain, err = resolveInterpreters(spec, []byte("#!/usr/bin/env sh\n"), newTempdir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != 1 || chain[0].Path != sh || len(chain[0].Args) != 0 {
+		t.Fatalf("Wrong interpreters for env %v", chain)
+	}
+
+	// An explicit interpreter overrides the #! line.
+	spec = HostedProgramSpec{Script: &ScriptMeasurement{Interpreter: sh, InterpreterArgs: []string{"-x"}}}
+	chain, err = resolveInterpreters(spec, script, newTempdir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != 1 || chain[0].Path != sh || len(chain[0].Args) != 1 {
+		t.Fatalf("Wrong explicit interpreter %v", chain)
+	}
+
+	if _, err := resolveInterpreters(HostedProgramSpec{Script: &ScriptMeasurement{}}, []byte("echo hi\n"), newTempdir()); err == nil {
+		t.Fatal("Resolved an interpreter for a script without one")
+	}
+
+	// Dependencies are measured recursively.
+	deps := path.Join(tmpdir, "deps")
+	if err := os.MkdirAll(path.Join(deps, "mod"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(path.Join(deps, "mod", "a.py"), []byte("a"), 0644)
+	depSpec := HostedProgramSpec{Dir: tmpdir, Script: &ScriptMeasurement{Dependencies: []string{"deps"}}}
+	h1, err := measureDependencies(depSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(path.Join(deps, "mod", "a.py"), []byte("b"), 0644)
+	h2, err := measureDependencies(depSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(h1, h2) {
+		t.Fatal("Change to a dependency was not measured")
+	}
+
+	p := &HostedProcess{spec: HostedProgramSpec{Id: 1}, Hash: []byte{1}, Interpreters: chain, DepsHash: h2}
+	want := ".Interpreter([" + fmt.Sprintf("%x", shHash) + `], "-x").Script(1, [01]).Deps([` + fmt.Sprintf("%x", h2) + "])"
+	if got := p.Subprin().String(); got != want {
+		t.Fatalf("Subprin = %s, want %s", got, want)
+	}
+}
+
+func TestLinuxOCIFactory(t *testing.T) {
+	bundle, err := ioutil.TempDir("/tmp", "test_oci_bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(bundle)
+	rootfs := path.Join(bundle, "rootfs")
+	if err := os.MkdirAll(path.Join(rootfs, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(rootfs, "bin", "demo"), []byte("demo"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("demo", path.Join(rootfs, "bin", "sh")); err != nil {
+		t.Fatal(err)
+	}
+	config := []byte(`{
+		"ociVersion": "1.0.0",
+		"process": {"user": {"uid": 0, "gid": 0}, "args": ["/bin/demo"], "cwd": "/"},
+		"root": {"path": "rootfs", "readonly": true},
+		"hostname": "demo",
+		"mounts": [{"destination": "/proc", "type": "proc", "source": "proc"}],
+		"linux": {
+			"namespaces": [{"type": "pid"}, {"type": "mount"}, {"type": "uts"}, {"type": "user"}],
+			"uidMappings": [{"containerID": 0, "hostID": 1000, "size": 1}],
+			"gidMappings": [{"containerID": 0, "hostID": 1000, "size": 1}]
+		}
+	}`)
+	if err := ioutil.WriteFile(path.Join(bundle, "config.json"), config, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	lof := NewLinuxOCIFactory()
+	prog, err := lof.NewHostedProgram(HostedProgramSpec{Id: 1, Path: bundle, Uid: 1000, Gid: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The ids may only map to the caller's ids, unless Superuser is set.
+	if _, err := lof.NewHostedProgram(HostedProgramSpec{Path: bundle, Uid: 1001, Gid: 1000}); err == nil {
+		t.Error("Accepted a uid mapping to another user without Superuser")
+	}
+	if _, err := lof.NewHostedProgram(HostedProgramSpec{Path: bundle, Uid: 1001, Gid: 1000, Superuser: true}); err != nil {
+		t.Error(err)
+	}
+	configHash := sha256.Sum256(config)
+	rootfsHash, err := MeasureRootfs(rootfs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := FormatOCISubprin(1, configHash[:], rootfsHash)
+	if !prog.Subprin().Identical(want) {
+		t.Fatalf("Subprin = %s, want %s", prog.Subprin(), want)
+	}
+
+	// Any change to the rootfs changes the measurement.
+	for i, change := range []func() error{
+		func() error { return ioutil.WriteFile(path.Join(rootfs, "bin", "demo"), []byte("evil"), 0755) },
+		func() error { return os.Chmod(path.Join(rootfs, "bin", "demo"), os.ModeSetuid|0755) },
+		func() error { return os.Remove(path.Join(rootfs, "bin", "sh")) },
+		func() error { return os.Symlink("/etc/passwd", path.Join(rootfs, "bin", "sh")) },
+	} {
+		if err := change(); err != nil {
+			t.Fatal(err)
+		}
+		h, err := MeasureRootfs(rootfs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Equal(h, rootfsHash) {
+			t.Errorf("Rootfs change %d was not measured", i)
+		}
+		rootfsHash = h
+	}
+
+	// Without a user namespace, a root process needs Superuser.
+	config = bytes.Replace(config, []byte(`{"type": "user"}`), []byte(`{"type": "ipc"}`), 1)
+	config = bytes.Replace(config, []byte(`"uidMappings"`), []byte(`"x"`), 1)
+	config = bytes.Replace(config, []byte(`"gidMappings"`), []byte(`"y"`), 1)
+	if err := ioutil.WriteFile(path.Join(bundle, "config.json"), config, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lof.NewHostedProgram(HostedProgramSpec{Path: bundle}); err == nil {
+		t.Error("Accepted a root OCI process without Superuser")
+	}
+	if _, err := lof.NewHostedProgram(HostedProgramSpec{Path: bundle, Superuser: true}); err != nil {
+		t.Error(err)
+	}
+
+	// Otherwise, the process runs as the caller.
+	config = bytes.Replace(config, []byte(`"uid": 0, "gid": 0`), []byte(`"uid": 1000, "gid": 1000`), 1)
+	if err := ioutil.WriteFile(path.Join(bundle, "config.json"), config, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lof.NewHostedProgram(HostedProgramSpec{Path: bundle, Uid: 1001, Gid: 1000}); err == nil {
+		t.Error("Accepted an OCI process user other than the caller")
+	}
+	if _, err := lof.NewHostedProgram(HostedProgramSpec{Path: bundle, Uid: 1000, Gid: 1000}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestKVMCustomBootChainSubprin(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("/tmp", "test_kvm_custom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	for _, f := range []string{"kernel", "initram", "disk0", "disk1"} {
+		if err := ioutil.WriteFile(path.Join(tmpdir, f), []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	subprin := func(cfg VmConfig, opts ...string) auth.SubPrin {
+		factory := NewLinuxKVMCustomFactory(&cfg)
+		spec := HostedProgramSpec{
+			Id:            1,
+			ContainerArgs: append([]string{"kvm_custom:img"}, opts...),
+			Args:          []string{path.Join(tmpdir, "kernel"), path.Join(tmpdir, "initram"), "2222"},
+		}
+		child, err := factory.NewHostedProgram(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return child.Subprin()
+	}
+
+	disk0 := path.Join(tmpdir, "disk0")
+	disk1 := path.Join(tmpdir, "disk1")
+	base := subprin(VmConfig{Memory: 1024}, "-append", "console=ttyS0", "-drive", disk0)
+	if len(base) != 4 || base[1].Name != "Cmdline" || base[2].Name != "Disk" || base[3].Name != "VMConfig" {
+		t.Fatalf("Unexpected subprincipal %v", base)
+	}
+	h := sha256.Sum256([]byte("disk0"))
+	if !base[2].Identical(FormatDiskSubprin(0, h[:])[0]) {
+		t.Errorf("Disk measured as %v, want hash of image", base[2])
+	}
+
+	// Each component changes only its own part of the subprincipal.
+	changed := []struct {
+		sp   auth.SubPrin
+		part int
+	}{
+		{subprin(VmConfig{Memory: 1024}, "-append", "console=ttyS1", "-drive", disk0), 1},
+		{subprin(VmConfig{Memory: 1024}, "-append", "console=ttyS0", "-drive", disk1), 2},
+		{subprin(VmConfig{Memory: 2048}, "-append", "console=ttyS0", "-drive", disk0), 3},
+		{subprin(VmConfig{Memory: 1024, SMP: 2}, "-append", "console=ttyS0", "-drive", disk0), 3},
+		{subprin(VmConfig{Memory: 1024, Machine: "q35"}, "-append", "console=ttyS0", "-drive", disk0), 3},
+	}
+	for i, c := range changed {
+		for j := range base {
+			if c.sp[j].Identical(base[j]) == (j == c.part) {
+				t.Errorf("Change %d: part %d is %v, base is %v", i, j, c.sp[j], base[j])
+			}
+		}
+	}
+
+	verity := subprin(VmConfig{Memory: 1024}, "-append", "console=ttyS0", "-drive", disk0+",verity=0123abcd")
+	if !verity[2].Identical(FormatVerityDiskSubprin(0, []byte{0x01, 0x23, 0xab, 0xcd})[0]) {
+		t.Errorf("Verity disk measured as %v", verity[2])
+	}
+
+	factory := NewLinuxKVMCustomFactory(&VmConfig{})
+	for _, opts := range [][]string{{"-append"}, {"-bogus", "x"}, {"-drive", disk0 + ",verity=xyz"}} {
+		spec := HostedProgramSpec{
+			ContainerArgs: append([]string{"kvm_custom:img"}, opts...),
+			Args:          []string{path.Join(tmpdir, "kernel"), path.Join(tmpdir, "initram"), "2222"},
+		}
+		if _, err := factory.NewHostedProgram(spec); err == nil {
+			t.Errorf("Options %v were accepted", opts)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2016, Google Inc.  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tao
+
+import (
+	"net"
+
+	"github.com/golang/glog"
+	"github.com/jlmucb/cloudproxy/go/tao/auth"
+)
+
+// ListenTao returns a Tao listener for hosted programs that reach this host
+// over TLS, e.g. a LinuxHost inside a VM without virtio-serial, for use with
+// ServeTao. The host attests to a fresh TLS key for the listener. Hosted
+// programs must present an attestation for a principal that guard, normally
+// the domain guard, authorizes to Execute. They connect with DialTLSRPC.
+func (lh *LinuxHost) ListenTao(network, addr string, guard Guard, v *Verifier) (net.Listener, error) {
+	return lh.listenAttested(network, addr, "Tao LinuxHost", guard, v, ListenOptions{
+		OnReject: func(addr net.Addr, err error) {
+			glog.Errorf("Rejected remote hosted program from %s: %s", addr, err)
+		},
+	})
+}
+
+// ServeTao accepts connections on sock, which must come from ListenTao, and
+// serves Tao RPC requests on each as for a hosted program named by the key it
+// presented in the Tao handshake, see FormatRemoteKeySubprin. It returns when
+// sock is closed.
+func (lh *LinuxHost) ServeTao(sock net.Listener) error {
+	if l, ok := sock.(*listener); !ok || l.opts.Anonymous {
+		return newError("remote hosted programs require a Tao listener")
+	}
+
+	for {
+		conn, err := sock.Accept()
+		if err != nil {
+			return err
+		}
+		go func(conn *Conn) {
+			key, err := FromX509(conn.ConnectionState().PeerCertificates[0])
+			if err != nil {
+				glog.Errorf("Rejected remote hosted program from %s: %s", conn.RemoteAddr(), err)
+				conn.Close()
+				return
+			}
+			child := &LinuxHostChild{
+				channel:      conn,
+				ChildSubprin: FormatRemoteKeySubprin(key),
+			}
+			glog.Infof("Serving remote hosted program from %s\n  subprincipal: %s", conn.RemoteAddr(), child.ChildSubprin)
+			if err := NewLinuxHostTaoServer(lh, child).Serve(conn); err != nil {
+				glog.Errorf("Error serving remote hosted program %s: %s", child.ChildSubprin, err)
+				conn.Close()
+			}
+		}(conn.(*Conn))
+	}
+}
+
+// FormatRemoteKeySubprin produces the subprincipal for a hosted program that
+// reaches its host over TLS with an attested key.
+func FormatRemoteKeySubprin(key *Verifier) auth.SubPrin {
+	return auth.SubPrin{auth.PrinExt{Name: "RemoteKey", Arg: []auth.Term{key.ToPrincipal().KeyHash}}}
+}
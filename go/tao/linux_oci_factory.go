@@ -0,0 +1,491 @@
+// Copyright (c) 2014, Google Inc.  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tao
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/jlmucb/cloudproxy/go/tao/auth"
+	"github.com/jlmucb/cloudproxy/go/util"
+)
+
+// ociSpec is the subset of an OCI runtime-spec config.json that is supported
+// for hosted programs. Fields not listed here are ignored, but they are still
+// covered by the measurement of the config.
+type ociSpec struct {
+	OCIVersion string `json:"ociVersion"`
+	Process    struct {
+		Terminal bool `json:"terminal"`
+		User     struct {
+			UID            uint32   `json:"uid"`
+			GID            uint32   `json:"gid"`
+			AdditionalGids []uint32 `json:"additionalGids"`
+		} `json:"user"`
+		Args []string `json:"args"`
+		Env  []string `json:"env"`
+		Cwd  string   `json:"cwd"`
+	} `json:"process"`
+	Root struct {
+		Path     string `json:"path"`
+		Readonly bool   `json:"readonly"`
+	} `json:"root"`
+	Hostname string     `json:"hostname"`
+	Mounts   []ociMount `json:"mounts"`
+	Linux    struct {
+		UIDMappings []ociIDMapping `json:"uidMappings"`
+		GIDMappings []ociIDMapping `json:"gidMappings"`
+		Namespaces  []struct {
+			Type string `json:"type"`
+			Path string `json:"path"`
+		} `json:"namespaces"`
+	} `json:"linux"`
+}
+
+type ociMount struct {
+	Destination string   `json:"destination"`
+	Type        string   `json:"type"`
+	Source      string   `json:"source"`
+	Options     []string `json:"options"`
+}
+
+type ociIDMapping struct {
+	ContainerID uint32 `json:"containerID"`
+	HostID      uint32 `json:"hostID"`
+	Size        uint32 `json:"size"`
+}
+
+// hasNamespace checks whether the bundle asks for a new namespace of the given
+// type, e.g. "mount" or "user".
+func (s *ociSpec) hasNamespace(t string) bool {
+	for _, ns := range s.Linux.Namespaces {
+		if ns.Type == t {
+			return true
+		}
+	}
+	return false
+}
+
+// ociInitConfig is passed from the host to the container init process, which
+// sets up the container and then execs the bundle process.
+type ociInitConfig struct {
+	Spec   *ociSpec
+	Bundle string
+	Rootfs string
+	Args   []string
+	Env    []string
+}
+
+// A LinuxOCIFactory supports methods for creating hosted programs from OCI
+// runtime bundles. Each hosted program is launched directly by the host in
+// its own Linux namespaces, without any container daemon. LinuxOCIFactory
+// implements HostedProgramFactory.
+type LinuxOCIFactory struct{}
+
+// NewLinuxOCIFactory returns a new HostedProgramFactory that can create
+// hosted programs from OCI bundles.
+func NewLinuxOCIFactory() HostedProgramFactory {
+	return &LinuxOCIFactory{}
+}
+
+// An OCIContainer represents a hosted program running from an OCI bundle.
+type OCIContainer struct {
+
+	// The spec from which this container was created.
+	spec HostedProgramSpec
+
+	// The bundle directory and the parsed config.json.
+	Bundle string
+	Config *ociSpec
+
+	// Hash of config.json, exactly as measured.
+	ConfigHash []byte
+
+	// Merkle hash of the root filesystem, see MeasureRootfs.
+	RootfsHash []byte
+
+	// The underlying init process, which becomes the bundle process.
+	Cmd exec.Cmd
+
+	// A channel to be signaled when the container is done.
+	Done chan bool
+}
+
+// NewHostedProgram initializes, but does not start, a hosted OCI container.
+// The spec.Path is the bundle directory, holding config.json and the root
+// filesystem. Since the root filesystem is used in place, the bundle should
+// not be writable by anyone other than the host.
+func (lof *LinuxOCIFactory) NewHostedProgram(spec HostedProgramSpec) (child HostedProgram, err error) {
+	if spec.Measure != nil || spec.Script != nil {
+		err = fmt.Errorf("measured configuration and scripts are not supported for OCI bundles")
+		return
+	}
+	if len(spec.ContainerArgs) > 1 {
+		err = fmt.Errorf("Too many container arguments for OCI bundle")
+		return
+	}
+	bundle, err := filepath.Abs(spec.Path)
+	if err != nil {
+		return
+	}
+
+	// The config is kept in memory, so we run what we measured.
+	b, err := ioutil.ReadFile(path.Join(bundle, "config.json"))
+	if err != nil {
+		return
+	}
+	config := new(ociSpec)
+	if err = json.Unmarshal(b, config); err != nil {
+		err = newError("bad OCI config in %s: %s", bundle, err)
+		return
+	}
+	if err = checkOCISpec(config, spec); err != nil {
+		return
+	}
+	configHash := sha256.Sum256(b)
+
+	rootfsHash, err := MeasureRootfs(ociRootfs(bundle, config))
+	if err != nil {
+		return
+	}
+
+	child = &OCIContainer{
+		spec:       spec,
+		Bundle:     bundle,
+		Config:     config,
+		ConfigHash: configHash[:],
+		RootfsHash: rootfsHash,
+		Done:       make(chan bool, 1),
+	}
+	return
+}
+
+// checkOCISpec rejects bundle configurations that can't be honored.
+func checkOCISpec(config *ociSpec, spec HostedProgramSpec) error {
+	if len(config.Process.Args) == 0 {
+		return newError("OCI config has no process args")
+	}
+	if config.Root.Path == "" {
+		return newError("OCI config has no root path")
+	}
+	if config.Process.Terminal {
+		return newError("OCI terminals are not supported")
+	}
+	for _, ns := range config.Linux.Namespaces {
+		switch ns.Type {
+		case "pid", "network", "mount", "ipc", "uts", "user", "cgroup":
+		default:
+			return newError("unknown OCI namespace type %s", ns.Type)
+		}
+		if ns.Path != "" {
+			return newError("joining existing namespaces is not supported")
+		}
+	}
+	user := config.hasNamespace("user")
+	if !user && (len(config.Linux.UIDMappings) > 0 || len(config.Linux.GIDMappings) > 0) {
+		return newError("OCI uid and gid mappings need a user namespace")
+	}
+	if !config.hasNamespace("mount") && len(config.Mounts) > 0 {
+		return newError("OCI mounts need a mount namespace")
+	}
+	if config.Hostname != "" && !config.hasNamespace("uts") {
+		return newError("OCI hostname needs a uts namespace")
+	}
+	// Without a user namespace, the process runs as the given host user, which
+	// must be the caller's user unless Superuser is set.
+	if !user && (config.Process.User.UID == 0 || config.Process.User.GID == 0) && !spec.Superuser {
+		return newError("OCI process user and group must be nonzero unless Superuser is set")
+	}
+	if !user && !spec.Superuser {
+		u := config.Process.User
+		if int(u.UID) != spec.Uid || int(u.GID) != spec.Gid || len(u.AdditionalGids) > 0 {
+			return newError("OCI process user %d:%d must be the caller's user %d:%d, with no additional groups, unless Superuser is set",
+				u.UID, u.GID, spec.Uid, spec.Gid)
+		}
+	}
+	// In a user namespace, the process runs as the host users that its ids
+	// map to, which likewise must be the caller's unless Superuser is set.
+	if !spec.Superuser {
+		if err := checkOCIIDMappings("uid", config.Linux.UIDMappings, spec.Uid); err != nil {
+			return err
+		}
+		if err := checkOCIIDMappings("gid", config.Linux.GIDMappings, spec.Gid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkOCIIDMappings makes sure that each mapping maps only to the host id
+// owner, and not to root.
+func checkOCIIDMappings(kind string, mappings []ociIDMapping, owner int) error {
+	for _, m := range mappings {
+		if owner == 0 || int(m.HostID) != owner || m.Size != 1 {
+			return newError("OCI %s mapping to host ids %d-%d needs Superuser", kind,
+				m.HostID, uint64(m.HostID)+uint64(m.Size)-1)
+		}
+	}
+	return nil
+}
+
+// ociRootfs returns the absolute path of the root filesystem of a bundle.
+func ociRootfs(bundle string, config *ociSpec) string {
+	if path.IsAbs(config.Root.Path) {
+		return config.Root.Path
+	}
+	return path.Join(bundle, config.Root.Path)
+}
+
+// MeasureRootfs computes a Merkle hash of a directory tree. Each regular file
+// is hashed, each symlink is represented by its target, and each directory is
+// hashed over its entries in name order. Every entry also covers its name,
+// mode bits, including setuid and setgid, and owner, so a change anywhere in
+// the tree changes the root hash.
+func MeasureRootfs(dir string) ([]byte, error) {
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, newError("%s is not a directory", dir)
+	}
+	return measureTree(dir, fi)
+}
+
+func measureTree(p string, fi os.FileInfo) ([]byte, error) {
+	switch {
+	case fi.Mode().IsRegular():
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return nil, err
+		}
+		return h.Sum(nil), nil
+	case fi.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(p)
+		if err != nil {
+			return nil, err
+		}
+		h := sha256.New()
+		writeMeasured(h, target)
+		return h.Sum(nil), nil
+	case fi.IsDir():
+		entries, err := ioutil.ReadDir(p)
+		if err != nil {
+			return nil, err
+		}
+		sort.Sort(byName(entries))
+		h := sha256.New()
+		for _, e := range entries {
+			eh, err := measureTree(path.Join(p, e.Name()), e)
+			if err != nil {
+				return nil, err
+			}
+			writeMeasured(h, e.Name())
+			writeMeasured(h, e.Mode().String())
+			if st, ok := e.Sys().(*syscall.Stat_t); ok {
+				writeMeasured(h, fmt.Sprintf("%d:%d", st.Uid, st.Gid))
+			}
+			writeMeasured(h, string(eh))
+		}
+		return h.Sum(nil), nil
+	default:
+		// Devices, fifos and sockets have no contents. Their entry in the
+		// parent directory covers their type and mode.
+		return sha256.New().Sum(nil), nil
+	}
+}
+
+type byName []os.FileInfo
+
+func (s byName) Len() int           { return len(s) }
+func (s byName) Less(i, j int) bool { return s[i].Name() < s[j].Name() }
+func (s byName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// Spec returns the specification used to start the hosted container.
+func (oc *OCIContainer) Spec() HostedProgramSpec {
+	return oc.spec
+}
+
+// Subprin returns the subprincipal representing the hosted container.
+func (oc *OCIContainer) Subprin() auth.SubPrin {
+	return FormatOCISubprin(oc.spec.Id, oc.ConfigHash, oc.RootfsHash)
+}
+
+// FormatOCISubprin produces a subprincipal with the given ID, config hash and
+// root filesystem hash, e.g. OCI(1, [...], [...]).
+func FormatOCISubprin(id uint, configHash, rootfsHash []byte) auth.SubPrin {
+	var args []auth.Term
+	if id != 0 {
+		args = append(args, auth.Int(id))
+	}
+	args = append(args, auth.Bytes(configHash), auth.Bytes(rootfsHash))
+	return auth.SubPrin{auth.PrinExt{Name: "OCI", Arg: args}}
+}
+
+// Start starts the hosted container and returns a tao channel to it. The host
+// re-executes itself as the container init process in new namespaces, which
+// sets up mounts and the root filesystem and then execs the bundle process.
+// The tao channel is a pair of pipes on fds 3 and 4, as for hosted processes.
+func (oc *OCIContainer) Start() (channel io.ReadWriteCloser, err error) {
+	serverRead, clientWrite, err := os.Pipe()
+	if err != nil {
+		return
+	}
+	defer clientWrite.Close()
+	clientRead, serverWrite, err := os.Pipe()
+	if err != nil {
+		serverRead.Close()
+		return
+	}
+	defer clientRead.Close()
+	channel = util.NewPairReadWriteCloser(serverRead, serverWrite)
+	defer func() {
+		if err != nil {
+			channel.Close()
+			channel = nil
+		}
+	}()
+
+	// The init process reads its configuration from one pipe, and reports
+	// setup errors on another, which is closed on a successful exec.
+	configRead, configWrite, err := os.Pipe()
+	if err != nil {
+		return
+	}
+	defer configRead.Close()
+	defer configWrite.Close()
+	errRead, errWrite, err := os.Pipe()
+	if err != nil {
+		return
+	}
+	defer errRead.Close()
+	defer errWrite.Close()
+
+	env := []string{}
+	for _, pair := range oc.Config.Process.Env {
+		if !strings.HasPrefix(pair, HostSpecEnvVar+"=") && !strings.HasPrefix(pair, HostChannelTypeEnvVar+"=") {
+			env = append(env, pair)
+		}
+	}
+	env = append(env, HostSpecEnvVar+"=tao::RPC+tao::FDMessageChannel(3, 4)",
+		HostChannelTypeEnvVar+"=pipe")
+	init := &ociInitConfig{
+		Spec:   oc.Config,
+		Bundle: oc.Bundle,
+		Rootfs: ociRootfs(oc.Bundle, oc.Config),
+		Args:   append(append([]string{}, oc.Config.Process.Args...), oc.spec.Args...),
+		Env:    env,
+	}
+
+	spa, err := ociSysProcAttr(oc.Config)
+	if err != nil {
+		return
+	}
+	oc.Cmd = exec.Cmd{
+		Path:   "/proc/self/exe",
+		Args:   []string{ociInitArgv0},
+		Stdin:  oc.spec.Stdin,
+		Stdout: oc.spec.Stdout,
+		Stderr: oc.spec.Stderr,
+		Env:    []string{},
+		// Note: fds 3 and 4 are the tao channel, 5 and 6 are for init.
+		ExtraFiles:  []*os.File{clientRead, clientWrite, configRead, errWrite},
+		SysProcAttr: spa,
+	}
+	if err = oc.Cmd.Start(); err != nil {
+		return
+	}
+	errWrite.Close()
+
+	// Reap the child when the process dies.
+	sc := make(chan os.Signal, 1)
+	signal.Notify(sc, syscall.SIGCHLD)
+	go func() {
+		<-sc
+		oc.Cmd.Wait()
+		signal.Stop(sc)
+		oc.Done <- true
+		close(oc.Done) // prevent any more blocking
+	}()
+
+	if err = json.NewEncoder(configWrite).Encode(init); err != nil {
+		oc.Cmd.Process.Kill()
+		return
+	}
+	configWrite.Close()
+	msg, _ := ioutil.ReadAll(errRead)
+	if len(msg) > 0 {
+		oc.Cmd.Process.Kill()
+		err = newError("couldn't start OCI container: %s", string(msg))
+		return
+	}
+	return
+}
+
+// ExitStatus returns an exit code for the container.
+func (oc *OCIContainer) ExitStatus() (int, error) {
+	s := oc.Cmd.ProcessState
+	if s == nil {
+		return 0, fmt.Errorf("Child has not exited")
+	}
+	if code, ok := (*s).Sys().(syscall.WaitStatus); ok {
+		return int(code), nil
+	}
+	return 0, fmt.Errorf("Couldn't get exit status\n")
+}
+
+// WaitChan returns a chan that will be signaled when the hosted container is
+// done.
+func (oc *OCIContainer) WaitChan() <-chan bool {
+	return oc.Done
+}
+
+// Kill kills the container process. In a new pid namespace, this kills all
+// processes in the container.
+func (oc *OCIContainer) Kill() error {
+	return oc.Cmd.Process.Kill()
+}
+
+// Stop tries to send SIGTERM to the container process.
+func (oc *OCIContainer) Stop() error {
+	err := syscall.Kill(oc.Cmd.Process.Pid, syscall.SIGTERM)
+	syscall.Kill(oc.Cmd.Process.Pid, syscall.SIGCONT)
+	return err
+}
+
+// Pid returns the host pid of the container process.
+func (oc *OCIContainer) Pid() int {
+	return oc.Cmd.Process.Pid
+}
+
+func (oc *OCIContainer) Cleanup() error {
+	return nil
+}
@@ -0,0 +1,26 @@
+// Copyright (c) 2014, Google Inc.  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tao
+
+import (
+	"syscall"
+)
+
+const ociInitArgv0 = "cloudproxy-oci-init"
+
+// ociSysProcAttr fails, since OCI containers need Linux namespaces.
+func ociSysProcAttr(config *ociSpec) (*syscall.SysProcAttr, error) {
+	return nil, newError("OCI containers are only supported on Linux")
+}
@@ -0,0 +1,306 @@
+// Copyright (c) 2014, Google Inc.  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tao
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"syscall"
+)
+
+// ociInitArgv0 is the argv[0] with which the host re-executes itself as the
+// init process of an OCI container.
+const ociInitArgv0 = "cloudproxy-oci-init"
+
+// The fds on which the container init process gets its configuration and
+// reports setup errors.
+const (
+	ociInitConfigFd = 5
+	ociInitErrorFd  = 6
+)
+
+func init() {
+	if len(os.Args) > 0 && os.Args[0] == ociInitArgv0 {
+		ociInit()
+	}
+}
+
+var ociNamespaceFlags = map[string]uintptr{
+	"pid":     syscall.CLONE_NEWPID,
+	"network": syscall.CLONE_NEWNET,
+	"mount":   syscall.CLONE_NEWNS,
+	"ipc":     syscall.CLONE_NEWIPC,
+	"uts":     syscall.CLONE_NEWUTS,
+	"user":    syscall.CLONE_NEWUSER,
+	"cgroup":  0x02000000, // CLONE_NEWCGROUP
+}
+
+// ociSysProcAttr returns the attributes with which to create the container
+// init process: its namespaces and, for a user namespace, its id mappings.
+func ociSysProcAttr(config *ociSpec) (*syscall.SysProcAttr, error) {
+	spa := &syscall.SysProcAttr{
+		Setpgid: true, // As for hosted processes.
+	}
+	for _, ns := range config.Linux.Namespaces {
+		spa.Cloneflags |= ociNamespaceFlags[ns.Type]
+	}
+	for _, m := range config.Linux.UIDMappings {
+		spa.UidMappings = append(spa.UidMappings, syscall.SysProcIDMap{
+			ContainerID: int(m.ContainerID), HostID: int(m.HostID), Size: int(m.Size)})
+	}
+	for _, m := range config.Linux.GIDMappings {
+		spa.GidMappings = append(spa.GidMappings, syscall.SysProcIDMap{
+			ContainerID: int(m.ContainerID), HostID: int(m.HostID), Size: int(m.Size)})
+	}
+	if config.hasNamespace("user") {
+		// Init must be root within the user namespace, so that it keeps its
+		// capabilities there when it re-executes the host binary.
+		spa.Credential = &syscall.Credential{Uid: 0, Gid: 0, NoSetGroups: true}
+	}
+	return spa, nil
+}
+
+// ociInit runs as the container init process. It never returns: it either
+// execs the bundle process or reports an error to the host and exits.
+func ociInit() {
+	runtime.LockOSThread()
+	errPipe := os.NewFile(ociInitErrorFd, "error")
+	syscall.CloseOnExec(ociInitErrorFd)
+	if err := ociInitContainer(); err != nil {
+		fmt.Fprintf(errPipe, "%s", err)
+		os.Exit(1)
+	}
+}
+
+func ociInitContainer() error {
+	configPipe := os.NewFile(ociInitConfigFd, "config")
+	var ic ociInitConfig
+	err := json.NewDecoder(configPipe).Decode(&ic)
+	configPipe.Close()
+	if err != nil {
+		return err
+	}
+	config := ic.Spec
+
+	if config.hasNamespace("mount") {
+		// Keep our mounts from propagating back to the host.
+		if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+			return fmt.Errorf("making / private: %s", err)
+		}
+		if err := syscall.Mount(ic.Rootfs, ic.Rootfs, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+			return fmt.Errorf("binding rootfs: %s", err)
+		}
+		for _, m := range config.Mounts {
+			if err := ociMountOne(ic.Bundle, ic.Rootfs, m); err != nil {
+				return err
+			}
+		}
+		if err := ociPivotRoot(ic.Rootfs); err != nil {
+			return err
+		}
+		if config.Root.Readonly {
+			flags := uintptr(syscall.MS_BIND | syscall.MS_REMOUNT | syscall.MS_RDONLY | syscall.MS_REC)
+			if err := syscall.Mount("", "/", "", flags, ""); err != nil {
+				return fmt.Errorf("making rootfs read-only: %s", err)
+			}
+		}
+	} else {
+		if err := syscall.Chroot(ic.Rootfs); err != nil {
+			return fmt.Errorf("chroot: %s", err)
+		}
+	}
+
+	if config.Hostname != "" {
+		if err := syscall.Sethostname([]byte(config.Hostname)); err != nil {
+			return fmt.Errorf("setting hostname: %s", err)
+		}
+	}
+
+	user := config.Process.User
+	gids := []int{}
+	for _, g := range user.AdditionalGids {
+		gids = append(gids, int(g))
+	}
+	if err := syscall.Setgroups(gids); err != nil && !config.hasNamespace("user") {
+		// In a user namespace, setgroups may be denied, but then the
+		// process also has no supplementary groups from the host.
+		return fmt.Errorf("setgroups: %s", err)
+	}
+	if err := syscall.Setgid(int(user.GID)); err != nil {
+		return fmt.Errorf("setgid: %s", err)
+	}
+	if err := syscall.Setuid(int(user.UID)); err != nil {
+		return fmt.Errorf("setuid: %s", err)
+	}
+
+	cwd := config.Process.Cwd
+	if cwd == "" {
+		cwd = "/"
+	}
+	if err := os.Chdir(cwd); err != nil {
+		return err
+	}
+	prog, err := lookPathEnv(ic.Args[0], ic.Env)
+	if err != nil {
+		return fmt.Errorf("executable %s not found", ic.Args[0])
+	}
+	if err := syscall.Exec(prog, ic.Args, ic.Env); err != nil {
+		return fmt.Errorf("exec %s: %s", prog, err)
+	}
+	return nil
+}
+
+var ociMountFlags = map[string]uintptr{
+	"ro":          syscall.MS_RDONLY,
+	"nosuid":      syscall.MS_NOSUID,
+	"nodev":       syscall.MS_NODEV,
+	"noexec":      syscall.MS_NOEXEC,
+	"sync":        syscall.MS_SYNCHRONOUS,
+	"remount":     syscall.MS_REMOUNT,
+	"noatime":     syscall.MS_NOATIME,
+	"nodiratime":  syscall.MS_NODIRATIME,
+	"strictatime": syscall.MS_STRICTATIME,
+	"relatime":    syscall.MS_RELATIME,
+	"bind":        syscall.MS_BIND,
+	"rbind":       syscall.MS_BIND | syscall.MS_REC,
+	"private":     syscall.MS_PRIVATE,
+	"rprivate":    syscall.MS_PRIVATE | syscall.MS_REC,
+	"slave":       syscall.MS_SLAVE,
+	"rslave":      syscall.MS_SLAVE | syscall.MS_REC,
+}
+
+// ociMountOne performs one of the mounts of an OCI config, below the rootfs.
+func ociMountOne(bundle, rootfs string, m ociMount) error {
+	if !path.IsAbs(m.Destination) {
+		return fmt.Errorf("mount destination %s is not absolute", m.Destination)
+	}
+	var flags uintptr
+	var data []string
+	for _, o := range m.Options {
+		if f, ok := ociMountFlags[o]; ok {
+			flags |= f
+		} else if o != "rw" && o != "suid" && o != "dev" && o != "exec" {
+			data = append(data, o)
+		}
+	}
+	source := m.Source
+	if m.Type == "bind" {
+		flags |= syscall.MS_BIND
+	}
+	if flags&syscall.MS_BIND != 0 && !path.IsAbs(source) {
+		source = path.Join(bundle, source)
+	}
+
+	// Bind mounts of files need a file to mount on. The destination is
+	// resolved within the rootfs without following symlinks, and the mount
+	// goes through the resulting fd, so the bundle can't redirect it out of
+	// the rootfs.
+	fi, err := os.Stat(source)
+	file := err == nil && flags&syscall.MS_BIND != 0 && !fi.IsDir()
+	fd, err := ociOpenInRootfs(rootfs, m.Destination, file)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+	dest := fmt.Sprintf("/proc/self/fd/%d", fd)
+
+	if err := syscall.Mount(source, dest, m.Type, flags, strings.Join(data, ",")); err != nil {
+		return fmt.Errorf("mounting %s: %s", m.Destination, err)
+	}
+	// Flags other than MS_REC are ignored for a new bind mount, so they need
+	// a remount.
+	if flags&syscall.MS_BIND != 0 && flags&^(syscall.MS_BIND|syscall.MS_REC) != 0 {
+		if err := syscall.Mount("", dest, "", flags|syscall.MS_REMOUNT, ""); err != nil {
+			return fmt.Errorf("remounting %s: %s", m.Destination, err)
+		}
+	}
+	return nil
+}
+
+// ociOPath is O_PATH, which package syscall doesn't define.
+const ociOPath = 0x200000
+
+// ociOpenInRootfs opens dest below rootfs one component at a time with
+// O_NOFOLLOW, so it fails on any symlink instead of leaving the rootfs.
+// Missing components are created as directories, except that the last one is
+// created as an empty file if file is set. It returns an O_PATH fd for dest.
+func ociOpenInRootfs(rootfs, dest string, file bool) (int, error) {
+	fd, err := syscall.Open(rootfs, ociOPath|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, fmt.Errorf("opening rootfs: %s", err)
+	}
+	// Cleaning an absolute path removes any "..", so each component is a
+	// name within its parent.
+	names := strings.Split(path.Clean(dest), "/")[1:]
+	for i, name := range names {
+		if name == "" {
+			continue
+		}
+		last := i == len(names)-1
+		flags := ociOPath | syscall.O_NOFOLLOW | syscall.O_CLOEXEC
+		if !last || !file {
+			flags |= syscall.O_DIRECTORY
+		}
+		next, err := syscall.Openat(fd, name, flags, 0)
+		if err == syscall.ENOENT {
+			if last && file {
+				var f int
+				f, err = syscall.Openat(fd, name, syscall.O_WRONLY|syscall.O_CREAT|syscall.O_EXCL|syscall.O_NOFOLLOW|syscall.O_CLOEXEC, 0644)
+				if err == nil {
+					syscall.Close(f)
+				}
+			} else {
+				err = syscall.Mkdirat(fd, name, 0755)
+			}
+			if err == nil || err == syscall.EEXIST {
+				next, err = syscall.Openat(fd, name, flags, 0)
+			}
+		}
+		syscall.Close(fd)
+		if err != nil {
+			return -1, fmt.Errorf("mount destination %s: %s: %s", dest, name, err)
+		}
+		fd = next
+	}
+	if file {
+		// With O_PATH and O_NOFOLLOW, a final symlink is opened itself.
+		var st syscall.Stat_t
+		if err := syscall.Fstat(fd, &st); err != nil || st.Mode&syscall.S_IFMT != syscall.S_IFREG {
+			syscall.Close(fd)
+			return -1, fmt.Errorf("mount destination %s is not a regular file", dest)
+		}
+	}
+	return fd, nil
+}
+
+// ociPivotRoot makes rootfs the root of our mount namespace, and detaches the
+// old root so nothing of the host filesystem remains visible.
+func ociPivotRoot(rootfs string) error {
+	if err := os.Chdir(rootfs); err != nil {
+		return err
+	}
+	// Pivot the old root onto the new one, then detach it from there.
+	if err := syscall.PivotRoot(".", "."); err != nil {
+		return fmt.Errorf("pivot_root: %s", err)
+	}
+	if err := syscall.Unmount(".", syscall.MNT_DETACH); err != nil {
+		return fmt.Errorf("unmounting old root: %s", err)
+	}
+	return os.Chdir("/")
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2014, Google Inc.  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tao
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"syscall"
+	"testing"
+)
+
+func TestOCIOpenInRootfs(t *testing.T) {
+	rootfs, err := ioutil.TempDir("/tmp", "test_oci_rootfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rootfs)
+	outside, err := ioutil.TempDir("/tmp", "test_oci_outside")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+	if err := os.Symlink(outside, path.Join(rootfs, "etc")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(path.Join(outside, "passwd"), path.Join(rootfs, "passwd")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Missing directories and files are created within the rootfs.
+	fd, err := ociOpenInRootfs(rootfs, "/run/lock", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	syscall.Close(fd)
+	if fi, err := os.Lstat(path.Join(rootfs, "run", "lock")); err != nil || !fi.IsDir() {
+		t.Errorf("Didn't create the mount directory: %v", err)
+	}
+	if fd, err = ociOpenInRootfs(rootfs, "/../run/resolv.conf", true); err != nil {
+		t.Fatal(err)
+	}
+	syscall.Close(fd)
+	if fi, err := os.Lstat(path.Join(rootfs, "run", "resolv.conf")); err != nil || !fi.Mode().IsRegular() {
+		t.Errorf("Didn't create the mount file: %v", err)
+	}
+
+	// Symlinks are refused rather than followed out of the rootfs.
+	for _, dest := range []string{"/etc", "/etc/shadow"} {
+		if fd, err := ociOpenInRootfs(rootfs, dest, false); err == nil {
+			syscall.Close(fd)
+			t.Errorf("Followed a symlink for %s", dest)
+		}
+	}
+	if fd, err := ociOpenInRootfs(rootfs, "/passwd", true); err == nil {
+		syscall.Close(fd)
+		t.Error("Followed a symlink for a file mount")
+	}
+	if names, _ := ioutil.ReadDir(outside); len(names) != 0 {
+		t.Errorf("Created %d files outside the rootfs", len(names))
+	}
+}
@@ -63,9 +63,21 @@ type HostedProcess struct {
 	// A temporary directory for storing the temporary executable.
 	Tempdir string
 
+	// The socket path for the "unix" channel type.
+	SocketPath string
+
 	// Hash of the executable.
 	Hash []byte
 
+	// Hash of the measured configuration, if any. See ConfigMeasurement.
+	ConfigHash []byte
+
+	// For interpreted programs, the interpreters that run the program,
+	// outermost first, and the hash of its dependencies, if any. See
+	// ScriptMeasurement.
+	Interpreters []ProcessInterpreter
+	DepsHash     []byte
+
 	// The underlying process.
 	Cmd exec.Cmd
 
@@ -129,14 +141,35 @@ func (lpf *LinuxProcessFactory) NewHostedProgram(spec HostedProgramSpec) (child
 
 	h := sha256.Sum256(b)
 
+	configHash, err := MeasureConfig(spec, os.Environ())
+	if err != nil {
+		return
+	}
+
+	var interpreters []ProcessInterpreter
+	var depsHash []byte
+	if spec.Script != nil {
+		if interpreters, err = resolveInterpreters(spec, b, tempdir); err != nil {
+			return
+		}
+		if len(spec.Script.Dependencies) > 0 {
+			if depsHash, err = measureDependencies(spec); err != nil {
+				return
+			}
+		}
+	}
+
 	child = &HostedProcess{
-		spec:     spec,
-		Argv0:    argv0,
-		Temppath: temppath,
-		Tempdir:  tempdir,
-		Hash:     h[:],
-		Factory:  lpf,
-		Done:     make(chan bool, 1),
+		spec:         spec,
+		Argv0:        argv0,
+		Temppath:     temppath,
+		Tempdir:      tempdir,
+		Hash:         h[:],
+		ConfigHash:   configHash,
+		Interpreters: interpreters,
+		DepsHash:     depsHash,
+		Factory:      lpf,
+		Done:         make(chan bool, 1),
 	}
 	return
 }
@@ -184,6 +217,7 @@ func (p *HostedProcess) Start() (channel io.ReadWriteCloser, err error) {
 			return
 		}
 		evar = HostSpecEnvVar + "=" + sockPath
+		p.SocketPath = sockPath
 	default:
 		err = fmt.Errorf("invalid channel type '%s'\n", p.Factory.channelType)
 		return
@@ -262,10 +296,16 @@ func (p *HostedProcess) Start() (channel io.ReadWriteCloser, err error) {
 		// Noctty: true, // Detach fd 0 from controlling terminal
 		// Ctty: 0, // Controlling TTY fd (Linux only)
 	}
+	prog := p.Temppath
 	argv := []string{p.Argv0}
+	if len(p.Interpreters) > 0 {
+		// Run the measured interpreter on the measured copy of the script,
+		// rather than letting the kernel find the interpreter again.
+		prog, argv = interpreterCommand(p.Interpreters, p.Temppath)
+	}
 	argv = append(argv, p.spec.Args...)
 	p.Cmd = exec.Cmd{
-		Path:        p.Temppath,
+		Path:        prog,
 		Dir:         wd,
 		Args:        argv,
 		Stdin:       p.spec.Stdin,
@@ -339,7 +379,22 @@ func (p *HostedProcess) Pid() int {
 
 // Subprin returns the subprincipal representing the hosted process.
 func (p *HostedProcess) Subprin() auth.SubPrin {
-	return FormatProcessSubprin(p.spec.Id, p.Hash)
+	var subprin auth.SubPrin
+	if len(p.Interpreters) > 0 {
+		for _, in := range p.Interpreters {
+			subprin = append(subprin, FormatInterpreterSubprin(in.Hash, in.Args)...)
+		}
+		subprin = append(subprin, FormatScriptSubprin(p.spec.Id, p.Hash)...)
+		if p.DepsHash != nil {
+			subprin = append(subprin, FormatDepsSubprin(p.DepsHash)...)
+		}
+	} else {
+		subprin = FormatProcessSubprin(p.spec.Id, p.Hash)
+	}
+	if p.ConfigHash != nil {
+		subprin = append(subprin, FormatConfigSubprin(p.ConfigHash)...)
+	}
+	return subprin
 }
 
 // FormatProcessSubprin produces a string that represents a subprincipal with
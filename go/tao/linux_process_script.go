@@ -0,0 +1,286 @@
+// Copyright (c) 2014, Google Inc.  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tao
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jlmucb/cloudproxy/go/tao/auth"
+)
+
+// maxInterpreterDepth is the number of nested interpreters that are followed,
+// the same limit Linux uses for #! scripts.
+const maxInterpreterDepth = 4
+
+// maxShebangLen is the number of bytes of a #! line that Linux reads.
+const maxShebangLen = 256
+
+// A ProcessInterpreter is an interpreter that runs a hosted process, as
+// determined by a ScriptMeasurement.
+type ProcessInterpreter struct {
+
+	// Path is the interpreter's file.
+	Path string
+
+	// Args are passed to the interpreter before the next interpreter or the
+	// script.
+	Args []string
+
+	// Hash is the hash of the interpreter's file.
+	Hash []byte
+
+	// Copy, if not empty, is a private copy of the file that was hashed, which
+	// is what actually runs.
+	Copy string
+}
+
+// FormatInterpreterSubprin produces the subprincipal extension that represents
+// an interpreter with the given hash and arguments.
+func FormatInterpreterSubprin(hash []byte, args []string) auth.SubPrin {
+	terms := []auth.Term{auth.Bytes(hash)}
+	for _, arg := range args {
+		terms = append(terms, auth.Str(arg))
+	}
+	return auth.SubPrin{auth.PrinExt{Name: "Interpreter", Arg: terms}}
+}
+
+// FormatScriptSubprin produces the subprincipal extension that represents a
+// script with the given ID and hash.
+func FormatScriptSubprin(id uint, hash []byte) auth.SubPrin {
+	var args []auth.Term
+	if id != 0 {
+		args = append(args, auth.Int(id))
+	}
+	args = append(args, auth.Bytes(hash))
+	return auth.SubPrin{auth.PrinExt{Name: "Script", Arg: args}}
+}
+
+// FormatDepsSubprin produces the subprincipal extension that represents the
+// dependencies of a script with the given hash.
+func FormatDepsSubprin(hash []byte) auth.SubPrin {
+	return auth.SubPrin{auth.PrinExt{Name: "Deps", Arg: []auth.Term{auth.Bytes(hash)}}}
+}
+
+// parseShebang returns the interpreter and argument named by the #! line of a
+// script, if it has one. Like Linux, everything after the interpreter is a
+// single argument.
+func parseShebang(b []byte) (string, []string, bool) {
+	if !bytes.HasPrefix(b, []byte("#!")) {
+		return "", nil, false
+	}
+	if len(b) > maxShebangLen {
+		b = b[:maxShebangLen]
+	}
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		b = b[:i]
+	}
+	line := strings.TrimSpace(string(b[2:]))
+	i := strings.IndexAny(line, " \t")
+	if i < 0 {
+		return line, nil, line != ""
+	}
+	arg := strings.TrimSpace(line[i:])
+	return line[:i], []string{arg}, true
+}
+
+// lookPathEnv finds an executable using $PATH from env or, if env is nil, from
+// our own environment.
+func lookPathEnv(name string, env []string) (string, error) {
+	if strings.Contains(name, "/") {
+		return name, nil
+	}
+	pathVar := os.Getenv("PATH")
+	if env != nil {
+		pathVar = ""
+		for _, pair := range env {
+			if strings.HasPrefix(pair, "PATH=") {
+				pathVar = pair[len("PATH="):]
+			}
+		}
+	}
+	for _, dir := range filepath.SplitList(pathVar) {
+		if dir == "" {
+			continue
+		}
+		p := path.Join(dir, name)
+		if fi, err := os.Stat(p); err == nil && fi.Mode().IsRegular() && fi.Mode()&0111 != 0 {
+			return p, nil
+		}
+	}
+	return "", newError("interpreter %s not found in $PATH", name)
+}
+
+// resolveInterpreters returns the chain of interpreters that run a script for
+// the hosted program in spec, outermost first, i.e. the one that is actually
+// executed comes first. Each interpreter is copied to tempdir as it is hashed,
+// so that the copy that runs is the one that was measured.
+func resolveInterpreters(spec HostedProgramSpec, script []byte, tempdir string) ([]ProcessInterpreter, error) {
+	sm, env := spec.Script, spec.Env
+	name, args := sm.Interpreter, sm.InterpreterArgs
+	explicit := name != ""
+	if !explicit {
+		var ok bool
+		if name, args, ok = parseShebang(script); !ok {
+			return nil, newError("script has no #! line and no interpreter was given")
+		}
+	}
+	var chain []ProcessInterpreter
+	for {
+		if len(chain) == maxInterpreterDepth {
+			return nil, newError("too many nested interpreters")
+		}
+		// Measure and run the program that env would run, not env itself.
+		if path.Base(name) == "env" && len(args) > 0 {
+			if strings.ContainsAny(args[0], " \t") || strings.HasPrefix(args[0], "-") {
+				return nil, newError("unsupported env arguments %q", args[0])
+			}
+			name, args, explicit = args[0], args[1:], true
+		}
+		if !path.IsAbs(name) {
+			if !explicit {
+				return nil, newError("interpreter %s is not an absolute path", name)
+			}
+			p, err := lookPathEnv(name, env)
+			if err != nil {
+				return nil, err
+			}
+			name = p
+		}
+		cp := path.Join(tempdir, "interpreter"+strconv.Itoa(len(chain)))
+		b, err := copyInterpreter(spec, name, cp)
+		if err != nil {
+			return nil, err
+		}
+		h := sha256.Sum256(b)
+		chain = append([]ProcessInterpreter{{Path: name, Args: args, Hash: h[:], Copy: cp}}, chain...)
+
+		// The interpreter may itself be a script.
+		var ok bool
+		if name, args, ok = parseShebang(b); !ok {
+			return chain, nil
+		}
+		explicit = false
+	}
+}
+
+// copyInterpreter copies an interpreter to a private file at cp, and returns
+// its contents. Interpreters are often symlinks, e.g. /usr/bin/python3, so the
+// link is resolved first, but the file it resolves to must pass the checks in
+// openMeasured.
+func copyInterpreter(spec HostedProgramSpec, name, cp string) ([]byte, error) {
+	resolved, err := filepath.EvalSymlinks(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := openMeasured(spec, resolved)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	out, err := os.OpenFile(cp, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0755)
+	if err != nil {
+		return nil, err
+	}
+	defer out.Close()
+	b, err := ioutil.ReadAll(io.TeeReader(io.LimitReader(f, maxMeasuredFileSize+1), out))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxMeasuredFileSize {
+		return nil, newError("can't measure %s: larger than %d bytes", name, maxMeasuredFileSize)
+	}
+	return b, out.Close()
+}
+
+// measureDependencies returns a hash of the files and directories a script for
+// the hosted program in spec depends on.
+func measureDependencies(spec HostedProgramSpec) ([]byte, error) {
+	deps, dir := spec.Script.Dependencies, spec.Dir
+	h := sha256.New()
+	writeMeasured(h, strconv.Itoa(len(deps)))
+	for _, dep := range deps {
+		p := dep
+		if !path.IsAbs(p) {
+			p = path.Join(dir, p)
+		}
+		writeMeasured(h, dep)
+		err := filepath.Walk(p, func(file string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(p, file)
+			if err != nil {
+				return err
+			}
+			writeMeasured(h, rel)
+			switch {
+			case fi.Mode().IsRegular():
+				b, err := readMeasured(spec, file)
+				if err != nil {
+					return err
+				}
+				fh := sha256.Sum256(b)
+				writeMeasured(h, "file")
+				writeMeasured(h, string(fh[:]))
+			case fi.Mode()&os.ModeSymlink != 0:
+				target, err := os.Readlink(file)
+				if err != nil {
+					return err
+				}
+				writeMeasured(h, "link")
+				writeMeasured(h, target)
+			case fi.IsDir():
+				writeMeasured(h, "dir")
+			default:
+				return newError("can't measure dependency %s", file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return h.Sum(nil), nil
+}
+
+// interpreterCommand returns the file to execute and the arguments before the
+// hosted program's own arguments, for running a script at scriptPath under
+// the given interpreters. This is the same as what Linux does for #! scripts,
+// except that the private copies of the interpreters are run, while argv[0]
+// keeps the interpreter's own path.
+func interpreterCommand(interpreters []ProcessInterpreter, scriptPath string) (string, []string) {
+	var argv []string
+	for i, in := range interpreters {
+		if i == 0 || in.Copy == "" {
+			argv = append(argv, in.Path)
+		} else {
+			argv = append(argv, in.Copy)
+		}
+		argv = append(argv, in.Args...)
+	}
+	argv = append(argv, scriptPath)
+	if interpreters[0].Copy != "" {
+		return interpreters[0].Copy, argv
+	}
+	return interpreters[0].Path, argv
+}
@@ -19,7 +19,10 @@ import (
 	"crypto/x509"
 	"errors"
 	"net"
+	"sync"
+	"time"
 
+	"github.com/golang/glog"
 	"github.com/jlmucb/cloudproxy/go/tao/auth"
 	"github.com/jlmucb/cloudproxy/go/util"
 )
@@ -29,87 +32,125 @@ import (
 // for the certificate of the client against its Guard. The guard in this
 // case should be the guard of the Tao domain. This listener allows connections
 // from any program that is authorized under the Tao to execute.
+//
+// The handshakes run in the background, one goroutine per connection, so a
+// slow or malicious peer doesn't hold up other peers. Accept returns only
+// connections that completed the handshake. Since the handshakes check the
+// guard concurrently, the guard must be safe for concurrent use, as
+// DatalogGuard is, and as ACLGuard is while no rules are being added.
 type listener struct {
 	gl         net.Listener
+	config     *tls.Config
 	guard      Guard
 	verifier   *Verifier
 	delegation *Attestation
+	opts       ListenOptions
+
+	start  sync.Once
+	conns  chan *Conn
+	failed chan struct{} // closed when gl fails or is closed
+	err    error         // the error from gl, set before failed is closed
 }
 
-// anonymousListener is like a listener, except it does not require its peer to
-// attest to its identity. This provides a one-way authenticated TLS channel for
-// anonymous clients to Tao-based services.
-type anonymousListener struct {
-	listener
+// DefaultHandshakeTimeout is how long a Tao listener gives a peer to complete
+// the TLS and Tao handshakes, unless ListenOptions says otherwise.
+const DefaultHandshakeTimeout = 10 * time.Second
+
+// ListenOptions controls how a Tao listener performs handshakes.
+type ListenOptions struct {
+	// Anonymous means the listener does not require its peer to attest to
+	// its identity. This provides a one-way authenticated TLS channel for
+	// anonymous clients to Tao-based services.
+	Anonymous bool
+
+	// HandshakeTimeout limits the time a peer has to complete the TLS and
+	// Tao handshakes. Zero means DefaultHandshakeTimeout.
+	HandshakeTimeout time.Duration
+
+	// OnReject, if not nil, is called for each peer whose handshake fails or
+	// times out, instead of logging it. It may be called from several
+	// goroutines at once.
+	OnReject func(addr net.Addr, err error)
+
+	// AttestedCert selects the attested certificate mode, in which the
+	// attestations travel in the TLS certificates and are checked during the
+	// TLS handshake. The listener's certificate must come from
+	// EncodeAttestedTLSCert, and peers must connect with DialWithOptions and
+	// DialOptions.AttestedCert.
+	AttestedCert bool
 }
 
 // Listen returns a new Tao-based net.Listener that uses the underlying
 // crypto/tls net.Listener and a Guard to check whether or not connections
 // are authorized.
 func Listen(network, laddr string, config *tls.Config, g Guard, v *Verifier, del *Attestation) (net.Listener, error) {
-	config.ClientAuth = tls.RequireAnyClientCert
-	inner, err := tls.Listen(network, laddr, config)
-	if err != nil {
-		return nil, err
-	}
-
-	return &listener{inner, g, v, del}, nil
+	return ListenWithOptions(network, laddr, config, g, v, del, ListenOptions{})
 }
 
 // ListenAnonymous returns a new Tao-based net.Listener that does not require
 // its peer to attest to its identity.
 func ListenAnonymous(network, laddr string, config *tls.Config, g Guard, v *Verifier, del *Attestation) (net.Listener, error) {
-	config.ClientAuth = tls.NoClientCert
-	inner, err := tls.Listen(network, laddr, config)
+	return ListenWithOptions(network, laddr, config, g, v, del, ListenOptions{Anonymous: true})
+}
+
+// ListenWithOptions is like Listen or, if opts.Anonymous is set,
+// ListenAnonymous, but with control over the handshakes.
+func ListenWithOptions(network, laddr string, config *tls.Config, g Guard, v *Verifier, del *Attestation, opts ListenOptions) (net.Listener, error) {
+	if opts.Anonymous {
+		config.ClientAuth = tls.NoClientCert
+	} else {
+		config.ClientAuth = tls.RequireAnyClientCert
+	}
+	if opts.HandshakeTimeout <= 0 {
+		opts.HandshakeTimeout = DefaultHandshakeTimeout
+	}
+	if len(config.Certificates) == 0 && config.GetCertificate == nil {
+		return nil, newError("a Tao listener requires a certificate in its TLS config")
+	}
+	inner, err := net.Listen(network, laddr)
 	if err != nil {
 		return nil, err
 	}
 
-	return &anonymousListener{listener{inner, g, v, del}}, nil
+	return &listener{
+		gl:         inner,
+		config:     config,
+		guard:      g,
+		verifier:   v,
+		delegation: del,
+		opts:       opts,
+		conns:      make(chan *Conn),
+		failed:     make(chan struct{}),
+	}, nil
 }
 
 // ValidatePeerAttestation checks a Attestation for a given Listener against
-// an X.509 certificate from a TLS channel.
+// an X.509 certificate from a TLS channel. If guard is a RevocationGuard, it
+// also checks each link of the attestation chain against the guard's
+// revocation checker.
 func ValidatePeerAttestation(a *Attestation, cert *x509.Certificate, guard Guard) error {
-	stmt, err := a.Validate()
-	if err != nil {
-		return err
-	}
-
-	// Insist that the message of the statement be a SpeaksFor and that the
-	// initial term be an auth.Prin of type key. Note that Validate has already
-	// checked the expirations and the times and the general well-formedness of
-	// the attestation.
-	sf, ok := stmt.Message.(auth.Speaksfor)
-	if !ok {
-		return errors.New("a peer attestation must have an auth.Speaksfor as a message")
-	}
-
-	// This key must contain the serialized X.509 certificate.
-	kprin, ok := sf.Delegate.(auth.Prin)
-	if !ok {
-		return errors.New("a peer attestation must have an auth.Prin as its delegate")
-	}
-
-	if kprin.Type != "key" {
-		return errors.New("a peer attestation must have an auth.Prin of type 'key' as its delegate")
-	}
+	_, err := validatePeerAttestation(a, cert, guard)
+	return err
+}
 
-	if _, ok := kprin.KeyHash.(auth.Bytes); !ok {
-		return errors.New("a peer attestation must have a KeyHash of type auth.Bytes")
+// validatePeerAttestation is like ValidatePeerAttestation, but also returns the
+// principal that delegated to the key in cert. It uses PeerAttestationCache to
+// avoid checking the signatures in an attestation it has seen recently.
+func validatePeerAttestation(a *Attestation, cert *x509.Certificate, guard Guard) (auth.Prin, error) {
+	va, err := PeerAttestationCache.validate(a)
+	if err != nil {
+		return auth.Prin{}, err
 	}
 
-	prin, ok := sf.Delegator.(auth.Prin)
-	if !ok {
-		return errors.New("a peer attestation must have an auth.Prin as its delegator")
+	// Revocations can come at any time, so they are checked even for a
+	// cached attestation.
+	if err := CheckChainRevocation(GuardRevocation(guard), a); err != nil {
+		return auth.Prin{}, err
 	}
 
 	// Ask the Tao Domain if this program is allowed to execute.
-	// TODO(tmroeder): the current implementation assumes that the Tao Guard is
-	// already able to check authorization of Execute for both programs. In
-	// general, this might not be true.
-	if !guard.IsAuthorized(prin, "Execute", nil) {
-		return errors.New("a principal delegator in a client attestation must be authorized to Execute")
+	if !PeerAttestationCache.authorize(va, guard) {
+		return auth.Prin{}, errors.New("a principal delegator in a client attestation must be authorized to Execute")
 	}
 
 	// The bytes of the delegate are the result of ToPrincipal on
@@ -117,22 +158,105 @@ func ValidatePeerAttestation(a *Attestation, cert *x509.Certificate, guard Guard
 	// in the certificate.
 	verifier, err := FromX509(cert)
 	if err != nil {
-		return err
+		return auth.Prin{}, err
 	}
-	if !verifier.ToPrincipal().Identical(kprin) {
-		return errors.New("a peer attestation must have an auth.Prin.KeyHash of type auth.Bytes where the bytes match the auth.Prin hash representation of the X.509 certificate")
+	if !verifier.ToPrincipal().Identical(va.delegate) {
+		return auth.Prin{}, errors.New("a peer attestation must have an auth.Prin.KeyHash of type auth.Bytes where the bytes match the auth.Prin hash representation of the X.509 certificate")
 	}
 
-	return nil
+	return va.delegator, nil
 }
 
-// Accept waits for a connect, accepts it using the underlying Conn and checks
-// the attestations and the statement.
+// Accept waits for a connection that has completed the Tao handshake, in
+// which the listener checked the attestations and the statement. The returned
+// connection is a *Conn, which exposes the authenticated principal of the
+// peer. Connections whose handshake fails are closed, and reported to
+// ListenOptions.OnReject, without waking Accept.
 func (l *listener) Accept() (net.Conn, error) {
-	c, err := l.gl.Accept()
-	if err != nil {
+	l.start.Do(func() { go l.serve() })
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.failed:
+		return nil, l.err
+	}
+}
+
+// serve accepts connections on the underlying listener and starts a handshake
+// for each one, until the underlying listener fails or is closed.
+func (l *listener) serve() {
+	for {
+		c, err := l.gl.Accept()
+		if err != nil {
+			l.err = err
+			close(l.failed)
+			return
+		}
+		go func() {
+			conn, err := l.timedHandshake(c)
+			if err != nil {
+				l.reject(c.RemoteAddr(), err)
+				return
+			}
+			select {
+			case l.conns <- conn:
+			case <-l.failed:
+				conn.Close()
+			}
+		}()
+	}
+}
+
+// timedHandshake performs the TLS and Tao handshakes on a newly accepted
+// connection within the listener's handshake timeout.
+func (l *listener) timedHandshake(c net.Conn) (*Conn, error) {
+	if err := c.SetDeadline(time.Now().Add(l.opts.HandshakeTimeout)); err != nil {
+		c.Close()
+		return nil, err
+	}
+	conn := &Conn{guard: l.guard}
+	config := l.config
+	if l.opts.AttestedCert && !l.opts.Anonymous {
+		config = config.Clone()
+		config.ClientAuth = tls.RequireAnyClientCert
+		config.VerifyPeerCertificate = verifyAttestedCert(l.guard, l.verifier, conn)
+	}
+	conn.Conn = tls.Server(c, config)
+	if err := l.handshake(conn); err != nil {
 		return nil, err
 	}
+	if err := c.SetDeadline(time.Time{}); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// reject reports a peer whose handshake failed.
+func (l *listener) reject(addr net.Addr, err error) {
+	if l.opts.OnReject != nil {
+		l.opts.OnReject(addr, err)
+	} else {
+		glog.Infof("Rejected Tao connection from %s: %s", addr, err)
+	}
+}
+
+// handshake performs the Tao handshake on a newly accepted connection and
+// records the authenticated peer in it. It closes the connection if the
+// handshake fails.
+func (l *listener) handshake(c *Conn) error {
+	if l.opts.AttestedCert {
+		// The peer's attestation, if any, is checked during the TLS
+		// handshake, see verifyAttestedCert.
+		if err := c.Handshake(); err != nil {
+			c.Close()
+			return err
+		}
+		return nil
+	}
+	if l.opts.Anonymous {
+		return l.anonymousHandshake(c)
+	}
 
 	// Tao handshake Protocol:
 	// 0. TLS handshake (executed automatically on first message)
@@ -144,35 +268,36 @@ func (l *listener) Accept() (net.Conn, error) {
 	var a Attestation
 	if err := ms.ReadMessage(&a); err != nil {
 		c.Close()
-		return nil, err
+		return err
 	}
 
-	if err := AddEndorsements(l.guard, &a, l.verifier); err != nil {
-		return nil, err
+	// The peer's endorsements apply only to this connection.
+	guard, endorsements, err := EndorsedGuard(l.guard, &a, l.verifier)
+	if err != nil {
+		c.Close()
+		return err
 	}
 
-	peerCert := c.(*tls.Conn).ConnectionState().PeerCertificates[0]
-	if err := ValidatePeerAttestation(&a, peerCert, l.guard); err != nil {
+	peerCert := c.ConnectionState().PeerCertificates[0]
+	prin, err := validatePeerAttestation(&a, peerCert, guard)
+	if err != nil {
 		c.Close()
-		return nil, err
+		return err
 	}
 
 	if _, err := ms.WriteMessage(l.delegation); err != nil {
 		c.Close()
-		return nil, err
+		return err
 	}
 
-	return c, nil
+	c.peer, c.attestation, c.endorsements, c.guard = prin, &a, endorsements, guard
+	return nil
 }
 
-// Accept waits for a connect, accepts it using the underlying Conn and checks
-// the attestations and the statement.
-func (l *anonymousListener) Accept() (net.Conn, error) {
-	c, err := l.gl.Accept()
-	if err != nil {
-		return nil, err
-	}
-
+// anonymousHandshake sends the listener's attestation on a newly accepted
+// connection, which has no authenticated peer. It closes the connection if
+// the handshake fails.
+func (l *listener) anonymousHandshake(c *Conn) error {
 	// One-way Tao handshake Protocol:
 	// 0. TLS handshake (executed automatically on first message)
 	// 1. Server -> Client: Tao delegation for X.509 certificate.
@@ -181,14 +306,15 @@ func (l *anonymousListener) Accept() (net.Conn, error) {
 
 	if _, err := ms.WriteMessage(l.delegation); err != nil {
 		c.Close()
-		return nil, err
+		return err
 	}
 
-	return c, nil
+	return nil
 }
 
 // Close closes the listener.
-// Any blocked Accept operations will be unblocked and return errors.
+// Any blocked Accept operations will be unblocked and return errors, and
+// connections that complete the handshake afterwards are closed.
 // This implementation passes the Close operation down to its inner listener.
 func (l *listener) Close() error {
 	return l.gl.Close()
@@ -19,10 +19,16 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"io"
+	"io/ioutil"
 	"net"
+	"net/http"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/golang/protobuf/proto"
+	"github.com/jlmucb/cloudproxy/go/tao/auth"
 	"github.com/jlmucb/cloudproxy/go/util"
 )
 
@@ -384,3 +390,346 @@ func TestInvalidRequest(t *testing.T) {
 
 	<-ch
 }
+
+// Test that both ends of a Tao handshake learn the principal of their peer.
+func TestTaoHandshakePeerPrincipal(t *testing.T) {
+	l, _, st := setUpListener(t, false)
+	defer l.Close()
+	peers := make(chan *Conn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			t.Errorf("couldn't accept a network connection: %s", err)
+			peers <- nil
+			return
+		}
+		peers <- c.(*Conn)
+	}()
+
+	cst, err := NewSoftTao("", nil)
+	if err != nil {
+		t.Fatalf("couldn't create a new SoftTao: %s", err)
+	}
+	ck, _ := newNetKeys(t, cst, "Net Test Client")
+	c, err := Dial("tcp", l.Addr().String(), LiberalGuard, st.(*SoftTao).GetVerifier(), ck)
+	if err != nil {
+		t.Fatalf("couldn't dial the server using Tao networking: %s", err)
+	}
+	defer c.Close()
+
+	serverName, _ := st.GetTaoName()
+	if !c.PeerPrincipal().Identical(serverName) {
+		t.Fatalf("the client saw server %v; want %v", c.PeerPrincipal(), serverName)
+	}
+	chain, err := c.PeerAttestationChain()
+	if err != nil || len(chain) != 1 || chain[0] != c.PeerAttestation() {
+		t.Fatalf("bad peer attestation chain %v: %v", chain, err)
+	}
+
+	sc := <-peers
+	if sc == nil {
+		t.FailNow()
+	}
+	defer sc.Close()
+	clientName, _ := cst.GetTaoName()
+	if !sc.PeerPrincipal().Identical(clientName) {
+		t.Fatalf("the server saw client %v; want %v", sc.PeerPrincipal(), clientName)
+	}
+	if !LiberalGuard.IsAuthorized(sc.PeerPrincipal(), "Read", nil) {
+		t.Fatal("the guard didn't authorize the peer principal")
+	}
+	if len(sc.PeerEndorsements()) != 0 {
+		t.Fatalf("the client sent no endorsements, but the server saw %d", len(sc.PeerEndorsements()))
+	}
+}
+
+// Test that a peer that stalls in the handshake doesn't hold up other peers,
+// and is rejected once the handshake times out.
+func TestListenerSlowPeer(t *testing.T) {
+	st, err := NewSoftTao("", nil)
+	if err != nil {
+		t.Fatalf("couldn't create a new SoftTao: %s", err)
+	}
+	verifier := st.(*SoftTao).GetVerifier()
+	keys, conf := newNetKeys(t, st, "Net Test")
+	rejects := make(chan error, 1)
+	opts := ListenOptions{
+		HandshakeTimeout: 500 * time.Millisecond,
+		OnReject:         func(addr net.Addr, err error) { rejects <- err },
+	}
+	l, err := ListenWithOptions("tcp", "127.0.0.1:0", conf, LiberalGuard, verifier, keys.Delegation, opts)
+	if err != nil {
+		t.Fatalf("couldn't set up a Tao listener: %s", err)
+	}
+	defer l.Close()
+
+	// This peer never starts the TLS handshake.
+	slow, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("couldn't connect to the listener: %s", err)
+	}
+	defer slow.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			t.Errorf("couldn't accept a network connection: %s", err)
+		}
+		accepted <- c
+	}()
+
+	ck, _ := newNetKeys(t, st, "Net Test")
+	c, err := Dial("tcp", l.Addr().String(), LiberalGuard, verifier, ck)
+	if err != nil {
+		t.Fatalf("couldn't dial the server using Tao networking: %s", err)
+	}
+	defer c.Close()
+
+	select {
+	case sc := <-accepted:
+		if sc == nil {
+			t.FailNow()
+		}
+		sc.Close()
+	case err := <-rejects:
+		t.Fatalf("a peer was rejected before the good peer was accepted: %s", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the slow peer held up the good peer")
+	}
+
+	select {
+	case err := <-rejects:
+		if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+			t.Fatalf("the slow peer was rejected with %v; want a timeout", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the slow peer was not rejected")
+	}
+}
+
+// Test that endorsements a peer presents apply to its connection only, and
+// never change the listener's guard.
+func TestTaoHandshakeEndorsementsScoped(t *testing.T) {
+	policy, err := NewTemporaryKeys(Signing)
+	if err != nil {
+		t.Fatalf("couldn't create a policy key: %s", err)
+	}
+	st, err := NewSoftTao("", nil)
+	if err != nil {
+		t.Fatalf("couldn't create a new SoftTao: %s", err)
+	}
+	keys, conf := newNetKeys(t, st, "Net Test")
+	guard := NewACLGuard(nil, ACLGuardDetails{})
+	l, err := Listen("tcp", "127.0.0.1:0", conf, guard, policy.VerifyingKey, keys.Delegation)
+	if err != nil {
+		t.Fatalf("couldn't set up a Tao listener: %s", err)
+	}
+	defer l.Close()
+	peers := make(chan *Conn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			peers <- nil
+			return
+		}
+		peers <- c.(*Conn)
+	}()
+
+	// The policy key endorses this client to Execute.
+	cst, err := NewSoftTao("", nil)
+	if err != nil {
+		t.Fatalf("couldn't create a new SoftTao: %s", err)
+	}
+	clientName, _ := cst.GetTaoName()
+	ck, _ := newNetKeys(t, cst, "Net Test Client")
+	e := auth.Says{
+		Speaker: policy.SigningKey.ToPrincipal(),
+		Message: auth.Pred{Name: "Authorized", Arg: []auth.Term{clientName, auth.Str("Execute")}},
+	}
+	ea, err := GenerateAttestation(policy.SigningKey, nil, e)
+	if err != nil {
+		t.Fatalf("couldn't attest to the endorsement: %s", err)
+	}
+	eab, err := proto.Marshal(ea)
+	if err != nil {
+		t.Fatalf("couldn't marshal the endorsement: %s", err)
+	}
+	ck.Delegation.SerializedEndorsements = [][]byte{eab}
+
+	c, err := Dial("tcp", l.Addr().String(), LiberalGuard, nil, ck)
+	if err != nil {
+		t.Fatalf("couldn't dial the server with an endorsement: %s", err)
+	}
+	defer c.Close()
+	sc := <-peers
+	if sc == nil {
+		t.Fatal("the server didn't accept the endorsed client")
+	}
+	if len(sc.PeerEndorsements()) != 1 {
+		t.Fatalf("the server saw %d endorsements; want 1", len(sc.PeerEndorsements()))
+	}
+	if !sc.Guard().IsAuthorized(clientName, "Execute", nil) {
+		t.Fatal("the connection's guard doesn't hold the endorsement")
+	}
+	if guard.RuleCount() != 0 || guard.IsAuthorized(clientName, "Execute", nil) {
+		t.Fatal("the endorsement changed the listener's guard")
+	}
+	sc.Close()
+	if sc.Guard() != nil {
+		t.Fatal("the endorsement outlived the connection")
+	}
+
+	// An endorsement signed by another key is refused.
+	other, err := NewTemporaryKeys(Signing)
+	if err != nil {
+		t.Fatalf("couldn't create a key: %s", err)
+	}
+	e.Speaker = other.SigningKey.ToPrincipal()
+	ea, err = GenerateAttestation(other.SigningKey, nil, e)
+	if err != nil {
+		t.Fatalf("couldn't attest to the endorsement: %s", err)
+	}
+	if eab, err = proto.Marshal(ea); err != nil {
+		t.Fatalf("couldn't marshal the endorsement: %s", err)
+	}
+	if _, _, err := EndorsedGuard(guard, &Attestation{SerializedEndorsements: [][]byte{eab}}, policy.VerifyingKey); err == nil {
+		t.Fatal("an endorsement by another key was admitted")
+	}
+
+	// A guard that can't be copied is refused rather than replaced.
+	if _, err := newGuardOverlay(&CachedGuard{}); err == nil {
+		t.Fatal("an empty cached guard was overlaid")
+	}
+}
+
+// Test the attested certificate mode of the Tao handshake, in which the
+// attestations are checked during the TLS handshake.
+func TestTaoHandshakeAttestedCert(t *testing.T) {
+	st, err := NewSoftTao("", nil)
+	if err != nil {
+		t.Fatalf("couldn't create a new SoftTao: %s", err)
+	}
+	verifier := st.(*SoftTao).GetVerifier()
+	keys, conf := newNetKeys(t, st, "Net Test")
+	tlsc, err := EncodeAttestedTLSCert(keys)
+	if err != nil {
+		t.Fatalf("couldn't encode an attested TLS cert: %s", err)
+	}
+	conf.Certificates = []tls.Certificate{*tlsc}
+	rejects := make(chan error, 2)
+	opts := ListenOptions{
+		AttestedCert: true,
+		OnReject:     func(addr net.Addr, err error) { rejects <- err },
+	}
+	l, err := ListenWithOptions("tcp", "127.0.0.1:0", conf, LiberalGuard, verifier, keys.Delegation, opts)
+	if err != nil {
+		t.Fatalf("couldn't set up a Tao listener: %s", err)
+	}
+	defer l.Close()
+	ch := make(chan bool)
+	count := 16
+	go runListener(t, l, count, ch)
+
+	cst, err := NewSoftTao("", nil)
+	if err != nil {
+		t.Fatalf("couldn't create a new SoftTao: %s", err)
+	}
+	ck, _ := newNetKeys(t, cst, "Net Test Client")
+
+	// A key can't present another key's delegation.
+	other, _ := newNetKeys(t, cst, "Net Test Client")
+	other.Delegation = ck.Delegation
+	if c, err := DialWithOptions("tcp", l.Addr().String(), LiberalGuard, verifier, other, DialOptions{AttestedCert: true}); err == nil {
+		// The client may finish its side of the handshake first.
+		if _, err := c.Read(make([]byte, 1)); err == nil {
+			t.Fatal("a relayed delegation was accepted")
+		}
+		c.Close()
+	}
+	if err := <-rejects; err == nil {
+		t.Fatal("the relayed delegation was not rejected")
+	}
+
+	c, err := DialWithOptions("tcp", l.Addr().String(), LiberalGuard, verifier, ck, DialOptions{AttestedCert: true})
+	if err != nil {
+		t.Fatalf("couldn't dial the server using attested certificates: %s", err)
+	}
+	defer c.Close()
+	serverName, _ := st.GetTaoName()
+	if !c.PeerPrincipal().Identical(serverName) {
+		t.Fatalf("the client saw server %v; want %v", c.PeerPrincipal(), serverName)
+	}
+
+	b := make([]byte, count)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatalf("couldn't read bytes to send to the server: %s", err)
+	}
+	if _, err := c.Write(b); err != nil {
+		t.Fatalf("couldn't send the bytes to the server: %s", err)
+	}
+	if res := getMessage(t, c, count); !bytes.Equal(res, b) {
+		t.Fatal("the received bytes didn't match the original bytes")
+	}
+	<-ch
+}
+
+// Test an HTTP server and client over Tao connections, with authorization of
+// each request.
+func TestHTTPOverTao(t *testing.T) {
+	st, err := NewSoftTao("", nil)
+	if err != nil {
+		t.Fatalf("couldn't create a new SoftTao: %s", err)
+	}
+	verifier := st.(*SoftTao).GetVerifier()
+	keys, conf := newNetKeys(t, st, "Net Test")
+	l, err := Listen("tcp", "127.0.0.1:0", conf, LiberalGuard, verifier, keys.Delegation)
+	if err != nil {
+		t.Fatalf("couldn't set up a Tao listener: %s", err)
+	}
+
+	cst, err := NewSoftTao("", nil)
+	if err != nil {
+		t.Fatalf("couldn't create a new SoftTao: %s", err)
+	}
+	clientName, _ := cst.GetTaoName()
+	ck, _ := newNetKeys(t, cst, "Net Test Client")
+
+	guard := NewACLGuard(nil, ACLGuardDetails{})
+	if err := guard.Authorize(clientName, "GET", []string{"/allowed"}); err != nil {
+		t.Fatalf("couldn't authorize the client: %s", err)
+	}
+	srv := NewHTTPServer(AuthorizeHTTP(guard, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer, _ := PeerPrincipalFromContext(r.Context())
+		io.WriteString(w, peer.String())
+	})))
+	go srv.Serve(l)
+	defer srv.Close()
+
+	client := &http.Client{Transport: NewHTTPTransport(LiberalGuard, verifier, ck, DialOptions{})}
+	resp, err := client.Get("https://" + l.Addr().String() + "/allowed")
+	if err != nil {
+		t.Fatalf("couldn't make an HTTP request over a Tao connection: %s", err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("couldn't read the response: %s", err)
+	}
+	if resp.StatusCode != http.StatusOK || string(body) != clientName.String() {
+		t.Fatalf("got response %d %q; want 200 %q", resp.StatusCode, body, clientName)
+	}
+
+	resp, err = client.Get("https://" + l.Addr().String() + "/denied")
+	if err != nil {
+		t.Fatalf("couldn't make an HTTP request over a Tao connection: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("an unauthorized request got status %d; want %d", resp.StatusCode, http.StatusForbidden)
+	}
+
+	if _, err := client.Get("http://" + l.Addr().String() + "/allowed"); err == nil {
+		t.Fatal("the client made a plain http request")
+	}
+}
@@ -0,0 +1,242 @@
+// Copyright (c) 2016, Google Inc.  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tao
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/jlmucb/cloudproxy/go/tao/auth"
+)
+
+// ReferenceManifestSigningContext is the context used to sign a
+// ReferenceManifest.
+const ReferenceManifestSigningContext = "tao.ReferenceManifest Version 1"
+
+// ReferenceManifestListSigningContext is the context used to sign a
+// ReferenceManifestList.
+const ReferenceManifestListSigningContext = "tao.ReferenceManifestList Version 1"
+
+// referenceManifestFileMode is the file mode for a saved ReferenceManifest or
+// ReferenceManifestList. Manifests hold only public reference values.
+const referenceManifestFileMode = 0644
+
+// NewReferenceValue returns a reference value for a component that hosts name
+// with subprin, e.g. tao.FormatProcessSubprin(0, hash) for a program binary
+// with the given hash.
+func NewReferenceValue(name, version string, hash []byte, subprin auth.SubPrin) *ReferenceValue {
+	v := &ReferenceValue{
+		Name:         proto.String(name),
+		Subprincipal: proto.String(subprin.String()),
+		Sha256:       hash,
+	}
+	if version != "" {
+		v.Version = proto.String(version)
+	}
+	return v
+}
+
+// SubPrin parses the subprincipal of the reference value.
+func (v *ReferenceValue) SubPrin() (auth.SubPrin, error) {
+	var subprin auth.SubPrin
+	if _, err := fmt.Sscanf(v.GetSubprincipal(), "%v", &subprin); err != nil {
+		return nil, newError("tao: bad subprincipal %q for reference value %s: %s",
+			v.GetSubprincipal(), v.GetName(), err)
+	}
+	if len(subprin) == 0 {
+		return nil, newError("tao: empty subprincipal for reference value %s", v.GetName())
+	}
+	return subprin, nil
+}
+
+// check makes sure the manifest is named and that each of its values has a
+// subprincipal that carries the value's hash, if it has one. Otherwise a value
+// could name one binary by its hash but trust the subprincipal of another.
+func (m *ReferenceManifest) check() error {
+	if m.GetName() == "" || m.GetVersion() == "" {
+		return errors.New("a reference manifest must have a name and a version")
+	}
+	for _, v := range m.Values {
+		subprin, err := v.SubPrin()
+		if err != nil {
+			return err
+		}
+		if v.Sha256 != nil && !subprinHasHash(subprin, v.Sha256) {
+			return newError("tao: the subprincipal of reference value %s doesn't carry its hash", v.GetName())
+		}
+	}
+	return nil
+}
+
+// subprinHasHash checks whether one of the extensions of subprin has hash as an
+// argument, e.g. the program hash in Program(1, [...]).
+func subprinHasHash(subprin auth.SubPrin, hash []byte) bool {
+	for _, e := range subprin {
+		for _, arg := range e.Arg {
+			if b, ok := arg.(auth.Bytes); ok && bytes.Equal(b, hash) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Sign serializes and signs the manifest.
+func (m *ReferenceManifest) Sign(signer *Signer) (*SignedReferenceManifest, error) {
+	if err := m.check(); err != nil {
+		return nil, err
+	}
+	ser, err := proto.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := signer.Sign(ser, ReferenceManifestSigningContext)
+	if err != nil {
+		return nil, err
+	}
+	return &SignedReferenceManifest{SerializedManifest: ser, Signature: sig}, nil
+}
+
+// Save writes the manifest to a file, signed by signer.
+func (m *ReferenceManifest) Save(signer *Signer, path string) error {
+	srm, err := m.Sign(signer)
+	if err != nil {
+		return err
+	}
+	b, err := proto.Marshal(srm)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, referenceManifestFileMode)
+}
+
+// VerifyReferenceManifest checks that key signed a manifest and returns the
+// manifest.
+func VerifyReferenceManifest(key *Verifier, srm *SignedReferenceManifest) (*ReferenceManifest, error) {
+	ok, err := key.Verify(srm.SerializedManifest, ReferenceManifestSigningContext, srm.Signature)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("the signature on the reference manifest didn't pass verification")
+	}
+	var m ReferenceManifest
+	if err := proto.Unmarshal(srm.SerializedManifest, &m); err != nil {
+		return nil, err
+	}
+	if err := m.check(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// LoadReferenceManifest reads a manifest saved with Save, and checks that key
+// signed it.
+func LoadReferenceManifest(key *Verifier, path string) (*ReferenceManifest, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var srm SignedReferenceManifest
+	if err := proto.Unmarshal(b, &srm); err != nil {
+		return nil, err
+	}
+	return VerifyReferenceManifest(key, &srm)
+}
+
+// ReferenceValueRule returns the policy rule that trusts the subprincipal of a
+// reference value, e.g. TrustedProgramHash(ext.Program([...])) for the
+// predicate TrustedProgramHash.
+func ReferenceValueRule(predicate string, v *ReferenceValue) (string, error) {
+	subprin, err := v.SubPrin()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprint(auth.MakePredicate(predicate, auth.PrinTail{Ext: subprin})), nil
+}
+
+// referenceManifestRules returns the distinct rules for the values of a
+// manifest, see ReferenceValueRule.
+func referenceManifestRules(predicate string, m *ReferenceManifest) ([]string, error) {
+	var rules []string
+	seen := make(map[string]bool)
+	for _, v := range m.Values {
+		rule, err := ReferenceValueRule(predicate, v)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[rule] {
+			seen[rule] = true
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+// guardHasRule checks whether rule is one of the rules of a guard.
+func guardHasRule(guard Guard, rule string) bool {
+	for i := 0; i < guard.RuleCount(); i++ {
+		if guard.GetRule(i) == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// saveReferenceManifestList writes a list of imported manifests to a file,
+// signed by signer.
+func saveReferenceManifestList(signer *Signer, path string, ms []*ImportedReferenceManifest) error {
+	ser, err := proto.Marshal(&ReferenceManifestList{Manifests: ms})
+	if err != nil {
+		return err
+	}
+	sig, err := signer.Sign(ser, ReferenceManifestListSigningContext)
+	if err != nil {
+		return err
+	}
+	b, err := proto.Marshal(&SignedReferenceManifestList{SerializedList: ser, Signature: sig})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, referenceManifestFileMode)
+}
+
+// loadReferenceManifestList reads a list saved with
+// saveReferenceManifestList, and checks that key signed it.
+func loadReferenceManifestList(key *Verifier, path string) ([]*ImportedReferenceManifest, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var srml SignedReferenceManifestList
+	if err := proto.Unmarshal(b, &srml); err != nil {
+		return nil, err
+	}
+	ok, err := key.Verify(srml.SerializedList, ReferenceManifestListSigningContext, srml.Signature)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("the signature on the reference manifest list didn't pass verification")
+	}
+	var rml ReferenceManifestList
+	if err := proto.Unmarshal(srml.SerializedList, &rml); err != nil {
+		return nil, err
+	}
+	return rml.Manifests, nil
+}
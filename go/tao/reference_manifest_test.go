@@ -0,0 +1,80 @@
+// Copyright (c) 2016, Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tao
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+)
+
+func TestReferenceManifestSaveLoad(t *testing.T) {
+	build, err := NewTemporaryKeys(Signing)
+	if err != nil {
+		t.Fatalf("couldn't create a build key: %s", err)
+	}
+	dir, err := ioutil.TempDir("", "reference_manifest_test")
+	if err != nil {
+		t.Fatalf("couldn't create a temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	p := path.Join(dir, "manifest")
+
+	hash := []byte{1, 2, 3}
+	subprin := FormatProcessSubprin(0, hash)
+	m := &ReferenceManifest{
+		Name:    proto.String("release"),
+		Version: proto.String("1.0"),
+		Values:  []*ReferenceValue{NewReferenceValue("demo_server", "1.0", hash, subprin)},
+	}
+	if err := m.Save(build.SigningKey, p); err != nil {
+		t.Fatalf("couldn't save the manifest: %s", err)
+	}
+	loaded, err := LoadReferenceManifest(build.VerifyingKey, p)
+	if err != nil {
+		t.Fatalf("couldn't load the manifest: %s", err)
+	}
+	if len(loaded.Values) != 1 {
+		t.Fatalf("loaded %d reference values, want 1", len(loaded.Values))
+	}
+	loadedSubprin, err := loaded.Values[0].SubPrin()
+	if err != nil {
+		t.Fatalf("couldn't parse the subprincipal: %s", err)
+	}
+	if !loadedSubprin.Identical(subprin) {
+		t.Fatalf("loaded subprincipal %s, want %s", loadedSubprin, subprin)
+	}
+
+	other, err := NewTemporaryKeys(Signing)
+	if err != nil {
+		t.Fatalf("couldn't create a signing key: %s", err)
+	}
+	if _, err := LoadReferenceManifest(other.VerifyingKey, p); err == nil {
+		t.Fatal("a manifest with the wrong signature was loaded")
+	}
+
+	m.Values[0].Subprincipal = proto.String("not a subprincipal")
+	if err := m.Save(build.SigningKey, p); err == nil {
+		t.Fatal("a manifest with a bad subprincipal was saved")
+	}
+
+	m.Values[0].Subprincipal = proto.String(FormatProcessSubprin(0, []byte{4, 5, 6}).String())
+	if err := m.Save(build.SigningKey, p); err == nil {
+		t.Fatal("a manifest with a subprincipal for another hash was saved")
+	}
+}
@@ -0,0 +1,357 @@
+// Copyright (c) 2016, Google Inc.  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tao
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/jlmucb/cloudproxy/go/tao/auth"
+)
+
+// RevocationListSigningContext is the context used to sign a RevocationList.
+const RevocationListSigningContext = "tao.RevocationList Version 1"
+
+// revocationListFileMode is the file mode for a saved RevocationList.
+const revocationListFileMode = 0600
+
+// A RevocationChecker decides whether one link of an attestation chain has been
+// revoked.
+type RevocationChecker interface {
+	// CheckRevocation returns an error if a involves a revoked key or
+	// certificate. It doesn't check the delegation in a, which is a separate
+	// link of the chain.
+	CheckRevocation(a *Attestation) error
+}
+
+// A RevocationGuard is a guard that also holds the revocation checker for its
+// domain. ValidatePeerAttestation, and so Dial and Listen, consult it about
+// every link of a peer's attestation chain. LoadDomain installs the domain's
+// revocation list on the domain's guard; a program can install another
+// checker, e.g. a RevocationCheckers that adds a CRLChecker.
+type RevocationGuard interface {
+	Guard
+
+	// Revocation returns the checker installed on the guard, or nil.
+	Revocation() RevocationChecker
+
+	// SetRevocation installs a checker on the guard. A nil checker turns
+	// revocation checking off.
+	SetRevocation(rc RevocationChecker)
+}
+
+// GuardRevocation returns the checker installed on guard, or nil if there is
+// none or guard isn't a RevocationGuard.
+func GuardRevocation(guard Guard) RevocationChecker {
+	if rg, ok := guard.(RevocationGuard); ok {
+		return rg.Revocation()
+	}
+	return nil
+}
+
+// RevocationCheckers is a RevocationChecker that consults each checker in a
+// list in turn.
+type RevocationCheckers []RevocationChecker
+
+// CheckRevocation returns the first error from a checker in the list.
+func (rcs RevocationCheckers) CheckRevocation(a *Attestation) error {
+	for _, rc := range rcs {
+		if err := rc.CheckRevocation(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckChainRevocation consults rc about each link of the attestation chain
+// that starts with a. A nil rc accepts every chain.
+func CheckChainRevocation(rc RevocationChecker, a *Attestation) error {
+	if rc == nil {
+		return nil
+	}
+	for {
+		if err := rc.CheckRevocation(a); err != nil {
+			return err
+		}
+		if a.SerializedDelegation == nil {
+			return nil
+		}
+		var da Attestation
+		if err := proto.Unmarshal(a.SerializedDelegation, &da); err != nil {
+			return err
+		}
+		a = &da
+	}
+}
+
+// revocationSerialGuard is a guard whose signed policy records the serial of
+// the domain's revocation list, so LoadDomain can refuse an older list.
+type revocationSerialGuard interface {
+	revocationSerial() uint64
+	setRevocationSerial(serial uint64)
+}
+
+// RevokedPrincipals is a RevocationChecker for a list of revoked principals,
+// e.g. host or program keys or TPM AIKs, that the domain distributes with its
+// policy. A link is revoked if its signer, the speaker of its statement, or
+// the delegate or the delegator of a delegation in it is one of the
+// principals, or a subprincipal of one. Each change to the list increases its
+// serial, which is signed with it and recorded in the guard policy, so an
+// older list can be refused.
+type RevokedPrincipals struct {
+	m      sync.RWMutex
+	prins  []auth.Prin
+	serial uint64
+}
+
+// NewRevokedPrincipals returns a list holding the given principals.
+func NewRevokedPrincipals(prins ...auth.Prin) *RevokedPrincipals {
+	return &RevokedPrincipals{prins: prins}
+}
+
+// Add adds a principal to the list.
+func (r *RevokedPrincipals) Add(p auth.Prin) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.prins = append(r.prins, p)
+	r.serial++
+}
+
+// Serial returns the serial of the list.
+func (r *RevokedPrincipals) Serial() uint64 {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	return r.serial
+}
+
+// Update replaces the list with a newer one, e.g. one just loaded with
+// LoadRevokedPrincipals. A list with the same serial as the current one isn't
+// newer, since it may hold different principals.
+func (r *RevokedPrincipals) Update(newer *RevokedPrincipals) error {
+	prins, serial := newer.Principals(), newer.Serial()
+	r.m.Lock()
+	defer r.m.Unlock()
+	if serial <= r.serial {
+		return newError("tao: revocation list %d is not newer than the current list %d", serial, r.serial)
+	}
+	r.prins, r.serial = prins, serial
+	return nil
+}
+
+// Principals returns the principals in the list.
+func (r *RevokedPrincipals) Principals() []auth.Prin {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	return append([]auth.Prin(nil), r.prins...)
+}
+
+// IsRevoked checks whether p, or a principal that p is a subprincipal of, is
+// in the list.
+func (r *RevokedPrincipals) IsRevoked(p auth.Term) bool {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	for _, revoked := range r.prins {
+		if auth.SubprinOrIdentical(p, revoked) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckRevocation checks the principals named by a against the list.
+func (r *RevokedPrincipals) CheckRevocation(a *Attestation) error {
+	prins := []auth.Term{auth.NewPrin(a.GetSignerType(), a.SignerKey)}
+	f, err := auth.UnmarshalForm(a.SerializedStatement)
+	if err != nil {
+		return err
+	}
+	if ptr, ok := f.(*auth.Says); ok {
+		f = *ptr
+	}
+	if says, ok := f.(auth.Says); ok {
+		prins = append(prins, says.Speaker)
+		if ptr, ok := says.Message.(*auth.Speaksfor); ok {
+			prins = append(prins, ptr.Delegate, ptr.Delegator)
+		} else if sf, ok := says.Message.(auth.Speaksfor); ok {
+			prins = append(prins, sf.Delegate, sf.Delegator)
+		}
+	}
+	for _, p := range prins {
+		if r.IsRevoked(p) {
+			return newError("tao: attestation chain involves revoked principal %s", p)
+		}
+	}
+	return nil
+}
+
+// GetSignedRevocationList serializes and signs the list.
+func (r *RevokedPrincipals) GetSignedRevocationList(signer *Signer) (*SignedRevocationList, error) {
+	rl := RevocationList{Serial: proto.Uint64(r.Serial())}
+	for _, p := range r.Principals() {
+		rl.RevokedPrincipals = append(rl.RevokedPrincipals, auth.Marshal(p))
+	}
+	ser, err := proto.Marshal(&rl)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := signer.Sign(ser, RevocationListSigningContext)
+	if err != nil {
+		return nil, err
+	}
+	return &SignedRevocationList{SerializedList: ser, Signature: sig}, nil
+}
+
+// Save writes the list to a file, signed by signer.
+func (r *RevokedPrincipals) Save(signer *Signer, path string) error {
+	srl, err := r.GetSignedRevocationList(signer)
+	if err != nil {
+		return err
+	}
+	b, err := proto.Marshal(srl)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, revocationListFileMode)
+}
+
+// LoadRevokedPrincipals reads a list saved with Save, and checks that key
+// signed it.
+func LoadRevokedPrincipals(key *Verifier, path string) (*RevokedPrincipals, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var srl SignedRevocationList
+	if err := proto.Unmarshal(b, &srl); err != nil {
+		return nil, err
+	}
+	ok, err := key.Verify(srl.SerializedList, RevocationListSigningContext, srl.Signature)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("the signature on the revocation list didn't pass verification")
+	}
+	var rl RevocationList
+	if err := proto.Unmarshal(srl.SerializedList, &rl); err != nil {
+		return nil, err
+	}
+	r := NewRevokedPrincipals()
+	r.serial = rl.GetSerial()
+	for _, b := range rl.RevokedPrincipals {
+		p, err := auth.UnmarshalPrin(b)
+		if err != nil {
+			return nil, err
+		}
+		r.prins = append(r.prins, p)
+	}
+	return r, nil
+}
+
+// CRLChecker is a RevocationChecker for an X.509 certificate revocation list
+// from the domain service, see RequestCrl and RevokeCertificate in
+// support_infrastructure/domain_service. The certificates it checks are the
+// ones the policy key issued: program certificates from GenerateProgramCert,
+// which a TLS peer presents, see VerifyPeerCertificate, and the certificate for
+// the root of an attestation chain, i.e. for a soft Tao key or a TPM AIK or
+// quote key, see Attestation.RootEndorsement. A certificate is also revoked if
+// the CRL is out of date.
+type CRLChecker struct {
+	issuer *x509.Certificate
+
+	m       sync.RWMutex
+	crl     *pkix.CertificateList
+	revoked map[string]bool
+}
+
+// NewCRLChecker returns a checker for a CRL issued by the holder of issuer,
+// normally the policy key.
+func NewCRLChecker(issuer *x509.Certificate, crl *pkix.CertificateList) (*CRLChecker, error) {
+	c := &CRLChecker{issuer: issuer}
+	if err := c.Update(crl); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Update replaces the CRL with a newer one.
+func (c *CRLChecker) Update(crl *pkix.CertificateList) error {
+	if err := c.issuer.CheckCRLSignature(crl); err != nil {
+		return err
+	}
+	revoked := make(map[string]bool)
+	for _, rc := range crl.TBSCertList.RevokedCertificates {
+		revoked[rc.SerialNumber.String()] = true
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.crl != nil && crl.TBSCertList.ThisUpdate.Before(c.crl.TBSCertList.ThisUpdate) {
+		return errors.New("the CRL is older than the current one")
+	}
+	c.crl = crl
+	c.revoked = revoked
+	return nil
+}
+
+// CheckRevocation checks the certificate in a, if any, against the CRL.
+func (c *CRLChecker) CheckRevocation(a *Attestation) error {
+	if a.RootEndorsement == nil {
+		return nil
+	}
+	cert, err := x509.ParseCertificate(a.RootEndorsement)
+	if err != nil {
+		return err
+	}
+	return c.CheckCertificate(cert)
+}
+
+// CheckCertificate checks cert against the CRL, if the policy key issued it.
+func (c *CRLChecker) CheckCertificate(cert *x509.Certificate) error {
+	if !bytes.Equal(cert.RawIssuer, c.issuer.RawSubject) {
+		return nil
+	}
+
+	c.m.RLock()
+	defer c.m.RUnlock()
+	if c.crl.HasExpired(time.Now()) {
+		return errors.New("the CRL is out of date")
+	}
+	if c.revoked[cert.SerialNumber.String()] {
+		return newError("tao: certificate %s has been revoked", cert.SerialNumber)
+	}
+	return nil
+}
+
+// VerifyPeerCertificate checks the certificates a TLS peer presented against
+// the CRL. It can be used as tls.Config.VerifyPeerCertificate.
+func (c *CRLChecker) VerifyPeerCertificate(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	for _, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		if err := c.CheckCertificate(cert); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+// Copyright (c) 2016, Google Inc. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tao
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/jlmucb/cloudproxy/go/tao/auth"
+)
+
+// newTestChain returns a two-link attestation chain, in which the key root
+// delegates to an intermediate key that signs a delegation to a new key, and
+// the principals of the root and intermediate keys.
+func newTestChain(t *testing.T) (*Attestation, auth.Prin, auth.Prin) {
+	var keys [3]*Keys
+	for i := range keys {
+		k, err := NewTemporaryKeys(Signing)
+		if err != nil {
+			t.Fatalf("couldn't create a signing key: %s", err)
+		}
+		keys[i] = k
+	}
+	root := keys[0].SigningKey.ToPrincipal()
+	inter := keys[1].SigningKey.ToPrincipal()
+	d, err := GenerateAttestation(keys[0].SigningKey, nil, auth.Says{
+		Speaker: root,
+		Message: auth.Speaksfor{Delegate: inter, Delegator: root},
+	})
+	if err != nil {
+		t.Fatalf("couldn't generate a delegation: %s", err)
+	}
+	db, err := proto.Marshal(d)
+	if err != nil {
+		t.Fatalf("couldn't marshal the delegation: %s", err)
+	}
+	a, err := GenerateAttestation(keys[1].SigningKey, db, auth.Says{
+		Speaker: root,
+		Message: auth.Speaksfor{Delegate: keys[2].SigningKey.ToPrincipal(), Delegator: root},
+	})
+	if err != nil {
+		t.Fatalf("couldn't generate an attestation: %s", err)
+	}
+	return a, root, inter
+}
+
+func TestRevokedPrincipals(t *testing.T) {
+	a, root, inter := newTestChain(t)
+	if _, err := a.Validate(); err != nil {
+		t.Fatalf("couldn't validate an attestation chain: %s", err)
+	}
+
+	// Revoking the intermediate key revokes the chain.
+	if err := CheckChainRevocation(NewRevokedPrincipals(inter), a); err == nil {
+		t.Fatal("a chain with a revoked intermediate key was accepted")
+	}
+
+	// So does revoking a principal that a link speaks for.
+	if err := CheckChainRevocation(NewRevokedPrincipals(root), a); err == nil {
+		t.Fatal("a chain with a revoked root key was accepted")
+	}
+
+	other, err := NewTemporaryKeys(Signing)
+	if err != nil {
+		t.Fatalf("couldn't create a signing key: %s", err)
+	}
+	if err := CheckChainRevocation(NewRevokedPrincipals(other.SigningKey.ToPrincipal()), a); err != nil {
+		t.Fatalf("an unrevoked chain was rejected: %s", err)
+	}
+	if err := CheckChainRevocation(nil, a); err != nil {
+		t.Fatalf("a chain was rejected without a checker: %s", err)
+	}
+}
+
+func TestGuardRevocation(t *testing.T) {
+	signer, err := NewTemporaryKeys(Signing)
+	if err != nil {
+		t.Fatalf("couldn't create a signing key: %s", err)
+	}
+	delegate, err := NewTemporaryKeys(Signing)
+	if err != nil {
+		t.Fatalf("couldn't create a delegate key: %s", err)
+	}
+	prin := signer.SigningKey.ToPrincipal()
+	a, err := GenerateAttestation(signer.SigningKey, nil, auth.Says{
+		Speaker: prin,
+		Message: auth.Speaksfor{Delegate: delegate.SigningKey.ToPrincipal(), Delegator: prin},
+	})
+	if err != nil {
+		t.Fatalf("couldn't generate an attestation: %s", err)
+	}
+	cert, err := delegate.SigningKey.CreateSelfSignedX509(&pkix.Name{Organization: []string{"Peer"}})
+	if err != nil {
+		t.Fatalf("couldn't create a certificate: %s", err)
+	}
+
+	guard := NewACLGuard(nil, ACLGuardDetails{}).(*ACLGuard)
+	if err := guard.Authorize(prin, "Execute", nil); err != nil {
+		t.Fatalf("couldn't authorize the peer: %s", err)
+	}
+	if err := ValidatePeerAttestation(a, cert, guard); err != nil {
+		t.Fatalf("couldn't validate a peer attestation: %s", err)
+	}
+
+	// The guard's checker is consulted even once the attestation has been
+	// cached, and only by that guard.
+	other := NewACLGuard(nil, ACLGuardDetails{}).(*ACLGuard)
+	if err := other.Authorize(prin, "Execute", nil); err != nil {
+		t.Fatalf("couldn't authorize the peer: %s", err)
+	}
+	guard.SetRevocation(NewRevokedPrincipals(prin))
+	if err := ValidatePeerAttestation(a, cert, guard); err == nil {
+		t.Fatal("a revoked peer was accepted")
+	}
+	if err := ValidatePeerAttestation(a, cert, other); err != nil {
+		t.Fatalf("another guard rejected the peer: %s", err)
+	}
+}
+
+func TestRevokedPrincipalsSaveLoad(t *testing.T) {
+	policy, err := NewTemporaryKeys(Signing)
+	if err != nil {
+		t.Fatalf("couldn't create a policy key: %s", err)
+	}
+	dir, err := ioutil.TempDir("", "revocation_test")
+	if err != nil {
+		t.Fatalf("couldn't create a temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	p := path.Join(dir, "revocations")
+
+	_, root, inter := newTestChain(t)
+	r := NewRevokedPrincipals(root)
+	r.Add(inter)
+	if err := r.Save(policy.SigningKey, p); err != nil {
+		t.Fatalf("couldn't save the revocation list: %s", err)
+	}
+	loaded, err := LoadRevokedPrincipals(policy.VerifyingKey, p)
+	if err != nil {
+		t.Fatalf("couldn't load the revocation list: %s", err)
+	}
+	if !loaded.IsRevoked(root) || !loaded.IsRevoked(inter) || len(loaded.Principals()) != 2 {
+		t.Fatalf("loaded revocation list %v; want [%v %v]", loaded.Principals(), root, inter)
+	}
+	if loaded.Serial() != r.Serial() || r.Serial() == 0 {
+		t.Fatalf("loaded revocation list %d; want %d", loaded.Serial(), r.Serial())
+	}
+	if err := r.Update(NewRevokedPrincipals()); err == nil {
+		t.Fatal("a revocation list was replaced by an older one")
+	}
+	same := NewRevokedPrincipals()
+	same.serial = r.Serial()
+	if err := r.Update(same); err == nil {
+		t.Fatal("a revocation list was replaced by one with the same serial")
+	}
+	newer := NewRevokedPrincipals(root, inter)
+	newer.serial = r.Serial() + 1
+	if err := r.Update(newer); err != nil || r.Serial() != newer.Serial() {
+		t.Fatalf("a revocation list wasn't replaced by a newer one: %v", err)
+	}
+
+	other, err := NewTemporaryKeys(Signing)
+	if err != nil {
+		t.Fatalf("couldn't create a signing key: %s", err)
+	}
+	if _, err := LoadRevokedPrincipals(other.VerifyingKey, p); err == nil {
+		t.Fatal("a revocation list with the wrong signature was loaded")
+	}
+}
+
+func TestCRLChecker(t *testing.T) {
+	policy, err := NewTemporaryKeys(Signing)
+	if err != nil {
+		t.Fatalf("couldn't create a policy key: %s", err)
+	}
+	policyCert, err := policy.SigningKey.CreateSelfSignedX509(&pkix.Name{Organization: []string{"Policy"}})
+	if err != nil {
+		t.Fatalf("couldn't create a policy certificate: %s", err)
+	}
+	var as []*Attestation
+	for i := 0; i < 2; i++ {
+		a, _ := newTestDelegation(t, time.Hour)
+		v, err := UnmarshalKey(a.SignerKey)
+		if err != nil {
+			t.Fatalf("couldn't unmarshal the signer key: %s", err)
+		}
+		cert, err := policy.SigningKey.CreateSignedX509(policyCert, i+1, v, &pkix.Name{Organization: []string{"Host"}})
+		if err != nil {
+			t.Fatalf("couldn't create a host certificate: %s", err)
+		}
+		a.RootEndorsement = cert.Raw
+		as = append(as, a)
+	}
+
+	newCRL := func(now, expiry time.Time) *pkix.CertificateList {
+		revoked := []pkix.RevokedCertificate{{SerialNumber: big.NewInt(1), RevocationTime: now}}
+		der, err := policy.SigningKey.CreateCRL(policyCert, revoked, now, expiry)
+		if err != nil {
+			t.Fatalf("couldn't create a CRL: %s", err)
+		}
+		crl, err := x509.ParseCRL(der)
+		if err != nil {
+			t.Fatalf("couldn't parse the CRL: %s", err)
+		}
+		return crl
+	}
+	now := time.Now()
+	c, err := NewCRLChecker(policyCert, newCRL(now, now.Add(time.Hour)))
+	if err != nil {
+		t.Fatalf("couldn't create a CRL checker: %s", err)
+	}
+	if err := c.CheckRevocation(as[0]); err == nil {
+		t.Fatal("a revoked certificate was accepted")
+	}
+	if err := c.CheckRevocation(as[1]); err != nil {
+		t.Fatalf("an unrevoked certificate was rejected: %s", err)
+	}
+
+	if err := c.Update(newCRL(now.Add(-time.Hour), now.Add(time.Hour))); err == nil {
+		t.Fatal("an older CRL replaced a newer one")
+	}
+	c, err = NewCRLChecker(policyCert, newCRL(now.Add(-time.Hour), now.Add(-time.Minute)))
+	if err != nil {
+		t.Fatalf("couldn't create a CRL checker: %s", err)
+	}
+	if err := c.CheckRevocation(as[1]); err == nil {
+		t.Fatal("a certificate was accepted with an out-of-date CRL")
+	}
+}
@@ -92,6 +92,12 @@ func (t *RootHost) GetSharedSecret(tag string, n int) (bytes []byte, err error)
 // Attest requests the Tao host sign a statement on behalf of the caller.
 func (t *RootHost) Attest(childSubprin auth.SubPrin, issuer *auth.Prin,
 	time, expiration *int64, message auth.Form) (*Attestation, error) {
+	return t.AttestNonce(childSubprin, issuer, time, expiration, nil, message)
+}
+
+// AttestNonce is like Attest, but binds a nonce into the attestation.
+func (t *RootHost) AttestNonce(childSubprin auth.SubPrin, issuer *auth.Prin,
+	time, expiration *int64, nonce []byte, message auth.Form) (*Attestation, error) {
 
 	child := t.taoHostName.MakeSubprincipal(childSubprin)
 	if issuer != nil {
@@ -104,7 +110,7 @@ func (t *RootHost) Attest(childSubprin auth.SubPrin, issuer *auth.Prin,
 
 	stmt := auth.Says{Speaker: *issuer, Time: time, Expiration: expiration, Message: message}
 
-	att, err := GenerateAttestation(t.keys.SigningKey, nil /* delegation */, stmt)
+	att, err := GenerateNonceAttestation(t.keys.SigningKey, nil /* delegation */, nonce, stmt)
 	if err != nil {
 		return nil, err
 	}
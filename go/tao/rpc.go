@@ -18,11 +18,15 @@ package tao
 // extremely dull and, ideally, would be generated automatically.
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"io"
 	"math"
 	"net/rpc"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/jlmucb/cloudproxy/go/tao/auth"
@@ -30,10 +34,46 @@ import (
 	"github.com/jlmucb/cloudproxy/go/util/protorpc"
 )
 
-// RPC sends requests between this hosted program and the host Tao.
+// RPC sends requests between this hosted program and the host Tao. Requests
+// from concurrent goroutines are in flight at the same time. Each Tao method
+// has a variant taking a context, e.g. SealContext, which gives up when the
+// context is done and tells the host to discard the response. The host still
+// carries out the request, so a call that gives up may have taken effect,
+// e.g. a counter may have been incremented.
 type RPC struct {
-	rpc         *rpc.Client
+	rpc         rpcClient
 	serviceName string
+
+	// redial, if not nil, opens a new connection to the host Tao. It is used
+	// to reconnect when the host restarts and re-adopts this hosted program.
+	redial func() (rpcClient, error)
+	m      sync.Mutex
+
+	// timeout, if not zero, bounds the calls made without a context.
+	timeout time.Duration
+}
+
+// An rpcClient makes calls to the host Tao. It is implemented by
+// protorpc.Client and, for gob encoding, by netRPCClient.
+type rpcClient interface {
+	Call(ctx context.Context, serviceMethod string, args interface{}, reply interface{}) error
+	Close() error
+}
+
+// netRPCClient adds contexts to a net/rpc client. It can't cancel requests
+// on the server, but calls return when their context is done.
+type netRPCClient struct {
+	*rpc.Client
+}
+
+func (c netRPCClient) Call(ctx context.Context, serviceMethod string, args interface{}, reply interface{}) error {
+	call := c.Go(serviceMethod, args, reply, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+		return call.Error
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 // DeserializeRPC produces a RPC from a string.
@@ -51,7 +91,7 @@ func DeserializeRPC(s string) (*RPC, error) {
 		return nil, newError("taorpc: unrecognized $" + HostSpecEnvVar + " string " + s +
 			" (" + err.Error() + ")")
 	}
-	return &RPC{protorpc.NewClient(ms), "Tao"}, nil
+	return &RPC{rpc: protorpc.NewContextClient(ms), serviceName: "Tao"}, nil
 }
 
 // DeserializeFileRPC produces a RPC from a string representing a file.
@@ -69,30 +109,127 @@ func DeserializeFileRPC(s string) (*RPC, error) {
 		return nil, newError("taorpc: unrecognized $" + HostSpecEnvVar + " string " + s +
 			" (" + err.Error() + ")")
 	}
-	return &RPC{protorpc.NewClient(ms), "Tao"}, nil
+	return &RPC{rpc: protorpc.NewContextClient(ms), serviceName: "Tao"}, nil
 }
 
-// DeserializeUnixSocketRPC produces a RPC from a path string.
+// DeserializeUnixSocketRPC produces a RPC from a path string. If the
+// connection is lost, e.g. because the host restarted, the RPC reconnects to
+// the same path.
 func DeserializeUnixSocketRPC(p string) (*RPC, error) {
 	if p == "" {
 		return nil, newError("taorpc: missing host Tao spec" +
 			" (ensure $" + HostSpecEnvVar + " is set)")
 	}
 
-	ms, err := util.DeserializeUnixSocketMessageStream(p)
+	redial := func() (rpcClient, error) {
+		ms, err := util.DeserializeUnixSocketMessageStream(p)
+		if err != nil {
+			return nil, err
+		}
+		return protorpc.NewContextClient(ms), nil
+	}
+	c, err := redial()
+	if err != nil {
+		return nil, err
+	}
+
+	return &RPC{rpc: c, serviceName: "Tao", redial: redial}, nil
+}
+
+// DialTLSRPC produces a RPC over a Tao TLS connection to a host listening with
+// LinuxHost.ListenTao. The host must present an attestation that guard
+// authorizes to Execute, and the RPC presents keys, whose delegation the host
+// checks in the same way. The host names this hosted program by the key, see
+// FormatRemoteKeySubprin. If the connection is lost, the RPC reconnects.
+func DialTLSRPC(network, addr string, guard Guard, v *Verifier, keys *Keys) (*RPC, error) {
+	if keys == nil || keys.Delegation == nil {
+		return nil, newError("taorpc: tls channel requires keys with a delegation")
+	}
+
+	redial := func() (rpcClient, error) {
+		conn, err := Dial(network, addr, guard, v, keys)
+		if err != nil {
+			return nil, err
+		}
+		return protorpc.NewContextClient(conn), nil
+	}
+	c, err := redial()
+	if err != nil {
+		return nil, err
+	}
+
+	return &RPC{rpc: c, serviceName: "Tao", redial: redial}, nil
+}
+
+// DeserializeTLSRPC produces a RPC over TLS to the host at addr, see
+// DialTLSRPC. The host must be authorized by the guard of the domain with
+// configuration domainConfig, and the RPC presents the attested signing key
+// stored in plaintext in keysDir, along with its X.509 certificate.
+func DeserializeTLSRPC(addr, keysDir, domainConfig string) (*RPC, error) {
+	if addr == "" {
+		return nil, newError("taorpc: missing host Tao spec" +
+			" (ensure $" + HostSpecEnvVar + " is set)")
+	}
+	if keysDir == "" {
+		return nil, newError("taorpc: missing keys for tls channel" +
+			" (ensure $" + TaoTLSKeysEnvVar + " is set)")
+	}
+	if domainConfig == "" {
+		return nil, newError("taorpc: missing domain for tls channel" +
+			" (ensure $" + TaoDomainConfigEnvVar + " is set)")
+	}
+
+	domain, err := LoadDomain(domainConfig, nil)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := LoadKeys(Signing, nil, keysDir, "")
 	if err != nil {
 		return nil, err
 	}
+	if err := keys.loadCert(); err != nil {
+		return nil, err
+	}
+	if keys.Cert == nil {
+		return nil, newError("taorpc: no certificate for tls channel key: %s", keys.X509Path())
+	}
 
-	return &RPC{protorpc.NewClient(ms), "Tao"}, nil
+	return DialTLSRPC("tcp", addr, domain.Guard, domain.Keys.VerifyingKey, keys)
 }
 
 // NewRPC constructs a RPC for the default gob encoding rpc client using
 // an io.ReadWriteCloser.
 func NewRPC(rwc io.ReadWriteCloser, serviceName string) (*RPC, error) {
-	return &RPC{rpc.NewClient(rwc), serviceName}, nil
+	return &RPC{rpc: netRPCClient{rpc.NewClient(rwc)}, serviceName: serviceName}, nil
 }
 
+// SetTimeout bounds each call made by a Tao method without a context, e.g.
+// Seal, so that a hung host can't block the hosted program forever. Calls
+// that time out return context.DeadlineExceeded. A zero timeout, the
+// default, means calls wait for the host indefinitely. SetTimeout should be
+// called before the RPC is used.
+func (t *RPC) SetTimeout(timeout time.Duration) {
+	t.timeout = timeout
+}
+
+// context returns the context for a call made without one.
+func (t *RPC) context() (context.Context, context.CancelFunc) {
+	if t.timeout == 0 {
+		return context.Background(), func() {}
+	}
+	return context.WithTimeout(context.Background(), t.timeout)
+}
+
+// TaoRPCVersion is the version of the Tao RPC protocol spoken by RPC and
+// LinuxHostTaoServer. Version 1 is the protocol before hosts reported their
+// capabilities. Version 2 adds GetCapabilities. Version 3 adds a nonce to
+// Attest, see AttestNonce.
+const TaoRPCVersion = 3
+
+// ErrNoCapabilities is returned by GetCapabilities if the host doesn't report
+// its capabilities, e.g. because it only speaks version 1 of the protocol.
+var ErrNoCapabilities = errors.New("taorpc: host does not report its capabilities")
+
 type expectedResponse int
 
 const (
@@ -108,10 +245,34 @@ var ErrMalformedResponse = errors.New("taorpc: malformed response")
 
 // call issues an rpc request, obtains the response, checks the response for
 // errors, and checks that the response contains exactly the expected values.
-func (t *RPC) call(method string, r *RPCRequest, e expectedResponse) (data []byte, policy string,
+// If the host refuses the request, the error is an *RPCRefusedError.
+func (t *RPC) call(ctx context.Context, method string, r *RPCRequest, e expectedResponse) (data []byte, policy string,
 	counter int64, err error) {
 	s := new(RPCResponse)
-	err = t.rpc.Call(method, r, s)
+	t.m.Lock()
+	c := t.rpc
+	t.m.Unlock()
+	err = c.Call(ctx, method, r, s)
+	if err != nil && t.redial != nil && isConnectionLost(err) {
+		// The host may have done the work before the connection was lost, so
+		// only calls that are safe to repeat are retried. Other calls return
+		// the error, but later ones use the new connection.
+		lost := err
+		if c, err = t.reconnect(c); err != nil {
+			return
+		}
+		if !idempotentMethods[strings.TrimPrefix(method, t.serviceName+".")] {
+			err = lost
+			return
+		}
+		s = new(RPCResponse)
+		err = c.Call(ctx, method, r, s)
+	}
+	if se, ok := err.(rpc.ServerError); ok {
+		if refused := parseRPCRefusedError(string(se)); refused != nil {
+			err = refused
+		}
+	}
 	if err != nil {
 		return
 	}
@@ -132,10 +293,54 @@ func (t *RPC) call(method string, r *RPCRequest, e expectedResponse) (data []byt
 	return
 }
 
+// idempotentMethods are the Tao RPC methods that can be repeated without
+// changing the result, so a call to one of them is retried after reconnecting
+// to the host. Others, like Seal, Attest, ExtendTaoName and InitCounter, are
+// not retried.
+var idempotentMethods = map[string]bool{
+	"GetTaoName":              true,
+	"GetRandomBytes":          true,
+	"GetSharedSecret":         true,
+	"Unseal":                  true,
+	"GetCounter":              true,
+	"RollbackProtectedUnseal": true,
+	"GetCapabilities":         true,
+}
+
+// isConnectionLost checks whether an rpc error means the connection to the
+// host Tao was lost, rather than that the host returned an error.
+func isConnectionLost(err error) bool {
+	return err == rpc.ErrShutdown || err == io.EOF || err == io.ErrUnexpectedEOF
+}
+
+// reconnect replaces a lost connection to the host Tao with a new one, unless
+// another caller already did so.
+func (t *RPC) reconnect(old rpcClient) (rpcClient, error) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	if t.rpc != old {
+		return t.rpc, nil
+	}
+	c, err := t.redial()
+	if err != nil {
+		return nil, err
+	}
+	old.Close()
+	t.rpc = c
+	return c, nil
+}
+
 // GetTaoName implements part of the Tao interface.
 func (t *RPC) GetTaoName() (auth.Prin, error) {
+	ctx, cancel := t.context()
+	defer cancel()
+	return t.GetTaoNameContext(ctx)
+}
+
+// GetTaoNameContext is like GetTaoName, but gives up when ctx is done.
+func (t *RPC) GetTaoNameContext(ctx context.Context) (auth.Prin, error) {
 	r := &RPCRequest{}
-	data, _, _, err := t.call(t.serviceName+".GetTaoName", r, wantData)
+	data, _, _, err := t.call(ctx, t.serviceName+".GetTaoName", r, wantData)
 	if err != nil {
 		return auth.Prin{}, err
 	}
@@ -144,8 +349,15 @@ func (t *RPC) GetTaoName() (auth.Prin, error) {
 
 // ExtendTaoName implements part of the Tao interface.
 func (t *RPC) ExtendTaoName(subprin auth.SubPrin) error {
+	ctx, cancel := t.context()
+	defer cancel()
+	return t.ExtendTaoNameContext(ctx, subprin)
+}
+
+// ExtendTaoNameContext is like ExtendTaoName, but gives up when ctx is done.
+func (t *RPC) ExtendTaoNameContext(ctx context.Context, subprin auth.SubPrin) error {
 	r := &RPCRequest{Data: auth.Marshal(subprin)}
-	_, _, _, err := t.call(t.serviceName+".ExtendTaoName", r, wantNothing)
+	_, _, _, err := t.call(ctx, t.serviceName+".ExtendTaoName", r, wantNothing)
 	return err
 }
 
@@ -171,26 +383,60 @@ func (t *RPC) Rand() io.Reader {
 
 // GetRandomBytes implements part of the Tao interface.
 func (t *RPC) GetRandomBytes(n int) ([]byte, error) {
+	ctx, cancel := t.context()
+	defer cancel()
+	return t.GetRandomBytesContext(ctx, n)
+}
+
+// GetRandomBytesContext is like GetRandomBytes, but gives up when ctx is done.
+func (t *RPC) GetRandomBytesContext(ctx context.Context, n int) ([]byte, error) {
 	if n > math.MaxUint32 {
 		return nil, newError("taorpc: request for too many random bytes")
 	}
 	r := &RPCRequest{Size: proto.Int32(int32(n))}
-	bytes, _, _, err := t.call(t.serviceName+".GetRandomBytes", r, wantData)
+	bytes, _, _, err := t.call(ctx, t.serviceName+".GetRandomBytes", r, wantData)
 	return bytes, err
 }
 
 // GetSharedSecret implements part of the Tao interface.
 func (t *RPC) GetSharedSecret(n int, policy string) ([]byte, error) {
+	ctx, cancel := t.context()
+	defer cancel()
+	return t.GetSharedSecretContext(ctx, n, policy)
+}
+
+// GetSharedSecretContext is like GetSharedSecret, but gives up when ctx is
+// done.
+func (t *RPC) GetSharedSecretContext(ctx context.Context, n int, policy string) ([]byte, error) {
 	if n > math.MaxUint32 {
 		return nil, newError("taorpc: request for too many secret bytes")
 	}
 	r := &RPCRequest{Size: proto.Int32(int32(n)), Policy: proto.String(policy)}
-	bytes, _, _, err := t.call(t.serviceName+".GetSharedSecret", r, wantData)
+	bytes, _, _, err := t.call(ctx, t.serviceName+".GetSharedSecret", r, wantData)
 	return bytes, err
 }
 
 // Attest implements part of the Tao interface.
 func (t *RPC) Attest(issuer *auth.Prin, time, expiration *int64, message auth.Form) (*Attestation, error) {
+	ctx, cancel := t.context()
+	defer cancel()
+	return t.AttestContext(ctx, issuer, time, expiration, message)
+}
+
+// AttestContext is like Attest, but gives up when ctx is done.
+func (t *RPC) AttestContext(ctx context.Context, issuer *auth.Prin, time, expiration *int64, message auth.Form) (*Attestation, error) {
+	return t.AttestNonceContext(ctx, issuer, time, expiration, nil, message)
+}
+
+// AttestNonce implements part of the Tao interface.
+func (t *RPC) AttestNonce(issuer *auth.Prin, time, expiration *int64, nonce []byte, message auth.Form) (*Attestation, error) {
+	ctx, cancel := t.context()
+	defer cancel()
+	return t.AttestNonceContext(ctx, issuer, time, expiration, nonce, message)
+}
+
+// AttestNonceContext is like AttestNonce, but gives up when ctx is done.
+func (t *RPC) AttestNonceContext(ctx context.Context, issuer *auth.Prin, time, expiration *int64, nonce []byte, message auth.Form) (*Attestation, error) {
 	var issuerBytes []byte
 	if issuer != nil {
 		issuerBytes = auth.Marshal(*issuer)
@@ -201,52 +447,183 @@ func (t *RPC) Attest(issuer *auth.Prin, time, expiration *int64, message auth.Fo
 		Expiration: expiration,
 		Data:       auth.Marshal(message),
 	}
-	bytes, _, _, err := t.call(t.serviceName+".Attest", r, wantData)
+	if len(nonce) > 0 {
+		r.Nonce = nonce
+	}
+	data, _, _, err := t.call(ctx, t.serviceName+".Attest", r, wantData)
 	if err != nil {
 		return nil, err
 	}
 	var a Attestation
-	err = proto.Unmarshal(bytes, &a)
+	err = proto.Unmarshal(data, &a)
 	if err != nil {
 		return nil, err
 	}
+	// A host that predates nonces ignores the one in the request.
+	if !bytes.Equal(a.Nonce, r.Nonce) {
+		return nil, newError("taorpc: the host didn't bind the nonce into the attestation")
+	}
 	return &a, nil
 }
 
 // Seal implements part of the Tao interface.
 func (t *RPC) Seal(data []byte, policy string) (sealed []byte, err error) {
+	ctx, cancel := t.context()
+	defer cancel()
+	return t.SealContext(ctx, data, policy)
+}
+
+// SealContext is like Seal, but gives up when ctx is done.
+func (t *RPC) SealContext(ctx context.Context, data []byte, policy string) (sealed []byte, err error) {
 	r := &RPCRequest{Data: data, Policy: proto.String(policy)}
-	sealed, _, _, err = t.call(t.serviceName+".Seal", r, wantData)
+	sealed, _, _, err = t.call(ctx, t.serviceName+".Seal", r, wantData)
 	return
 }
 
 // Unseal implements part of the Tao interface.
 func (t *RPC) Unseal(sealed []byte) (data []byte, policy string, err error) {
+	ctx, cancel := t.context()
+	defer cancel()
+	return t.UnsealContext(ctx, sealed)
+}
+
+// UnsealContext is like Unseal, but gives up when ctx is done.
+func (t *RPC) UnsealContext(ctx context.Context, sealed []byte) (data []byte, policy string, err error) {
 	r := &RPCRequest{Data: sealed}
-	data, policy, _, err = t.call(t.serviceName+".Unseal", r, wantData|wantPolicy)
+	data, policy, _, err = t.call(ctx, t.serviceName+".Unseal", r, wantData|wantPolicy)
 	return
 }
 
 func (t *RPC) InitCounter(label string, c int64) (err error) {
+	ctx, cancel := t.context()
+	defer cancel()
+	return t.InitCounterContext(ctx, label, c)
+}
+
+// InitCounterContext is like InitCounter, but gives up when ctx is done.
+func (t *RPC) InitCounterContext(ctx context.Context, label string, c int64) (err error) {
 	r := &RPCRequest{Label: &label, Counter: &c}
-	_, _, _, err = t.call(t.serviceName+".InitCounter", r, wantNothing)
+	_, _, _, err = t.call(ctx, t.serviceName+".InitCounter", r, wantNothing)
 	return
 }
 
 func (t *RPC) GetCounter(label string) (c int64, err error) {
+	ctx, cancel := t.context()
+	defer cancel()
+	return t.GetCounterContext(ctx, label)
+}
+
+// GetCounterContext is like GetCounter, but gives up when ctx is done.
+func (t *RPC) GetCounterContext(ctx context.Context, label string) (c int64, err error) {
 	r := &RPCRequest{Label: &label}
-	_, _, c, err = t.call(t.serviceName+".GetCounter", r, wantCounter)
+	_, _, c, err = t.call(ctx, t.serviceName+".GetCounter", r, wantCounter)
 	return
 }
 
 func (t *RPC) RollbackProtectedSeal(label string, data []byte, policy string) (sealed []byte, err error) {
+	ctx, cancel := t.context()
+	defer cancel()
+	return t.RollbackProtectedSealContext(ctx, label, data, policy)
+}
+
+// RollbackProtectedSealContext is like RollbackProtectedSeal, but gives up
+// when ctx is done.
+func (t *RPC) RollbackProtectedSealContext(ctx context.Context, label string, data []byte, policy string) (sealed []byte, err error) {
 	r := &RPCRequest{Label: &label, Data: data, Policy: &policy}
-	sealed, _, _, err = t.call(t.serviceName+".RollbackProtectedSeal", r, wantData)
+	sealed, _, _, err = t.call(ctx, t.serviceName+".RollbackProtectedSeal", r, wantData)
 	return
 }
 
 func (t *RPC) RollbackProtectedUnseal(sealed []byte) (data []byte, policy string, err error) {
+	ctx, cancel := t.context()
+	defer cancel()
+	return t.RollbackProtectedUnsealContext(ctx, sealed)
+}
+
+// RollbackProtectedUnsealContext is like RollbackProtectedUnseal, but gives up
+// when ctx is done.
+func (t *RPC) RollbackProtectedUnsealContext(ctx context.Context, sealed []byte) (data []byte, policy string, err error) {
 	r := &RPCRequest{Data: sealed}
-	data, policy, _, err = t.call(t.serviceName+".RollbackProtectedUnseal", r, wantData|wantPolicy)
+	data, policy, _, err = t.call(ctx, t.serviceName+".RollbackProtectedUnseal", r, wantData|wantPolicy)
 	return
 }
+
+// GetCapabilities asks the host for its protocol version, the methods it
+// serves, the Seal and GetSharedSecret policies it accepts, and the kinds of
+// Tao it is built on. It returns ErrNoCapabilities if the host predates
+// capability discovery.
+func (t *RPC) GetCapabilities() (*RPCCapabilities, error) {
+	ctx, cancel := t.context()
+	defer cancel()
+	return t.GetCapabilitiesContext(ctx)
+}
+
+// GetCapabilitiesContext is like GetCapabilities, but gives up when ctx is
+// done.
+func (t *RPC) GetCapabilitiesContext(ctx context.Context) (*RPCCapabilities, error) {
+	r := &RPCRequest{Version: proto.Int32(TaoRPCVersion)}
+	bytes, _, _, err := t.call(ctx, t.serviceName+".GetCapabilities", r, wantData)
+	if se, ok := err.(rpc.ServerError); ok && strings.HasPrefix(string(se), "rpc: can't find method") {
+		return nil, ErrNoCapabilities
+	} else if err != nil {
+		return nil, err
+	}
+	var caps RPCCapabilities
+	if err := proto.Unmarshal(bytes, &caps); err != nil {
+		return nil, err
+	}
+	return &caps, nil
+}
+
+// HostCapabilities returns the capabilities of a host Tao, see
+// RPC.GetCapabilities. It returns ErrNoCapabilities if t is not a stub for a
+// host that reports its capabilities.
+func HostCapabilities(t Tao) (*RPCCapabilities, error) {
+	if r, ok := t.(*RPC); ok {
+		return r.GetCapabilities()
+	}
+	return nil, ErrNoCapabilities
+}
+
+// HasMethod checks whether the host serves a Tao RPC method, e.g. "Seal".
+func (c *RPCCapabilities) HasMethod(method string) bool {
+	return containsString(c.GetMethods(), method)
+}
+
+// HasSealPolicy checks whether the host accepts a policy for Seal.
+func (c *RPCCapabilities) HasSealPolicy(policy string) bool {
+	return containsString(c.GetSealPolicies(), policy)
+}
+
+// HasSharedSecretPolicy checks whether the host accepts a policy for
+// GetSharedSecret.
+func (c *RPCCapabilities) HasSharedSecretPolicy(policy string) bool {
+	return containsString(c.GetSharedSecretPolicies(), policy)
+}
+
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// taoTypes describes the kinds of Tao that t is built on, starting with t
+// itself, for RPCCapabilities.HostTypes.
+func taoTypes(t Tao) []string {
+	switch t := t.(type) {
+	case *TPMTao:
+		return []string{"TPM"}
+	case *TPM2Tao:
+		return []string{"TPM2"}
+	case *SoftTao:
+		return []string{"Soft"}
+	case *RPC:
+		if caps, err := t.GetCapabilities(); err == nil {
+			return caps.HostTypes
+		}
+	}
+	return []string{"Unknown"}
+}
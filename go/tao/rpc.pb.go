@@ -11,6 +11,7 @@ It is generated from these files:
 It has these top-level messages:
 	RPCRequest
 	RPCResponse
+	RPCCapabilities
 */
 package tao
 
@@ -24,15 +25,19 @@ var _ = fmt.Errorf
 var _ = math.Inf
 
 type RPCRequest struct {
-	Data             []byte  `protobuf:"bytes,1,opt,name=data" json:"data,omitempty"`
-	Size             *int32  `protobuf:"varint,2,opt,name=size" json:"size,omitempty"`
-	Policy           *string `protobuf:"bytes,3,opt,name=policy" json:"policy,omitempty"`
-	Time             *int64  `protobuf:"varint,4,opt,name=time" json:"time,omitempty"`
-	Expiration       *int64  `protobuf:"varint,5,opt,name=expiration" json:"expiration,omitempty"`
-	Issuer           []byte  `protobuf:"bytes,6,opt,name=issuer" json:"issuer,omitempty"`
-	Label            *string `protobuf:"bytes,7,opt,name=label" json:"label,omitempty"`
-	Counter          *int64  `protobuf:"varint,8,opt,name=counter" json:"counter,omitempty"`
-	XXX_unrecognized []byte  `json:"-"`
+	Data       []byte  `protobuf:"bytes,1,opt,name=data" json:"data,omitempty"`
+	Size       *int32  `protobuf:"varint,2,opt,name=size" json:"size,omitempty"`
+	Policy     *string `protobuf:"bytes,3,opt,name=policy" json:"policy,omitempty"`
+	Time       *int64  `protobuf:"varint,4,opt,name=time" json:"time,omitempty"`
+	Expiration *int64  `protobuf:"varint,5,opt,name=expiration" json:"expiration,omitempty"`
+	Issuer     []byte  `protobuf:"bytes,6,opt,name=issuer" json:"issuer,omitempty"`
+	Label      *string `protobuf:"bytes,7,opt,name=label" json:"label,omitempty"`
+	Counter    *int64  `protobuf:"varint,8,opt,name=counter" json:"counter,omitempty"`
+	// The Tao RPC protocol version of the caller, sent with GetCapabilities.
+	Version *int32 `protobuf:"varint,9,opt,name=version" json:"version,omitempty"`
+	// A nonce chosen by a verifier, sent with Attest, see Tao.AttestNonce.
+	Nonce            []byte `protobuf:"bytes,10,opt,name=nonce" json:"nonce,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
 }
 
 func (m *RPCRequest) Reset()                    { *m = RPCRequest{} }
@@ -96,6 +101,20 @@ func (m *RPCRequest) GetCounter() int64 {
 	return 0
 }
 
+func (m *RPCRequest) GetVersion() int32 {
+	if m != nil && m.Version != nil {
+		return *m.Version
+	}
+	return 0
+}
+
+func (m *RPCRequest) GetNonce() []byte {
+	if m != nil {
+		return m.Nonce
+	}
+	return nil
+}
+
 type RPCResponse struct {
 	Data             []byte  `protobuf:"bytes,1,opt,name=data" json:"data,omitempty"`
 	Policy           *string `protobuf:"bytes,2,opt,name=policy" json:"policy,omitempty"`
@@ -129,25 +148,87 @@ func (m *RPCResponse) GetCounter() int64 {
 	return 0
 }
 
+// The capabilities of a host Tao, returned marshalled in RPCResponse.data by
+// Tao.GetCapabilities.
+type RPCCapabilities struct {
+	// The Tao RPC protocol version of the host, see TaoRPCVersion.
+	Version *int32 `protobuf:"varint,1,opt,name=version" json:"version,omitempty"`
+	// The Tao RPC methods the host serves, e.g. "Seal".
+	Methods []string `protobuf:"bytes,2,rep,name=methods" json:"methods,omitempty"`
+	// The policies the host accepts for Seal and GetSharedSecret.
+	SealPolicies         []string `protobuf:"bytes,3,rep,name=seal_policies" json:"seal_policies,omitempty"`
+	SharedSecretPolicies []string `protobuf:"bytes,4,rep,name=shared_secret_policies" json:"shared_secret_policies,omitempty"`
+	// The kinds of Tao the host is built on, starting with the host itself,
+	// e.g. ["LinuxHost", "TPM2"] or ["LinuxHost", "LinuxHost", "Soft"].
+	HostTypes        []string `protobuf:"bytes,5,rep,name=host_types" json:"host_types,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *RPCCapabilities) Reset()                    { *m = RPCCapabilities{} }
+func (m *RPCCapabilities) String() string            { return proto.CompactTextString(m) }
+func (*RPCCapabilities) ProtoMessage()               {}
+func (*RPCCapabilities) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
+func (m *RPCCapabilities) GetVersion() int32 {
+	if m != nil && m.Version != nil {
+		return *m.Version
+	}
+	return 0
+}
+
+func (m *RPCCapabilities) GetMethods() []string {
+	if m != nil {
+		return m.Methods
+	}
+	return nil
+}
+
+func (m *RPCCapabilities) GetSealPolicies() []string {
+	if m != nil {
+		return m.SealPolicies
+	}
+	return nil
+}
+
+func (m *RPCCapabilities) GetSharedSecretPolicies() []string {
+	if m != nil {
+		return m.SharedSecretPolicies
+	}
+	return nil
+}
+
+func (m *RPCCapabilities) GetHostTypes() []string {
+	if m != nil {
+		return m.HostTypes
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*RPCRequest)(nil), "tao.RPCRequest")
 	proto.RegisterType((*RPCResponse)(nil), "tao.RPCResponse")
+	proto.RegisterType((*RPCCapabilities)(nil), "tao.RPCCapabilities")
 }
 
 /*
 var fileDescriptor0 = []byte{
-	// 180 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x5c, 0x8e, 0x3d, 0x8e, 0xc2, 0x30,
-	0x10, 0x85, 0x95, 0x38, 0x3f, 0x9b, 0xd9, 0xec, 0xae, 0xe4, 0x6a, 0xca, 0x55, 0x2a, 0x2a, 0x4e,
-	0x40, 0xc7, 0x05, 0x50, 0x6e, 0x60, 0xc2, 0x14, 0x96, 0x42, 0xc6, 0xd8, 0x13, 0x09, 0x38, 0x02,
-	0xa7, 0xc6, 0x76, 0x83, 0x94, 0xf2, 0xf3, 0xf3, 0x7b, 0xf3, 0x41, 0xe7, 0xdd, 0xb4, 0x77, 0x9e,
-	0x85, 0xb5, 0x12, 0xc3, 0xc3, 0xab, 0x00, 0x18, 0x4f, 0xc7, 0x91, 0x6e, 0x2b, 0x05, 0xd1, 0x3d,
-	0x54, 0x17, 0x23, 0x06, 0x8b, 0xff, 0x62, 0xd7, 0x27, 0x0a, 0xf6, 0x49, 0x58, 0x46, 0xaa, 0xf5,
-	0x2f, 0x34, 0x8e, 0x67, 0x3b, 0x3d, 0x50, 0x45, 0xee, 0x52, 0x2a, 0xf6, 0x4a, 0x58, 0x45, 0x52,
-	0x5a, 0x03, 0xd0, 0xdd, 0x59, 0x6f, 0xc4, 0xf2, 0x82, 0x75, 0x7e, 0x8b, 0x0d, 0x1b, 0xc2, 0x4a,
-	0x1e, 0x9b, 0xbc, 0xf7, 0x03, 0xf5, 0x6c, 0xce, 0x34, 0x63, 0x9b, 0x07, 0xfe, 0xa0, 0x9d, 0x78,
-	0x5d, 0x24, 0xe6, 0x5f, 0xe9, 0xff, 0x70, 0x80, 0xef, 0xec, 0x12, 0x1c, 0x2f, 0x81, 0x36, 0x32,
-	0x9f, 0xf3, 0xe5, 0xb6, 0x9d, 0x7c, 0xd4, 0x3b, 0x00, 0x00, 0xff, 0xff, 0x05, 0x51, 0xc8, 0x46,
-	0xdb, 0x00, 0x00, 0x00,
+	// 269 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x5c, 0x8e, 0x41, 0x6a, 0xf3, 0x30,
+	0x10, 0x85, 0x51, 0x14, 0xc7, 0xbf, 0xe7, 0x4f, 0x62, 0x10, 0xb4, 0xcc, 0xaa, 0x98, 0xac, 0xbc,
+	0xea, 0x09, 0xba, 0xcb, 0x05, 0x42, 0x2e, 0x60, 0x14, 0x7b, 0xc0, 0x02, 0xc7, 0x52, 0x35, 0xe3,
+	0xd2, 0x74, 0xd1, 0x03, 0xf5, 0x94, 0x45, 0xda, 0xa4, 0x64, 0xa9, 0xf7, 0x34, 0xdf, 0xfb, 0xa0,
+	0x8a, 0xa1, 0x7f, 0x0d, 0xd1, 0x8b, 0x37, 0x5a, 0xac, 0x3f, 0xfc, 0x28, 0x80, 0xf3, 0xe9, 0x78,
+	0xa6, 0xf7, 0x85, 0x58, 0xcc, 0x16, 0xd6, 0x83, 0x15, 0x8b, 0xaa, 0x51, 0xed, 0x36, 0xbd, 0xd8,
+	0x7d, 0x11, 0xae, 0x1a, 0xd5, 0x16, 0x66, 0x0f, 0x9b, 0xe0, 0x27, 0xd7, 0xdf, 0x50, 0x37, 0xaa,
+	0xad, 0x52, 0x2b, 0xee, 0x4a, 0xb8, 0x6e, 0x54, 0xab, 0x8d, 0x01, 0xa0, 0xcf, 0xe0, 0xa2, 0x15,
+	0xe7, 0x67, 0x2c, 0x72, 0xb6, 0x87, 0x8d, 0x63, 0x5e, 0x28, 0xe2, 0x26, 0xf3, 0x76, 0x50, 0x4c,
+	0xf6, 0x42, 0x13, 0x96, 0x19, 0x50, 0x43, 0xd9, 0xfb, 0x65, 0x16, 0x8a, 0xf8, 0x2f, 0xff, 0xaf,
+	0xa1, 0xfc, 0xa0, 0xc8, 0x09, 0x50, 0xe5, 0xc9, 0x1d, 0x14, 0xb3, 0x9f, 0x7b, 0x42, 0x48, 0xf7,
+	0x87, 0x37, 0xf8, 0x9f, 0x5d, 0x39, 0xf8, 0x99, 0xe9, 0x41, 0xf6, 0xae, 0xb7, 0x7a, 0xa4, 0x27,
+	0x5f, 0x7d, 0xf8, 0x86, 0xfa, 0x7c, 0x3a, 0x1e, 0x6d, 0xb0, 0x17, 0x37, 0x39, 0x71, 0xc4, 0x7f,
+	0x07, 0x55, 0x1e, 0xac, 0xa1, 0xbc, 0x92, 0x8c, 0x7e, 0x60, 0x5c, 0x35, 0xba, 0xad, 0xcc, 0x13,
+	0xec, 0x98, 0xec, 0xd4, 0x65, 0xb4, 0x23, 0x46, 0x9d, 0xe3, 0x17, 0x78, 0xe6, 0xd1, 0x46, 0x1a,
+	0x3a, 0xa6, 0x3e, 0x92, 0xdc, 0xfb, 0x75, 0xee, 0x0d, 0xc0, 0xe8, 0x59, 0x3a, 0xb9, 0x05, 0x62,
+	0x2c, 0x52, 0xf6, 0x3b, 0x00, 0x22, 0xab, 0x76, 0xe8, 0x7b, 0x01, 0x00, 0x00,
 }
 */
@@ -127,6 +127,11 @@ func (s *SoftTao) Unseal(sealed []byte) (data []byte, policy string, err error)
 
 // Attest requests that the Tao host sign a statement on behalf of the caller.
 func (s *SoftTao) Attest(issuer *auth.Prin, time, expiration *int64, message auth.Form) (*Attestation, error) {
+	return s.AttestNonce(issuer, time, expiration, nil, message)
+}
+
+// AttestNonce is like Attest, but binds a nonce into the attestation.
+func (s *SoftTao) AttestNonce(issuer *auth.Prin, time, expiration *int64, nonce []byte, message auth.Form) (*Attestation, error) {
 	child := s.name.MakeSubprincipal(s.nameExtension)
 	if issuer == nil {
 		issuer = &child
@@ -145,7 +150,7 @@ func (s *SoftTao) Attest(issuer *auth.Prin, time, expiration *int64, message aut
 		}
 	}
 
-	return GenerateAttestation(s.keys.SigningKey, delegation, stmt)
+	return GenerateNonceAttestation(s.keys.SigningKey, delegation, nonce, stmt)
 }
 
 var softtao_counter int64
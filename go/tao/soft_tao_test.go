@@ -118,3 +118,51 @@ func TestSoftTaoAttest(t *testing.T) {
 		t.Fatalf("The attestation produced by the SoftTao didn't pass validation: %s", err)
 	}
 }
+
+func TestSoftTaoAttestNonce(t *testing.T) {
+	ft, err := NewSoftTao("", nil)
+	if err != nil {
+		t.Fatal("Couldn't initialize a SoftTao in memory:", err)
+	}
+
+	self, err := ft.GetTaoName()
+	if err != nil {
+		t.Fatal("Couldn't get own name:", err)
+	}
+
+	stmt := auth.Speaksfor{
+		Delegate:  auth.NewKeyPrin([]byte("BogusKeyBytes1")),
+		Delegator: self,
+	}
+
+	nonce, err := NewNonce()
+	if err != nil {
+		t.Fatal("Couldn't make a nonce:", err)
+	}
+	a, err := ft.AttestNonce(nil, nil, nil, nonce, stmt)
+	if err != nil {
+		t.Fatal("Couldn't attest to a statement in the SoftTao:", err)
+	}
+	if _, err := a.ValidateNonce(nonce); err != nil {
+		t.Fatalf("The attestation produced by the SoftTao didn't pass validation: %s", err)
+	}
+
+	other, err := NewNonce()
+	if err != nil {
+		t.Fatal("Couldn't make a nonce:", err)
+	}
+	if _, err := a.ValidateNonce(other); err == nil {
+		t.Fatal("The attestation passed validation with the wrong nonce")
+	}
+
+	// The nonce is bound into the signature, so it can't be replaced or
+	// removed.
+	a.Nonce = other
+	if _, err := a.ValidateNonce(other); err == nil {
+		t.Fatal("An attestation with a replaced nonce passed validation")
+	}
+	a.Nonce = nil
+	if _, err := a.Validate(); err == nil {
+		t.Fatal("An attestation with its nonce removed passed validation")
+	}
+}
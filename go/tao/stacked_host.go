@@ -79,6 +79,12 @@ func (t *StackedHost) GetSharedSecret(tag string, n int) (bytes []byte, err erro
 // Attest requests the Tao host sign a statement on behalf of the caller.
 func (t *StackedHost) Attest(childSubprin auth.SubPrin, issuer *auth.Prin,
 	time, expiration *int64, message auth.Form) (*Attestation, error) {
+	return t.AttestNonce(childSubprin, issuer, time, expiration, nil, message)
+}
+
+// AttestNonce is like Attest, but binds a nonce into the attestation.
+func (t *StackedHost) AttestNonce(childSubprin auth.SubPrin, issuer *auth.Prin,
+	time, expiration *int64, nonce []byte, message auth.Form) (*Attestation, error) {
 
 	child := t.taoHostName.MakeSubprincipal(childSubprin)
 	if issuer != nil {
@@ -90,7 +96,7 @@ func (t *StackedHost) Attest(childSubprin auth.SubPrin, issuer *auth.Prin,
 	}
 
 	if t.keys == nil || t.keys.SigningKey == nil {
-		return t.hostTao.Attest(issuer, time, expiration, message)
+		return t.hostTao.AttestNonce(issuer, time, expiration, nonce, message)
 	}
 
 	stmt := auth.Says{Speaker: *issuer, Time: time, Expiration: expiration, Message: message}
@@ -104,7 +110,7 @@ func (t *StackedHost) Attest(childSubprin auth.SubPrin, issuer *auth.Prin,
 		}
 	}
 
-	return GenerateAttestation(t.keys.SigningKey, d, stmt)
+	return GenerateNonceAttestation(t.keys.SigningKey, d, nonce, stmt)
 }
 
 // Encrypt data so that only this host can access it.
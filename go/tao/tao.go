@@ -39,6 +39,9 @@ const (
 	TaoTPMAIKEnvVar    = "CLOUDPROXY_TAO_TPM_AIK"
 	TaoTPMDeviceEnvVar = "CLOUDPROXY_TAO_TPM_DEVICE"
 
+	TaoTLSKeysEnvVar      = "CLOUDPROXY_TAO_TLS_KEYS"
+	TaoDomainConfigEnvVar = "CLOUDPROXY_TAO_DOMAIN_CONFIG"
+
 	SharedSecretPolicyDefault      = "self"
 	SharedSecretPolicyConservative = "few"
 	SharedSecretPolicyLiberal      = "any"
@@ -47,7 +50,8 @@ const (
 	SealPolicyConservative = "few"
 	SealPolicyLiberal      = "any"
 
-	AttestationSigningContext = "Tao Attestation Signing Context V1"
+	AttestationSigningContext      = "Tao Attestation Signing Context V1"
+	AttestationNonceSigningContext = "Tao Attestation Nonce Signing Context V1"
 )
 
 // Tao is the fundamental Trustworthy Computing interface provided by a host to
@@ -81,6 +85,11 @@ type Tao interface {
 	// bogus Speaker field like key([]) or nil([]) or self, etc.
 	Attest(issuer *auth.Prin, time, expiration *int64, message auth.Form) (*Attestation, error)
 
+	// AttestNonce is like Attest, but binds a nonce chosen by a verifier into
+	// the attestation, so the verifier can check that it is fresh, see
+	// Attestation.ValidateNonce.
+	AttestNonce(issuer *auth.Prin, time, expiration *int64, nonce []byte, message auth.Form) (*Attestation, error)
+
 	// Seal encrypts data so only certain hosted programs can unseal it.
 	Seal(data []byte, policy string) (sealed []byte, err error)
 
@@ -228,6 +237,13 @@ func ParentFromConfig(tc Config) Tao {
 				return
 			}
 			cachedHost = host
+		case "tls":
+			host, err := DeserializeTLSRPC(tcEnv.HostSpec, tcEnv.TLSKeysPath, tcEnv.DomainConfigPath)
+			if err != nil {
+				glog.Error(err)
+				return
+			}
+			cachedHost = host
 		default:
 			// Look in the registry to see if there is a function
 			// that can produce a Tao instance for this host spec
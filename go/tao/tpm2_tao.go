@@ -513,6 +513,13 @@ func getQuoteCert(rw io.ReadWriteCloser, filePath string, quoteHandle tpm2.Handl
 // optional issuer, time and expiration will be given default values if nil.
 func (tt *TPM2Tao) Attest(issuer *auth.Prin, start, expiration *int64,
 	message auth.Form) (*Attestation, error) {
+	return tt.AttestNonce(issuer, start, expiration, nil, message)
+}
+
+// AttestNonce is like Attest, but binds a nonce into the attestation. The
+// qualifying data of the quote is a hash of the statement and the nonce.
+func (tt *TPM2Tao) AttestNonce(issuer *auth.Prin, start, expiration *int64,
+	nonce []byte, message auth.Form) (*Attestation, error) {
 	fmt.Fprintf(os.Stderr, "About to load the quote key in attest\n")
 	qh, err := tt.loadQuoteContext()
 	if err != nil {
@@ -555,7 +562,7 @@ func (tt *TPM2Tao) Attest(issuer *auth.Prin, start, expiration *int64,
 	ser := auth.Marshal(stmt)
 
 	var pcrVals [][]byte
-	toQuote, err := tpm2.FormatTpm2Quote(ser, tt.pcrs, pcrVals)
+	toQuote, err := tpm2.FormatTpm2Quote(nonceBoundData(ser, nonce), tt.pcrs, pcrVals)
 	if err != nil {
 		return nil, errors.New("Can't format tpm2 Quote")
 	}
@@ -582,6 +589,9 @@ func (tt *TPM2Tao) Attest(issuer *auth.Prin, start, expiration *int64,
 		Tpm2QuoteStructure:  quote_struct,
 		RootEndorsement:     tt.quoteCert,
 	}
+	if len(nonce) > 0 {
+		a.Nonce = nonce
+	}
 
 	return a, nil
 }
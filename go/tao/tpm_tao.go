@@ -169,6 +169,13 @@ func (tt *TPMTao) GetSharedSecret(n int, policy string) (bytes []byte, err error
 // Attest requests the Tao host sign a statement on behalf of the caller. The
 // optional issuer, time and expiration will be given default values if nil.
 func (tt *TPMTao) Attest(issuer *auth.Prin, start, expiration *int64, message auth.Form) (*Attestation, error) {
+	return tt.AttestNonce(issuer, start, expiration, nil, message)
+}
+
+// AttestNonce is like Attest, but binds a nonce into the attestation. The TPM
+// quotes a hash of the statement and the nonce, so the nonce is bound into the
+// external data of the quote.
+func (tt *TPMTao) AttestNonce(issuer *auth.Prin, start, expiration *int64, nonce []byte, message auth.Form) (*Attestation, error) {
 	if issuer == nil {
 		issuer = &tt.name
 	} else if !auth.SubprinOrIdentical(*issuer, tt.name) {
@@ -204,7 +211,7 @@ func (tt *TPMTao) Attest(issuer *auth.Prin, start, expiration *int64, message au
 	ser := auth.Marshal(stmt)
 	// TODO(tmroeder): check the pcrVals for sanity once we support extending or
 	// clearing the PCRs.
-	sig, _, err := tpm.Quote(tt.tpmfile, tt.aikHandle, ser, tt.pcrNums, tt.srkAuth[:])
+	sig, _, err := tpm.Quote(tt.tpmfile, tt.aikHandle, nonceBoundData(ser, nonce), tt.pcrNums, tt.srkAuth[:])
 	if err != nil {
 		return nil, err
 	}
@@ -220,6 +227,9 @@ func (tt *TPMTao) Attest(issuer *auth.Prin, start, expiration *int64, message au
 		SignerKey:           aik,
 		RootEndorsement:     tt.aikCert,
 	}
+	if len(nonce) > 0 {
+		a.Nonce = nonce
+	}
 	return a, nil
 }
 
@@ -0,0 +1,180 @@
+// Copyright (c) 2016, Google Inc.  All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package protorpc
+
+import (
+	"context"
+	"io"
+	"net/rpc"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/jlmucb/cloudproxy/go/util"
+)
+
+// Client is a protobuf rpc client whose calls take a context. Like
+// rpc.Client, it allows many requests to be in flight over one connection at
+// once. Unlike rpc.Client, a call returns as soon as its context is done, and
+// the server is then told to discard the response. net/rpc methods can't be
+// interrupted, so the server still finishes the work of the request.
+type Client struct {
+	codec *clientCodec
+
+	// m protects the fields below.
+	m       sync.Mutex
+	seq     uint64
+	pending map[uint64]*pendingCall
+	err     error // set once the connection fails or is closed
+	closing bool
+}
+
+type pendingCall struct {
+	reply interface{}
+	done  chan error
+}
+
+// NewContextClient returns a new Client to handle requests to the set of
+// services at the other end of the connection.
+func NewContextClient(conn io.ReadWriteCloser) *Client {
+	c := &Client{
+		codec:   NewClientCodec(conn).(*clientCodec),
+		pending: make(map[uint64]*pendingCall),
+	}
+	go c.read()
+	return c
+}
+
+// Call invokes the named function, waits for it to complete or for ctx to be
+// done, and returns its error status. Errors returned by the server have type
+// rpc.ServerError. If the connection is lost, Call returns rpc.ErrShutdown or
+// io.ErrUnexpectedEOF, as rpc.Client does.
+func (c *Client) Call(ctx context.Context, serviceMethod string, args interface{}, reply interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	call := &pendingCall{reply: reply, done: make(chan error, 1)}
+	c.m.Lock()
+	if c.err != nil {
+		err := c.err
+		c.m.Unlock()
+		return err
+	}
+	c.seq++
+	seq := c.seq
+	c.pending[seq] = call
+	c.m.Unlock()
+
+	if err := c.codec.WriteRequest(&rpc.Request{ServiceMethod: serviceMethod, Seq: seq}, args); err != nil {
+		c.m.Lock()
+		delete(c.pending, seq)
+		c.m.Unlock()
+		return err
+	}
+
+	select {
+	case err := <-call.done:
+		return err
+	case <-ctx.Done():
+		c.m.Lock()
+		_, ok := c.pending[seq]
+		delete(c.pending, seq)
+		c.m.Unlock()
+		if !ok {
+			// The response is already being read into reply.
+			return <-call.done
+		}
+		c.codec.writeCancel(seq)
+		return ctx.Err()
+	}
+}
+
+// read reads responses and hands them to the waiting calls until the
+// connection fails or is closed.
+func (c *Client) read() {
+	var err error
+	for err == nil {
+		var r rpc.Response
+		if err = c.codec.ReadResponseHeader(&r); err != nil {
+			break
+		}
+		c.m.Lock()
+		call := c.pending[r.Seq]
+		delete(c.pending, r.Seq)
+		c.m.Unlock()
+		switch {
+		case call == nil:
+			// The call was cancelled, but the server answered first.
+			err = c.codec.ReadResponseBody(nil)
+		case r.Error != "":
+			err = c.codec.ReadResponseBody(nil)
+			call.done <- rpc.ServerError(r.Error)
+		default:
+			err = c.codec.ReadResponseBody(call.reply)
+			call.done <- err
+			if err == ErrBadResponseType {
+				// The body was discarded, so the connection is still usable.
+				err = nil
+			}
+		}
+	}
+
+	c.m.Lock()
+	if c.closing {
+		err = rpc.ErrShutdown
+	} else if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	for seq, call := range c.pending {
+		delete(c.pending, seq)
+		call.done <- err
+	}
+	c.err = rpc.ErrShutdown
+	c.m.Unlock()
+}
+
+// Close closes the connection. Pending calls fail with rpc.ErrShutdown.
+func (c *Client) Close() error {
+	c.m.Lock()
+	if c.closing {
+		c.m.Unlock()
+		return rpc.ErrShutdown
+	}
+	c.closing = true
+	c.m.Unlock()
+	return c.codec.Close()
+}
+
+// cancelOp is the op of a request that cancels another one. It isn't of the
+// form Service.Method, so a server whose codec predates the cancel field
+// rejects the request with an error, which the client discards, rather than
+// running the cancelled method again with an empty body.
+const cancelOp = "Cancel"
+
+// writeCancel asks the server to cancel the request with the given sequence
+// number.
+func (c *clientCodec) writeCancel(seq uint64) error {
+	hdr := ProtoRPCRequestHeader{
+		Op:     proto.String(cancelOp),
+		Seq:    proto.Uint64(seq),
+		Cancel: proto.Bool(true),
+	}
+	c.sending.Lock()
+	_, err := c.m.WriteMessage(&hdr)
+	if err == nil {
+		_, err = c.m.WriteString("") // empty body
+	}
+	c.sending.Unlock()
+	return util.Logged(err)
+}
@@ -131,6 +131,11 @@ func (c *clientCodec) Close() error {
 type serverCodec struct {
 	m       *util.MessageStream
 	sending sync.Mutex
+
+	// pending holds the sequence numbers of requests awaiting a response,
+	// mapped to whether the client cancelled them.
+	pm      sync.Mutex
+	pending map[uint64]bool
 }
 
 // NewServerCodec returns a new rpc.ServerCodec using protobuf messages on conn.
@@ -140,23 +145,39 @@ func NewServerCodec(conn io.ReadWriteCloser) rpc.ServerCodec {
 		// The given conn lacks framing, so add some.
 		m = util.NewMessageStream(conn)
 	}
-	return &serverCodec{m, sync.Mutex{}}
+	return &serverCodec{m: m, pending: make(map[uint64]bool)}
 }
 
 // ReadRequestHeader receives and decodes a net/rpc request header r.
 func (c *serverCodec) ReadRequestHeader(r *rpc.Request) error {
 	// This is almost identical to ReadResponseHeader(), above.
-	var err error
-	var hdr ProtoRPCRequestHeader
-	if err = c.m.ReadMessage(&hdr); err != nil {
-		// Don't log an error here, since this is where normal EOF
-		// happens over net/rpc channels, e.g., if a client finishes and
-		// disconnects.
-		return err
+	for {
+		var hdr ProtoRPCRequestHeader
+		if err := c.m.ReadMessage(&hdr); err != nil {
+			// Don't log an error here, since this is where normal EOF
+			// happens over net/rpc channels, e.g., if a client finishes and
+			// disconnects.
+			return err
+		}
+		if !hdr.GetCancel() {
+			c.pm.Lock()
+			c.pending[*hdr.Seq] = false
+			c.pm.Unlock()
+			r.Seq = *hdr.Seq
+			r.ServiceMethod = *hdr.Op
+			return nil
+		}
+		// net/rpc can't interrupt a running method, but the response is
+		// dropped, since the client is no longer waiting for it.
+		if _, err := c.m.ReadString(); err != nil {
+			return util.Logged(err)
+		}
+		c.pm.Lock()
+		if _, ok := c.pending[*hdr.Seq]; ok {
+			c.pending[*hdr.Seq] = true
+		}
+		c.pm.Unlock()
 	}
-	r.Seq = *hdr.Seq
-	r.ServiceMethod = *hdr.Op
-	return nil
 }
 
 // ReadRequestBody receives and decodes a net/rpc request body x.
@@ -182,6 +203,14 @@ func (c *serverCodec) ReadRequestBody(x interface{}) error {
 // WriteResponse encodes and sends a net/rpc response header r with body x.
 func (c *serverCodec) WriteResponse(r *rpc.Response, x interface{}) error {
 	// This is similar to WriteRequest(), above.
+	c.pm.Lock()
+	cancelled := c.pending[r.Seq]
+	delete(c.pending, r.Seq)
+	c.pm.Unlock()
+	if cancelled {
+		return nil
+	}
+
 	var encodeErr error
 	var hdr ProtoRPCResponseHeader
 	hdr.Op = proto.String(r.ServiceMethod)
@@ -26,8 +26,14 @@ type ProtoRPCRequestHeader struct {
 	// The service method.
 	Op *string `protobuf:"bytes,1,req,name=op" json:"op,omitempty"`
 	// The sequence number.
-	Seq              *uint64 `protobuf:"varint,2,req,name=seq" json:"seq,omitempty"`
-	XXX_unrecognized []byte  `json:"-"`
+	Seq *uint64 `protobuf:"varint,2,req,name=seq" json:"seq,omitempty"`
+	// If true, this cancels the pending request with this sequence number: the
+	// server sends no response to it. The server may still carry out the
+	// request, since a running method can't be interrupted.
+	// A cancel has the op "Cancel", which isn't a Service.Method, so a server
+	// that predates this field rejects it instead of running a method again.
+	Cancel           *bool  `protobuf:"varint,3,opt,name=cancel" json:"cancel,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
 }
 
 func (m *ProtoRPCRequestHeader) Reset()         { *m = ProtoRPCRequestHeader{} }
@@ -48,6 +54,13 @@ func (m *ProtoRPCRequestHeader) GetSeq() uint64 {
 	return 0
 }
 
+func (m *ProtoRPCRequestHeader) GetCancel() bool {
+	if m != nil && m.Cancel != nil {
+		return *m.Cancel
+	}
+	return false
+}
+
 // Protobuf RPC response header.
 type ProtoRPCResponseHeader struct {
 	// The service method (matches request op).
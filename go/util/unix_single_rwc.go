@@ -24,8 +24,9 @@ import (
 // A UnixSingleReadWriteCloser accepts a single connection and reads and writes
 // to this connection
 type UnixSingleReadWriteCloser struct {
-	l net.Listener
-	c net.Conn
+	l     net.Listener
+	c     net.Conn
+	check func(net.Conn) error
 }
 
 // NewUnixSingleReadWriteCloser listens on a given Unix socket path and returns
@@ -38,16 +39,45 @@ func NewUnixSingleReadWriteCloser(path string) io.ReadWriteCloser {
 		return nil
 	}
 
-	return &UnixSingleReadWriteCloser{l, nil}
+	return &UnixSingleReadWriteCloser{l, nil, nil}
+}
+
+// NewCheckedUnixSingleReadWriteCloser is like NewUnixSingleReadWriteCloser,
+// but it closes any connection for which check returns an error, e.g. one from
+// an unexpected peer, and waits for another.
+func NewCheckedUnixSingleReadWriteCloser(path string, check func(net.Conn) error) io.ReadWriteCloser {
+	rwc := NewUnixSingleReadWriteCloser(path)
+	if rwc == nil {
+		return nil
+	}
+	rwc.(*UnixSingleReadWriteCloser).check = check
+	return rwc
+}
+
+// accept accepts a connection that passes the check, if any.
+func (usrwc *UnixSingleReadWriteCloser) accept() error {
+	for {
+		c, err := usrwc.l.Accept()
+		if err != nil {
+			return err
+		}
+		if usrwc.check != nil {
+			if err := usrwc.check(c); err != nil {
+				fmt.Fprintf(os.Stderr, "Rejected connection on the channel: %s\n", err)
+				c.Close()
+				continue
+			}
+		}
+		usrwc.c = c
+		return nil
+	}
 }
 
 // Read accepts a connection if there isn't one already and reads from the
 // connection.
 func (usrwc *UnixSingleReadWriteCloser) Read(p []byte) (int, error) {
-	var err error
 	if usrwc.c == nil {
-		usrwc.c, err = usrwc.l.Accept()
-		if err != nil {
+		if err := usrwc.accept(); err != nil {
 			return 0, err
 		}
 	}
@@ -58,10 +88,8 @@ func (usrwc *UnixSingleReadWriteCloser) Read(p []byte) (int, error) {
 // Write accepts a connection if there isn't one already and writes to the
 // connection.
 func (usrwc *UnixSingleReadWriteCloser) Write(p []byte) (int, error) {
-	var err error
 	if usrwc.c == nil {
-		usrwc.c, err = usrwc.l.Accept()
-		if err != nil {
+		if err := usrwc.accept(); err != nil {
 			return 0, err
 		}
 	}